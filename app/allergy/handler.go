@@ -0,0 +1,181 @@
+package allergy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the allergy endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+var (
+	categories    = []string{models.AllergyDrug, models.AllergyFood, models.AllergyEnvironment}
+	severities    = []string{models.SeverityMild, models.SeverityModerate, models.SeveritySevere, models.SeverityLifeThreatening}
+	verifications = []string{models.VerificationUnconfirmed, models.VerificationConfirmed, models.VerificationRefuted, models.VerificationEnteredInError}
+	sources       = []string{models.SourcePatient, models.SourceRelative, models.SourceClinician, models.SourceRecord}
+)
+
+// Active is a preload scope returning the allergies clinicians must see:
+// refuted and erroneous entries are hidden and the most severe come first.
+func Active(db *gorm.DB) *gorm.DB {
+	return db.
+		Where("verification_status NOT IN ?", []string{models.VerificationRefuted, models.VerificationEnteredInError}).
+		Order("CASE severity WHEN 'life-threatening' THEN 0 WHEN 'severe' THEN 1 WHEN 'moderate' THEN 2 ELSE 3 END").
+		Order("id")
+}
+
+func (h *Handler) AddAllergy(c *gin.Context) {
+	var input struct {
+		PatientID          string `json:"patient_id" binding:"required"`
+		Category           string `json:"category" binding:"required"`
+		Substance          string `json:"substance" binding:"required"`
+		Reaction           string `json:"reaction"`
+		Severity           string `json:"severity" binding:"required"`
+		VerificationStatus string `json:"verification_status"`
+		Source             string `json:"source"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	if input.VerificationStatus == "" {
+		input.VerificationStatus = models.VerificationUnconfirmed
+	}
+	if invalid := validate(input.Category, input.Severity, input.VerificationStatus, input.Source); invalid != nil {
+		apierror.Respond(c, invalid)
+		return
+	}
+
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.PatientID, staffHospital).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+
+	username, _ := c.Get("username")
+	recordedBy, _ := username.(string)
+	allergy := models.Allergy{
+		PatientID:          patient.ID,
+		HospitalID:         staffHospital,
+		Category:           input.Category,
+		Substance:          strings.TrimSpace(input.Substance),
+		Reaction:           input.Reaction,
+		Severity:           input.Severity,
+		VerificationStatus: input.VerificationStatus,
+		Source:             input.Source,
+		RecordedBy:         recordedBy,
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&allergy).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกข้อมูลการแพ้ได้", "Could not save the allergy").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, allergy)
+}
+
+func (h *Handler) UpdateAllergy(c *gin.Context) {
+	id := c.Param("id")
+	var input struct {
+		Reaction           *string `json:"reaction"`
+		Severity           *string `json:"severity"`
+		VerificationStatus *string `json:"verification_status"`
+		Source             *string `json:"source"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrInvalidInput)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var allergy models.Allergy
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", id, staffHospital).
+		First(&allergy).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบข้อมูลการแพ้ที่ระบุ", "Allergy not found"))
+		return
+	}
+
+	if input.Reaction != nil {
+		allergy.Reaction = *input.Reaction
+	}
+	if input.Severity != nil {
+		allergy.Severity = *input.Severity
+	}
+	if input.VerificationStatus != nil {
+		allergy.VerificationStatus = *input.VerificationStatus
+	}
+	if input.Source != nil {
+		allergy.Source = *input.Source
+	}
+	if invalid := validate(allergy.Category, allergy.Severity, allergy.VerificationStatus, allergy.Source); invalid != nil {
+		apierror.Respond(c, invalid)
+		return
+	}
+
+	if err := h.DB.WithContext(c.Request.Context()).Save(&allergy).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถแก้ไขข้อมูลการแพ้ได้", "Could not update the allergy").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, allergy)
+}
+
+// GetAllergies lists every allergy recorded for a patient, including refuted
+// ones, so the history of a changed assessment stays visible.
+func (h *Handler) GetAllergies(c *gin.Context) {
+	patientID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var allergies []models.Allergy
+	result := h.DB.WithContext(c.Request.Context()).
+		Where("patient_id = ? AND hospital_id = ?", patientID, staffHospital).
+		Order("created_at DESC").
+		Find(&allergies)
+
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลการแพ้ได้", "Could not load allergies").Wrap(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, allergies)
+}
+
+func validate(category, severity, verification, source string) *apierror.Error {
+	switch {
+	case !slices.Contains(categories, category):
+		return apierror.Invalid("category", "ประเภทการแพ้ต้องเป็น drug, food หรือ environment", "Category must be drug, food or environment")
+	case !slices.Contains(severities, severity):
+		return apierror.Invalid("severity", "ความรุนแรงต้องเป็น mild, moderate, severe หรือ life-threatening", "Severity must be mild, moderate, severe or life-threatening")
+	case !slices.Contains(verifications, verification):
+		return apierror.Invalid("verification_status", "สถานะการยืนยันต้องเป็น unconfirmed, confirmed, refuted หรือ entered-in-error", "Verification status must be unconfirmed, confirmed, refuted or entered-in-error")
+	case source != "" && !slices.Contains(sources, source):
+		return apierror.Invalid("source", "แหล่งข้อมูลต้องเป็น patient, relative, clinician หรือ record", "Source must be patient, relative, clinician or record")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package allergy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Allergy{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	return db
+}
+
+func generateTestToken(HospitalID string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func sendJSON(r *gin.Engine, method, path string, data map[string]interface{}, hospitalID string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAddAllergy(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/allergy/add", h.AddAllergy)
+
+	t.Run("Add Allergy Success", func(t *testing.T) {
+		w := sendJSON(r, "POST", "/allergy/add", map[string]interface{}{
+			"patient_id": "001",
+			"category":   "drug",
+			"substance":  "Penicillin",
+			"reaction":   "Anaphylaxis",
+			"severity":   "life-threatening",
+			"source":     "patient",
+		}, "1")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"verification_status":"unconfirmed"`)
+		assert.Contains(t, w.Body.String(), `"recorded_by":"testuser"`)
+	})
+
+	t.Run("Add Allergy Fail Case Invalid Severity", func(t *testing.T) {
+		w := sendJSON(r, "POST", "/allergy/add", map[string]interface{}{
+			"patient_id": "001",
+			"category":   "drug",
+			"substance":  "Penicillin",
+			"severity":   "very bad",
+		}, "1")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Add Allergy Fail Case Other Hospital", func(t *testing.T) {
+		w := sendJSON(r, "POST", "/allergy/add", map[string]interface{}{
+			"patient_id": "001",
+			"category":   "food",
+			"substance":  "Peanut",
+			"severity":   "severe",
+		}, "2")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestUpdateAllergy(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	db.Create(&models.Allergy{ID: 1, PatientID: "001", HospitalID: "1", Category: "drug",
+		Substance: "Sulfa", Severity: "moderate", VerificationStatus: "unconfirmed"})
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.PUT("/allergy/:id", h.UpdateAllergy)
+
+	t.Run("Update Allergy Success", func(t *testing.T) {
+		w := sendJSON(r, "PUT", "/allergy/1", map[string]interface{}{
+			"verification_status": "confirmed",
+		}, "1")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"verification_status":"confirmed"`)
+	})
+
+	t.Run("Update Allergy Fail Case Invalid Status", func(t *testing.T) {
+		w := sendJSON(r, "PUT", "/allergy/1", map[string]interface{}{
+			"verification_status": "maybe",
+		}, "1")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Update Allergy Fail Case Other Hospital", func(t *testing.T) {
+		w := sendJSON(r, "PUT", "/allergy/1", map[string]interface{}{
+			"severity": "mild",
+		}, "2")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,168 @@
+// Package apierror writes the API's error responses. Every error carries a
+// stable machine-readable code, which fixes its HTTP status, and a message
+// in Thai and English; the message is chosen by the request's
+// Accept-Language, Thai by default. The body is
+//
+//	{"error": "<message>", "code": "NOT_FOUND", "details": [...], "request_id": "..."}
+//
+// so clients reading "error" as a string keep working.
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code identifies the kind of error. Codes are part of the API and do not
+// change; clients should branch on them rather than on messages.
+type Code string
+
+const (
+	InvalidInput   Code = "INVALID_INPUT"
+	Unauthorized   Code = "UNAUTHORIZED"
+	Forbidden      Code = "FORBIDDEN"
+	NotFound       Code = "NOT_FOUND"
+	Conflict       Code = "CONFLICT"
+	Unprocessable  Code = "UNPROCESSABLE"
+	Internal       Code = "INTERNAL"
+	UpstreamFailed Code = "UPSTREAM_FAILED"
+	Unavailable    Code = "UNAVAILABLE"
+)
+
+var statuses = map[Code]int{
+	InvalidInput:   http.StatusBadRequest,
+	Unauthorized:   http.StatusUnauthorized,
+	Forbidden:      http.StatusForbidden,
+	NotFound:       http.StatusNotFound,
+	Conflict:       http.StatusConflict,
+	Unprocessable:  http.StatusUnprocessableEntity,
+	Internal:       http.StatusInternalServerError,
+	UpstreamFailed: http.StatusBadGateway,
+	Unavailable:    http.StatusServiceUnavailable,
+}
+
+// Status is the HTTP status sent with code.
+func (code Code) Status() int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Text is a message in both languages.
+type Text struct {
+	TH string
+	EN string
+}
+
+// In returns the message in lang.
+func (t Text) In(lang Lang) string {
+	if lang == English {
+		return t.EN
+	}
+	return t.TH
+}
+
+// FieldError is a problem with one input field. Row locates it in an
+// uploaded file, counting the header as row 1; it is 0 otherwise.
+type FieldError struct {
+	Row     int
+	Field   string
+	Message Text
+}
+
+// Error is an error response. Errors are not modified once made, so common
+// ones can be shared.
+type Error struct {
+	Code    Code
+	Message Text
+	Details []FieldError
+	// Extra holds additional top-level fields of the body.
+	Extra gin.H
+	cause error
+}
+
+func New(code Code, th, en string) *Error {
+	return &Error{Code: code, Message: Text{TH: th, EN: en}}
+}
+
+// Invalid is an InvalidInput error about one field, whose message is also
+// the error's message.
+func Invalid(field, th, en string) *Error {
+	return New(InvalidInput, th, en).WithDetails(FieldError{Field: field, Message: Text{TH: th, EN: en}})
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message.EN + ": " + e.cause.Error()
+	}
+	return e.Message.EN
+}
+
+func (e *Error) Unwrap() error { return e.cause }
+
+// WithDetails returns e with field-level details.
+func (e *Error) WithDetails(details ...FieldError) *Error {
+	clone := *e
+	clone.Details = append(clone.Details[:len(clone.Details):len(clone.Details)], details...)
+	return &clone
+}
+
+// With returns e with an additional top-level field in the body.
+func (e *Error) With(key string, value any) *Error {
+	clone := *e
+	clone.Extra = gin.H{}
+	for k, v := range e.Extra {
+		clone.Extra[k] = v
+	}
+	clone.Extra[key] = value
+	return &clone
+}
+
+// Wrap returns e caused by err. The cause is logged with the request, never
+// sent to the client.
+func (e *Error) Wrap(err error) *Error {
+	clone := *e
+	clone.cause = err
+	return &clone
+}
+
+// Respond writes err as the response and stops the handler chain.
+func Respond(c *gin.Context, err *Error) {
+	if err.cause != nil {
+		c.Error(err.cause)
+	}
+	lang := Language(c)
+	body := gin.H{}
+	for k, v := range err.Extra {
+		body[k] = v
+	}
+	body["error"] = err.Message.In(lang)
+	body["code"] = err.Code
+	if len(err.Details) > 0 {
+		details := make([]gin.H, len(err.Details))
+		for i, d := range err.Details {
+			details[i] = gin.H{"field": d.Field, "message": d.Message.In(lang)}
+			if d.Row > 0 {
+				details[i]["row"] = d.Row
+			}
+		}
+		body["details"] = details
+	}
+	if id := c.GetString("request_id"); id != "" {
+		body["request_id"] = id
+	}
+	c.Header("Content-Language", string(lang))
+	c.AbortWithStatusJSON(err.Code.Status(), body)
+}
+
+// Errors shared by many handlers.
+var (
+	ErrNoHospital        = New(Unauthorized, "ไม่พบข้อมูลสิทธิ์โรงพยาบาล", "The token carries no hospital")
+	ErrIncomplete        = New(InvalidInput, "กรุณากรอกข้อมูลให้ครบถ้วน", "Required fields are missing or invalid")
+	ErrInvalidInput      = New(InvalidInput, "ข้อมูล Input ไม่ถูกต้อง", "The request input is invalid")
+	ErrInvalidDate       = New(InvalidInput, "รูปแบบวันที่ต้องเป็น YYYY-MM-DD", "Dates must be in YYYY-MM-DD format")
+	ErrPatientNotFound   = New(NotFound, "ไม่พบข้อมูลคนไข้ที่ระบุ", "Patient not found")
+	ErrEncounterNotFound = New(NotFound, "ไม่พบข้อมูลการรับบริการที่ระบุ", "Encounter not found")
+)
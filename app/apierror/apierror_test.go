@@ -0,0 +1,102 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguage(t *testing.T) {
+	for header, want := range map[string]Lang{
+		"":                        Thai,
+		"en":                      English,
+		"en-US,en;q=0.9":          English,
+		"th-TH,th;q=0.9,en;q=0.8": Thai,
+		"en;q=0.5,th;q=0.8":       Thai,
+		"th,en":                   Thai,
+		"fr-FR,en;q=0.5":          English,
+		"fr-FR,de":                Thai,
+		"EN-gb":                   English,
+		"en;q=abc":                Thai,
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("Accept-Language", header)
+		assert.Equal(t, want, Language(c), header)
+	}
+}
+
+func respond(err *Error, language, requestID string) (*httptest.ResponseRecorder, map[string]any) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Accept-Language", language)
+	if requestID != "" {
+		c.Set("request_id", requestID)
+	}
+	Respond(c, err)
+	var body map[string]any
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func TestRespond(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Respond Thai By Default", func(t *testing.T) {
+		w, body := respond(ErrPatientNotFound, "", "req-1")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "th", w.Header().Get("Content-Language"))
+		assert.Equal(t, map[string]any{
+			"error":      "ไม่พบข้อมูลคนไข้ที่ระบุ",
+			"code":       "NOT_FOUND",
+			"request_id": "req-1",
+		}, body)
+	})
+
+	t.Run("Respond English With Details", func(t *testing.T) {
+		w, body := respond(Invalid("national_id", "เลขบัตรประชาชนต้องเป็นตัวเลข 13 หลัก", "National ID must be 13 digits"), "en", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "en", w.Header().Get("Content-Language"))
+		assert.Equal(t, map[string]any{
+			"error": "National ID must be 13 digits",
+			"code":  "INVALID_INPUT",
+			"details": []any{
+				map[string]any{"field": "national_id", "message": "National ID must be 13 digits"},
+			},
+		}, body)
+	})
+
+	t.Run("Respond Extra Fields", func(t *testing.T) {
+		w, body := respond(New(Conflict, "มีคำเตือน", "Has warnings").With("warnings", []string{"a"}), "en", "")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "Has warnings", body["error"])
+		assert.Equal(t, []any{"a"}, body["warnings"])
+	})
+
+	t.Run("Respond Hides Cause", func(t *testing.T) {
+		cause := errors.New(`pq: duplicate key value violates unique constraint "patients_pkey"`)
+		err := New(Internal, "บันทึกไม่สำเร็จ", "Could not save").Wrap(cause)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		Respond(c, err)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.NotContains(t, w.Body.String(), "pq:")
+		assert.True(t, c.IsAborted())
+		assert.Equal(t, cause, c.Errors.Last().Err)
+		assert.ErrorIs(t, err, cause)
+	})
+
+	t.Run("Shared Errors Are Not Modified", func(t *testing.T) {
+		ErrInvalidInput.WithDetails(FieldError{Field: "x"}).With("k", 1)
+		assert.Empty(t, ErrInvalidInput.Details)
+		assert.Empty(t, ErrInvalidInput.Extra)
+	})
+}
@@ -0,0 +1,43 @@
+package apierror
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Lang is a language messages are available in.
+type Lang string
+
+const (
+	Thai    Lang = "th"
+	English Lang = "en"
+)
+
+// Language picks the language for c's response from its Accept-Language
+// header: the supported language with the highest quality, the first listed
+// on a tie, and Thai when neither is acceptable.
+func Language(c *gin.Context) Lang {
+	best, bestQ := Thai, 0.0
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		lang := Lang(primary)
+		if lang != Thai && lang != English {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Entry describes an audited action. The actor is taken from the request.
+type Entry struct {
+	Action            string
+	ResourceType      string
+	ResourceID        string
+	PatientID         string
+	PatientHospitalID string
+	Detail            string
+}
+
+// Log writes entry on db, attributed to the staff member making request c.
+// Pass the transaction that performs the action, so the action and its audit
+// record are committed or rolled back together.
+func Log(db *gorm.DB, c *gin.Context, entry Entry) error {
+	hospitalID, _ := c.Get("hospital_id")
+	username, _ := c.Get("username")
+	staffID, _ := c.Get("staff_id")
+
+	log := models.AuditLog{
+		Action:            entry.Action,
+		ResourceType:      entry.ResourceType,
+		ResourceID:        entry.ResourceID,
+		PatientID:         entry.PatientID,
+		PatientHospitalID: entry.PatientHospitalID,
+		Detail:            entry.Detail,
+	}
+	log.HospitalID, _ = hospitalID.(string)
+	log.Username, _ = username.(string)
+	log.StaffID, _ = staffID.(uint)
+	return db.Create(&log).Error
+}
@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the audit log endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+// GetLogs lists audit entries made by the caller's hospital or touching its
+// patients, newest first.
+func (h *Handler) GetLogs(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่ดูประวัติการเข้าถึงข้อมูลได้", "Only admins can view the access log"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("(hospital_id = ? OR patient_hospital_id = ?)", staffHospital, staffHospital)
+	if patientID := c.Query("patient_id"); patientID != "" {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			apierror.Respond(c, apierror.ErrInvalidDate)
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	limit := 200
+	if s := c.Query("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Find(&logs).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงประวัติการเข้าถึงข้อมูลได้", "Could not load the access log").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.AuditLog{})
+	db.Create(&models.AuditLog{HospitalID: "1", Action: "referral.create", ResourceType: "referral", PatientID: "001", PatientHospitalID: "1"})
+	db.Create(&models.AuditLog{HospitalID: "2", Action: "referral.read", ResourceType: "referral", PatientID: "001", PatientHospitalID: "1"})
+	db.Create(&models.AuditLog{HospitalID: "2", Action: "referral.create", ResourceType: "referral", PatientID: "900", PatientHospitalID: "2"})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"staff_id":    7,
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func get(r *gin.Engine, path, role string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken("1", role))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetLogs(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/audit", h.GetLogs)
+
+	t.Run("Get Logs Includes Access By Other Hospitals", func(t *testing.T) {
+		w := get(r, "/audit?patient_id=001", "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"action":"referral.read"`)
+		assert.NotContains(t, w.Body.String(), `"patient_id":"900"`)
+	})
+
+	t.Run("Get Logs Fail Case Not Admin", func(t *testing.T) {
+		w := get(r, "/audit", "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestLogTakesActorFromRequest(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/touch", func(c *gin.Context) {
+		Log(db, c, Entry{Action: "patient.export", ResourceType: "patient", PatientID: "001", PatientHospitalID: "1"})
+	})
+	get(r, "/touch", "admin")
+
+	var log models.AuditLog
+	db.Where("action = ?", "patient.export").First(&log)
+	assert.Equal(t, "1", log.HospitalID)
+	assert.Equal(t, "testuser", log.Username)
+	assert.Equal(t, uint(7), log.StaffID)
+}
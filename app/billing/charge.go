@@ -0,0 +1,98 @@
+package billing
+
+import (
+	"errors"
+
+	"example.com/myapp/app/model"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Capture records a charge for code on an encounter at the charge master
+// price. Codes the hospital has not priced are not billable and are skipped.
+// A charge already captured for the same source row is left untouched, so
+// callers may capture inside retried transactions.
+func Capture(tx *gorm.DB, encounter models.Encounter, code string, qty int, source string, sourceID uint, by string) error {
+	var item models.ChargeItem
+	err := tx.Where("hospital_id = ? AND code = ? AND active = ?", encounter.HospitalID, code, true).
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	charge := newCharge(encounter, item, qty, by)
+	charge.Source = source
+	charge.SourceID = &sourceID
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&charge).Error
+}
+
+func newCharge(encounter models.Encounter, item models.ChargeItem, qty int, by string) models.Charge {
+	return models.Charge{
+		HospitalID:  encounter.HospitalID,
+		EncounterID: encounter.ID,
+		PatientID:   encounter.PatientID,
+		ChargeCode:  item.Code,
+		Description: item.Name,
+		Quantity:    qty,
+		UnitPrice:   item.Price,
+		Amount:      item.Price.Mul(decimal.NewFromInt(int64(qty))),
+		CreatedBy:   by,
+	}
+}
+
+// reprice applies the payer's price list to charges being invoiced and
+// returns the invoice total. Codes the payer has not priced go back to the
+// charge master price, so a charge released from a voided invoice is not
+// billed at the previous payer's price.
+func reprice(tx *gorm.DB, hospitalID, payer string, charges []models.Charge) (decimal.Decimal, error) {
+	codes := make([]string, len(charges))
+	for i, charge := range charges {
+		codes[i] = charge.ChargeCode
+	}
+	var items []models.ChargeItem
+	if err := tx.Where("hospital_id = ? AND code IN ?", hospitalID, codes).Find(&items).Error; err != nil {
+		return decimal.Zero, err
+	}
+	var entries []models.PriceListEntry
+	if err := tx.Where("hospital_id = ? AND payer = ?", hospitalID, payer).Find(&entries).Error; err != nil {
+		return decimal.Zero, err
+	}
+	prices := map[string]decimal.Decimal{}
+	for _, item := range items {
+		prices[item.Code] = item.Price
+	}
+	for _, e := range entries {
+		prices[e.ChargeCode] = e.Price
+	}
+
+	total := decimal.Zero
+	for i := range charges {
+		if price, ok := prices[charges[i].ChargeCode]; ok && !price.Equal(charges[i].UnitPrice) {
+			charges[i].UnitPrice = price
+			charges[i].Amount = price.Mul(decimal.NewFromInt(int64(charges[i].Quantity)))
+			if err := tx.Model(&charges[i]).
+				Updates(map[string]interface{}{"unit_price": charges[i].UnitPrice, "amount": charges[i].Amount}).Error; err != nil {
+				return decimal.Zero, err
+			}
+		}
+		total = total.Add(charges[i].Amount)
+	}
+	return total, nil
+}
+
+// paidAmount is payments minus refunds recorded against an invoice.
+func paidAmount(payments []models.Payment) decimal.Decimal {
+	paid := decimal.Zero
+	for _, p := range payments {
+		if p.Kind == models.PaymentKindRefund {
+			paid = paid.Sub(p.Amount)
+		} else {
+			paid = paid.Add(p.Amount)
+		}
+	}
+	return paid
+}
@@ -0,0 +1,547 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/coverage"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Handler serves the billing endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+// PayerSelf is the payer of an invoice when the patient pays out of pocket.
+const PayerSelf = "self"
+
+var (
+	errNoCharges      = errors.New("billing: no uninvoiced charges")
+	errInvoiceClosed  = errors.New("billing: invoice is not open")
+	errExceedsBalance = errors.New("billing: amount exceeds balance")
+)
+
+func (h *Handler) AddChargeItem(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่แก้ไขรายการค่าบริการได้", "Only admins can edit the charge catalog"))
+		return
+	}
+	var input struct {
+		Code     string          `json:"code" binding:"required"`
+		Name     string          `json:"name" binding:"required"`
+		Category string          `json:"category" binding:"required"`
+		Price    decimal.Decimal `json:"price"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if !slices.Contains(models.ChargeCategories, input.Category) {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "หมวดค่าบริการไม่ถูกต้อง", "Invalid charge category"))
+		return
+	}
+	if input.Price.IsNegative() || input.Price.Exponent() < -2 {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ราคาต้องไม่ติดลบและมีทศนิยมไม่เกิน 2 ตำแหน่ง", "Price must not be negative and may have at most 2 decimal places"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	item := models.ChargeItem{
+		HospitalID: staffHospital,
+		Code:       input.Code,
+		Name:       input.Name,
+		Category:   input.Category,
+		Price:      input.Price,
+		Active:     true,
+	}
+	err := repository.Duplicate(h.DB, h.DB.WithContext(c.Request.Context()).Create(&item).Error)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "รหัสค่าบริการนี้มีอยู่แล้ว", "A charge item with this code already exists"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเพิ่มรายการค่าบริการได้", "Could not add the charge item").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, item)
+}
+
+func (h *Handler) GetChargeItems(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ? AND active = ?", staffHospital, true)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	var items []models.ChargeItem
+	if err := query.Order("code").Find(&items).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงรายการค่าบริการได้", "Could not load charge items").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// SetPayerPrice sets the price a payer is billed for a charge master item,
+// replacing any earlier price for the same pair.
+func (h *Handler) SetPayerPrice(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่แก้ไขรายการค่าบริการได้", "Only admins can edit the charge catalog"))
+		return
+	}
+	var input struct {
+		Payer      string          `json:"payer" binding:"required"`
+		ChargeCode string          `json:"charge_code" binding:"required"`
+		Price      decimal.Decimal `json:"price"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if input.Price.IsNegative() || input.Price.Exponent() < -2 {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ราคาต้องไม่ติดลบและมีทศนิยมไม่เกิน 2 ตำแหน่ง", "Price must not be negative and may have at most 2 decimal places"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var item models.ChargeItem
+	if err := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ? AND code = ?", staffHospital, input.ChargeCode).
+		First(&item).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบรายการค่าบริการที่ระบุ", "Charge item not found"))
+		return
+	}
+
+	entry := models.PriceListEntry{
+		HospitalID: staffHospital,
+		Payer:      input.Payer,
+		ChargeCode: item.Code,
+		Price:      input.Price,
+	}
+	err := h.DB.WithContext(c.Request.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hospital_id"}, {Name: "payer"}, {Name: "charge_code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price"}),
+	}).Create(&entry).Error
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกราคาได้", "Could not save the price").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+func (h *Handler) GetPriceList(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", staffHospital)
+	if payer := c.Query("payer"); payer != "" {
+		query = query.Where("payer = ?", payer)
+	}
+	var entries []models.PriceListEntry
+	if err := query.Order("payer, charge_code").Find(&entries).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงรายการราคาได้", "Could not load prices").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// AddCharge records a manual charge, such as a procedure or room fee, that is
+// not captured from an order.
+func (h *Handler) AddCharge(c *gin.Context) {
+	var input struct {
+		EncounterID uint   `json:"encounter_id" binding:"required"`
+		ChargeCode  string `json:"charge_code" binding:"required"`
+		Quantity    int    `json:"quantity" binding:"required,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	encounter, ok := h.findEncounter(c, input.EncounterID)
+	if !ok {
+		return
+	}
+
+	var item models.ChargeItem
+	if err := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ? AND code = ? AND active = ?", encounter.HospitalID, input.ChargeCode, true).
+		First(&item).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบรายการค่าบริการที่ระบุ", "Charge item not found"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	createdBy, _ := username.(string)
+	charge := newCharge(encounter, item, input.Quantity, createdBy)
+	charge.Source = models.ChargeSourceManual
+	if err := h.DB.WithContext(c.Request.Context()).Create(&charge).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกค่าใช้จ่ายได้", "Could not save the charge").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, charge)
+}
+
+func (h *Handler) GetEncounterCharges(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var charges []models.Charge
+	if err := h.DB.WithContext(c.Request.Context()).Where("encounter_id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		Order("id").Find(&charges).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงรายการค่าใช้จ่ายได้", "Could not load charges").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, charges)
+}
+
+// CreateInvoice bills every charge of the encounter not yet on an invoice,
+// repriced with the payer's price list. Without an explicit payer the
+// patient's active coverage is billed, or the patient when there is none.
+func (h *Handler) CreateInvoice(c *gin.Context) {
+	var input struct {
+		EncounterID uint   `json:"encounter_id" binding:"required"`
+		Payer       string `json:"payer"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	encounter, ok := h.findEncounter(c, input.EncounterID)
+	if !ok {
+		return
+	}
+	var coverageID *uint
+	if input.Payer == "" {
+		active, err := coverage.Active(h.DB.WithContext(c.Request.Context()), encounter.PatientID, encounter.HospitalID, encounter.StartedAt)
+		if err != nil {
+			apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถตรวจสอบสิทธิการรักษาได้", "Could not check the patient's coverage").Wrap(err))
+			return
+		}
+		input.Payer = PayerSelf
+		if active != nil {
+			input.Payer = active.Payer()
+			coverageID = &active.ID
+		}
+	}
+
+	username, _ := c.Get("username")
+	issuedBy, _ := username.(string)
+	invoice := models.Invoice{
+		HospitalID:  encounter.HospitalID,
+		EncounterID: encounter.ID,
+		PatientID:   encounter.PatientID,
+		Payer:       input.Payer,
+		CoverageID:  coverageID,
+		Total:       decimal.Zero,
+		Status:      models.InvoiceOpen,
+		IssuedBy:    issuedBy,
+	}
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Charges", "Payments").Create(&invoice).Error; err != nil {
+			return err
+		}
+		// Claiming charges with a conditional update keeps two cashiers from
+		// putting the same charge on two invoices.
+		result := tx.Model(&models.Charge{}).
+			Where("encounter_id = ? AND invoice_id IS NULL", encounter.ID).
+			Update("invoice_id", invoice.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNoCharges
+		}
+		if err := tx.Where("invoice_id = ?", invoice.ID).Order("id").Find(&invoice.Charges).Error; err != nil {
+			return err
+		}
+		total, err := reprice(tx, invoice.HospitalID, invoice.Payer, invoice.Charges)
+		if err != nil {
+			return err
+		}
+		invoice.Total = total
+		invoice.Number = fmt.Sprintf("INV%08d", invoice.ID)
+		return tx.Model(&invoice).Updates(map[string]interface{}{"number": invoice.Number, "total": invoice.Total}).Error
+	})
+	switch {
+	case errors.Is(err, errNoCharges):
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่มีรายการค่าใช้จ่ายที่ยังไม่ได้ออกใบแจ้งหนี้", "There are no uninvoiced charges"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถออกใบแจ้งหนี้ได้", "Could not create the invoice").Wrap(err))
+		return
+	}
+
+	invoice.Payments = []models.Payment{}
+	c.JSON(http.StatusCreated, invoiceResponse(invoice))
+}
+
+func (h *Handler) GetInvoice(c *gin.Context) {
+	invoice, ok := h.findInvoice(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, invoiceResponse(invoice))
+}
+
+func (h *Handler) GetPatientInvoices(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var invoices []models.Invoice
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Payments").
+		Where("patient_id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		Order("created_at DESC").Find(&invoices).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลใบแจ้งหนี้ได้", "Could not load invoices").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, invoices)
+}
+
+// AddPayment records a payment or refund. Payments are capped at the
+// outstanding amount and refunds at what has been paid; the invoice row is
+// locked so concurrent counters cannot overshoot either limit.
+func (h *Handler) AddPayment(c *gin.Context) {
+	var input struct {
+		Kind      string          `json:"kind"`
+		Amount    decimal.Decimal `json:"amount"`
+		Method    string          `json:"method" binding:"required"`
+		Reference string          `json:"reference"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if input.Kind == "" {
+		input.Kind = models.PaymentKindPayment
+	}
+	if input.Kind != models.PaymentKindPayment && input.Kind != models.PaymentKindRefund {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ประเภทการชำระเงินไม่ถูกต้อง", "Invalid payment type"))
+		return
+	}
+	if !input.Amount.IsPositive() || input.Amount.Exponent() < -2 {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "จำนวนเงินต้องมากกว่า 0 และมีทศนิยมไม่เกิน 2 ตำแหน่ง", "Amount must be greater than 0 and may have at most 2 decimal places"))
+		return
+	}
+	invoice, ok := h.findInvoice(c)
+	if !ok {
+		return
+	}
+
+	username, _ := c.Get("username")
+	receivedBy, _ := username.(string)
+	payment := models.Payment{
+		InvoiceID:  invoice.ID,
+		HospitalID: invoice.HospitalID,
+		PatientID:  invoice.PatientID,
+		Kind:       input.Kind,
+		Amount:     input.Amount,
+		Method:     input.Method,
+		Reference:  input.Reference,
+		ReceivedBy: receivedBy,
+	}
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Payments").
+			First(&invoice, invoice.ID).Error; err != nil {
+			return err
+		}
+		if invoice.Status == models.InvoiceVoid {
+			return errInvoiceClosed
+		}
+		paid := paidAmount(invoice.Payments)
+		if input.Kind == models.PaymentKindPayment {
+			if input.Amount.GreaterThan(invoice.Total.Sub(paid)) {
+				return errExceedsBalance
+			}
+			paid = paid.Add(input.Amount)
+		} else {
+			if input.Amount.GreaterThan(paid) {
+				return errExceedsBalance
+			}
+			paid = paid.Sub(input.Amount)
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		invoice.Payments = append(invoice.Payments, payment)
+
+		status := models.InvoiceOpen
+		if paid.Equal(invoice.Total) {
+			status = models.InvoicePaid
+		}
+		invoice.Status = status
+		return tx.Model(&models.Invoice{}).Where("id = ?", invoice.ID).Update("status", status).Error
+	})
+	switch {
+	case errors.Is(err, errInvoiceClosed):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ใบแจ้งหนี้นี้ถูกยกเลิกแล้ว", "The invoice has been voided"))
+		return
+	case errors.Is(err, errExceedsBalance) && input.Kind == models.PaymentKindRefund:
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "จำนวนเงินคืนเกินยอดที่ชำระแล้ว", "Refund exceeds the amount paid"))
+		return
+	case errors.Is(err, errExceedsBalance):
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "จำนวนเงินเกินยอดค้างชำระ", "Amount exceeds the outstanding balance"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการชำระเงินได้", "Could not save the payment").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, invoiceResponse(invoice))
+}
+
+// VoidInvoice cancels an invoice that has no money on it and releases its
+// charges so they can be billed again, for example to another payer.
+func (h *Handler) VoidInvoice(c *gin.Context) {
+	invoice, ok := h.findInvoice(c)
+	if !ok {
+		return
+	}
+
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Payments").
+			First(&invoice, invoice.ID).Error; err != nil {
+			return err
+		}
+		if invoice.Status != models.InvoiceOpen || !paidAmount(invoice.Payments).IsZero() {
+			return errInvoiceClosed
+		}
+		if err := tx.Model(&models.Charge{}).Where("invoice_id = ?", invoice.ID).
+			Update("invoice_id", nil).Error; err != nil {
+			return err
+		}
+		invoice.Status = models.InvoiceVoid
+		return tx.Model(&models.Invoice{}).Where("id = ?", invoice.ID).Update("status", invoice.Status).Error
+	})
+	switch {
+	case errors.Is(err, errInvoiceClosed):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ยกเลิกได้เฉพาะใบแจ้งหนี้ที่ยังไม่มียอดชำระ", "Only invoices with no payments can be voided"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถยกเลิกใบแจ้งหนี้ได้", "Could not void the invoice").Wrap(err))
+		return
+	}
+
+	invoice.Charges = []models.Charge{}
+	c.JSON(http.StatusOK, invoiceResponse(invoice))
+}
+
+// GetPatientBalance sums what the patient owes on open invoices and the
+// charges that have not been invoiced yet.
+func (h *Handler) GetPatientBalance(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	patientID := c.Param("id")
+
+	var invoices []models.Invoice
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Payments").
+		Where("patient_id = ? AND hospital_id = ? AND status <> ?", patientID, staffHospital, models.InvoiceVoid).
+		Find(&invoices).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถคำนวณยอดค้างชำระได้", "Could not calculate outstanding balances").Wrap(err))
+		return
+	}
+	var charges []models.Charge
+	if err := h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ? AND invoice_id IS NULL", patientID, staffHospital).
+		Find(&charges).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถคำนวณยอดค้างชำระได้", "Could not calculate outstanding balances").Wrap(err))
+		return
+	}
+
+	invoiced, paid, uninvoiced := decimal.Zero, decimal.Zero, decimal.Zero
+	for _, invoice := range invoices {
+		invoiced = invoiced.Add(invoice.Total)
+		paid = paid.Add(paidAmount(invoice.Payments))
+	}
+	for _, charge := range charges {
+		uninvoiced = uninvoiced.Add(charge.Amount)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"patient_id":  patientID,
+		"invoiced":    invoiced.StringFixed(2),
+		"paid":        paid.StringFixed(2),
+		"outstanding": invoiced.Sub(paid).StringFixed(2),
+		"uninvoiced":  uninvoiced.StringFixed(2),
+	})
+}
+
+func invoiceResponse(invoice models.Invoice) gin.H {
+	paid := paidAmount(invoice.Payments)
+	return gin.H{
+		"invoice": invoice,
+		"paid":    paid.StringFixed(2),
+		"balance": invoice.Total.Sub(paid).StringFixed(2),
+	}
+}
+
+func (h *Handler) findEncounter(c *gin.Context, id uint) (models.Encounter, bool) {
+	var encounter models.Encounter
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return encounter, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", id, staffHospital).First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return encounter, false
+	}
+	return encounter, true
+}
+
+func (h *Handler) findInvoice(c *gin.Context) (models.Invoice, bool) {
+	var invoice models.Invoice
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return invoice, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Charges", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&invoice).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบใบแจ้งหนี้ที่ระบุ", "Invoice not found"))
+		return invoice, false
+	}
+	return invoice, true
+}
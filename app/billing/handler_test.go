@@ -0,0 +1,293 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{}, &models.ChargeItem{},
+		&models.PriceListEntry{}, &models.Charge{}, &models.Invoice{}, &models.Payment{}, &models.Coverage{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	db.Create(&models.ChargeItem{HospitalID: "1", Code: "OPD01", Name: "OPD service fee", Category: "service",
+		Price: decimal.RequireFromString("50.00"), Active: true})
+	db.Create(&models.ChargeItem{HospitalID: "1", Code: "CBC", Name: "Complete blood count", Category: "lab",
+		Price: decimal.RequireFromString("120.25"), Active: true})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/billing/item/add", h.AddChargeItem)
+	r.POST("/billing/price/add", h.SetPayerPrice)
+	r.POST("/billing/charge/add", h.AddCharge)
+	r.POST("/billing/invoice/add", h.CreateInvoice)
+	r.GET("/billing/invoice/search/:id", h.GetInvoice)
+	r.POST("/billing/invoice/payment/:id", h.AddPayment)
+	r.POST("/billing/invoice/void/:id", h.VoidInvoice)
+	r.GET("/billing/balance/:id", h.GetPatientBalance)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID, role))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type invoiceBody struct {
+	Invoice models.Invoice `json:"invoice"`
+	Paid    string         `json:"paid"`
+	Balance string         `json:"balance"`
+}
+
+func TestAddChargeItem(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Add Charge Item Success", func(t *testing.T) {
+		w := send(r, "POST", "/billing/item/add", map[string]interface{}{
+			"code": "XRAY", "name": "Chest X-ray", "category": "service", "price": "350.00",
+		}, "1", "admin")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Add Charge Item Fail Case Duplicate Code", func(t *testing.T) {
+		w := send(r, "POST", "/billing/item/add", map[string]interface{}{
+			"code": "XRAY", "name": "Chest X-ray PA", "category": "service", "price": "400.00",
+		}, "1", "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Add Charge Item Fail Case Not Admin", func(t *testing.T) {
+		w := send(r, "POST", "/billing/item/add", map[string]interface{}{
+			"code": "XRAY2", "name": "Chest X-ray", "category": "service", "price": "350.00",
+		}, "1", "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Add Charge Item Fail Case Fractional Satang", func(t *testing.T) {
+		w := send(r, "POST", "/billing/item/add", map[string]interface{}{
+			"code": "XRAY3", "name": "Chest X-ray", "category": "service", "price": "350.005",
+		}, "1", "admin")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestCaptureIsIdempotent(t *testing.T) {
+	db := SetupTestDB()
+	encounter := models.Encounter{ID: 1, PatientID: "001", HospitalID: "1"}
+
+	assert.NoError(t, Capture(db, encounter, "CBC", 1, models.ChargeSourceLabOrder, 7, "lab"))
+	assert.NoError(t, Capture(db, encounter, "CBC", 1, models.ChargeSourceLabOrder, 7, "lab"))
+	assert.NoError(t, Capture(db, encounter, "NOPRICE", 1, models.ChargeSourceLabOrder, 8, "lab"))
+
+	var count int64
+	db.Model(&models.Charge{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestInvoiceWorkflow(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	send(r, "POST", "/billing/charge/add", map[string]interface{}{
+		"encounter_id": 1, "charge_code": "OPD01", "quantity": 1,
+	}, "1", "nurse")
+	send(r, "POST", "/billing/charge/add", map[string]interface{}{
+		"encounter_id": 1, "charge_code": "CBC", "quantity": 2,
+	}, "1", "nurse")
+	send(r, "POST", "/billing/price/add", map[string]interface{}{
+		"payer": "SSS", "charge_code": "CBC", "price": "100.10",
+	}, "1", "admin")
+
+	t.Run("Add Charge Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", "/billing/charge/add", map[string]interface{}{
+			"encounter_id": 1, "charge_code": "OPD01", "quantity": 1,
+		}, "2", "nurse")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	w := send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1, "payer": "SSS"}, "1", "nurse")
+	var created invoiceBody
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := func(action string) string {
+		return "/billing/invoice/" + action + "/" + fmt.Sprint(created.Invoice.ID)
+	}
+
+	t.Run("Create Invoice Applies Payer Prices", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "INV00000001", created.Invoice.Number)
+		assert.Len(t, created.Invoice.Charges, 2)
+		// 50.00 + 2 x 100.10, without float rounding drift
+		assert.True(t, decimal.RequireFromString("250.20").Equal(created.Invoice.Total))
+		assert.Equal(t, "250.20", created.Balance)
+	})
+
+	t.Run("Create Invoice Fail Case Nothing To Bill", func(t *testing.T) {
+		w := send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1}, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Payment Fail Case Exceeds Balance", func(t *testing.T) {
+		w := send(r, "POST", path("payment"), map[string]interface{}{"amount": "250.21", "method": "cash"}, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Partial Payment Keeps Invoice Open", func(t *testing.T) {
+		w := send(r, "POST", path("payment"), map[string]interface{}{"amount": "100.10", "method": "cash"}, "1", "nurse")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var body invoiceBody
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, models.InvoiceOpen, body.Invoice.Status)
+		assert.Equal(t, "150.10", body.Balance)
+	})
+
+	t.Run("Patient Balance", func(t *testing.T) {
+		w := send(r, "GET", "/billing/balance/001", nil, "1", "nurse")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"outstanding":"150.10"`)
+	})
+
+	t.Run("Void Fail Case Has Payments", func(t *testing.T) {
+		w := send(r, "POST", path("void"), nil, "1", "nurse")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Full Payment Marks Invoice Paid", func(t *testing.T) {
+		w := send(r, "POST", path("payment"), map[string]interface{}{"amount": 150.1, "method": "card"}, "1", "nurse")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"paid"`)
+		assert.Contains(t, w.Body.String(), `"balance":"0.00"`)
+	})
+
+	t.Run("Refund Fail Case Exceeds Paid", func(t *testing.T) {
+		w := send(r, "POST", path("payment"), map[string]interface{}{
+			"kind": "refund", "amount": "300", "method": "cash",
+		}, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Refund Reopens Invoice", func(t *testing.T) {
+		w := send(r, "POST", path("payment"), map[string]interface{}{
+			"kind": "refund", "amount": "100.10", "method": "cash",
+		}, "1", "nurse")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"open"`)
+		assert.Contains(t, w.Body.String(), `"paid":"150.10"`)
+	})
+}
+
+func TestVoidInvoiceReleasesCharges(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	send(r, "POST", "/billing/charge/add", map[string]interface{}{
+		"encounter_id": 1, "charge_code": "OPD01", "quantity": 1,
+	}, "1", "nurse")
+	w := send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1}, "1", "nurse")
+	var created invoiceBody
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = send(r, "POST", "/billing/invoice/void/"+fmt.Sprint(created.Invoice.ID), nil, "1", "nurse")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"void"`)
+
+	w = send(r, "GET", "/billing/balance/001", nil, "1", "nurse")
+	assert.Contains(t, w.Body.String(), `"outstanding":"0.00"`)
+	assert.Contains(t, w.Body.String(), `"uninvoiced":"50.00"`)
+
+	w = send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1}, "1", "nurse")
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestReinvoiceUsesChargeMasterPrice(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	send(r, "POST", "/billing/charge/add", map[string]interface{}{
+		"encounter_id": 1, "charge_code": "CBC", "quantity": 1,
+	}, "1", "nurse")
+	send(r, "POST", "/billing/price/add", map[string]interface{}{
+		"payer": "SSS", "charge_code": "CBC", "price": "100.10",
+	}, "1", "admin")
+	w := send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1, "payer": "SSS"}, "1", "nurse")
+	var created invoiceBody
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.True(t, decimal.RequireFromString("100.10").Equal(created.Invoice.Total))
+	send(r, "POST", "/billing/invoice/void/"+fmt.Sprint(created.Invoice.ID), nil, "1", "nurse")
+
+	w = send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1, "payer": PayerSelf}, "1", "nurse")
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.True(t, decimal.RequireFromString("120.25").Equal(created.Invoice.Total))
+	assert.True(t, decimal.RequireFromString("120.25").Equal(created.Invoice.Charges[0].UnitPrice))
+}
+
+func TestInvoiceDefaultsToActiveCoverage(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	expired := time.Now().AddDate(0, -1, 0)
+	db.Create(&models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "CSMBS", Priority: 1,
+		ValidFrom: time.Now().AddDate(-1, 0, 0), ValidTo: &expired, EligibilityStatus: "eligible"})
+	db.Create(&models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "UCS", Priority: 2,
+		ValidFrom: time.Now().AddDate(-1, 0, 0), EligibilityStatus: "ineligible"})
+	sss := models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "SSS", Priority: 3,
+		ValidFrom: time.Now().AddDate(-1, 0, 0), EligibilityStatus: "unknown"}
+	db.Create(&sss)
+
+	send(r, "POST", "/billing/charge/add", map[string]interface{}{
+		"encounter_id": 1, "charge_code": "OPD01", "quantity": 1,
+	}, "1", "nurse")
+	w := send(r, "POST", "/billing/invoice/add", map[string]interface{}{"encounter_id": 1}, "1", "nurse")
+	var created invoiceBody
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "SSS", created.Invoice.Payer)
+	assert.Equal(t, sss.ID, *created.Invoice.CoverageID)
+}
@@ -0,0 +1,279 @@
+// Package config loads the server's settings once at startup, so that a
+// missing or invalid setting stops the server instead of surfacing later.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting. Each field is read, in increasing order of
+// precedence, from its default, the YAML file named by CONFIG_FILE, the
+// .env file and the environment. A setting can also be read from a file
+// named by <NAME>_FILE, as Docker secrets are mounted. A setting tagged
+// required:"serve" is needed by the server but not by the maintenance
+// commands.
+type Config struct {
+	Port      string `yaml:"port" env:"PORT" default:"8080"`
+	DBSource  string `yaml:"db_source" env:"DB_SOURCE" required:"true" secret:"true"`
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" required:"serve" secret:"true"`
+
+	// Server timeouts. Streaming exports lift the write timeout for
+	// themselves; ShutdownTimeout bounds how long a deploy waits for
+	// in-flight requests and background workers.
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT" default:"15s"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT" default:"60s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" default:"120s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// DBConnectTimeout bounds how long startup waits for the database.
+	DBConnectTimeout  time.Duration `yaml:"db_connect_timeout" env:"DB_CONNECT_TIMEOUT" default:"60s"`
+	DBMaxOpenConns    int           `yaml:"db_max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	DBMaxIdleConns    int           `yaml:"db_max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"5"`
+	DBConnMaxLifetime time.Duration `yaml:"db_conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	DBConnMaxIdleTime time.Duration `yaml:"db_conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+
+	// LogLevel is debug, info, warn or error; debug adds every SQL statement.
+	LogLevel slog.Level `yaml:"log_level" env:"LOG_LEVEL" default:"info"`
+
+	// Tracing: OTelTracesExporter is none, otlp (OTLP/HTTP to OTelEndpoint,
+	// or localhost:4318) or console (stdout, for development).
+	OTelTracesExporter string `yaml:"otel_traces_exporter" env:"OTEL_TRACES_EXPORTER" default:"none"`
+	OTelEndpoint       string `yaml:"otel_exporter_otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTelServiceName    string `yaml:"otel_service_name" env:"OTEL_SERVICE_NAME" default:"hospital-api"`
+
+	ICD10CSV   string `yaml:"icd10_csv" env:"ICD10_CSV"`
+	LabDropDir string `yaml:"lab_drop_dir" env:"LAB_DROP_DIR"`
+
+	DeidKey        string `yaml:"deid_key" env:"DEID_KEY" secret:"true"`
+	DeidPolicyFile string `yaml:"deid_policy_file" env:"DEID_POLICY_FILE"`
+
+	HL7MLLPAddr   string `yaml:"hl7_mllp_addr" env:"HL7_MLLP_ADDR"`
+	HL7HospitalID string `yaml:"hl7_hospital_id" env:"HL7_HOSPITAL_ID"`
+}
+
+// minSecretLength is the shortest JWT secret accepted: 256 bits, the size
+// of an HS256 key.
+const minSecretLength = 32
+
+// Load reads the configuration from the process environment and the .env
+// file in the working directory, if there is one.
+func Load() (*Config, error) {
+	return load(os.LookupEnv, ".env", true)
+}
+
+// LoadCommand reads the configuration like Load for a maintenance command
+// (migrate, staff role), which only talks to the database and so does not
+// need the settings the server alone uses, such as JWT_SECRET.
+func LoadCommand() (*Config, error) {
+	return load(os.LookupEnv, ".env", false)
+}
+
+func load(lookupEnv func(string) (string, bool), envFile string, serve bool) (*Config, error) {
+	dotenv, err := readDotEnv(envFile)
+	if err != nil {
+		return nil, err
+	}
+	lookup := func(name string) (string, bool, error) {
+		value, ok := lookupEnv(name)
+		if !ok {
+			value, ok = dotenv[name]
+		}
+		path, fromFile := lookupEnv(name + "_FILE")
+		if !fromFile {
+			path, fromFile = dotenv[name+"_FILE"]
+		}
+		switch {
+		case fromFile && ok:
+			return "", false, fmt.Errorf("config: both %s and %s_FILE are set", name, name)
+		case fromFile:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", false, fmt.Errorf("config: %s_FILE: %w", name, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), true, nil
+		}
+		return value, ok, nil
+	}
+
+	cfg := &Config{}
+	fields := reflect.ValueOf(cfg).Elem()
+	for i := range fields.NumField() {
+		if def, ok := fields.Type().Field(i).Tag.Lookup("default"); ok {
+			if err := set(fields.Field(i), def); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if path, ok, err := lookup("CONFIG_FILE"); err != nil {
+		return nil, err
+	} else if ok && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+	for i := range fields.NumField() {
+		name := fields.Type().Field(i).Tag.Get("env")
+		value, ok, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if err := set(fields.Field(i), value); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", name, err)
+		}
+	}
+	return cfg, cfg.validate(serve)
+}
+
+// validate reports every problem at once, so a deployment can be fixed in
+// one go. Settings only the server needs are checked when serve is set.
+func (c *Config) validate(serve bool) error {
+	var errs []error
+	fields := reflect.ValueOf(c).Elem()
+	for i := range fields.NumField() {
+		field := fields.Type().Field(i)
+		required := field.Tag.Get("required")
+		if (required == "true" || serve && required == "serve") && fields.Field(i).IsZero() {
+			errs = append(errs, fmt.Errorf("config: %s is required", field.Tag.Get("env")))
+		}
+	}
+	if serve && c.JWTSecret != "" && len(c.JWTSecret) < minSecretLength {
+		errs = append(errs, fmt.Errorf("config: JWT_SECRET must be at least %d characters", minSecretLength))
+	}
+	if c.HL7MLLPAddr != "" && c.HL7HospitalID == "" {
+		errs = append(errs, errors.New("config: HL7_HOSPITAL_ID is required with HL7_MLLP_ADDR"))
+	}
+	if _, err := strconv.ParseUint(c.Port, 10, 16); err != nil {
+		errs = append(errs, fmt.Errorf("config: PORT %q is not a port number", c.Port))
+	}
+	for _, timeout := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"READ_TIMEOUT", c.ReadTimeout}, {"WRITE_TIMEOUT", c.WriteTimeout},
+		{"IDLE_TIMEOUT", c.IdleTimeout}, {"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"DB_CONNECT_TIMEOUT", c.DBConnectTimeout},
+	} {
+		if timeout.d <= 0 {
+			errs = append(errs, fmt.Errorf("config: %s must be positive", timeout.name))
+		}
+	}
+	if !slices.Contains([]string{"none", "otlp", "console"}, c.OTelTracesExporter) {
+		errs = append(errs, fmt.Errorf("config: OTEL_TRACES_EXPORTER %q is not none, otlp or console", c.OTelTracesExporter))
+	}
+	if c.DBMaxOpenConns < 1 {
+		errs = append(errs, errors.New("config: DB_MAX_OPEN_CONNS must be at least 1"))
+	}
+	if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("config: DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS"))
+	}
+	return errors.Join(errs...)
+}
+
+// String lists the settings with secrets masked, for logging at startup.
+func (c Config) String() string {
+	var b strings.Builder
+	fields := reflect.ValueOf(c)
+	for i := range fields.NumField() {
+		field := fields.Type().Field(i)
+		value := fmt.Sprint(fields.Field(i).Interface())
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = "[REDACTED]"
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%s", field.Tag.Get("env"), value)
+	}
+	return b.String()
+}
+
+// GoString keeps secrets out of %#v as well.
+func (c Config) GoString() string { return "config.Config{" + c.String() + "}" }
+
+func set(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case slog.Level:
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(level))
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// readDotEnv reads KEY=VALUE lines from path, skipping blank lines and
+// comments. Values may be quoted. A missing file is not an error.
+func readDotEnv(path string) (map[string]string, error) {
+	values := map[string]string{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("config: %s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
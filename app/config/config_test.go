@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, []byte(content), 0o600)
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Load Success Defaults", func(t *testing.T) {
+		cfg, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret}), "missing.env", true)
+		assert.NoError(t, err)
+		assert.Equal(t, "8080", cfg.Port)
+		assert.Equal(t, "host=db", cfg.DBSource)
+		assert.Equal(t, 60*time.Second, cfg.WriteTimeout)
+		assert.Equal(t, 25, cfg.DBMaxOpenConns)
+		assert.Equal(t, 30*time.Minute, cfg.DBConnMaxLifetime)
+	})
+
+	t.Run("Load Success Durations", func(t *testing.T) {
+		cfg, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret,
+			"SHUTDOWN_TIMEOUT": "45s", "DB_MAX_OPEN_CONNS": "50", "DB_MAX_IDLE_CONNS": "10"}), "missing.env", true)
+		assert.NoError(t, err)
+		assert.Equal(t, 45*time.Second, cfg.ShutdownTimeout)
+		assert.Equal(t, 50, cfg.DBMaxOpenConns)
+		assert.Equal(t, 10, cfg.DBMaxIdleConns)
+	})
+
+	t.Run("Load Success Log Level", func(t *testing.T) {
+		cfg, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "LOG_LEVEL": "debug"}), "missing.env", true)
+		assert.NoError(t, err)
+		assert.Equal(t, slog.LevelDebug, cfg.LogLevel)
+
+		_, err = load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "LOG_LEVEL": "verbose"}), "missing.env", true)
+		assert.ErrorContains(t, err, "LOG_LEVEL")
+	})
+
+	t.Run("Load Fail Case Unknown Trace Exporter", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "OTEL_TRACES_EXPORTER": "jaeger"}), "missing.env", true)
+		assert.ErrorContains(t, err, "OTEL_TRACES_EXPORTER")
+	})
+
+	t.Run("Load Fail Case Bad Duration", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "READ_TIMEOUT": "15"}), "missing.env", true)
+		assert.ErrorContains(t, err, "READ_TIMEOUT")
+	})
+
+	t.Run("Load Fail Case Bad Pool", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret,
+			"DB_MAX_OPEN_CONNS": "5", "DB_MAX_IDLE_CONNS": "10", "IDLE_TIMEOUT": "0s"}), "missing.env", true)
+		assert.ErrorContains(t, err, "DB_MAX_IDLE_CONNS")
+		assert.ErrorContains(t, err, "IDLE_TIMEOUT must be positive")
+	})
+
+	t.Run("Load Fail Case Missing Required", func(t *testing.T) {
+		_, err := load(env(map[string]string{}), "missing.env", true)
+		assert.ErrorContains(t, err, "DB_SOURCE is required")
+		assert.ErrorContains(t, err, "JWT_SECRET is required")
+	})
+
+	t.Run("Load Success Command Without Secret", func(t *testing.T) {
+		cfg, err := load(env(map[string]string{"DB_SOURCE": "host=db"}), "missing.env", false)
+		assert.NoError(t, err)
+		assert.Equal(t, "host=db", cfg.DBSource)
+
+		_, err = load(env(map[string]string{}), "missing.env", false)
+		assert.ErrorContains(t, err, "DB_SOURCE is required")
+		assert.NotContains(t, err.Error(), "JWT_SECRET")
+	})
+
+	t.Run("Load Fail Case Weak Secret", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": "secret"}), "missing.env", true)
+		assert.ErrorContains(t, err, "at least 32")
+	})
+
+	t.Run("Load Fail Case Invalid Port", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "PORT": "http"}), "missing.env", true)
+		assert.ErrorContains(t, err, "PORT")
+	})
+
+	t.Run("Load Fail Case HL7 Without Hospital", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "HL7_MLLP_ADDR": ":2575"}), "missing.env", true)
+		assert.ErrorContains(t, err, "HL7_HOSPITAL_ID")
+	})
+
+	t.Run("Load Success Precedence", func(t *testing.T) {
+		yamlFile := writeFile(t, "config.yaml", "port: \"9000\"\nicd10_csv: /yaml/icd10.csv\nlab_drop_dir: /yaml/drop\n")
+		dotenv := writeFile(t, ".env", fmt.Sprintf(`# local settings
+DB_SOURCE="host=localhost dbname=hospital"
+JWT_SECRET=%s
+LAB_DROP_DIR=/dotenv/drop # inline comment
+export ICD10_CSV='/dotenv/icd10.csv'
+`, testSecret))
+		cfg, err := load(env(map[string]string{"CONFIG_FILE": yamlFile, "ICD10_CSV": "/env/icd10.csv"}), dotenv, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "9000", cfg.Port)
+		assert.Equal(t, "host=localhost dbname=hospital", cfg.DBSource)
+		assert.Equal(t, "/dotenv/drop", cfg.LabDropDir)
+		assert.Equal(t, "/env/icd10.csv", cfg.ICD10CSV)
+	})
+
+	t.Run("Load Success File Secret", func(t *testing.T) {
+		secret := writeFile(t, "jwt_secret", testSecret+"\n")
+		cfg, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET_FILE": secret}), "missing.env", true)
+		assert.NoError(t, err)
+		assert.Equal(t, testSecret, cfg.JWTSecret)
+	})
+
+	t.Run("Load Fail Case Secret Set Twice", func(t *testing.T) {
+		secret := writeFile(t, "jwt_secret", testSecret)
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET": testSecret, "JWT_SECRET_FILE": secret}), "missing.env", true)
+		assert.ErrorContains(t, err, "both JWT_SECRET and JWT_SECRET_FILE")
+	})
+
+	t.Run("Load Fail Case Unreadable Secret File", func(t *testing.T) {
+		_, err := load(env(map[string]string{"DB_SOURCE": "host=db", "JWT_SECRET_FILE": "/no/such/file"}), "missing.env", true)
+		assert.ErrorContains(t, err, "JWT_SECRET_FILE")
+	})
+
+	t.Run("Load Fail Case Bad Dotenv Line", func(t *testing.T) {
+		dotenv := writeFile(t, ".env", "JWT_SECRET\n")
+		_, err := load(env(map[string]string{}), dotenv, true)
+		assert.ErrorContains(t, err, ".env:1")
+	})
+}
+
+func TestString(t *testing.T) {
+	cfg := Config{Port: "8080", DBSource: "postgres://admin:hunter2@db/hospital", JWTSecret: testSecret, LabDropDir: "/drop"}
+	for _, s := range []string{cfg.String(), fmt.Sprint(cfg), fmt.Sprintf("%+v", cfg), fmt.Sprintf("%#v", cfg), fmt.Sprint(&cfg)} {
+		assert.NotContains(t, s, "hunter2")
+		assert.NotContains(t, s, testSecret)
+	}
+	assert.Contains(t, cfg.String(), "LAB_DROP_DIR=/drop")
+	assert.Contains(t, cfg.String(), "JWT_SECRET=[REDACTED]")
+	assert.True(t, strings.Contains(cfg.String(), "DEID_KEY= "), "unset secrets show as empty")
+}
@@ -0,0 +1,72 @@
+package coverage
+
+import (
+	"context"
+	"time"
+
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+// Result is a payer's answer to an eligibility check.
+type Result struct {
+	Status       string
+	Note         string
+	MainHospital string // set when the payer reports a different main hospital
+}
+
+// EligibilityChecker asks a payer whether a patient may use a coverage.
+// Implementations wrap the NHSO, SSO, Comptroller General or insurer
+// services; an error means the payer could not be asked, not that the
+// patient is ineligible.
+type EligibilityChecker interface {
+	Check(ctx context.Context, patient models.Patient, coverage models.Coverage) (Result, error)
+}
+
+// Checker is the checker CheckEligibility uses. It is a MockChecker until a
+// payer integration is configured in main.
+var Checker EligibilityChecker = MockChecker{}
+
+// MockChecker answers locally, for development and tests. Results keyed by
+// national ID are returned as given; any other coverage is eligible exactly
+// when it is within its validity dates.
+type MockChecker struct {
+	Results map[string]Result
+}
+
+func (m MockChecker) Check(ctx context.Context, patient models.Patient, coverage models.Coverage) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if result, ok := m.Results[patient.NationalID]; ok {
+		return result, nil
+	}
+	if !coverage.ValidAt(time.Now()) {
+		return Result{Status: models.EligibilityIneligible, Note: "coverage is outside its validity dates"}, nil
+	}
+	return Result{Status: models.EligibilityEligible}, nil
+}
+
+// ByPriority is a preload scope listing a patient's coverages in the order
+// they are tried.
+func ByPriority(db *gorm.DB) *gorm.DB {
+	return db.Order("priority").Order("id")
+}
+
+// Active returns the coverage a patient's bills go to at time at: the first
+// by priority that is valid then and not known to be ineligible. It returns
+// nil when the patient pays for themselves.
+func Active(db *gorm.DB, patientID, hospitalID string, at time.Time) (*models.Coverage, error) {
+	var coverages []models.Coverage
+	err := ByPriority(db.Where("patient_id = ? AND hospital_id = ? AND eligibility_status <> ?",
+		patientID, hospitalID, models.EligibilityIneligible)).Find(&coverages).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range coverages {
+		if coverages[i].ValidAt(at) {
+			return &coverages[i], nil
+		}
+	}
+	return nil, nil
+}
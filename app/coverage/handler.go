@@ -0,0 +1,254 @@
+package coverage
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the coverage endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+var schemes = []string{models.SchemeUCS, models.SchemeSSS, models.SchemeCSMBS, models.SchemePrivate}
+
+func (h *Handler) AddCoverage(c *gin.Context) {
+	var input struct {
+		PatientID    string `json:"patient_id" binding:"required"`
+		Scheme       string `json:"scheme" binding:"required"`
+		InsurerName  string `json:"insurer_name"`
+		PolicyNumber string `json:"policy_number"`
+		MainHospital string `json:"main_hospital"`
+		ValidFrom    string `json:"valid_from" binding:"required"`
+		ValidTo      string `json:"valid_to"`
+		Priority     int    `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	validFrom, err := time.Parse("2006-01-02", input.ValidFrom)
+	if err != nil {
+		apierror.Respond(c, apierror.ErrInvalidDate)
+		return
+	}
+	validTo, ok := parseOptionalDate(c, input.ValidTo)
+	if !ok {
+		return
+	}
+	if input.Priority == 0 {
+		input.Priority = 1
+	}
+
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.PatientID, staffHospital).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+
+	username, _ := c.Get("username")
+	recordedBy, _ := username.(string)
+	coverage := models.Coverage{
+		PatientID:         patient.ID,
+		HospitalID:        staffHospital,
+		Scheme:            strings.ToUpper(input.Scheme),
+		InsurerName:       strings.TrimSpace(input.InsurerName),
+		PolicyNumber:      strings.TrimSpace(input.PolicyNumber),
+		MainHospital:      input.MainHospital,
+		ValidFrom:         validFrom,
+		ValidTo:           validTo,
+		Priority:          input.Priority,
+		EligibilityStatus: models.EligibilityUnknown,
+		RecordedBy:        recordedBy,
+	}
+	if invalid := validate(coverage); invalid != nil {
+		apierror.Respond(c, invalid)
+		return
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&coverage).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกสิทธิการรักษาได้", "Could not save the coverage").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, coverage)
+}
+
+// UpdateCoverage edits a coverage. Changing the policy or its dates makes the
+// last eligibility answer stale, so the status goes back to unknown.
+func (h *Handler) UpdateCoverage(c *gin.Context) {
+	var input struct {
+		InsurerName  *string `json:"insurer_name"`
+		PolicyNumber *string `json:"policy_number"`
+		MainHospital *string `json:"main_hospital"`
+		ValidFrom    *string `json:"valid_from"`
+		ValidTo      *string `json:"valid_to"`
+		Priority     *int    `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrInvalidInput)
+		return
+	}
+	coverage, ok := h.findCoverage(c)
+	if !ok {
+		return
+	}
+
+	stale := false
+	if input.InsurerName != nil {
+		coverage.InsurerName = strings.TrimSpace(*input.InsurerName)
+		stale = true
+	}
+	if input.PolicyNumber != nil {
+		coverage.PolicyNumber = strings.TrimSpace(*input.PolicyNumber)
+		stale = true
+	}
+	if input.MainHospital != nil {
+		coverage.MainHospital = *input.MainHospital
+	}
+	if input.ValidFrom != nil {
+		validFrom, err := time.Parse("2006-01-02", *input.ValidFrom)
+		if err != nil {
+			apierror.Respond(c, apierror.ErrInvalidDate)
+			return
+		}
+		coverage.ValidFrom = validFrom
+		stale = true
+	}
+	if input.ValidTo != nil {
+		validTo, ok := parseOptionalDate(c, *input.ValidTo)
+		if !ok {
+			return
+		}
+		coverage.ValidTo = validTo
+		stale = true
+	}
+	if input.Priority != nil {
+		coverage.Priority = *input.Priority
+	}
+	if invalid := validate(coverage); invalid != nil {
+		apierror.Respond(c, invalid)
+		return
+	}
+	if stale {
+		coverage.EligibilityStatus = models.EligibilityUnknown
+		coverage.EligibilityNote = ""
+		coverage.EligibilityCheckedAt = nil
+	}
+
+	if err := h.DB.WithContext(c.Request.Context()).Save(&coverage).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถแก้ไขสิทธิการรักษาได้", "Could not update the coverage").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, coverage)
+}
+
+func (h *Handler) GetCoverages(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var coverages []models.Coverage
+	if err := ByPriority(h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ?", c.Param("id"), staffHospital)).
+		Find(&coverages).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลสิทธิการรักษาได้", "Could not load coverages").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, coverages)
+}
+
+// CheckEligibility asks the payer, through Checker, whether the coverage can
+// be used today and stores the answer on the coverage.
+func (h *Handler) CheckEligibility(c *gin.Context) {
+	coverage, ok := h.findCoverage(c)
+	if !ok {
+		return
+	}
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", coverage.PatientID, coverage.HospitalID).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+
+	result, err := Checker.Check(c.Request.Context(), patient, coverage)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.UpstreamFailed, "ไม่สามารถตรวจสอบสิทธิกับหน่วยงานผู้จ่ายได้ กรุณาลองใหม่อีกครั้ง", "Could not verify eligibility with the payer, please try again"))
+		return
+	}
+
+	now := time.Now()
+	coverage.EligibilityStatus = result.Status
+	coverage.EligibilityNote = result.Note
+	coverage.EligibilityCheckedAt = &now
+	if result.MainHospital != "" {
+		coverage.MainHospital = result.MainHospital
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Save(&coverage).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกผลการตรวจสอบสิทธิได้", "Could not save the eligibility result").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, coverage)
+}
+
+func (h *Handler) findCoverage(c *gin.Context) (models.Coverage, bool) {
+	var coverage models.Coverage
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return coverage, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&coverage).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบสิทธิการรักษาที่ระบุ", "Coverage not found"))
+		return coverage, false
+	}
+	return coverage, true
+}
+
+// parseOptionalDate parses a YYYY-MM-DD date, where an empty string means
+// no date (open-ended validity).
+func parseOptionalDate(c *gin.Context, s string) (*time.Time, bool) {
+	if s == "" {
+		return nil, true
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		apierror.Respond(c, apierror.ErrInvalidDate)
+		return nil, false
+	}
+	return &t, true
+}
+
+func validate(coverage models.Coverage) *apierror.Error {
+	switch {
+	case !slices.Contains(schemes, coverage.Scheme):
+		return apierror.Invalid("scheme", "สิทธิการรักษาต้องเป็น UCS, SSS, CSMBS หรือ PRIVATE", "Scheme must be UCS, SSS, CSMBS or PRIVATE")
+	case coverage.Scheme == models.SchemePrivate && (coverage.InsurerName == "" || coverage.PolicyNumber == ""):
+		return apierror.Invalid("policy_number", "ประกันเอกชนต้องระบุชื่อบริษัทประกันและเลขกรมธรรม์", "Private insurance needs an insurer name and policy number")
+	case coverage.ValidTo != nil && coverage.ValidTo.Before(coverage.ValidFrom):
+		return apierror.Invalid("valid_to", "วันสิ้นสุดสิทธิต้องไม่ก่อนวันเริ่มสิทธิ", "valid_to must not be before valid_from")
+	case coverage.Priority < 1:
+		return apierror.Invalid("priority", "ลำดับการใช้สิทธิต้องมากกว่า 0", "Priority must be greater than 0")
+	}
+	return nil
+}
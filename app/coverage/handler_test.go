@@ -0,0 +1,172 @@
+package coverage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Coverage{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", NationalID: "1100700000001"})
+	db.Create(&models.Patient{ID: "002", PatientHN: "HN002", HospitalID: "1", NationalID: "1100700000002"})
+	return db
+}
+
+func generateTestToken(HospitalID string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/coverage/add", h.AddCoverage)
+	r.PUT("/coverage/:id", h.UpdateCoverage)
+	r.GET("/coverage/patient/:id", h.GetCoverages)
+	r.POST("/coverage/check/:id", h.CheckEligibility)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type failingChecker struct{}
+
+func (failingChecker) Check(context.Context, models.Patient, models.Coverage) (Result, error) {
+	return Result{}, errors.New("payer service unavailable")
+}
+
+func TestAddCoverage(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Add Coverage Success", func(t *testing.T) {
+		w := send(r, "POST", "/coverage/add", map[string]interface{}{
+			"patient_id": "001", "scheme": "sss", "main_hospital": "BKK Hospital", "valid_from": "2024-01-01",
+		}, "1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"scheme":"SSS"`)
+		assert.Contains(t, w.Body.String(), `"eligibility_status":"unknown"`)
+	})
+
+	t.Run("Add Coverage Fail Case Private Without Policy", func(t *testing.T) {
+		w := send(r, "POST", "/coverage/add", map[string]interface{}{
+			"patient_id": "001", "scheme": "PRIVATE", "insurer_name": "Thai Life", "valid_from": "2024-01-01",
+		}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Add Coverage Fail Case Ends Before Start", func(t *testing.T) {
+		w := send(r, "POST", "/coverage/add", map[string]interface{}{
+			"patient_id": "001", "scheme": "UCS", "valid_from": "2024-01-01", "valid_to": "2023-12-31",
+		}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Add Coverage Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", "/coverage/add", map[string]interface{}{
+			"patient_id": "001", "scheme": "UCS", "valid_from": "2024-01-01",
+		}, "2")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestCheckEligibility(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	defer func(previous EligibilityChecker) { Checker = previous }(Checker)
+	Checker = MockChecker{Results: map[string]Result{
+		"1100700000002": {Status: models.EligibilityIneligible, Note: "registered at another hospital", MainHospital: "Bangna Medical"},
+	}}
+
+	expired := time.Now().AddDate(0, 0, -1)
+	current := models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "UCS", ValidFrom: time.Now().AddDate(-1, 0, 0),
+		Priority: 1, EligibilityStatus: "unknown"}
+	lapsed := models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "CSMBS", ValidFrom: time.Now().AddDate(-1, 0, 0),
+		ValidTo: &expired, Priority: 2, EligibilityStatus: "unknown"}
+	moved := models.Coverage{PatientID: "002", HospitalID: "1", Scheme: "UCS", ValidFrom: time.Now().AddDate(-1, 0, 0),
+		Priority: 1, EligibilityStatus: "unknown"}
+	db.Create(&current)
+	db.Create(&lapsed)
+	db.Create(&moved)
+	path := func(c models.Coverage) string { return "/coverage/check/" + fmt.Sprint(c.ID) }
+
+	t.Run("Check Eligible", func(t *testing.T) {
+		w := send(r, "POST", path(current), nil, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"eligibility_status":"eligible"`)
+	})
+
+	t.Run("Check Ineligible When Lapsed", func(t *testing.T) {
+		w := send(r, "POST", path(lapsed), nil, "1")
+		assert.Contains(t, w.Body.String(), `"eligibility_status":"ineligible"`)
+	})
+
+	t.Run("Check Uses Payer Answer", func(t *testing.T) {
+		w := send(r, "POST", path(moved), nil, "1")
+		assert.Contains(t, w.Body.String(), `"eligibility_status":"ineligible"`)
+		assert.Contains(t, w.Body.String(), `"main_hospital":"Bangna Medical"`)
+	})
+
+	t.Run("Check Fail Case Payer Unavailable", func(t *testing.T) {
+		Checker = failingChecker{}
+		w := send(r, "POST", path(current), nil, "1")
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+
+		var stored models.Coverage
+		db.First(&stored, current.ID)
+		assert.Equal(t, models.EligibilityEligible, stored.EligibilityStatus)
+	})
+
+	t.Run("Update Resets Eligibility", func(t *testing.T) {
+		w := send(r, "PUT", "/coverage/"+fmt.Sprint(current.ID), map[string]interface{}{"policy_number": "X-1"}, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"eligibility_status":"unknown"`)
+	})
+
+	t.Run("Active Skips Lapsed And Ineligible", func(t *testing.T) {
+		active, err := Active(db, "001", "1", time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, current.ID, active.ID)
+
+		active, err = Active(db, "002", "1", time.Now())
+		assert.NoError(t, err)
+		assert.Nil(t, active)
+	})
+}
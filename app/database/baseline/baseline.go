@@ -0,0 +1,519 @@
+// Package baseline is the schema of migration 1, frozen as it stood when
+// versioned migrations replaced AutoMigrate at startup. The structs copy
+// the models of that time with only their column tags, so the baseline
+// creates the same tables, indexes and foreign keys however the models
+// change later. Never edit them: a schema change is a new migration.
+package baseline
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Tables lists the baseline tables in the order they are created.
+var Tables = []interface{}{
+	&Hospital{}, &Patient{}, &Staff{},
+	&Encounter{}, &VitalSign{}, &Triage{},
+	&ICD10Code{}, &Diagnosis{}, &Allergy{},
+	&Drug{}, &DrugInteraction{}, &Prescription{}, &PrescriptionItem{},
+	&Store{}, &StockLot{}, &StockMovement{},
+	&LabTest{}, &LabOrder{}, &LabOrderItem{}, &Specimen{}, &LabResult{},
+	&ClinicalNote{},
+	&ChargeItem{}, &PriceListEntry{}, &Charge{}, &Invoice{}, &Payment{},
+	&Coverage{}, &Referral{}, &AuditLog{}, &HL7Message{},
+	&Consent{}, &DataSubjectRequest{},
+}
+
+type Hospital struct {
+	Name      string `gorm:"size:255;not null;unique"`
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Address   string
+
+	Staffs   []Staff   `gorm:"foreignKey:HospitalID"`
+	Patients []Patient `gorm:"foreignKey:HospitalID"`
+}
+
+type Patient struct {
+	ID        string `gorm:"primaryKey"`
+	PatientHN string
+
+	HospitalID string   `gorm:"not null"`
+	Hospital   Hospital `gorm:"foreignKey:HospitalID"`
+
+	FirstNameTH  string `gorm:"size:100"`
+	MiddleNameTH string `gorm:"size:100"`
+	LastNameTH   string `gorm:"size:100"`
+
+	FirstNameEN  string `gorm:"size:100"`
+	MiddleNameEN string `gorm:"size:100"`
+	LastNameEN   string `gorm:"size:100"`
+
+	DateOfBirth time.Time
+	NationalID  string `gorm:"size:13;index"`
+	PassportID  string `gorm:"size:20;index"`
+
+	PhoneNumber string `gorm:"size:20"`
+	Email       string `gorm:"size:100"`
+	Gender      string `gorm:"size:1"`
+
+	Allergies []Allergy  `gorm:"foreignKey:PatientID"`
+	Coverages []Coverage `gorm:"foreignKey:PatientID"`
+}
+
+type Staff struct {
+	ID         uint     `gorm:"primaryKey"`
+	Username   string   `gorm:"unique;not null"`
+	Password   string   `gorm:"not null"`
+	HospitalID string   `gorm:"not null"`
+	Hospital   Hospital `gorm:"foreignKey:HospitalID"`
+	FullName   string
+	Role       string
+	CreatedAt  time.Time
+}
+
+type Encounter struct {
+	ID         uint   `gorm:"primaryKey"`
+	PatientID  string `gorm:"not null;index"`
+	HospitalID string `gorm:"not null;index"`
+	Type       string `gorm:"size:3;not null"`
+
+	StartedAt time.Time
+	EndedAt   *time.Time
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+type VitalSign struct {
+	ID          uint   `gorm:"primaryKey"`
+	EncounterID uint   `gorm:"not null;index"`
+	PatientID   string `gorm:"not null;index"`
+	HospitalID  string `gorm:"not null;index"`
+
+	Systolic        *int
+	Diastolic       *int
+	Pulse           *int
+	Temperature     *float64
+	SpO2            *int
+	RespiratoryRate *int
+	Weight          *float64
+	Height          *float64
+	BMI             *float64
+	PainScore       *int
+
+	Flags      []string  `gorm:"serializer:json"`
+	MeasuredAt time.Time `gorm:"index"`
+	RecordedBy string
+	CreatedAt  time.Time
+}
+
+type Triage struct {
+	ID             uint   `gorm:"primaryKey"`
+	EncounterID    uint   `gorm:"not null;index"`
+	PatientID      string `gorm:"not null;index"`
+	HospitalID     string `gorm:"not null;index"`
+	System         string `gorm:"size:4;not null"`
+	Level          int    `gorm:"not null"`
+	Label          string
+	ChiefComplaint string
+	AssessedBy     string
+	CreatedAt      time.Time
+}
+
+type ICD10Code struct {
+	Code          string `gorm:"primaryKey;size:10"`
+	DescriptionEN string `gorm:"size:500"`
+	DescriptionTH string `gorm:"size:500"`
+}
+
+type Diagnosis struct {
+	ID          uint   `gorm:"primaryKey"`
+	EncounterID uint   `gorm:"not null;index"`
+	PatientID   string `gorm:"not null;index"`
+	HospitalID  string `gorm:"not null;index"`
+
+	Code  string    `gorm:"size:10;not null"`
+	ICD10 ICD10Code `gorm:"foreignKey:Code;references:Code"`
+	Type  string    `gorm:"size:10;not null"`
+	Note  string
+
+	DiagnosedBy string
+	CreatedAt   time.Time
+}
+
+type Allergy struct {
+	ID         uint   `gorm:"primaryKey"`
+	PatientID  string `gorm:"not null;index"`
+	HospitalID string `gorm:"not null;index"`
+
+	Category           string `gorm:"size:20;not null"`
+	Substance          string `gorm:"size:255;not null"`
+	Reaction           string
+	Severity           string `gorm:"size:20;not null"`
+	VerificationStatus string `gorm:"size:20;not null"`
+	Source             string `gorm:"size:20"`
+
+	RecordedBy string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type Drug struct {
+	ID          uint   `gorm:"primaryKey"`
+	Code        string `gorm:"size:50;not null;unique"`
+	Name        string `gorm:"size:255;not null"`
+	GenericName string `gorm:"size:255;index"`
+	Form        string `gorm:"size:50"`
+	Strength    string `gorm:"size:50"`
+	Unit        string `gorm:"size:20"`
+	Active      bool   `gorm:"default:true"`
+}
+
+type DrugInteraction struct {
+	ID          uint   `gorm:"primaryKey"`
+	DrugA       string `gorm:"size:255;not null;uniqueIndex:idx_interaction_pair"`
+	DrugB       string `gorm:"size:255;not null;uniqueIndex:idx_interaction_pair"`
+	Severity    string `gorm:"size:20;not null"`
+	Description string
+}
+
+type Prescription struct {
+	ID          uint   `gorm:"primaryKey"`
+	PatientID   string `gorm:"not null;index"`
+	EncounterID uint   `gorm:"not null;index"`
+	HospitalID  string `gorm:"not null;index"`
+
+	Status       string `gorm:"size:20;not null;index"`
+	Items        []PrescriptionItem
+	PrescribedBy string
+	SignedBy     string
+	SignedAt     *time.Time
+	CancelReason string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type PrescriptionItem struct {
+	ID             uint `gorm:"primaryKey"`
+	PrescriptionID uint `gorm:"not null;index"`
+	DrugID         uint `gorm:"not null"`
+	Drug           Drug
+	Dose           string `gorm:"size:50;not null"`
+	DoseUnit       string `gorm:"size:20;not null"`
+	Route          string `gorm:"size:20;not null"`
+	Frequency      string `gorm:"size:20;not null"`
+	DurationDays   int
+	Quantity       int `gorm:"not null"`
+	Instruction    string
+}
+
+type Store struct {
+	ID         uint   `gorm:"primaryKey"`
+	HospitalID string `gorm:"not null;index"`
+	Name       string `gorm:"size:255;not null"`
+	CreatedAt  time.Time
+}
+
+type StockLot struct {
+	ID         uint   `gorm:"primaryKey"`
+	HospitalID string `gorm:"not null;index"`
+	StoreID    uint   `gorm:"not null;uniqueIndex:idx_store_drug_lot"`
+	DrugID     uint   `gorm:"not null;uniqueIndex:idx_store_drug_lot"`
+	Drug       Drug
+	LotNumber  string    `gorm:"size:50;not null;uniqueIndex:idx_store_drug_lot"`
+	ExpiryDate time.Time `gorm:"not null;index"`
+	Quantity   int       `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type StockMovement struct {
+	ID             uint   `gorm:"primaryKey"`
+	HospitalID     string `gorm:"not null;index"`
+	StoreID        uint   `gorm:"not null;index"`
+	LotID          uint   `gorm:"not null;index"`
+	DrugID         uint   `gorm:"not null"`
+	Type           string `gorm:"size:20;not null"`
+	Quantity       int    `gorm:"not null"`
+	PrescriptionID *uint  `gorm:"index"`
+	Note           string
+	PerformedBy    string
+	CreatedAt      time.Time
+}
+
+type LabTest struct {
+	ID           uint   `gorm:"primaryKey"`
+	Code         string `gorm:"size:20;not null;unique"`
+	Name         string `gorm:"size:255;not null"`
+	SpecimenType string `gorm:"size:20;not null"`
+	Unit         string `gorm:"size:20"`
+	RefLow       *float64
+	RefHigh      *float64
+	CriticalLow  *float64
+	CriticalHigh *float64
+	RefText      string `gorm:"size:50"`
+	Active       bool   `gorm:"default:true"`
+}
+
+type LabOrder struct {
+	ID          uint   `gorm:"primaryKey"`
+	PatientID   string `gorm:"not null;index"`
+	EncounterID uint   `gorm:"not null;index"`
+	HospitalID  string `gorm:"not null;index"`
+
+	Status    string `gorm:"size:20;not null"`
+	Items     []LabOrderItem
+	Specimens []Specimen
+	Results   []LabResult
+	OrderedBy string
+	CreatedAt time.Time
+}
+
+type LabOrderItem struct {
+	ID         uint   `gorm:"primaryKey"`
+	LabOrderID uint   `gorm:"not null;index"`
+	TestCode   string `gorm:"size:20;not null"`
+	SpecimenID uint   `gorm:"not null"`
+}
+
+type Specimen struct {
+	ID           uint   `gorm:"primaryKey"`
+	LabOrderID   uint   `gorm:"not null;index"`
+	HospitalID   string `gorm:"not null;index"`
+	Barcode      string `gorm:"size:20;not null;unique"`
+	Type         string `gorm:"size:20;not null"`
+	Status       string `gorm:"size:20;not null"`
+	CollectedAt  *time.Time
+	CollectedBy  string
+	ReceivedAt   *time.Time
+	RejectReason string
+}
+
+type LabResult struct {
+	ID         uint   `gorm:"primaryKey"`
+	LabOrderID uint   `gorm:"not null;index"`
+	SpecimenID uint   `gorm:"not null;index"`
+	PatientID  string `gorm:"not null;index"`
+	HospitalID string `gorm:"not null;index"`
+
+	TestCode     string `gorm:"size:20;not null;index"`
+	Value        string `gorm:"size:100;not null"`
+	NumericValue *float64
+	Unit         string `gorm:"size:20"`
+	RefLow       *float64
+	RefHigh      *float64
+	RefText      string `gorm:"size:50"`
+	Flag         string `gorm:"size:2"`
+
+	Source     string `gorm:"size:20"`
+	ResultedBy string
+	ResultedAt time.Time `gorm:"index"`
+}
+
+type ClinicalNote struct {
+	ID          uint   `gorm:"primaryKey"`
+	EncounterID uint   `gorm:"not null;index"`
+	PatientID   string `gorm:"not null;index"`
+	HospitalID  string `gorm:"not null;index"`
+
+	AuthorID uint  `gorm:"not null;index"`
+	Author   Staff `gorm:"foreignKey:AuthorID"`
+
+	Subjective string `gorm:"type:text"`
+	Objective  string `gorm:"type:text"`
+	Assessment string `gorm:"type:text"`
+	Plan       string `gorm:"type:text"`
+
+	Status       string `gorm:"size:10;not null"`
+	SignedAt     *time.Time
+	AddendumToID *uint          `gorm:"index"`
+	Addenda      []ClinicalNote `gorm:"foreignKey:AddendumToID"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ChargeItem struct {
+	ID         uint            `gorm:"primaryKey"`
+	HospitalID string          `gorm:"size:50;not null;uniqueIndex:idx_charge_item_code"`
+	Code       string          `gorm:"size:50;not null;uniqueIndex:idx_charge_item_code"`
+	Name       string          `gorm:"size:255;not null"`
+	Category   string          `gorm:"size:20;not null"`
+	Price      decimal.Decimal `gorm:"type:numeric(12,2);not null"`
+	Active     bool            `gorm:"default:true"`
+}
+
+type PriceListEntry struct {
+	ID         uint            `gorm:"primaryKey"`
+	HospitalID string          `gorm:"size:50;not null;uniqueIndex:idx_price_list"`
+	Payer      string          `gorm:"size:50;not null;uniqueIndex:idx_price_list"`
+	ChargeCode string          `gorm:"size:50;not null;uniqueIndex:idx_price_list"`
+	Price      decimal.Decimal `gorm:"type:numeric(12,2);not null"`
+}
+
+type Charge struct {
+	ID          uint   `gorm:"primaryKey"`
+	HospitalID  string `gorm:"not null;index"`
+	EncounterID uint   `gorm:"not null;index"`
+	PatientID   string `gorm:"not null;index"`
+
+	ChargeCode  string `gorm:"size:50;not null;uniqueIndex:idx_charge_source"`
+	Description string
+	Quantity    int             `gorm:"not null"`
+	UnitPrice   decimal.Decimal `gorm:"type:numeric(12,2);not null"`
+	Amount      decimal.Decimal `gorm:"type:numeric(12,2);not null"`
+
+	Source    string `gorm:"size:30;not null;uniqueIndex:idx_charge_source"`
+	SourceID  *uint  `gorm:"uniqueIndex:idx_charge_source"`
+	InvoiceID *uint  `gorm:"index"`
+
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+type Invoice struct {
+	ID          uint   `gorm:"primaryKey"`
+	HospitalID  string `gorm:"not null;index"`
+	EncounterID uint   `gorm:"not null;index"`
+	PatientID   string `gorm:"not null;index"`
+
+	Number     string `gorm:"size:30;index"`
+	Payer      string `gorm:"size:50"`
+	CoverageID *uint
+	Total      decimal.Decimal `gorm:"type:numeric(12,2);not null"`
+	Status     string          `gorm:"size:10;not null"`
+	Charges    []Charge
+	Payments   []Payment
+
+	IssuedBy  string
+	CreatedAt time.Time
+}
+
+type Payment struct {
+	ID         uint            `gorm:"primaryKey"`
+	InvoiceID  uint            `gorm:"not null;index"`
+	HospitalID string          `gorm:"not null;index"`
+	PatientID  string          `gorm:"not null;index"`
+	Kind       string          `gorm:"size:10;not null"`
+	Amount     decimal.Decimal `gorm:"type:numeric(12,2);not null"`
+	Method     string          `gorm:"size:20"`
+	Reference  string
+	ReceivedBy string
+	CreatedAt  time.Time
+}
+
+type Coverage struct {
+	ID         uint   `gorm:"primaryKey"`
+	PatientID  string `gorm:"not null;index"`
+	HospitalID string `gorm:"not null;index"`
+
+	Scheme       string `gorm:"size:10;not null"`
+	InsurerName  string `gorm:"size:255"`
+	PolicyNumber string `gorm:"size:50"`
+	MainHospital string `gorm:"size:255"`
+	ValidFrom    time.Time
+	ValidTo      *time.Time
+	Priority     int `gorm:"default:1"`
+
+	EligibilityStatus    string `gorm:"size:20;not null"`
+	EligibilityNote      string
+	EligibilityCheckedAt *time.Time
+
+	RecordedBy string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type Referral struct {
+	ID             uint     `gorm:"primaryKey"`
+	PatientID      string   `gorm:"not null;index"`
+	FromHospitalID string   `gorm:"not null;index"`
+	ToHospitalID   string   `gorm:"not null;index"`
+	ToHospital     Hospital `gorm:"foreignKey:ToHospitalID"`
+	FromHospital   Hospital `gorm:"foreignKey:FromHospitalID"`
+
+	Reason          string   `gorm:"not null"`
+	ClinicalSummary string   `gorm:"type:text"`
+	Scopes          []string `gorm:"serializer:json"`
+	AccessDays      int      `gorm:"not null"`
+
+	Status          string `gorm:"size:20;not null;index"`
+	RequestedBy     string
+	RespondedBy     string
+	RespondedAt     *time.Time
+	ResponseNote    string
+	AccessExpiresAt *time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type AuditLog struct {
+	ID         uint   `gorm:"primaryKey"`
+	HospitalID string `gorm:"not null;index"`
+	Username   string
+	StaffID    uint
+
+	Action       string `gorm:"size:50;not null;index"`
+	ResourceType string `gorm:"size:50;not null"`
+	ResourceID   string `gorm:"size:50"`
+
+	PatientID         string `gorm:"index"`
+	PatientHospitalID string `gorm:"index"`
+	Detail            string
+
+	CreatedAt time.Time `gorm:"index"`
+}
+
+type HL7Message struct {
+	ID          uint   `gorm:"primaryKey"`
+	HospitalID  string `gorm:"not null;index"`
+	ControlID   string `gorm:"size:50;index"`
+	MessageType string `gorm:"size:20"`
+	Raw         string `gorm:"type:text;not null"`
+
+	Status      string `gorm:"size:20;not null;index"`
+	Error       string
+	Attempts    int
+	ReceivedAt  time.Time
+	ProcessedAt *time.Time
+}
+
+type Consent struct {
+	ID         uint   `gorm:"primaryKey"`
+	PatientID  string `gorm:"not null;index"`
+	HospitalID string `gorm:"not null;index"`
+	Purpose    string `gorm:"size:30;not null;index"`
+	Version    string `gorm:"size:20;not null"`
+
+	Channel    string `gorm:"size:20;not null"`
+	Note       string
+	GrantedAt  time.Time
+	RecordedBy string
+
+	WithdrawnAt  *time.Time
+	WithdrawnBy  string
+	WithdrawVia  string `gorm:"size:20"`
+	WithdrawNote string
+}
+
+type DataSubjectRequest struct {
+	ID         uint   `gorm:"primaryKey"`
+	PatientID  string `gorm:"not null;index"`
+	HospitalID string `gorm:"not null;index"`
+	Type       string `gorm:"size:20;not null"`
+	Note       string
+
+	Status      string `gorm:"size:20;not null;index"`
+	RequestedBy string
+	RequestedAt time.Time
+	DueAt       time.Time
+	HandledBy   string
+	HandledAt   *time.Time
+	Outcome     string
+}
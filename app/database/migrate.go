@@ -0,0 +1,217 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so
+// that replicas starting together apply each migration once.
+const migrationLockKey = 72150042
+
+// Migration is one numbered schema change. Up and Down each run in a
+// transaction together with the update of schema_migrations, so a failed
+// migration leaves neither a half-applied schema nor a wrong version.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SQL builds a migration's Up or Down from plain SQL statements.
+func SQL(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// MigrationState is a migration and when it was applied, if it was.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// MigrateUp applies every pending migration in order.
+func MigrateUp(db *gorm.DB) error {
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range Migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first.
+func MigrateDown(db *gorm.DB, steps int) error {
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		var done []SchemaMigration
+		if err := conn.Order("version DESC").Limit(steps).Find(&done).Error; err != nil {
+			return err
+		}
+		for _, record := range done {
+			i := slices.IndexFunc(Migrations, func(m Migration) bool { return m.Version == record.Version })
+			if i < 0 {
+				return fmt.Errorf("migration %d %s is applied but unknown to this build", record.Version, record.Name)
+			}
+			m := Migrations[i]
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("revert migration %d %s: %w", m.Version, m.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lists the known migrations and which are applied.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	if err := checkMigrations(); err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if applied, err = appliedVersions(db); err != nil {
+			return nil, err
+		}
+	}
+	states := make([]MigrationState, len(Migrations))
+	for i, m := range Migrations {
+		states[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+// MigrateCommand runs the migrate subcommand: up, down [steps] or status.
+func MigrateCommand(db *gorm.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up | down [steps] | status")
+	}
+	switch args[0] {
+	case "up":
+		if err := MigrateUp(db); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		if err := MigrateDown(db, steps); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range states {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
+
+// withMigrationLock runs fn on a single connection, holding the advisory
+// lock on Postgres, once the version table exists.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	if err := checkMigrations(); err != nil {
+		return err
+	}
+	return db.Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{})
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+		}
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func appliedVersions(db *gorm.DB) (map[int]time.Time, error) {
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time, len(records))
+	for _, r := range records {
+		applied[r.Version] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+// checkMigrations guards against a badly edited list: versions must be
+// positive and strictly increasing, and every migration reversible.
+func checkMigrations() error {
+	for i, m := range Migrations {
+		if m.Version < 1 || i > 0 && m.Version <= Migrations[i-1].Version {
+			return fmt.Errorf("migration %d %s is out of order", m.Version, m.Name)
+		}
+		if m.Up == nil || m.Down == nil {
+			return fmt.Errorf("migration %d %s needs both Up and Down", m.Version, m.Name)
+		}
+	}
+	return nil
+}
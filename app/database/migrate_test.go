@@ -0,0 +1,143 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"example.com/myapp/app/database/baseline"
+	"example.com/myapp/app/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	t.Run("Migrate Up Success", func(t *testing.T) {
+		db := openTestDB()
+		assert.NoError(t, MigrateUp(db))
+		assert.True(t, db.Migrator().HasTable(&models.Patient{}))
+		assert.True(t, db.Migrator().HasIndex(&models.Patient{}, "idx_patients_hospital_hn"))
+		assert.True(t, db.Migrator().HasColumn(&models.HL7Message{}, "patient_id"))
+		assert.True(t, db.Migrator().HasIndex(&models.Diagnosis{}, "idx_diagnoses_primary"))
+
+		// running again is a no-op
+		assert.NoError(t, MigrateUp(db))
+		var count int64
+		db.Model(&SchemaMigration{}).Count(&count)
+		assert.Equal(t, int64(len(Migrations)), count)
+
+		db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+		err := db.Create(&models.Patient{ID: "002", PatientHN: "HN001", HospitalID: "1"}).Error
+		assert.Error(t, err)
+		assert.NoError(t, db.Create(&models.Patient{ID: "003", PatientHN: "HN001", HospitalID: "2"}).Error)
+	})
+
+	t.Run("Migrate Up Success Adopts AutoMigrated Database", func(t *testing.T) {
+		db := openTestDB()
+		db.AutoMigrate(baseline.Tables...)
+		db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+		assert.NoError(t, MigrateUp(db))
+
+		var patient models.Patient
+		assert.NoError(t, db.First(&patient, "id = ?", "001").Error)
+	})
+
+	t.Run("Migrate Up Fail Case Rolls Back Failed Migration", func(t *testing.T) {
+		db := openTestDB()
+		db.AutoMigrate(baseline.Tables...)
+		db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+		db.Create(&models.Patient{ID: "002", PatientHN: "HN001", HospitalID: "1"})
+
+		err := MigrateUp(db)
+		assert.ErrorContains(t, err, "hospital 1 HN HN001 (2 patients)")
+		states, err := MigrationStatus(db)
+		assert.NoError(t, err)
+		assert.NotNil(t, states[0].AppliedAt)
+		assert.Nil(t, states[1].AppliedAt)
+	})
+
+	t.Run("Migrate Up Fail Case Two Primary Diagnoses", func(t *testing.T) {
+		db := openTestDB()
+		db.AutoMigrate(baseline.Tables...)
+		db.Create(&models.Diagnosis{EncounterID: 7, PatientID: "001", HospitalID: "1", Code: "I10", Type: "primary"})
+		db.Create(&models.Diagnosis{EncounterID: 7, PatientID: "001", HospitalID: "1", Code: "J18.9", Type: "primary"})
+		db.Create(&models.Diagnosis{EncounterID: 8, PatientID: "001", HospitalID: "1", Code: "I10", Type: "primary"})
+
+		err := MigrateUp(db)
+		assert.ErrorContains(t, err, "encounters 7")
+		states, _ := MigrationStatus(db)
+		assert.NotNil(t, states[2].AppliedAt)
+		assert.Nil(t, states[3].AppliedAt)
+	})
+
+	t.Run("Migrate Down Success", func(t *testing.T) {
+		db := openTestDB()
+		assert.NoError(t, MigrateUp(db))
+		assert.NoError(t, MigrateDown(db, 3))
+		assert.False(t, db.Migrator().HasIndex(&models.Diagnosis{}, "idx_diagnoses_primary"))
+		assert.False(t, db.Migrator().HasColumn(&models.HL7Message{}, "patient_id"))
+		assert.False(t, db.Migrator().HasIndex(&models.Patient{}, "idx_patients_hospital_hn"))
+		assert.True(t, db.Migrator().HasTable(&models.Patient{}))
+
+	})
+
+	t.Run("Migrate Down Fail Case Baseline", func(t *testing.T) {
+		db := openTestDB()
+		assert.NoError(t, MigrateUp(db))
+		db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+
+		assert.Error(t, MigrateDown(db, 5))
+		var patient models.Patient
+		assert.NoError(t, db.First(&patient, "id = ?", "001").Error)
+		states, _ := MigrationStatus(db)
+		assert.NotNil(t, states[0].AppliedAt)
+		assert.Nil(t, states[1].AppliedAt)
+	})
+
+	t.Run("Migrate Fail Case Out Of Order", func(t *testing.T) {
+		defer func(previous []Migration) { Migrations = previous }(Migrations)
+		noop := func(*gorm.DB) error { return nil }
+		Migrations = []Migration{{Version: 2, Name: "b", Up: noop, Down: noop}, {Version: 1, Name: "a", Up: noop, Down: noop}}
+		assert.Error(t, MigrateUp(openTestDB()))
+	})
+
+	t.Run("Migrate Down Fail Case Down Fails", func(t *testing.T) {
+		defer func(previous []Migration) { Migrations = previous }(Migrations)
+		noop := func(*gorm.DB) error { return nil }
+		Migrations = []Migration{{Version: 1, Name: "irreversible", Up: noop,
+			Down: func(*gorm.DB) error { return errors.New("cannot revert") }}}
+		db := openTestDB()
+		assert.NoError(t, MigrateUp(db))
+		assert.Error(t, MigrateDown(db, 1))
+		states, _ := MigrationStatus(db)
+		assert.NotNil(t, states[0].AppliedAt)
+	})
+
+	t.Run("Migrate Command Success", func(t *testing.T) {
+		db := openTestDB()
+		var out bytes.Buffer
+		assert.NoError(t, MigrateCommand(db, []string{"status"}, &out))
+		assert.Contains(t, out.String(), "pending")
+
+		out.Reset()
+		assert.NoError(t, MigrateCommand(db, []string{"up"}, &out))
+		assert.NotContains(t, out.String(), "pending")
+
+		out.Reset()
+		assert.NoError(t, MigrateCommand(db, []string{"down", "1"}, &out))
+		assert.Regexp(t, `4 +one primary diagnosis per encounter +pending`, out.String())
+	})
+
+	t.Run("Migrate Command Fail Case Bad Arguments", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.Error(t, MigrateCommand(openTestDB(), nil, &out))
+		assert.Error(t, MigrateCommand(openTestDB(), []string{"sideways"}, &out))
+		assert.Error(t, MigrateCommand(openTestDB(), []string{"down", "0"}, &out))
+	})
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"example.com/myapp/app/database/baseline"
+	"gorm.io/gorm"
+)
+
+// Migrations is the schema history, oldest first. Add a new migration at
+// the end for every schema change; never edit or renumber one that has
+// shipped.
+//
+// The baseline is the schema that AutoMigrate used to create at startup,
+// frozen in package baseline. Applying it to a database created that way
+// only fills in what is missing, so existing installations adopt
+// migrations without a dump and reload. Databases whose baseline was
+// applied from the live models may already have what a later migration
+// adds, so migrations up to 4 check first (Migrator().HasColumn and the
+// like) or use IF NOT EXISTS.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baseline.Tables...)
+		},
+		// reverting the baseline would drop every table and its data
+		Down: func(*gorm.DB) error {
+			return errors.New("the baseline cannot be reverted; restore a backup instead")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "unique patient HN per hospital",
+		Up: func(tx *gorm.DB) error {
+			// the baseline let a hospital reuse an HN; name the clashes
+			// instead of failing on the index
+			if err := duplicateHNs(tx); err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_hospital_hn ON patients (hospital_id, patient_hn)").Error
+		},
+		Down: SQL("DROP INDEX IF EXISTS idx_patients_hospital_hn"),
+	},
+	{
+		Version: 3,
+		Name:    "link HL7 messages to patients",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn("hl7_messages", "patient_id") {
+				if err := tx.Exec("ALTER TABLE hl7_messages ADD COLUMN patient_id text").Error; err != nil {
+					return err
+				}
+			}
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_hl7_messages_patient_id ON hl7_messages (patient_id)").Error
+		},
+		Down: SQL(
+			"DROP INDEX IF EXISTS idx_hl7_messages_patient_id",
+			"ALTER TABLE hl7_messages DROP COLUMN patient_id",
+		),
+	},
+	{
+		Version: 4,
+		Name:    "one primary diagnosis per encounter",
+		Up: func(tx *gorm.DB) error {
+			if err := duplicatePrimaryDiagnoses(tx); err != nil {
+				return err
+			}
+			return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_diagnoses_primary ON diagnoses (encounter_id) WHERE type = 'primary'").Error
+		},
+		Down: SQL("DROP INDEX IF EXISTS idx_diagnoses_primary"),
+	},
+}
+
+// maxListedDuplicates bounds how many clashes a pre-check names.
+const maxListedDuplicates = 20
+
+// duplicateHNs fails when patients of a hospital share an HN, listing them
+// so they can be merged or renumbered before the migration is run again.
+func duplicateHNs(tx *gorm.DB) error {
+	var duplicates []struct {
+		HospitalID string
+		PatientHN  string
+		Patients   int
+	}
+	err := tx.Table("patients").Select("hospital_id, patient_hn, COUNT(*) AS patients").
+		Group("hospital_id, patient_hn").Having("COUNT(*) > 1").
+		Order("hospital_id, patient_hn").Limit(maxListedDuplicates + 1).
+		Scan(&duplicates).Error
+	if err != nil || len(duplicates) == 0 {
+		return err
+	}
+	var list []string
+	for i, d := range duplicates {
+		if i == maxListedDuplicates {
+			list = append(list, "...")
+			break
+		}
+		list = append(list, fmt.Sprintf("hospital %s HN %s (%d patients)", d.HospitalID, d.PatientHN, d.Patients))
+	}
+	return fmt.Errorf("patients share an HN within a hospital; merge or renumber them, then migrate again: %s",
+		strings.Join(list, ", "))
+}
+
+// duplicatePrimaryDiagnoses fails when an encounter has more than one
+// primary diagnosis, listing the encounters so all but one can be made
+// secondary before the migration is run again.
+func duplicatePrimaryDiagnoses(tx *gorm.DB) error {
+	var encounters []uint
+	err := tx.Table("diagnoses").Where("type = ?", "primary").
+		Group("encounter_id").Having("COUNT(*) > 1").
+		Order("encounter_id").Limit(maxListedDuplicates+1).
+		Pluck("encounter_id", &encounters).Error
+	if err != nil || len(encounters) == 0 {
+		return err
+	}
+	var list []string
+	for i, id := range encounters {
+		if i == maxListedDuplicates {
+			list = append(list, "...")
+			break
+		}
+		list = append(list, fmt.Sprint(id))
+	}
+	return fmt.Errorf("encounters have more than one primary diagnosis; make all but one secondary, then migrate again: encounters %s",
+		strings.Join(list, ", "))
+}
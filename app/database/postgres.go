@@ -1,10 +1,11 @@
 package database
 
 import (
+	"context"
 	"log"
-	"os"
 	"time"
 
+	"example.com/myapp/app/logging"
 	"example.com/myapp/app/model"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -12,15 +13,78 @@ import (
 
 var DB *gorm.DB
 
-func InitDB() {
-	dsn := os.Getenv("DB_SOURCE")
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// Pool sizes the connection pool.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// slowQueryThreshold is the duration above which a statement is logged
+// as slow.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// Backoff between connection attempts at startup.
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// Connect opens the database at dsn with the given pool settings. Postgres
+// may still be starting, so a failed attempt is retried with backoff until
+// ctx is done.
+func Connect(ctx context.Context, dsn string, pool Pool) {
+	db, err := retry(ctx, initialBackoff, func() (*gorm.DB, error) {
+		return gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logging.NewGormLogger(slowQueryThreshold)})
+	})
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err)
+	}
+	DB = db
+	sqlDB, err := DB.DB()
 	if err != nil {
 		log.Fatal(err)
 	}
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+}
+
+// retry calls fn until it succeeds or ctx is done, doubling the wait
+// between attempts up to maxBackoff, and returns the last error.
+func retry[T any](ctx context.Context, wait time.Duration, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		v, err := fn()
+		if err == nil {
+			return v, nil
+		}
+		log.Printf("Database not ready (attempt %d), retrying in %s: %v", attempt, wait, err)
+		select {
+		case <-ctx.Done():
+			return v, err
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxBackoff)
+	}
+}
 
-	DB.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Staff{})
+// Close closes the connection pool, waiting for queries in progress.
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// InitDB connects, applies pending migrations and seeds an empty database.
+func InitDB(ctx context.Context, dsn string, pool Pool) {
+	Connect(ctx, dsn, pool)
+	if err := MigrateUp(DB); err != nil {
+		log.Fatal("Failed to migrate database: ", err)
+	}
 
 	seedHospital()
 	seedPatient()
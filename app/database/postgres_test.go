@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	t.Run("Retry Success After Failures", func(t *testing.T) {
+		attempts := 0
+		v, err := retry(context.Background(), time.Millisecond, func() (int, error) {
+			if attempts++; attempts < 3 {
+				return 0, errors.New("connection refused")
+			}
+			return 42, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 42, v)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Retry Fail Case Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := retry(ctx, time.Millisecond, func() (int, error) {
+			return 0, errors.New("connection refused")
+		})
+		assert.EqualError(t, err, "connection refused")
+	})
+}
@@ -0,0 +1,315 @@
+package deid
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"example.com/myapp/app/model"
+)
+
+// Actions for a direct identifier.
+const (
+	Keep = "keep"
+	Drop = "drop"
+	Hash = "hash"
+)
+
+// Ways to release the date of birth.
+const (
+	DOBKeep    = "keep"
+	DOBShift   = "shift"
+	DOBYear    = "year"
+	DOBAgeBand = "age_band"
+)
+
+// Identifiers are the patient fields that identify a person directly. Any
+// of them not named in a policy is dropped.
+var Identifiers = []string{
+	"patient_hn", "national_id", "passport_id",
+	"first_name_th", "middle_name_th", "last_name_th",
+	"first_name_en", "middle_name_en", "last_name_en",
+	"phone_number", "email",
+}
+
+var ErrWeakKey = errors.New("deid: pseudonym key must be at least 32 bytes")
+
+// Policy says how each kind of data is released. It is set once for the
+// server (see Load) so that what leaves the hospital is what the research
+// committee approved, not what a request asks for.
+type Policy struct {
+	Fields       map[string]string `json:"fields"`
+	DateOfBirth  string            `json:"date_of_birth"`
+	AgeBandYears int               `json:"age_band_years"`
+	MaxShiftDays int               `json:"max_shift_days"`
+}
+
+// DefaultPolicy drops every direct identifier, releases age in five-year
+// bands and shifts clinical dates by up to half a year.
+var DefaultPolicy = Policy{DateOfBirth: DOBAgeBand, AgeBandYears: 5, MaxShiftDays: 180}
+
+func (p Policy) validate() error {
+	for field, action := range p.Fields {
+		if !slices.Contains(Identifiers, field) {
+			return fmt.Errorf("deid: unknown field %q", field)
+		}
+		if action != Keep && action != Drop && action != Hash {
+			return fmt.Errorf("deid: field %s: action must be keep, drop or hash", field)
+		}
+	}
+	switch p.DateOfBirth {
+	case DOBKeep, DOBShift, DOBYear:
+	case DOBAgeBand:
+		if p.AgeBandYears < 1 {
+			return errors.New("deid: age_band_years must be positive")
+		}
+	default:
+		return errors.New("deid: date_of_birth must be keep, shift, year or age_band")
+	}
+	if p.MaxShiftDays < 0 {
+		return errors.New("deid: max_shift_days cannot be negative")
+	}
+	return nil
+}
+
+// Engine de-identifies records under a policy. Pseudonyms and date shifts
+// are keyed HMACs, so the same patient always gets the same pseudonym and
+// the same shift, and records link up across extracts made with one key.
+type Engine struct {
+	key    []byte
+	policy Policy
+}
+
+func New(key []byte, policy Policy) (*Engine, error) {
+	if len(key) < 32 {
+		return nil, ErrWeakKey
+	}
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return &Engine{key: key, policy: policy}, nil
+}
+
+// Default is the engine used for exports and research extracts, or nil if
+// no key is configured, in which case they are refused.
+var Default *Engine
+
+// Loaded reports whether Default has been set.
+func Loaded() bool { return Default != nil }
+
+// Load sets Default from the key and an optional JSON policy file. It is
+// meant to be called at startup with the DEID_KEY and DEID_POLICY_FILE
+// settings.
+func Load(key, policyFile string) error {
+	if key == "" {
+		return nil
+	}
+	policy := DefaultPolicy
+	if policyFile != "" {
+		data, err := os.ReadFile(policyFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return fmt.Errorf("deid: policy file: %w", err)
+		}
+	}
+	engine, err := New([]byte(key), policy)
+	if err != nil {
+		return err
+	}
+	Default = engine
+	return nil
+}
+
+func (e *Engine) mac(kind, value string) []byte {
+	h := hmac.New(sha256.New, e.key)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// Pseudonym replaces value, of the given kind, with a stable keyed token.
+func (e *Engine) Pseudonym(kind, value string) string {
+	return hex.EncodeToString(e.mac(kind, value)[:12])
+}
+
+// ShiftDays is the patient's date offset, between -MaxShiftDays and
+// MaxShiftDays.
+func (e *Engine) ShiftDays(patientID string) int {
+	if e.policy.MaxShiftDays == 0 {
+		return 0
+	}
+	n := binary.BigEndian.Uint32(e.mac("shift", patientID))
+	return int(n%uint32(2*e.policy.MaxShiftDays+1)) - e.policy.MaxShiftDays
+}
+
+// ShiftDate moves t by the patient's offset. Intervals between a patient's
+// dates are preserved.
+func (e *Engine) ShiftDate(patientID string, t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.AddDate(0, 0, e.ShiftDays(patientID))
+}
+
+func (e *Engine) shiftPtr(patientID string, t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	shifted := e.ShiftDate(patientID, *t)
+	return &shifted
+}
+
+// Patient is a de-identified patient. Identifiers holds the fields the
+// policy keeps or hashes, by field name.
+type Patient struct {
+	PatientKey  string            `json:"patient_key"`
+	HospitalID  string            `json:"hospital_id"`
+	Gender      string            `json:"gender"`
+	BirthDate   string            `json:"birth_date,omitempty"`
+	BirthYear   int               `json:"birth_year,omitempty"`
+	AgeBand     string            `json:"age_band,omitempty"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+}
+
+// Patient de-identifies p, working out age bands as of asOf.
+func (e *Engine) Patient(p models.Patient, asOf time.Time) Patient {
+	out := Patient{
+		PatientKey: e.Pseudonym("patient", p.ID),
+		HospitalID: p.HospitalID,
+		Gender:     p.Gender,
+	}
+	values := map[string]string{
+		"patient_hn": p.PatientHN, "national_id": p.NationalID, "passport_id": p.PassportID,
+		"first_name_th": p.FirstNameTH, "middle_name_th": p.MiddleNameTH, "last_name_th": p.LastNameTH,
+		"first_name_en": p.FirstNameEN, "middle_name_en": p.MiddleNameEN, "last_name_en": p.LastNameEN,
+		"phone_number": p.PhoneNumber, "email": p.Email,
+	}
+	for _, field := range Identifiers {
+		value := values[field]
+		if value == "" {
+			continue
+		}
+		switch e.policy.Fields[field] {
+		case Keep:
+		case Hash:
+			value = e.Pseudonym(field, value)
+		default:
+			continue
+		}
+		if out.Identifiers == nil {
+			out.Identifiers = map[string]string{}
+		}
+		out.Identifiers[field] = value
+	}
+
+	if !p.DateOfBirth.IsZero() {
+		switch e.policy.DateOfBirth {
+		case DOBKeep:
+			out.BirthDate = p.DateOfBirth.Format("2006-01-02")
+		case DOBShift:
+			out.BirthDate = e.ShiftDate(p.ID, p.DateOfBirth).Format("2006-01-02")
+		case DOBYear:
+			out.BirthYear = p.DateOfBirth.Year()
+		case DOBAgeBand:
+			out.AgeBand = ageBand(age(p.DateOfBirth, asOf), e.policy.AgeBandYears)
+		}
+	}
+	return out
+}
+
+// Encounter is a de-identified visit.
+type Encounter struct {
+	EncounterKey string     `json:"encounter_key"`
+	PatientKey   string     `json:"patient_key"`
+	Type         string     `json:"type"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+}
+
+func (e *Engine) Encounter(enc models.Encounter) Encounter {
+	return Encounter{
+		EncounterKey: e.Pseudonym("encounter", fmt.Sprint(enc.ID)),
+		PatientKey:   e.Pseudonym("patient", enc.PatientID),
+		Type:         enc.Type,
+		StartedAt:    e.ShiftDate(enc.PatientID, enc.StartedAt),
+		EndedAt:      e.shiftPtr(enc.PatientID, enc.EndedAt),
+	}
+}
+
+// Diagnosis is a de-identified diagnosis. The free-text note and the
+// diagnosing staff are left out.
+type Diagnosis struct {
+	EncounterKey string    `json:"encounter_key"`
+	PatientKey   string    `json:"patient_key"`
+	Code         string    `json:"code"`
+	Type         string    `json:"type"`
+	DiagnosedAt  time.Time `json:"diagnosed_at"`
+}
+
+func (e *Engine) Diagnosis(d models.Diagnosis) Diagnosis {
+	return Diagnosis{
+		EncounterKey: e.Pseudonym("encounter", fmt.Sprint(d.EncounterID)),
+		PatientKey:   e.Pseudonym("patient", d.PatientID),
+		Code:         d.Code,
+		Type:         d.Type,
+		DiagnosedAt:  e.ShiftDate(d.PatientID, d.CreatedAt),
+	}
+}
+
+// LabResult is a de-identified lab result, without who reported it.
+type LabResult struct {
+	PatientKey   string    `json:"patient_key"`
+	TestCode     string    `json:"test_code"`
+	Value        string    `json:"value"`
+	NumericValue *float64  `json:"numeric_value"`
+	Unit         string    `json:"unit"`
+	RefLow       *float64  `json:"ref_low"`
+	RefHigh      *float64  `json:"ref_high"`
+	Flag         string    `json:"flag"`
+	ResultedAt   time.Time `json:"resulted_at"`
+}
+
+func (e *Engine) LabResult(r models.LabResult) LabResult {
+	return LabResult{
+		PatientKey:   e.Pseudonym("patient", r.PatientID),
+		TestCode:     r.TestCode,
+		Value:        r.Value,
+		NumericValue: r.NumericValue,
+		Unit:         r.Unit,
+		RefLow:       r.RefLow,
+		RefHigh:      r.RefHigh,
+		Flag:         r.Flag,
+		ResultedAt:   e.ShiftDate(r.PatientID, r.ResultedAt),
+	}
+}
+
+func age(dob, asOf time.Time) int {
+	years := asOf.Year() - dob.Year()
+	if asOf.Month() < dob.Month() || asOf.Month() == dob.Month() && asOf.Day() < dob.Day() {
+		years--
+	}
+	return years
+}
+
+// ageBand groups an age into width-year bands, with everyone 90 and over in
+// one band as they are few enough to be identifiable.
+func ageBand(age, width int) string {
+	if age >= 90 {
+		return "90+"
+	}
+	if age < 0 {
+		age = 0
+	}
+	low := age / width * width
+	return fmt.Sprintf("%d-%d", low, low+width-1)
+}
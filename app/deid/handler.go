@@ -0,0 +1,140 @@
+package deid
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/pdpa"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the research extract endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+const extractBatchSize = 200
+
+// Record is one line of a research extract: a patient and their linked
+// records, all de-identified.
+type Record struct {
+	Patient    Patient     `json:"patient"`
+	Encounters []Encounter `json:"encounters"`
+	Diagnoses  []Diagnosis `json:"diagnoses"`
+	LabResults []LabResult `json:"lab_results"`
+}
+
+// GetResearchExtract streams a de-identified extract of the caller's
+// hospital as JSON Lines, one Record per patient, under the server's
+// policy. Only patients with research consent in force are included. Admin
+// only; every extract is audited before it starts.
+func (h *Handler) GetResearchExtract(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่ส่งออกข้อมูลเพื่อการวิจัยได้", "Only admins can export research data"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	engine := Default
+	if engine == nil {
+		apierror.Respond(c, apierror.New(apierror.Unavailable, "ยังไม่ได้ตั้งค่ากุญแจสำหรับทำข้อมูลนิรนาม (DEID_KEY)", "The de-identification key (DEID_KEY) is not configured"))
+		return
+	}
+	policy, _ := json.Marshal(engine.policy)
+	if err := audit.Log(h.DB.WithContext(c.Request.Context()), c, audit.Entry{
+		Action:            "research.extract",
+		ResourceType:      "patient",
+		PatientHospitalID: staffHospital,
+		Detail:            "policy=" + string(policy),
+	}); err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถส่งออกข้อมูลได้", "Could not export the data").Wrap(err))
+		return
+	}
+
+	c.Header("Content-Type", "application/jsonl")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="research-%s-%s.jsonl"`,
+		staffHospital, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+	// a large export outlasts WRITE_TIMEOUT; it ends when the data does
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	enc := json.NewEncoder(c.Writer)
+	asOf := time.Now()
+
+	var batch []models.Patient
+	err := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", staffHospital).Scopes(pdpa.WithConsent(models.ConsentResearch)).Order("id").
+		FindInBatches(&batch, extractBatchSize, func(tx *gorm.DB, _ int) error {
+			records, err := linkedRecords(h.DB.WithContext(c.Request.Context()), engine, staffHospital, batch, asOf)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		}).Error
+	if err != nil {
+		// the status is already sent; the client sees a truncated file
+		log.Println("Research extract failed:", err)
+	}
+}
+
+// linkedRecords de-identifies a batch of patients along with their visits,
+// diagnoses and lab results.
+func linkedRecords(db *gorm.DB, engine *Engine, hospitalID string, patients []models.Patient, asOf time.Time) ([]Record, error) {
+	ids := make([]string, len(patients))
+	for i, p := range patients {
+		ids[i] = p.ID
+	}
+	var encounters []models.Encounter
+	var diagnoses []models.Diagnosis
+	var results []models.LabResult
+	scope := db.Where("hospital_id = ? AND patient_id IN ?", hospitalID, ids).Session(&gorm.Session{})
+	if err := scope.Order("started_at").Find(&encounters).Error; err != nil {
+		return nil, err
+	}
+	if err := scope.Order("created_at").Find(&diagnoses).Error; err != nil {
+		return nil, err
+	}
+	if err := scope.Order("resulted_at").Find(&results).Error; err != nil {
+		return nil, err
+	}
+
+	byPatient := make(map[string]*Record, len(patients))
+	records := make([]Record, len(patients))
+	for i, p := range patients {
+		records[i] = Record{
+			Patient:    engine.Patient(p, asOf),
+			Encounters: []Encounter{},
+			Diagnoses:  []Diagnosis{},
+			LabResults: []LabResult{},
+		}
+		byPatient[p.ID] = &records[i]
+	}
+	for _, e := range encounters {
+		byPatient[e.PatientID].Encounters = append(byPatient[e.PatientID].Encounters, engine.Encounter(e))
+	}
+	for _, d := range diagnoses {
+		byPatient[d.PatientID].Diagnoses = append(byPatient[d.PatientID].Diagnoses, engine.Diagnosis(d))
+	}
+	for _, r := range results {
+		byPatient[r.PatientID].LabResults = append(byPatient[r.PatientID].LabResults, engine.LabResult(r))
+	}
+	return records, nil
+}
@@ -0,0 +1,192 @@
+package deid
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{}, &models.Diagnosis{},
+		&models.LabResult{}, &models.AuditLog{}, &models.Consent{})
+	db.Create(&models.Hospital{ID: "1", Name: "BKK Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", FirstNameEN: "Somchai",
+		NationalID: "1100700000001", Gender: "M", DateOfBirth: time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)})
+	db.Create(&models.Patient{ID: "002", PatientHN: "HN002", HospitalID: "1", FirstNameEN: "Malee", Gender: "F"})
+	db.Create(&models.Patient{ID: "003", PatientHN: "HN003", HospitalID: "2", FirstNameEN: "Other"})
+	db.Create(&models.Patient{ID: "004", PatientHN: "HN004", HospitalID: "1", FirstNameEN: "Withdrawn"})
+	withdrawn := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, consent := range []models.Consent{
+		{PatientID: "001", HospitalID: "1", Purpose: models.ConsentResearch, Version: "1", Channel: "paper"},
+		{PatientID: "002", HospitalID: "1", Purpose: models.ConsentResearch, Version: "1", Channel: "paper"},
+		{PatientID: "004", HospitalID: "1", Purpose: models.ConsentResearch, Version: "1", Channel: "paper", WithdrawnAt: &withdrawn},
+		{PatientID: "004", HospitalID: "1", Purpose: models.ConsentMarketing, Version: "1", Channel: "paper"},
+	} {
+		db.Create(&consent)
+	}
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD",
+		StartedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)})
+	db.Create(&models.Diagnosis{EncounterID: 1, PatientID: "001", HospitalID: "1", Code: "I10", Type: "primary",
+		Note: "lives alone at 12 Sukhumvit", CreatedAt: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)})
+	db.Create(&models.LabResult{LabOrderID: 1, SpecimenID: 1, PatientID: "001", HospitalID: "1", TestCode: "GLU",
+		Value: "110", Unit: "mg/dL", Flag: "H", ResultedBy: "tech01", ResultedAt: time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func TestEngine(t *testing.T) {
+	patient := models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", FirstNameEN: "Somchai",
+		NationalID: "1100700000001", PhoneNumber: "0812345678", Gender: "M",
+		DateOfBirth: time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)}
+	asOf := time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)
+
+	t.Run("New Fail Case Short Key", func(t *testing.T) {
+		_, err := New([]byte("short"), DefaultPolicy)
+		assert.ErrorIs(t, err, ErrWeakKey)
+	})
+
+	t.Run("New Fail Case Unknown Field", func(t *testing.T) {
+		policy := DefaultPolicy
+		policy.Fields = map[string]string{"diagnosis": Hash}
+		_, err := New(testKey, policy)
+		assert.Error(t, err)
+	})
+
+	t.Run("Default Policy Drops Identifiers", func(t *testing.T) {
+		engine, _ := New(testKey, DefaultPolicy)
+		out := engine.Patient(patient, asOf)
+		assert.Len(t, out.PatientKey, 24)
+		assert.NotEqual(t, "001", out.PatientKey)
+		assert.Nil(t, out.Identifiers)
+		assert.Equal(t, "40-44", out.AgeBand)
+		assert.Empty(t, out.BirthDate)
+		assert.Equal(t, "M", out.Gender)
+	})
+
+	t.Run("Hash Keeps Linkage Under One Key", func(t *testing.T) {
+		policy := DefaultPolicy
+		policy.Fields = map[string]string{"national_id": Hash, "patient_hn": Keep}
+		engine, _ := New(testKey, policy)
+		first := engine.Patient(patient, asOf)
+		again := engine.Patient(patient, asOf)
+		assert.Equal(t, first, again)
+		assert.NotEqual(t, patient.NationalID, first.Identifiers["national_id"])
+		assert.Equal(t, "HN001", first.Identifiers["patient_hn"])
+		assert.NotContains(t, first.Identifiers, "phone_number")
+
+		other, _ := New([]byte(strings.Repeat("x", 32)), policy)
+		assert.NotEqual(t, first.PatientKey, other.Patient(patient, asOf).PatientKey)
+	})
+
+	t.Run("Dates Shift Consistently Per Patient", func(t *testing.T) {
+		engine, _ := New(testKey, DefaultPolicy)
+		shift := engine.ShiftDays("001")
+		assert.LessOrEqual(t, shift, 180)
+		assert.GreaterOrEqual(t, shift, -180)
+
+		start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+		end := start.Add(72 * time.Hour)
+		enc := engine.Encounter(models.Encounter{ID: 1, PatientID: "001", Type: "IPD", StartedAt: start, EndedAt: &end})
+		assert.Equal(t, start.AddDate(0, 0, shift), enc.StartedAt)
+		assert.Equal(t, 72*time.Hour, enc.EndedAt.Sub(enc.StartedAt))
+		assert.Equal(t, engine.Pseudonym("patient", "001"), enc.PatientKey)
+	})
+
+	t.Run("Age Bands", func(t *testing.T) {
+		assert.Equal(t, "0-4", ageBand(0, 5))
+		assert.Equal(t, "40-49", ageBand(43, 10))
+		assert.Equal(t, "90+", ageBand(93, 5))
+		assert.Equal(t, 43, age(patient.DateOfBirth, asOf))
+		assert.Equal(t, 44, age(patient.DateOfBirth, asOf.AddDate(0, 0, 1)))
+	})
+}
+
+func TestGetResearchExtract(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	defer func(previous *Engine) { Default = previous }(Default)
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/research/extract", h.GetResearchExtract)
+	extract := func(role string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/research/extract", nil)
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1", role))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Extract Fail Case No Key", func(t *testing.T) {
+		Default = nil
+		w := extract("admin")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	Default, _ = New(testKey, DefaultPolicy)
+
+	t.Run("Extract Fail Case Not Admin", func(t *testing.T) {
+		w := extract("doctor")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Extract Success", func(t *testing.T) {
+		w := extract("admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		body := w.Body.String()
+		assert.NotContains(t, body, "Somchai")
+		assert.NotContains(t, body, "HN001")
+		assert.NotContains(t, body, "Sukhumvit")
+		assert.NotContains(t, body, "tech01")
+		assert.NotContains(t, body, Default.Pseudonym("patient", "004"))
+
+		var records []Record
+		scanner := bufio.NewScanner(strings.NewReader(body))
+		for scanner.Scan() {
+			var record Record
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			records = append(records, record)
+		}
+		assert.Len(t, records, 2)
+		first := records[0]
+		assert.Equal(t, Default.Pseudonym("patient", "001"), first.Patient.PatientKey)
+		assert.Len(t, first.Encounters, 1)
+		assert.Equal(t, first.Encounters[0].EncounterKey, first.Diagnoses[0].EncounterKey)
+		assert.Equal(t, "I10", first.Diagnoses[0].Code)
+		assert.Equal(t, "110", first.LabResults[0].Value)
+		assert.Empty(t, records[1].Encounters)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("action = ?", "research.extract").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
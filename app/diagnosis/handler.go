@@ -0,0 +1,189 @@
+package diagnosis
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the ICD-10 and diagnosis endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+func (h *Handler) ImportCodes(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่นำเข้ารหัส ICD-10 ได้", "Only admins can import ICD-10 codes"))
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาแนบไฟล์ CSV", "Please attach a CSV file"))
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่สามารถอ่านไฟล์ได้", "Could not read the file"))
+		return
+	}
+	defer f.Close()
+
+	n, err := ImportICD10CSV(h.DB.WithContext(c.Request.Context()), f)
+	var invalid *apierror.Error
+	switch {
+	case errors.As(err, &invalid):
+		apierror.Respond(c, invalid)
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "นำเข้ารหัส ICD-10 ไม่สำเร็จ", "Could not import ICD-10 codes").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "นำเข้ารหัส ICD-10 สำเร็จ", "imported": n})
+}
+
+// SearchCodes autocompletes over the catalog by code prefix or by a Thai or
+// English description fragment.
+func (h *Handler) SearchCodes(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุคำค้นหา", "Please provide a search term"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	like := "%" + strings.ToLower(q) + "%"
+	var codes []models.ICD10Code
+	result := h.DB.WithContext(c.Request.Context()).
+		Where("code LIKE ? OR LOWER(description_en) LIKE ? OR description_th LIKE ?",
+			NormalizeCode(q)+"%", like, "%"+q+"%").
+		Order("code").
+		Limit(limit).
+		Find(&codes)
+
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถค้นหารหัส ICD-10 ได้", "Could not search ICD-10 codes").Wrap(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, codes)
+}
+
+func (h *Handler) AddDiagnosis(c *gin.Context) {
+	var input struct {
+		EncounterID uint   `json:"encounter_id" binding:"required"`
+		Code        string `json:"code" binding:"required"`
+		Type        string `json:"type" binding:"required"`
+		Note        string `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	if input.Type != models.DiagnosisPrimary && input.Type != models.DiagnosisSecondary {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ประเภทการวินิจฉัยต้องเป็น primary หรือ secondary", "Diagnosis type must be primary or secondary"))
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.EncounterID, staffHospital).
+		First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return
+	}
+
+	var code models.ICD10Code
+	if err := h.DB.WithContext(c.Request.Context()).First(&code, "code = ?", NormalizeCode(input.Code)).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่พบรหัส ICD-10 ที่ระบุ", "ICD-10 code not found"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	diagnosedBy, _ := username.(string)
+	diagnosis := models.Diagnosis{
+		EncounterID: encounter.ID,
+		PatientID:   encounter.PatientID,
+		HospitalID:  staffHospital,
+		Code:        code.Code,
+		ICD10:       code,
+		Type:        input.Type,
+		Note:        input.Note,
+		DiagnosedBy: diagnosedBy,
+	}
+	// the unique index on an encounter's primary diagnosis decides, so two
+	// concurrent requests cannot both add one
+	err := repository.Duplicate(h.DB, h.DB.WithContext(c.Request.Context()).Omit("ICD10").Create(&diagnosis).Error)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "การรับบริการนี้มีการวินิจฉัยหลักแล้ว", "The encounter already has a primary diagnosis"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการวินิจฉัยได้", "Could not save the diagnosis").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, diagnosis)
+}
+
+func (h *Handler) GetEncounterDiagnoses(c *gin.Context) {
+	encounterID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var diagnoses []models.Diagnosis
+	result := h.DB.WithContext(c.Request.Context()).Preload("ICD10").
+		Where("encounter_id = ? AND hospital_id = ?", encounterID, staffHospital).
+		Order("type, id").
+		Find(&diagnoses)
+
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลการวินิจฉัยได้", "Could not load diagnoses").Wrap(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, diagnoses)
+}
+
+func (h *Handler) GetPatientDiagnoses(c *gin.Context) {
+	patientID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var diagnoses []models.Diagnosis
+	result := h.DB.WithContext(c.Request.Context()).Preload("ICD10").
+		Where("patient_id = ? AND hospital_id = ?", patientID, staffHospital).
+		Order("created_at DESC").
+		Find(&diagnoses)
+
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลการวินิจฉัยได้", "Could not load diagnoses").Wrap(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, diagnoses)
+}
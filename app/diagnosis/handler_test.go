@@ -0,0 +1,189 @@
+package diagnosis
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testCSV = `code,description_en,description_th
+J18.9,"Pneumonia, unspecified",ปอดอักเสบ ไม่ระบุรายละเอียด
+I10,Essential (primary) hypertension,ความดันโลหิตสูงที่ไม่ทราบสาเหตุ
+E119,Type 2 diabetes mellitus without complications,เบาหวานชนิดที่ 2 ไม่มีภาวะแทรกซ้อน
+`
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{},
+		&models.ICD10Code{}, &models.Diagnosis{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func TestImportICD10CSV(t *testing.T) {
+	db := SetupTestDB()
+
+	n, err := ImportICD10CSV(db, strings.NewReader(testCSV))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	var code models.ICD10Code
+	db.First(&code, "code = ?", "E11.9")
+	assert.Equal(t, "เบาหวานชนิดที่ 2 ไม่มีภาวะแทรกซ้อน", code.DescriptionTH)
+
+	// re-importing updates rather than duplicates
+	n, err = ImportICD10CSV(db, strings.NewReader("code,description_en\nI10,Hypertension\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	var count int64
+	db.Model(&models.ICD10Code{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+
+	// the same code twice in a batch is one upsert, the last row winning
+	n, err = ImportICD10CSV(db, strings.NewReader("code,description_en\nI10,Hypertension\ni10,Essential hypertension\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	var updated models.ICD10Code
+	db.First(&updated, "code = ?", "I10")
+	assert.Equal(t, "Essential hypertension", updated.DescriptionEN)
+
+	_, err = ImportICD10CSV(db, strings.NewReader("name\nfoo\n"))
+	assert.Error(t, err)
+}
+
+func TestImportAndSearchCodes(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/icd10/import", h.ImportCodes)
+	r.GET("/icd10/search", h.SearchCodes)
+	token := generateTestToken("1", "doctor")
+	upload := func(role string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "icd10.csv")
+		part.Write([]byte(testCSV))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/icd10/import", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1", role))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Import Fail Case Not Admin", func(t *testing.T) {
+		w := upload("doctor")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Import Success", func(t *testing.T) {
+		w := upload("admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"imported":3`)
+	})
+
+	for _, tc := range []struct{ q, code string }{
+		{"j18", "J18.9"},
+		{"hypertension", "I10"},
+		{"เบาหวาน", "E11.9"},
+	} {
+		t.Run("Search "+tc.q, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/icd10/search?q="+tc.q, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var codes []models.ICD10Code
+			json.Unmarshal(w.Body.Bytes(), &codes)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Len(t, codes, 1)
+			assert.Equal(t, tc.code, codes[0].Code)
+		})
+	}
+}
+
+func TestAddDiagnosis(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	ImportICD10CSV(db, strings.NewReader(testCSV))
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/diagnosis/add", h.AddDiagnosis)
+
+	post := func(data map[string]interface{}, hospitalID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(data)
+		req, _ := http.NewRequest("POST", "/diagnosis/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID, "doctor"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Add Primary Diagnosis Success", func(t *testing.T) {
+		w := post(map[string]interface{}{"encounter_id": 1, "code": "j189", "type": "primary"}, "1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"J18.9"`)
+	})
+
+	t.Run("Add Secondary Diagnosis Success", func(t *testing.T) {
+		w := post(map[string]interface{}{"encounter_id": 1, "code": "I10", "type": "secondary"}, "1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Add Diagnosis Fail Case Second Primary", func(t *testing.T) {
+		w := post(map[string]interface{}{"encounter_id": 1, "code": "E11.9", "type": "primary"}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Add Another Secondary Diagnosis Success", func(t *testing.T) {
+		w := post(map[string]interface{}{"encounter_id": 1, "code": "E11.9", "type": "secondary"}, "1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Add Diagnosis Fail Case Unknown Code", func(t *testing.T) {
+		w := post(map[string]interface{}{"encounter_id": 1, "code": "Z99.99", "type": "secondary"}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Add Diagnosis Fail Case Other Hospital", func(t *testing.T) {
+		w := post(map[string]interface{}{"encounter_id": 1, "code": "I10", "type": "secondary"}, "2")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,141 @@
+package diagnosis
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const importBatchSize = 500
+
+var errInvalidCSV = apierror.New(apierror.InvalidInput, "ไฟล์ CSV ไม่ถูกต้อง", "The CSV file is invalid")
+
+// NormalizeCode upper-cases an ICD-10 code and puts it in dotted form, so
+// "j189" and "J18.9" refer to the same entry.
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, ".", "")
+	if len(code) > 3 {
+		code = code[:3] + "." + code[3:]
+	}
+	return code
+}
+
+// ImportICD10CSV loads codes from a CSV file with a header row. The columns
+// code, description_en and description_th are recognised in any order;
+// existing codes are updated in place, and a code listed twice takes the
+// later row. It returns the number of codes loaded.
+func ImportICD10CSV(db *gorm.DB, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, errInvalidCSV.Wrap(err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["code"]; !ok {
+		return 0, apierror.New(apierror.InvalidInput, "ไฟล์ CSV ต้องมีคอลัมน์ code", "The CSV file needs a code column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	total := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		batch := make([]models.ICD10Code, 0, importBatchSize)
+		// Postgres rejects an upsert that touches the same row twice, so a
+		// repeated code replaces its earlier row in the batch
+		index := map[string]int{}
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&batch).Error; err != nil {
+				return err
+			}
+			total += len(batch)
+			batch = batch[:0]
+			clear(index)
+			return nil
+		}
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errInvalidCSV.Wrap(err)
+			}
+			code := field(record, "code")
+			if code == "" {
+				continue
+			}
+			entry := models.ICD10Code{
+				Code:          NormalizeCode(code),
+				DescriptionEN: field(record, "description_en"),
+				DescriptionTH: field(record, "description_th"),
+			}
+			if i, ok := index[entry.Code]; ok {
+				batch[i] = entry
+				continue
+			}
+			index[entry.Code] = len(batch)
+			batch = append(batch, entry)
+			if len(batch) == importBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return flush()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// LoadICD10File seeds the catalog from path when the table is still empty.
+// It is meant to be called at startup with the ICD10_CSV setting.
+func LoadICD10File(db *gorm.DB, path string) {
+	if path == "" {
+		return
+	}
+	var count int64
+	db.Model(&models.ICD10Code{}).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to open ICD-10 file:", err)
+		return
+	}
+	defer f.Close()
+
+	n, err := ImportICD10CSV(db, f)
+	if err != nil {
+		log.Println("Failed to import ICD-10 codes:", err)
+		return
+	}
+	log.Printf("Successfully imported %d ICD-10 codes!", n)
+}
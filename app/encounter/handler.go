@@ -0,0 +1,93 @@
+package encounter
+
+import (
+	"net/http"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the encounter endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+func (h *Handler) CreateEncounter(c *gin.Context) {
+	var input struct {
+		PatientID string     `json:"patient_id" binding:"required"`
+		Type      string     `json:"type" binding:"required"`
+		StartedAt *time.Time `json:"started_at"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	switch input.Type {
+	case models.EncounterOPD, models.EncounterIPD, models.EncounterER:
+	default:
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ประเภทการรับบริการต้องเป็น OPD, IPD หรือ ER", "Encounter type must be OPD, IPD or ER"))
+		return
+	}
+
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.PatientID, staffHospital).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+
+	startedAt := time.Now()
+	if input.StartedAt != nil {
+		startedAt = *input.StartedAt
+	}
+	username, _ := c.Get("username")
+	createdBy, _ := username.(string)
+
+	newEncounter := models.Encounter{
+		PatientID:  patient.ID,
+		HospitalID: staffHospital,
+		Type:       input.Type,
+		StartedAt:  startedAt,
+		CreatedBy:  createdBy,
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&newEncounter).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเปิดการรับบริการได้", "Could not open the encounter").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, newEncounter)
+}
+
+func (h *Handler) GetEncounters(c *gin.Context) {
+	patientID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var encounters []models.Encounter
+	result := h.DB.WithContext(c.Request.Context()).
+		Where("patient_id = ? AND hospital_id = ?", patientID, staffHospital).
+		Order("started_at DESC").
+		Find(&encounters)
+
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลการรับบริการได้", "Could not load encounters").Wrap(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, encounters)
+}
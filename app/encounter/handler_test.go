@@ -0,0 +1,134 @@
+package encounter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	return db
+}
+
+func generateTestToken(HospitalID string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func TestEncounterCreate(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(db)
+
+	t.Run("Create Encounter Success", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.POST("/encounter/add", h.CreateEncounter)
+
+		body, _ := json.Marshal(map[string]interface{}{"patient_id": "001", "type": "ER"})
+		req, _ := http.NewRequest("POST", "/encounter/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"created_by":"testuser"`)
+	})
+
+	t.Run("Create Encounter Fail Case Invalid Type", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.POST("/encounter/add", h.CreateEncounter)
+
+		body, _ := json.Marshal(map[string]interface{}{"patient_id": "001", "type": "XYZ"})
+		req, _ := http.NewRequest("POST", "/encounter/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Create Encounter Fail Case Other Hospital", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.POST("/encounter/add", h.CreateEncounter)
+
+		body, _ := json.Marshal(map[string]interface{}{"patient_id": "001", "type": "OPD"})
+		req, _ := http.NewRequest("POST", "/encounter/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("2"))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestEncounterSearch(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	db.Create(&models.Encounter{PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	h := NewHandler(db)
+
+	t.Run("Search Success", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.GET("/encounter/patient/:id", h.GetEncounters)
+
+		req, _ := http.NewRequest("GET", "/encounter/patient/001", nil)
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var encounters []models.Encounter
+		json.Unmarshal(w.Body.Bytes(), &encounters)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, encounters, 1)
+	})
+
+	t.Run("Search Case Other Hospital", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.GET("/encounter/patient/:id", h.GetEncounters)
+
+		req, _ := http.NewRequest("GET", "/encounter/patient/001", nil)
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("2"))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "[]", w.Body.String())
+	})
+}
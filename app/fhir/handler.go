@@ -0,0 +1,444 @@
+package fhir
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/metrics"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the FHIR endpoints. Patients are written through the same
+// repository as the patient API.
+type Handler struct {
+	DB       *gorm.DB
+	Patients repository.PatientRepository
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{DB: db, Patients: repository.NewPatientRepository(db)}
+}
+
+const (
+	contentType     = "application/fhir+json; charset=utf-8"
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+func (h *Handler) GetPatient(c *gin.Context) {
+	hospitalID, ok := hospitalOf(c)
+	if !ok {
+		return
+	}
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Hospital").Where("id = ? AND hospital_id = ?", c.Param("id"), hospitalID).
+		First(&patient).Error; err != nil {
+		outcome(c, http.StatusNotFound, "not-found", "Patient/"+c.Param("id")+" is not known")
+		return
+	}
+	write(c, http.StatusOK, FromPatient(patient))
+}
+
+// SearchPatients supports identifier, name, family, given, birthdate and
+// gender, always within the caller's hospital.
+func (h *Handler) SearchPatients(c *gin.Context) {
+	hospitalID, ok := hospitalOf(c)
+	if !ok {
+		return
+	}
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", hospitalID)
+
+	if token := c.Query("identifier"); token != "" {
+		system, value := splitToken(token)
+		switch system {
+		case SystemNationalID:
+			query = query.Where("national_id = ?", value)
+		case "":
+			query = query.Where("(national_id = ? OR passport_id = ? OR patient_hn = ?)", value, value, value)
+		default:
+			// no identifiers from other systems are stored
+			query = query.Where("1 = 0")
+		}
+	}
+	if name := c.Query("name"); name != "" {
+		like := "%" + name + "%"
+		query = query.Where("(first_name_th LIKE ? OR middle_name_th LIKE ? OR last_name_th LIKE ? OR "+
+			"first_name_en LIKE ? OR middle_name_en LIKE ? OR last_name_en LIKE ?)", like, like, like, like, like, like)
+	}
+	if family := c.Query("family"); family != "" {
+		query = query.Where("(last_name_th LIKE ? OR last_name_en LIKE ?)", family+"%", family+"%")
+	}
+	if given := c.Query("given"); given != "" {
+		query = query.Where("(first_name_th LIKE ? OR first_name_en LIKE ?)", given+"%", given+"%")
+	}
+	if birthdate := c.Query("birthdate"); birthdate != "" {
+		day, err := time.Parse("2006-01-02", birthdate)
+		if err != nil {
+			outcome(c, http.StatusBadRequest, "invalid", "birthdate must be YYYY-MM-DD")
+			return
+		}
+		query = query.Where("date_of_birth >= ? AND date_of_birth < ?", day, day.AddDate(0, 0, 1))
+	}
+	if gender := c.Query("gender"); gender != "" {
+		// a patient without a recorded gender is "unknown"
+		code, known := "", gender == "unknown"
+		for k, v := range genders {
+			if v == gender {
+				code, known = k, true
+			}
+		}
+		if !known {
+			outcome(c, http.StatusBadRequest, "code-invalid", "gender must be male, female, other or unknown")
+			return
+		}
+		query = query.Where("gender = ?", code)
+	}
+
+	patients, total, err := findPage[models.Patient](c, query, "Hospital")
+	if err != nil {
+		outcome(c, http.StatusInternalServerError, "exception", "search failed")
+		return
+	}
+	resources := make([]interface{}, len(patients))
+	for i, p := range patients {
+		resources[i] = FromPatient(p)
+	}
+	write(c, http.StatusOK, searchset(c, "Patient", resources, total))
+}
+
+// CreatePatient registers a patient in the caller's hospital. The server
+// assigns the id; the HN must be sent as an MR identifier.
+func (h *Handler) CreatePatient(c *gin.Context) {
+	hospitalID, ok := hospitalOf(c)
+	if !ok {
+		return
+	}
+	var resource Patient
+	if err := c.ShouldBindJSON(&resource); err != nil || resource.ResourceType != "Patient" {
+		outcome(c, http.StatusBadRequest, "structure", "body must be a FHIR Patient resource")
+		return
+	}
+	if ref := resource.ManagingOrganization; ref != nil && ref.Reference != "" && ref.Reference != "Organization/"+hospitalID {
+		outcome(c, http.StatusForbidden, "forbidden", "patients can only be registered in the caller's own organization")
+		return
+	}
+	patient, msg := resource.toModel(hospitalID)
+	if msg != "" {
+		outcome(c, http.StatusBadRequest, "invalid", msg)
+		return
+	}
+	patient.ID = newID()
+	if invalid := repository.ValidatePatient(patient); invalid != nil {
+		outcome(c, http.StatusBadRequest, "invalid", invalid.Message.EN)
+		return
+	}
+
+	err := h.Patients.Create(c.Request.Context(), &patient)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		outcome(c, http.StatusConflict, "duplicate", "a patient with this hospital number already exists")
+		return
+	case err != nil:
+		outcome(c, http.StatusInternalServerError, "exception", "the patient could not be stored")
+		return
+	}
+	metrics.PatientsRegistered.WithLabelValues(hospitalID, metrics.SourceFHIR).Inc()
+	h.DB.WithContext(c.Request.Context()).First(&patient.Hospital, "id = ?", hospitalID)
+	c.Header("Location", baseURL(c)+"/Patient/"+patient.ID)
+	write(c, http.StatusCreated, FromPatient(patient))
+}
+
+// GetOrganization reads any hospital. Hospitals are directory data shared
+// by all, unlike the patients they hold.
+func (h *Handler) GetOrganization(c *gin.Context) {
+	var hospital models.Hospital
+	if err := h.DB.WithContext(c.Request.Context()).First(&hospital, "id = ?", c.Param("id")).Error; err != nil {
+		outcome(c, http.StatusNotFound, "not-found", "Organization/"+c.Param("id")+" is not known")
+		return
+	}
+	write(c, http.StatusOK, FromHospital(hospital))
+}
+
+func (h *Handler) SearchOrganizations(c *gin.Context) {
+	query := h.DB.WithContext(c.Request.Context()).Model(&models.Hospital{})
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+	if token := c.Query("identifier"); token != "" {
+		_, value := splitToken(token)
+		query = query.Where("id = ?", value)
+	}
+
+	hospitals, total, err := findPage[models.Hospital](c, query)
+	if err != nil {
+		outcome(c, http.StatusInternalServerError, "exception", "search failed")
+		return
+	}
+	resources := make([]interface{}, len(hospitals))
+	for i, h := range hospitals {
+		resources[i] = FromHospital(h)
+	}
+	write(c, http.StatusOK, searchset(c, "Organization", resources, total))
+}
+
+// CreateOrganization adds a hospital. Its id is taken from the XX
+// identifier, since hospital codes are assigned outside this system.
+func (h *Handler) CreateOrganization(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	var resource Organization
+	if err := c.ShouldBindJSON(&resource); err != nil || resource.ResourceType != "Organization" {
+		outcome(c, http.StatusBadRequest, "structure", "body must be a FHIR Organization resource")
+		return
+	}
+	hospital := models.Hospital{Name: strings.TrimSpace(resource.Name)}
+	for _, id := range resource.Identifier {
+		if id.hasType(TypeOrgID) {
+			hospital.ID = id.Value
+		}
+	}
+	if hospital.ID == "" || hospital.Name == "" {
+		outcome(c, http.StatusBadRequest, "required", "Organization needs a name and an identifier of type XX")
+		return
+	}
+	if len(resource.Address) > 0 {
+		hospital.Address = resource.Address[0].Text
+	}
+
+	if err := h.DB.WithContext(c.Request.Context()).Create(&hospital).Error; err != nil {
+		outcome(c, http.StatusConflict, "duplicate", "an organization with this identifier or name already exists")
+		return
+	}
+	c.Header("Location", baseURL(c)+"/Organization/"+hospital.ID)
+	write(c, http.StatusCreated, FromHospital(hospital))
+}
+
+func (h *Handler) GetPractitioner(c *gin.Context) {
+	hospitalID, ok := hospitalOf(c)
+	if !ok {
+		return
+	}
+	var staff models.Staff
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), hospitalID).
+		First(&staff).Error; err != nil {
+		outcome(c, http.StatusNotFound, "not-found", "Practitioner/"+c.Param("id")+" is not known")
+		return
+	}
+	write(c, http.StatusOK, FromStaff(staff))
+}
+
+func (h *Handler) SearchPractitioners(c *gin.Context) {
+	hospitalID, ok := hospitalOf(c)
+	if !ok {
+		return
+	}
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", hospitalID)
+	if name := c.Query("name"); name != "" {
+		query = query.Where("full_name LIKE ?", "%"+name+"%")
+	}
+	if token := c.Query("identifier"); token != "" {
+		_, value := splitToken(token)
+		query = query.Where("username = ?", value)
+	}
+
+	staffs, total, err := findPage[models.Staff](c, query)
+	if err != nil {
+		outcome(c, http.StatusInternalServerError, "exception", "search failed")
+		return
+	}
+	resources := make([]interface{}, len(staffs))
+	for i, s := range staffs {
+		resources[i] = FromStaff(s)
+	}
+	write(c, http.StatusOK, searchset(c, "Practitioner", resources, total))
+}
+
+// CreatePractitioner adds a staff member to the caller's hospital. The first
+// identifier becomes the username; the account has no password and cannot
+// log in until one is set.
+func (h *Handler) CreatePractitioner(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	hospitalID, ok := hospitalOf(c)
+	if !ok {
+		return
+	}
+	var resource Practitioner
+	if err := c.ShouldBindJSON(&resource); err != nil || resource.ResourceType != "Practitioner" {
+		outcome(c, http.StatusBadRequest, "structure", "body must be a FHIR Practitioner resource")
+		return
+	}
+	if len(resource.Identifier) == 0 || resource.Identifier[0].Value == "" {
+		outcome(c, http.StatusBadRequest, "required", "Practitioner needs an identifier")
+		return
+	}
+	staff := models.Staff{Username: resource.Identifier[0].Value, HospitalID: hospitalID}
+	if len(resource.Name) > 0 {
+		staff.FullName = resource.Name[0].Text
+		if staff.FullName == "" {
+			staff.FullName = strings.TrimSpace(strings.Join(resource.Name[0].Given, " ") + " " + resource.Name[0].Family)
+		}
+	}
+	if len(resource.Qualification) > 0 {
+		role := resource.Qualification[0].Code.Text
+		if !slices.Contains(models.Roles, role) {
+			outcome(c, http.StatusBadRequest, "code-invalid", "qualification must be one of admin, doctor, dentist, nurse, pharmacist")
+			return
+		}
+		staff.Role = role
+	}
+
+	if err := h.DB.WithContext(c.Request.Context()).Create(&staff).Error; err != nil {
+		outcome(c, http.StatusConflict, "duplicate", "a practitioner with this identifier already exists")
+		return
+	}
+	c.Header("Location", baseURL(c)+"/Practitioner/"+strconv.FormatUint(uint64(staff.ID), 10))
+	write(c, http.StatusCreated, FromStaff(staff))
+}
+
+func write(c *gin.Context, status int, resource interface{}) {
+	c.Header("Content-Type", contentType)
+	c.JSON(status, resource)
+}
+
+// outcome reports an error as an OperationOutcome, which FHIR clients
+// expect instead of the API's usual error body.
+func outcome(c *gin.Context, status int, code, diagnostics string) {
+	write(c, status, OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []OperationOutcomeIssue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	})
+}
+
+func hospitalOf(c *gin.Context) (string, bool) {
+	val, _ := c.Get("hospital_id")
+	hospitalID, ok := val.(string)
+	if !ok {
+		outcome(c, http.StatusUnauthorized, "security", "the token carries no hospital")
+	}
+	return hospitalID, ok
+}
+
+func requireAdmin(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		outcome(c, http.StatusForbidden, "forbidden", "only administrators may create this resource")
+		return false
+	}
+	return true
+}
+
+// findPage returns the page of query's matches that the request asks for
+// with _count and _offset, with preload loaded, and how many matches there
+// are in all.
+func findPage[T any](c *gin.Context, query *gorm.DB, preload ...string) ([]T, int, error) {
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Model(new(T)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	page := query.Order("id").Offset(pageOffset(c)).Limit(pageSize(c))
+	for _, name := range preload {
+		page = page.Preload(name)
+	}
+	var rows []T
+	err := page.Find(&rows).Error
+	return rows, int(total), err
+}
+
+// searchset builds the bundle for one page of a search. total counts every
+// match; the links let a client page through them.
+func searchset(c *gin.Context, resourceType string, resources []interface{}, total int) Bundle {
+	bundle := Bundle{ResourceType: "Bundle", Type: "searchset", Total: total, Entry: []BundleEntry{}}
+	base := baseURL(c)
+	offset, count := pageOffset(c), pageSize(c)
+	link := func(relation string, offset int) BundleLink {
+		query := c.Request.URL.Query()
+		query.Set("_count", strconv.Itoa(count))
+		query.Set("_offset", strconv.Itoa(offset))
+		return BundleLink{Relation: relation, URL: base + "/" + resourceType + "?" + query.Encode()}
+	}
+	bundle.Link = append(bundle.Link, link("self", offset))
+	if offset+count < total {
+		bundle.Link = append(bundle.Link, link("next", offset+count))
+	}
+	if offset > 0 {
+		bundle.Link = append(bundle.Link, link("previous", max(offset-count, 0)))
+	}
+	for _, r := range resources {
+		var id string
+		switch r := r.(type) {
+		case Patient:
+			id = r.ID
+		case Organization:
+			id = r.ID
+		case Practitioner:
+			id = r.ID
+		}
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			FullURL:  base + "/" + resourceType + "/" + id,
+			Resource: r,
+			Search:   &BundleMatch{Mode: "match"},
+		})
+	}
+	return bundle
+}
+
+// baseURL is the absolute URL of the FHIR endpoint as the client reached
+// it, honouring the proxy's forwarded headers.
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host + "/fhir"
+}
+
+// splitToken splits a FHIR token search value "system|value".
+func splitToken(token string) (string, string) {
+	if system, value, ok := strings.Cut(token, "|"); ok {
+		return system, value
+	}
+	return "", token
+}
+
+func pageSize(c *gin.Context) int {
+	n, err := strconv.Atoi(c.Query("_count"))
+	if err != nil || n <= 0 {
+		return defaultPageSize
+	}
+	return min(n, maxPageSize)
+}
+
+func pageOffset(c *gin.Context) int {
+	n, err := strconv.Atoi(c.Query("_offset"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// newID returns a random resource id for server-assigned patient ids.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,304 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Staff{})
+	db.Exec("CREATE UNIQUE INDEX idx_patients_hospital_hn ON patients (hospital_id, patient_hn)")
+	db.Create(&models.Hospital{ID: "1", Name: "BKK Hospital", Address: "Bangkok"})
+	db.Create(&models.Hospital{ID: "2", Name: "Bangna Medical"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1",
+		FirstNameTH: "สมชาย", LastNameTH: "ใจดี", FirstNameEN: "Somchai", LastNameEN: "Jaidee",
+		NationalID: "1100700000001", Gender: "M", DateOfBirth: time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)})
+	db.Create(&models.Patient{ID: "002", PatientHN: "HN002", HospitalID: "2", FirstNameEN: "Other"})
+	db.Create(&models.Staff{ID: 1, Username: "doctor01", Password: "x", HospitalID: "1", FullName: "Dr. Anan", Role: "doctor"})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/fhir/Patient/:id", h.GetPatient)
+	r.GET("/fhir/Patient", h.SearchPatients)
+	r.POST("/fhir/Patient", h.CreatePatient)
+	r.GET("/fhir/Organization/:id", h.GetOrganization)
+	r.POST("/fhir/Organization", h.CreateOrganization)
+	r.GET("/fhir/Practitioner", h.SearchPractitioners)
+	r.POST("/fhir/Practitioner", h.CreatePractitioner)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID, role string) *httptest.ResponseRecorder {
+	var body []byte
+	if data != nil {
+		body, _ = json.Marshal(data)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/fhir+json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID, role))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReadPatient(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Read Patient Success", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient/001", nil, "1", "nurse")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/fhir+json")
+
+		var patient Patient
+		json.Unmarshal(w.Body.Bytes(), &patient)
+		assert.Equal(t, "Patient", patient.ResourceType)
+		assert.Equal(t, "male", patient.Gender)
+		assert.Equal(t, "1980-05-01", patient.BirthDate)
+		assert.Len(t, patient.Name, 2)
+		assert.Equal(t, "th", patient.Name[0].language())
+		assert.Equal(t, "ใจดี", patient.Name[0].Family)
+		assert.Equal(t, "Jaidee", patient.Name[1].Family)
+		assert.Equal(t, "Organization/1", patient.ManagingOrganization.Reference)
+		assert.Contains(t, w.Body.String(), `"system":"`+SystemNationalID+`","value":"1100700000001"`)
+	})
+
+	t.Run("Read Patient Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient/002", nil, "1", "nurse")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), `"resourceType":"OperationOutcome"`)
+		assert.Contains(t, w.Body.String(), `"code":"not-found"`)
+	})
+}
+
+func TestSearchPatients(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Search By National ID", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient?identifier="+SystemNationalID+"|1100700000001", nil, "1", "nurse")
+		var bundle Bundle
+		json.Unmarshal(w.Body.Bytes(), &bundle)
+		assert.Equal(t, "searchset", bundle.Type)
+		assert.Equal(t, 1, bundle.Total)
+		assert.True(t, strings.HasSuffix(bundle.Entry[0].FullURL, "/fhir/Patient/001"))
+	})
+
+	t.Run("Search By Thai Name", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient?name=สมชาย", nil, "1", "nurse")
+		assert.Contains(t, w.Body.String(), `"total":1`)
+	})
+
+	t.Run("Search Never Crosses Hospitals", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient?name=Other", nil, "1", "nurse")
+		assert.Contains(t, w.Body.String(), `"total":0`)
+		assert.Contains(t, w.Body.String(), `"entry":[]`)
+	})
+
+	t.Run("Search By Gender", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient?gender=male", nil, "1", "nurse")
+		assert.Contains(t, w.Body.String(), `"total":1`)
+
+		w = send(r, "GET", "/fhir/Patient?gender=unknown", nil, "1", "nurse")
+		assert.Contains(t, w.Body.String(), `"total":0`)
+	})
+
+	t.Run("Search Fail Case Unknown Gender Code", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Patient?gender=mail", nil, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"code-invalid"`)
+	})
+
+	t.Run("Search Pages Report Total And Links", func(t *testing.T) {
+		db.Create(&models.Patient{ID: "003", PatientHN: "HN003", HospitalID: "1", FirstNameEN: "Malee"})
+		links := func(bundle Bundle) map[string]string {
+			m := map[string]string{}
+			for _, l := range bundle.Link {
+				m[l.Relation] = l.URL
+			}
+			return m
+		}
+
+		w := send(r, "GET", "/fhir/Patient?_count=1", nil, "1", "nurse")
+		var first Bundle
+		json.Unmarshal(w.Body.Bytes(), &first)
+		assert.Equal(t, 2, first.Total)
+		assert.Len(t, first.Entry, 1)
+		assert.True(t, strings.HasSuffix(first.Entry[0].FullURL, "/fhir/Patient/001"))
+		assert.Contains(t, w.Body.String(), `"display":"BKK Hospital"`)
+		assert.Contains(t, links(first)["next"], "_offset=1")
+		assert.NotContains(t, links(first), "previous")
+
+		next := links(first)["next"]
+		w = send(r, "GET", next[strings.Index(next, "/fhir/"):], nil, "1", "nurse")
+		var second Bundle
+		json.Unmarshal(w.Body.Bytes(), &second)
+		assert.Equal(t, 2, second.Total)
+		assert.True(t, strings.HasSuffix(second.Entry[0].FullURL, "/fhir/Patient/003"))
+		assert.Contains(t, links(second)["previous"], "_offset=0")
+		assert.NotContains(t, links(second), "next")
+	})
+}
+
+func TestCreatePatient(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	resource := map[string]interface{}{
+		"resourceType": "Patient",
+		"identifier": []interface{}{
+			map[string]interface{}{"type": map[string]interface{}{"coding": []interface{}{map[string]interface{}{"code": "MR"}}}, "value": "HN777"},
+			map[string]interface{}{"system": SystemNationalID, "value": "3100700000007"},
+		},
+		"name": []interface{}{
+			map[string]interface{}{"family": "มีสุข", "given": []string{"สมหญิง"}},
+			map[string]interface{}{"family": "Meesuk", "given": []string{"Somying", "Ann"}},
+		},
+		"gender":    "female",
+		"birthDate": "1990-02-03",
+	}
+
+	t.Run("Create Patient Success", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Patient", resource, "1", "nurse")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Location"))
+
+		var stored models.Patient
+		db.Where("patient_hn = ?", "HN777").First(&stored)
+		assert.Equal(t, "1", stored.HospitalID)
+		assert.Equal(t, "สมหญิง", stored.FirstNameTH)
+		assert.Equal(t, "Ann", stored.MiddleNameEN)
+		assert.Equal(t, "F", stored.Gender)
+	})
+
+	t.Run("Create Patient Fail Case Duplicate HN", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Patient", resource, "1", "nurse")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"duplicate"`)
+	})
+
+	t.Run("Create Patient Fail Case Invalid Email", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Patient", map[string]interface{}{
+			"resourceType": "Patient",
+			"identifier": []interface{}{
+				map[string]interface{}{"type": map[string]interface{}{"coding": []interface{}{map[string]interface{}{"code": "MR"}}}, "value": "HN778"},
+			},
+			"telecom": []interface{}{map[string]interface{}{"system": "email", "value": "somying.example.com"}},
+		}, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid email address")
+	})
+
+	t.Run("Create Patient Fail Case Other Organization", func(t *testing.T) {
+		other := map[string]interface{}{}
+		for k, v := range resource {
+			other[k] = v
+		}
+		other["managingOrganization"] = map[string]interface{}{"reference": "Organization/2"}
+		w := send(r, "POST", "/fhir/Patient", other, "1", "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Create Patient Fail Case Missing HN", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Patient", map[string]interface{}{"resourceType": "Patient"}, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "OperationOutcome")
+	})
+
+	t.Run("Create Patient Fail Case Wrong Resource", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Patient", map[string]interface{}{"resourceType": "Observation"}, "1", "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestOrganizationAndPractitioner(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Read Organization", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Organization/2", nil, "1", "nurse")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"Bangna Medical"`)
+	})
+
+	org := map[string]interface{}{
+		"resourceType": "Organization",
+		"name":         "Chiang Mai Hospital",
+		"identifier": []interface{}{
+			map[string]interface{}{"type": map[string]interface{}{"coding": []interface{}{map[string]interface{}{"code": "XX"}}}, "value": "3"},
+		},
+	}
+	t.Run("Create Organization Fail Case Not Admin", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Organization", org, "1", "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Create Organization Success", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Organization", org, "1", "admin")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = send(r, "POST", "/fhir/Organization", org, "1", "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Search Practitioners In Own Hospital", func(t *testing.T) {
+		w := send(r, "GET", "/fhir/Practitioner?name=Anan", nil, "1", "nurse")
+		assert.Contains(t, w.Body.String(), `"total":1`)
+		assert.Contains(t, w.Body.String(), `"text":"doctor"`)
+
+		w = send(r, "GET", "/fhir/Practitioner?name=Anan", nil, "2", "nurse")
+		assert.Contains(t, w.Body.String(), `"total":0`)
+	})
+
+	t.Run("Create Practitioner", func(t *testing.T) {
+		w := send(r, "POST", "/fhir/Practitioner", map[string]interface{}{
+			"resourceType":  "Practitioner",
+			"identifier":    []interface{}{map[string]interface{}{"value": "nurse07"}},
+			"name":          []interface{}{map[string]interface{}{"family": "Sukjai", "given": []string{"Malee"}}},
+			"qualification": []interface{}{map[string]interface{}{"code": map[string]interface{}{"text": "nurse"}}},
+		}, "1", "admin")
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var staff models.Staff
+		db.Where("username = ?", "nurse07").First(&staff)
+		assert.Equal(t, "Malee Sukjai", staff.FullName)
+		assert.Equal(t, "1", staff.HospitalID)
+		assert.Empty(t, staff.Password)
+	})
+}
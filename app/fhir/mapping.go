@@ -0,0 +1,183 @@
+package fhir
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"example.com/myapp/app/model"
+)
+
+var genders = map[string]string{"M": "male", "F": "female", "O": "other"}
+
+// FromPatient maps a patient to a FHIR Patient. The HN is an MR identifier
+// assigned by the patient's hospital.
+func FromPatient(p models.Patient) Patient {
+	resource := Patient{
+		ResourceType:         "Patient",
+		ID:                   p.ID,
+		Gender:               "unknown",
+		ManagingOrganization: &Reference{Reference: "Organization/" + p.HospitalID, Display: p.Hospital.Name},
+	}
+	if p.PatientHN != "" {
+		resource.Identifier = append(resource.Identifier, Identifier{
+			Use:      "usual",
+			Type:     identifierType(TypeMedicalRec),
+			Value:    p.PatientHN,
+			Assigner: &Reference{Reference: "Organization/" + p.HospitalID},
+		})
+	}
+	if p.NationalID != "" {
+		resource.Identifier = append(resource.Identifier, Identifier{
+			Use:    "official",
+			Type:   identifierType(TypeNationalID),
+			System: SystemNationalID,
+			Value:  p.NationalID,
+		})
+	}
+	if p.PassportID != "" {
+		resource.Identifier = append(resource.Identifier, Identifier{
+			Use:   "official",
+			Type:  identifierType(TypePassport),
+			Value: p.PassportID,
+		})
+	}
+	if name, ok := humanName("th", p.FirstNameTH, p.MiddleNameTH, p.LastNameTH); ok {
+		resource.Name = append(resource.Name, name)
+	}
+	if name, ok := humanName("en", p.FirstNameEN, p.MiddleNameEN, p.LastNameEN); ok {
+		resource.Name = append(resource.Name, name)
+	}
+	if p.PhoneNumber != "" {
+		resource.Telecom = append(resource.Telecom, ContactPoint{System: "phone", Value: p.PhoneNumber, Use: "mobile"})
+	}
+	if p.Email != "" {
+		resource.Telecom = append(resource.Telecom, ContactPoint{System: "email", Value: p.Email})
+	}
+	if g, ok := genders[strings.ToUpper(p.Gender)]; ok {
+		resource.Gender = g
+	}
+	if !p.DateOfBirth.IsZero() {
+		resource.BirthDate = p.DateOfBirth.Format("2006-01-02")
+	}
+	return resource
+}
+
+// toModel maps a FHIR Patient to a new patient of hospitalID. It returns a
+// message explaining why the resource cannot be stored, or "".
+func (r Patient) toModel(hospitalID string) (models.Patient, string) {
+	p := models.Patient{HospitalID: hospitalID}
+	for _, id := range r.Identifier {
+		switch {
+		case id.System == SystemNationalID || id.hasType(TypeNationalID):
+			p.NationalID = id.Value
+		case id.hasType(TypePassport):
+			p.PassportID = id.Value
+		case id.hasType(TypeMedicalRec):
+			p.PatientHN = id.Value
+		}
+	}
+	if p.PatientHN == "" {
+		return p, "Patient.identifier must contain the hospital number (type MR)"
+	}
+
+	for _, name := range r.Name {
+		first, middle := "", ""
+		if len(name.Given) > 0 {
+			first = name.Given[0]
+			middle = strings.Join(name.Given[1:], " ")
+		}
+		lang := name.language()
+		if lang == "" && isThai(name.Family+first) {
+			lang = "th"
+		}
+		if strings.HasPrefix(lang, "th") {
+			p.FirstNameTH, p.MiddleNameTH, p.LastNameTH = first, middle, name.Family
+		} else {
+			p.FirstNameEN, p.MiddleNameEN, p.LastNameEN = first, middle, name.Family
+		}
+	}
+
+	for _, t := range r.Telecom {
+		switch t.System {
+		case "phone":
+			p.PhoneNumber = t.Value
+		case "email":
+			p.Email = t.Value
+		}
+	}
+	for code, gender := range genders {
+		if gender == r.Gender {
+			p.Gender = code
+		}
+	}
+	if r.BirthDate != "" {
+		dob, err := time.Parse("2006-01-02", r.BirthDate)
+		if err != nil {
+			return p, "birthDate must be a full date (YYYY-MM-DD)"
+		}
+		p.DateOfBirth = dob
+	}
+	return p, ""
+}
+
+func FromHospital(h models.Hospital) Organization {
+	resource := Organization{
+		ResourceType: "Organization",
+		ID:           h.ID,
+		Identifier:   []Identifier{{Use: "official", Type: identifierType(TypeOrgID), Value: h.ID}},
+		Active:       true,
+		Name:         h.Name,
+	}
+	if h.Address != "" {
+		resource.Address = []Address{{Text: h.Address}}
+	}
+	return resource
+}
+
+// FromStaff maps a staff member to a Practitioner. The login username is the
+// identifier and the role is the qualification.
+func FromStaff(s models.Staff) Practitioner {
+	resource := Practitioner{
+		ResourceType: "Practitioner",
+		ID:           strconv.FormatUint(uint64(s.ID), 10),
+		Identifier:   []Identifier{{Use: "usual", Type: identifierType(TypeProviderNum), Value: s.Username}},
+		Active:       true,
+	}
+	if s.FullName != "" {
+		resource.Name = []HumanName{{Use: "official", Text: s.FullName}}
+	}
+	if s.Role != "" {
+		resource.Qualification = []Qualification{{
+			Code:   CodeableConcept{Text: s.Role},
+			Issuer: &Reference{Reference: "Organization/" + s.HospitalID},
+		}}
+	}
+	return resource
+}
+
+func humanName(lang, first, middle, last string) (HumanName, bool) {
+	name := HumanName{
+		Extension: []Extension{{URL: ExtensionLanguage, ValueCode: lang}},
+		Use:       "official",
+		Family:    last,
+	}
+	for _, given := range []string{first, middle} {
+		if given != "" {
+			name.Given = append(name.Given, given)
+		}
+	}
+	name.Text = strings.Join(append(append([]string{}, name.Given...), last), " ")
+	name.Text = strings.TrimSpace(name.Text)
+	return name, name.Text != ""
+}
+
+func isThai(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Thai, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package fhir
+
+// The subset of FHIR R4 data types and resources the facade reads and
+// writes. Fields the hospital system has no data for are left out.
+
+const (
+	SystemNationalID  = "https://terminology.moph.go.th/CodeSystem/cid"
+	SystemIdentifier  = "http://terminology.hl7.org/CodeSystem/v2-0203"
+	SystemIssueType   = "http://hl7.org/fhir/issue-type"
+	ExtensionLanguage = "http://hl7.org/fhir/StructureDefinition/language"
+
+	// Identifier type codes from the v2-0203 table.
+	TypeNationalID  = "NI"
+	TypePassport    = "PPN"
+	TypeMedicalRec  = "MR"
+	TypeOrgID       = "XX"
+	TypeProviderNum = "PRN"
+)
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Extension struct {
+	URL       string `json:"url"`
+	ValueCode string `json:"valueCode,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Identifier struct {
+	Use      string           `json:"use,omitempty"`
+	Type     *CodeableConcept `json:"type,omitempty"`
+	System   string           `json:"system,omitempty"`
+	Value    string           `json:"value"`
+	Assigner *Reference       `json:"assigner,omitempty"`
+}
+
+// HumanName carries its language in the standard language extension, so a
+// patient has one name in Thai and one in English.
+type HumanName struct {
+	Extension []Extension `json:"extension,omitempty"`
+	Use       string      `json:"use,omitempty"`
+	Text      string      `json:"text,omitempty"`
+	Family    string      `json:"family,omitempty"`
+	Given     []string    `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Address struct {
+	Text string `json:"text,omitempty"`
+}
+
+type Patient struct {
+	ResourceType         string         `json:"resourceType"`
+	ID                   string         `json:"id,omitempty"`
+	Identifier           []Identifier   `json:"identifier,omitempty"`
+	Name                 []HumanName    `json:"name,omitempty"`
+	Telecom              []ContactPoint `json:"telecom,omitempty"`
+	Gender               string         `json:"gender,omitempty"`
+	BirthDate            string         `json:"birthDate,omitempty"`
+	ManagingOrganization *Reference     `json:"managingOrganization,omitempty"`
+}
+
+type Organization struct {
+	ResourceType string       `json:"resourceType"`
+	ID           string       `json:"id,omitempty"`
+	Identifier   []Identifier `json:"identifier,omitempty"`
+	Active       bool         `json:"active"`
+	Name         string       `json:"name"`
+	Address      []Address    `json:"address,omitempty"`
+}
+
+type Qualification struct {
+	Code   CodeableConcept `json:"code"`
+	Issuer *Reference      `json:"issuer,omitempty"`
+}
+
+type Practitioner struct {
+	ResourceType  string          `json:"resourceType"`
+	ID            string          `json:"id,omitempty"`
+	Identifier    []Identifier    `json:"identifier,omitempty"`
+	Active        bool            `json:"active"`
+	Name          []HumanName     `json:"name,omitempty"`
+	Qualification []Qualification `json:"qualification,omitempty"`
+}
+
+type BundleEntry struct {
+	FullURL  string       `json:"fullUrl,omitempty"`
+	Resource interface{}  `json:"resource"`
+	Search   *BundleMatch `json:"search,omitempty"`
+}
+
+type BundleMatch struct {
+	Mode string `json:"mode"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int           `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+func identifierType(code string) *CodeableConcept {
+	return &CodeableConcept{Coding: []Coding{{System: SystemIdentifier, Code: code}}}
+}
+
+// hasType reports whether the identifier is typed with the v2-0203 code.
+func (id Identifier) hasType(code string) bool {
+	if id.Type == nil {
+		return false
+	}
+	for _, c := range id.Type.Coding {
+		if c.Code == code && (c.System == "" || c.System == SystemIdentifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// language returns the language code of a name, or "" if it has none.
+func (n HumanName) language() string {
+	for _, ext := range n.Extension {
+		if ext.URL == ExtensionLanguage {
+			return ext.ValueCode
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+// Package health serves the liveness and readiness probes used by Docker
+// and the load balancer.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/myapp/app/database"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkTimeout bounds a readiness probe, so a hung database fails it
+// instead of holding it open.
+const checkTimeout = 2 * time.Second
+
+// Check is one dependency the server needs in order to serve requests.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type Handler struct {
+	Checks []Check
+}
+
+func NewHandler(checks ...Check) *Handler {
+	return &Handler{Checks: checks}
+}
+
+// Liveness reports that the process is serving requests. It checks no
+// dependencies, so a database outage does not get the container restarted.
+func (h *Handler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness runs every check and answers 503 if any fails, so traffic is
+// only sent to an instance that can serve it. Failures are logged; the
+// response names the failed checks without their errors, which may
+// describe the network or the database.
+func (h *Handler) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+	defer cancel()
+	status, checks := http.StatusOK, gin.H{}
+	for _, check := range h.Checks {
+		if err := check.Run(ctx); err != nil {
+			log.Printf("Readiness check %s failed: %v", check.Name, err)
+			status = http.StatusServiceUnavailable
+			checks[check.Name] = "fail"
+			continue
+		}
+		checks[check.Name] = "ok"
+	}
+	if status != http.StatusOK {
+		c.JSON(status, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(status, gin.H{"status": "ok", "checks": checks})
+}
+
+// Database checks that db answers a ping.
+func Database(db *gorm.DB) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}}
+}
+
+// Migrations checks that every migration this build knows has been
+// applied to db.
+func Migrations(db *gorm.DB) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		states, err := database.MigrationStatus(db.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		pending := 0
+		for _, state := range states {
+			if state.AppliedAt == nil {
+				pending++
+			}
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d pending migrations", pending)
+		}
+		return nil
+	}}
+}
+
+// Loaded checks that the key called name has been loaded.
+func Loaded(name string, loaded func() bool) Check {
+	return Check{Name: name, Run: func(context.Context) error {
+		if !loaded() {
+			return errors.New("not loaded")
+		}
+		return nil
+	}}
+}
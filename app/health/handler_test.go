@@ -0,0 +1,91 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/myapp/app/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB(migrated bool) *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // every :memory: connection is a separate database
+	if migrated {
+		database.MigrateUp(db)
+	}
+	return db
+}
+
+func setupRouter(h *Handler) *gin.Engine {
+	r := gin.Default()
+	r.GET("/healthz", h.Liveness)
+	r.GET("/readyz", h.Readiness)
+	return r
+}
+
+func get(r *gin.Engine, path string) (*httptest.ResponseRecorder, map[string]any) {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var body map[string]any
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func TestHealth(t *testing.T) {
+	keyLoaded := true
+	checks := func(db *gorm.DB) []Check {
+		return []Check{Database(db), Migrations(db), Loaded("jwt_key", func() bool { return keyLoaded })}
+	}
+
+	t.Run("Readiness Success", func(t *testing.T) {
+		r := setupRouter(NewHandler(checks(SetupTestDB(true))...))
+		w, body := get(r, "/readyz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, map[string]any{"database": "ok", "migrations": "ok", "jwt_key": "ok"}, body["checks"])
+	})
+
+	t.Run("Readiness Fail Case Pending Migrations", func(t *testing.T) {
+		r := setupRouter(NewHandler(checks(SetupTestDB(false))...))
+		w, body := get(r, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "unavailable", body["status"])
+		assert.Equal(t, "fail", body["checks"].(map[string]any)["migrations"])
+		assert.Equal(t, "ok", body["checks"].(map[string]any)["database"])
+	})
+
+	t.Run("Readiness Fail Case Database Down", func(t *testing.T) {
+		db := SetupTestDB(true)
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		w, body := get(setupRouter(NewHandler(checks(db)...)), "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "fail", body["checks"].(map[string]any)["database"])
+		assert.NotContains(t, w.Body.String(), "closed", "errors stay in the log")
+	})
+
+	t.Run("Readiness Fail Case Key Not Loaded", func(t *testing.T) {
+		keyLoaded = false
+		defer func() { keyLoaded = true }()
+		w, body := get(setupRouter(NewHandler(checks(SetupTestDB(true))...)), "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "fail", body["checks"].(map[string]any)["jwt_key"])
+	})
+
+	t.Run("Liveness Success With Database Down", func(t *testing.T) {
+		db := SetupTestDB(true)
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		w, body := get(setupRouter(NewHandler(checks(db)...)), "/healthz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", body["status"])
+	})
+}
@@ -0,0 +1,242 @@
+package hl7
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+// RejectError marks a message that cannot be understood at all, answered
+// with AR. Other processing errors are answered with AE.
+type RejectError struct{ Reason string }
+
+func (e *RejectError) Error() string { return e.Reason }
+
+// adtEvents are the message types Process applies.
+var adtEvents = []string{"ADT^A04", "ADT^A08", "ADT^A40"}
+
+var encounterTypes = map[string]string{"O": models.EncounterOPD, "I": models.EncounterIPD, "E": models.EncounterER}
+
+// Process applies an ADT message to hospitalID's patients:
+// A04 registers (or refreshes) a patient and opens the visit in PV1,
+// A08 updates a patient's demographics and A40 merges the patient in MRG
+// into the one in PID. tx should be a transaction. registered reports
+// whether an A04 created a new patient, to be counted once tx commits.
+func Process(tx *gorm.DB, hospitalID string, m *Message) (registered bool, err error) {
+	code, event := m.Type()
+	if code != "ADT" {
+		return false, &RejectError{Reason: "unsupported message type " + code}
+	}
+	if m.Segment("PID") == nil {
+		return false, &RejectError{Reason: "message has no PID segment"}
+	}
+	demographics := parsePID(m)
+	if demographics.PatientHN == "" {
+		return false, &RejectError{Reason: "PID-3 carries no hospital number"}
+	}
+
+	switch event {
+	case "A04":
+		return register(tx, hospitalID, demographics, m)
+	case "A08":
+		patient, err := findByHN(tx, hospitalID, demographics.PatientHN)
+		if err != nil {
+			return false, err
+		}
+		return false, tx.Model(&patient).Updates(demographics).Error
+	case "A40":
+		return false, merge(tx, hospitalID, demographics.PatientHN, m.Component(m.Field("MRG", 1), 1))
+	}
+	return false, &RejectError{Reason: "unsupported trigger event " + event}
+}
+
+func register(tx *gorm.DB, hospitalID string, demographics models.Patient, m *Message) (bool, error) {
+	patient, err := findByHN(tx, hospitalID, demographics.PatientHN)
+	created := false
+	switch {
+	case err == nil:
+		// a repeated A04 refreshes the registration instead of duplicating it
+		if err := tx.Model(&patient).Updates(demographics).Error; err != nil {
+			return false, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		patient = demographics
+		patient.ID = newID()
+		patient.HospitalID = hospitalID
+		if err := tx.Create(&patient).Error; err != nil {
+			return false, err
+		}
+		// messages for this HN that failed before it was registered
+		if err := LinkMessages(tx, hospitalID, patient.PatientHN, patient.ID); err != nil {
+			return false, err
+		}
+		created = true
+	default:
+		return false, err
+	}
+
+	if m.Segment("PV1") == nil {
+		return created, nil
+	}
+	kind, ok := encounterTypes[m.Field("PV1", 2)]
+	if !ok {
+		return false, fmt.Errorf("PV1-2 patient class %q is not O, I or E", m.Field("PV1", 2))
+	}
+	started := parseTS(m.Field("PV1", 44))
+	if started.IsZero() {
+		started = time.Now()
+	}
+	return created, tx.Create(&models.Encounter{
+		PatientID:  patient.ID,
+		HospitalID: hospitalID,
+		Type:       kind,
+		StartedAt:  started,
+		CreatedBy:  "hl7",
+	}).Error
+}
+
+// merge moves every record of the prior patient to the surviving one and
+// removes the prior patient.
+func merge(tx *gorm.DB, hospitalID, survivorHN, priorHN string) error {
+	if priorHN == "" {
+		return &RejectError{Reason: "A40 needs the prior patient in MRG-1"}
+	}
+	survivor, err := findByHN(tx, hospitalID, survivorHN)
+	if err != nil {
+		return err
+	}
+	prior, err := findByHN(tx, hospitalID, priorHN)
+	if err != nil {
+		return err
+	}
+	if prior.ID == survivor.ID {
+		return nil
+	}
+
+	for _, table := range models.PatientRecords {
+		if err := tx.Model(table).Where("patient_id = ? AND hospital_id = ?", prior.ID, hospitalID).
+			Update("patient_id", survivor.ID).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(&models.Referral{}).Where("patient_id = ? AND from_hospital_id = ?", prior.ID, hospitalID).
+		Update("patient_id", survivor.ID).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&prior).Error
+}
+
+// LinkMessages links the hospital's stored messages that carry hn in PID-3
+// but no patient, such as ones that failed before the patient existed or
+// arrived before messages were linked, to patientID. Raw repeats the
+// patient's identifiers, so an erasure has to reach them.
+func LinkMessages(tx *gorm.DB, hospitalID, hn, patientID string) error {
+	var messages []models.HL7Message
+	if err := tx.Select("id", "raw").
+		Where("hospital_id = ? AND (patient_id = '' OR patient_id IS NULL) AND raw LIKE ?", hospitalID, "%"+hn+"%").
+		Find(&messages).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	for _, msg := range messages {
+		// the LIKE only narrows the search; the HN must be the one in PID-3
+		if m, err := Parse(msg.Raw); err == nil && m.Segment("PID") != nil && parsePID(m).PatientHN == hn {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Model(&models.HL7Message{}).Where("id IN ?", ids).Update("patient_id", patientID).Error
+}
+
+func findByHN(tx *gorm.DB, hospitalID, hn string) (models.Patient, error) {
+	var patient models.Patient
+	err := tx.Where("hospital_id = ? AND patient_hn = ?", hospitalID, hn).First(&patient).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return patient, fmt.Errorf("no patient with HN %s: %w", hn, err)
+	}
+	return patient, err
+}
+
+// parsePID reads the demographics in PID. Only fields present in the
+// message are set, so an update never blanks what the sender left out.
+func parsePID(m *Message) models.Patient {
+	var p models.Patient
+	for _, cx := range m.Repetitions(m.Field("PID", 3)) {
+		value := m.Component(cx, 1)
+		switch strings.ToUpper(m.Component(cx, 5)) {
+		case "MR", "HN", "PI":
+			p.PatientHN = value
+		case "NI", "CID", "NNTHA":
+			p.NationalID = value
+		case "PPN":
+			p.PassportID = value
+		case "":
+			if p.PatientHN == "" {
+				p.PatientHN = value
+			}
+		}
+	}
+	if ssn := m.Field("PID", 19); p.NationalID == "" && len(ssn) == 13 {
+		p.NationalID = ssn
+	}
+
+	for _, xpn := range m.Repetitions(m.Field("PID", 5)) {
+		family, given, middle := m.Component(xpn, 1), m.Component(xpn, 2), m.Component(xpn, 3)
+		if isThai(family + given) {
+			p.LastNameTH, p.FirstNameTH, p.MiddleNameTH = family, given, middle
+		} else {
+			p.LastNameEN, p.FirstNameEN, p.MiddleNameEN = family, given, middle
+		}
+	}
+
+	p.DateOfBirth = parseTS(m.Field("PID", 7))
+	switch sex := m.Field("PID", 8); sex {
+	case "M", "F", "O":
+		p.Gender = sex
+	}
+	for _, xtn := range m.Repetitions(m.Field("PID", 13)) {
+		if strings.EqualFold(m.Component(xtn, 3), "Internet") {
+			p.Email = m.Component(xtn, 4)
+		} else if number := m.Component(xtn, 1); number != "" && p.PhoneNumber == "" {
+			p.PhoneNumber = number
+		}
+	}
+	return p
+}
+
+// parseTS reads an HL7 timestamp (YYYYMMDD[HHMM[SS]]) in local time, or the
+// zero time if it is missing or malformed.
+func parseTS(ts string) time.Time {
+	for _, layout := range []string{"20060102150405", "200601021504", "20060102"} {
+		if len(ts) >= len(layout) {
+			if t, err := time.ParseInLocation(layout, ts[:len(layout)], time.Local); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func isThai(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Thai, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,93 @@
+package hl7
+
+import (
+	"net/http"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the HL7 message endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+// GetMessages lists the HL7 messages received for the caller's hospital,
+// newest first, optionally filtered by status.
+func (h *Handler) GetMessages(c *gin.Context) {
+	staffHospital, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", staffHospital)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var messages []models.HL7Message
+	if err := query.Order("received_at DESC").Order("id DESC").Limit(200).Find(&messages).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลข้อความ HL7 ได้", "Could not load HL7 messages").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+// ReprocessMessage applies a failed message again. The raw text may be
+// corrected in the same request.
+func (h *Handler) ReprocessMessage(c *gin.Context) {
+	var input struct {
+		Raw string `json:"raw"`
+	}
+	c.ShouldBindJSON(&input)
+	staffHospital, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	var msg models.HL7Message
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&msg).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบข้อความ HL7 ที่ระบุ", "HL7 message not found"))
+		return
+	}
+	if msg.Status == models.HL7Processed {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ข้อความนี้ประมวลผลสำเร็จแล้ว", "The message has already been processed"))
+		return
+	}
+	if input.Raw != "" {
+		msg.Raw = input.Raw
+	}
+	if msg.Raw == "" {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ข้อความนี้ถูกลบตามคำขอของเจ้าของข้อมูลแล้ว", "The message was erased at the data subject's request"))
+		return
+	}
+
+	if err := Reprocess(h.DB.WithContext(c.Request.Context()), &msg); err != nil && msg.Status != models.HL7Failed {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกผลการประมวลผลข้อความได้", "Could not save the processing result").Wrap(err))
+		return
+	}
+	if msg.Status == models.HL7Failed {
+		c.JSON(http.StatusUnprocessableEntity, msg)
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+func requireAdmin(c *gin.Context) (string, bool) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่จัดการข้อความ HL7 ได้", "Only admins can manage HL7 messages"))
+		return "", false
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return "", false
+	}
+	return staffHospital, true
+}
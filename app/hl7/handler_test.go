@@ -0,0 +1,331 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/metrics"
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Referral{}, &models.HL7Message{})
+	db.AutoMigrate(models.PatientRecords...)
+	db.Create(&models.Hospital{ID: "1", Name: "BKK Hospital"})
+	db.Create(&models.Hospital{ID: "2", Name: "Bangna Medical"})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/hl7/message", h.GetMessages)
+	r.POST("/hl7/message/reprocess/:id", h.ReprocessMessage)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID, role))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func adt(event, controlID string, segments ...string) string {
+	msh := "MSH|^~\\&|LEGACY-HIS|BKK|HOSPITAL-SYSTEM|1|20240501083000||ADT^" + event + "|" + controlID + "|P|2.5"
+	return strings.Join(append([]string{msh}, segments...), "\r")
+}
+
+func msa(ack string) string {
+	for _, segment := range strings.Split(ack, "\r") {
+		if strings.HasPrefix(segment, "MSA|") {
+			return segment
+		}
+	}
+	return ""
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Parse Fields And Components", func(t *testing.T) {
+		m, err := Parse("MSH|^~\\&|HIS|BKK|||20240501||ADT^A04^ADT_A01|C1|P|2.5\nPID|||HN001^^^BKK^MR~1100700000001^^^TH^NI||Jaidee^Somchai\\T\\Co")
+		assert.NoError(t, err)
+		code, event := m.Type()
+		assert.Equal(t, "ADT", code)
+		assert.Equal(t, "A04", event)
+		assert.Equal(t, "C1", m.ControlID())
+		assert.Equal(t, "HIS", m.Field("MSH", 3))
+		assert.Len(t, m.Repetitions(m.Field("PID", 3)), 2)
+		assert.Equal(t, "Somchai&Co", m.Component(m.Field("PID", 5), 2))
+	})
+
+	t.Run("Parse Fail Case No MSH", func(t *testing.T) {
+		_, err := Parse("PID|||HN001")
+		assert.ErrorIs(t, err, ErrNoMSH)
+	})
+}
+
+func TestReceive(t *testing.T) {
+	db := SetupTestDB()
+
+	t.Run("A04 Registers Patient And Visit", func(t *testing.T) {
+		registered := metrics.PatientsRegistered.WithLabelValues("1", metrics.SourceHL7)
+		before := testutil.ToFloat64(registered)
+		ack := Receive(db, "1", adt("A04", "C1",
+			"PID|1||HN100^^^BKK^MR~1100700000100^^^TH^NI||ใจดี^สมชาย~Jaidee^Somchai||19800501|M|||||0812345678",
+			"PV1|1|O"+strings.Repeat("|", 42)+"20240501080000"))
+		assert.Equal(t, "MSA|AA|C1", msa(ack))
+		assert.Equal(t, before+1, testutil.ToFloat64(registered))
+
+		// a repeated A04 refreshes the patient and is not a new registration
+		Receive(db, "1", adt("A04", "C1R", "PID|1||HN100^^^BKK^MR"))
+		assert.Equal(t, before+1, testutil.ToFloat64(registered))
+
+		var patient models.Patient
+		assert.NoError(t, db.Where("hospital_id = ? AND patient_hn = ?", "1", "HN100").First(&patient).Error)
+		assert.Equal(t, "สมชาย", patient.FirstNameTH)
+		assert.Equal(t, "Somchai", patient.FirstNameEN)
+		assert.Equal(t, "1100700000100", patient.NationalID)
+		assert.Equal(t, "0812345678", patient.PhoneNumber)
+
+		var encounter models.Encounter
+		assert.NoError(t, db.Where("patient_id = ?", patient.ID).First(&encounter).Error)
+		assert.Equal(t, models.EncounterOPD, encounter.Type)
+		assert.Equal(t, 8, encounter.StartedAt.Hour())
+
+		var stored models.HL7Message
+		db.Where("control_id = ?", "C1").First(&stored)
+		assert.Equal(t, patient.ID, stored.PatientID)
+	})
+
+	t.Run("Resent A04 Is Acknowledged Once", func(t *testing.T) {
+		message := adt("A04", "C1D", "PID|1||HN150^^^BKK^MR||Jaidee^Somsri", "PV1|1|O")
+		assert.Equal(t, "MSA|AA|C1D", msa(Receive(db, "1", message)))
+		assert.Equal(t, "MSA|AA|C1D", msa(Receive(db, "1", message)))
+
+		var patient models.Patient
+		db.Where("hospital_id = ? AND patient_hn = ?", "1", "HN150").First(&patient)
+		var count int64
+		db.Model(&models.Encounter{}).Where("patient_id = ?", patient.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+		db.Model(&models.HL7Message{}).Where("control_id = ?", "C1D").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("A08 Updates Only Sent Fields", func(t *testing.T) {
+		ack := Receive(db, "1", adt("A08", "C2", "PID|1||HN100^^^BKK^MR||||||||||0899999999"))
+		assert.Equal(t, "MSA|AA|C2", msa(ack))
+
+		var patient models.Patient
+		db.Where("patient_hn = ?", "HN100").First(&patient)
+		assert.Equal(t, "0899999999", patient.PhoneNumber)
+		assert.Equal(t, "Somchai", patient.FirstNameEN)
+	})
+
+	t.Run("A40 Merges Records Into Survivor", func(t *testing.T) {
+		Receive(db, "1", adt("A04", "C3", "PID|1||HN200^^^BKK^MR||Jaidee^Somchai"))
+		var prior, survivor models.Patient
+		db.Where("patient_hn = ?", "HN200").First(&prior)
+		db.Where("patient_hn = ?", "HN100").First(&survivor)
+		db.Create(&models.Allergy{PatientID: prior.ID, HospitalID: "1", Category: "drug", Substance: "Penicillin",
+			Severity: "severe", VerificationStatus: "confirmed"})
+
+		ack := Receive(db, "1", adt("A40", "C4", "PID|1||HN100^^^BKK^MR", "MRG|HN200^^^BKK^MR"))
+		assert.Equal(t, "MSA|AA|C4", msa(ack))
+
+		var count int64
+		db.Model(&models.Patient{}).Where("id = ?", prior.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+		db.Model(&models.Allergy{}).Where("patient_id = ?", survivor.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Unknown Patient Is NAKed And Stored", func(t *testing.T) {
+		ack := Receive(db, "1", adt("A08", "C5", "PID|1||HN999^^^BKK^MR"))
+		assert.Equal(t, "MSA|AE|C5", msa(ack))
+		assert.Contains(t, ack, "ERR|")
+
+		var stored models.HL7Message
+		assert.NoError(t, db.Where("control_id = ?", "C5").First(&stored).Error)
+		assert.Equal(t, models.HL7Failed, stored.Status)
+		assert.Equal(t, "ADT^A08", stored.MessageType)
+		assert.Empty(t, stored.PatientID)
+	})
+
+	t.Run("Registration Links Earlier Failed Messages", func(t *testing.T) {
+		ack := Receive(db, "1", adt("A04", "C6", "PID|1||HN300^^^BKK^MR||Jaidee^Somying", "PV1|1|X"))
+		assert.Equal(t, "MSA|AE|C6", msa(ack))
+
+		Receive(db, "1", adt("A04", "C7", "PID|1||HN300^^^BKK^MR||Jaidee^Somying"))
+		var patient models.Patient
+		db.Where("patient_hn = ?", "HN300").First(&patient)
+		var failed models.HL7Message
+		db.Where("control_id = ?", "C6").First(&failed)
+		assert.Equal(t, models.HL7Failed, failed.Status)
+		assert.Equal(t, patient.ID, failed.PatientID)
+	})
+
+	t.Run("Malformed Message Is Rejected And Stored", func(t *testing.T) {
+		ack := Receive(db, "1", "garbage")
+		assert.Equal(t, "MSA|AR|", msa(ack))
+
+		var count int64
+		db.Model(&models.HL7Message{}).Where("raw = ? AND status = ?", "garbage", models.HL7Failed).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestReadFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("noise\x0bMSH|^~\\&|A\rPID|1\x1c\x0d\x0bMSH|^~\\&|B\x1c\x0d"))
+	first, err := readFrame(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "MSH|^~\\&|A\rPID|1", first)
+	second, err := readFrame(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "MSH|^~\\&|B", second)
+
+	r = bufio.NewReader(strings.NewReader("\x0b" + strings.Repeat("x", maxFrameSize) + "\x1c"))
+	_, err = readFrame(r)
+	assert.NoError(t, err)
+	r = bufio.NewReader(strings.NewReader("\x0b" + strings.Repeat("x", maxFrameSize+1) + "\x1c"))
+	_, err = readFrame(r)
+	assert.ErrorIs(t, err, errFrameTooLarge)
+}
+
+func TestServeFrameTooLarge(t *testing.T) {
+	db := SetupTestDB()
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		serve(context.Background(), db, server, "1")
+		close(done)
+	}()
+	// the server stops reading part way, so the write only ends on close
+	go fmt.Fprintf(client, "\x0b%s\x1c\x0d", strings.Repeat("x", 2*maxFrameSize))
+
+	ack, err := readFrame(bufio.NewReader(client))
+	assert.NoError(t, err)
+	assert.Equal(t, "MSA|AR|", msa(ack))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not close the connection")
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	db := SetupTestDB()
+	client, server := net.Pipe()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		serve(ctx, db, server, "1")
+		close(done)
+	}()
+
+	fmt.Fprintf(client, "\x0b%s\x1c\x0d", adt("A04", "MSG900", "PID|1||HN900||Doe^John||19800101|M"))
+	ack, err := readFrame(bufio.NewReader(client))
+	assert.NoError(t, err)
+	assert.Equal(t, "MSA|AA|MSG900", msa(ack))
+
+	// an idle connection is closed as soon as shutdown starts
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after cancel")
+	}
+}
+
+func TestReprocessMessage(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	Receive(db, "1", adt("A04", "C1", "PID|1||^^^BKK^MR||Jaidee^Somchai"))
+	var failed models.HL7Message
+	db.Where("control_id = ?", "C1").First(&failed)
+	path := "/hl7/message/reprocess/" + fmt.Sprint(failed.ID)
+
+	t.Run("List Failed Messages", func(t *testing.T) {
+		w := send(r, "GET", "/hl7/message?status=failed", nil, "1", "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"control_id":"C1"`)
+	})
+
+	t.Run("Reprocess Fail Case Not Admin", func(t *testing.T) {
+		w := send(r, "POST", path, nil, "1", "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Reprocess Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", path, nil, "2", "admin")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Reprocess Fail Case Still Invalid", func(t *testing.T) {
+		w := send(r, "POST", path, nil, "1", "admin")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"attempts":2`)
+	})
+
+	t.Run("Reprocess Corrected Message Success", func(t *testing.T) {
+		w := send(r, "POST", path, map[string]string{
+			"raw": adt("A04", "C1", "PID|1||HN300^^^BKK^MR||Jaidee^Somchai"),
+		}, "1", "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"processed"`)
+
+		var count int64
+		db.Model(&models.Patient{}).Where("patient_hn = ?", "HN300").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Reprocess Fail Case Already Processed", func(t *testing.T) {
+		w := send(r, "POST", path, nil, "1", "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Reprocess Fail Case Erased", func(t *testing.T) {
+		erased := models.HL7Message{HospitalID: "1", PatientID: "001", ControlID: "C9", Status: models.HL7Failed}
+		db.Create(&erased)
+		w := send(r, "POST", "/hl7/message/reprocess/"+fmt.Sprint(erased.ID), nil, "1", "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
@@ -0,0 +1,115 @@
+package hl7
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrNoMSH = errors.New("hl7: message does not start with an MSH segment")
+
+// Message is a parsed HL7 v2 message. Fields are kept raw and split into
+// components and repetitions on access, using the message's own delimiters.
+type Message struct {
+	Segments [][]string
+
+	field, component, repetition, escape, subcomponent byte
+}
+
+// Parse splits an ER7-encoded message into segments and fields. Segments may
+// be separated by CR, LF or CRLF.
+func Parse(raw string) (*Message, error) {
+	raw = strings.TrimLeft(raw, "\r\n \t")
+	if len(raw) < 8 || !strings.HasPrefix(raw, "MSH") {
+		return nil, ErrNoMSH
+	}
+	m := &Message{field: raw[3], component: '^', repetition: '~', escape: '\\', subcomponent: '&'}
+	enc := raw[4:]
+	if i := strings.IndexByte(enc, m.field); i >= 0 {
+		enc = enc[:i]
+	}
+	for i, d := range []*byte{&m.component, &m.repetition, &m.escape, &m.subcomponent} {
+		if i < len(enc) {
+			*d = enc[i]
+		}
+	}
+
+	lines := strings.FieldsFunc(raw, func(r rune) bool { return r == '\r' || r == '\n' })
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, string(m.field))
+		if fields[0] == "MSH" {
+			// MSH-1 is the field separator itself, so shift the fields to keep
+			// MSH-n at index n like every other segment.
+			fields = append([]string{"MSH", string(m.field)}, fields[1:]...)
+		}
+		m.Segments = append(m.Segments, fields)
+	}
+	return m, nil
+}
+
+// Segment returns the first segment with the given name, or nil.
+func (m *Message) Segment(name string) []string {
+	for _, s := range m.Segments {
+		if s[0] == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Field returns field n of the first named segment, unsplit.
+func (m *Message) Field(segment string, n int) string {
+	s := m.Segment(segment)
+	if n >= len(s) {
+		return ""
+	}
+	return s[n]
+}
+
+// Repetitions splits a field into its repetitions.
+func (m *Message) Repetitions(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, string(m.repetition))
+}
+
+// Component returns component n (1-based) of a field or repetition, with
+// escape sequences decoded.
+func (m *Message) Component(field string, n int) string {
+	parts := strings.Split(field, string(m.component))
+	if n < 1 || n > len(parts) {
+		return ""
+	}
+	value := parts[n-1]
+	if i := strings.IndexByte(value, m.subcomponent); i >= 0 {
+		value = value[:i]
+	}
+	return m.unescape(value)
+}
+
+// Type returns the message code and trigger event from MSH-9, e.g. "ADT", "A04".
+func (m *Message) Type() (string, string) {
+	msh9 := m.Field("MSH", 9)
+	return m.Component(msh9, 1), m.Component(msh9, 2)
+}
+
+func (m *Message) ControlID() string {
+	return m.Field("MSH", 10)
+}
+
+func (m *Message) unescape(s string) string {
+	esc := string(m.escape)
+	if !strings.Contains(s, esc) {
+		return s
+	}
+	return strings.NewReplacer(
+		esc+"F"+esc, string(m.field),
+		esc+"S"+esc, string(m.component),
+		esc+"R"+esc, string(m.repetition),
+		esc+"T"+esc, string(m.subcomponent),
+		esc+"E"+esc, esc,
+	).Replace(s)
+}
@@ -0,0 +1,267 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/myapp/app/metrics"
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+// MLLP framing bytes.
+const (
+	startBlock = 0x0b
+	endBlock   = 0x1c
+	carriageRe = 0x0d
+)
+
+const readTimeout = 5 * time.Minute
+
+// maxFrameSize bounds one inbound message. ADT messages are a few KiB; a
+// frame larger than this is not HL7 worth buffering.
+const maxFrameSize = 1 << 20
+
+var errFrameTooLarge = fmt.Errorf("hl7: frame larger than %d bytes", maxFrameSize)
+
+// ListenMLLP accepts HL7 v2 messages over MLLP on addr for hospitalID until
+// ctx is cancelled. Every message is stored and answered with an ACK, or a
+// NAK carrying the reason when it could not be applied. On cancellation it
+// stops accepting, lets each connection finish the message in hand and
+// returns once they are closed.
+func ListenMLLP(ctx context.Context, db *gorm.DB, addr, hospitalID string) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	log.Println("HL7 MLLP listener on", ln.Addr())
+
+	var conns sync.WaitGroup
+	defer conns.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Println("HL7 accept:", err)
+			continue
+		}
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			serve(ctx, db, conn, hospitalID)
+		}()
+	}
+}
+
+func serve(ctx context.Context, db *gorm.DB, conn net.Conn, hospitalID string) {
+	defer conn.Close()
+	// Cancelling ctx interrupts a connection waiting for its next message.
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if ctx.Err() != nil {
+			return
+		}
+		raw, err := readFrame(r)
+		if errors.Is(err, errFrameTooLarge) {
+			// the rest of the frame is still unread, so the connection
+			// cannot carry on after the NAK
+			log.Println("HL7 read:", err)
+			writeFrame(conn, ack(nil, hospitalID, &RejectError{Reason: err.Error()}))
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Println("HL7 read:", err)
+			}
+			return
+		}
+		if err := writeFrame(conn, Receive(db, hospitalID, raw)); err != nil {
+			return
+		}
+	}
+}
+
+// readFrame reads one <VT>message<FS><CR> frame, skipping anything before
+// the start block. A message longer than maxFrameSize fails with
+// errFrameTooLarge.
+func readFrame(r *bufio.Reader) (string, error) {
+	for {
+		_, err := r.ReadSlice(startBlock)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	var body []byte
+	for {
+		chunk, err := r.ReadSlice(endBlock)
+		if len(body)+len(chunk) > maxFrameSize+1 {
+			return "", errFrameTooLarge
+		}
+		body = append(body, chunk...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	if b, err := r.ReadByte(); err == nil && b != carriageRe {
+		r.UnreadByte()
+	}
+	return string(body[:len(body)-1]), nil
+}
+
+func writeFrame(w io.Writer, message string) error {
+	if _, err := w.Write([]byte{startBlock}); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, message); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{endBlock, carriageRe})
+	return err
+}
+
+// Receive stores an inbound message, applies it and returns the ACK to send.
+// A message whose control ID was already processed is one the sender
+// repeated after losing our ACK; it is acknowledged again, not reapplied.
+func Receive(db *gorm.DB, hospitalID, raw string) string {
+	if parsed, err := Parse(raw); err == nil && parsed.ControlID() != "" {
+		var seen int64
+		if err := db.Model(&models.HL7Message{}).
+			Where("hospital_id = ? AND control_id = ? AND status = ?", hospitalID, parsed.ControlID(), models.HL7Processed).
+			Count(&seen).Error; err == nil && seen > 0 {
+			return ack(parsed, hospitalID, nil)
+		}
+	}
+	msg := models.HL7Message{
+		HospitalID: hospitalID,
+		Raw:        raw,
+		ReceivedAt: time.Now(),
+	}
+	parsed, err := apply(db, &msg)
+	if err := db.Create(&msg).Error; err != nil {
+		log.Println("HL7 store:", err)
+	}
+	return ack(parsed, hospitalID, err)
+}
+
+// Reprocess applies a stored message again, e.g. after its Raw text has been
+// corrected, and records the outcome on it.
+func Reprocess(db *gorm.DB, msg *models.HL7Message) error {
+	_, err := apply(db, msg)
+	if saveErr := db.Save(msg).Error; saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+func apply(db *gorm.DB, msg *models.HL7Message) (*Message, error) {
+	msg.Attempts++
+	parsed, err := Parse(msg.Raw)
+	if err != nil {
+		err = &RejectError{Reason: err.Error()}
+	} else {
+		code, event := parsed.Type()
+		msg.ControlID = parsed.ControlID()
+		msg.MessageType = code + "^" + event
+		var registered bool
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			registered, err = Process(tx, msg.HospitalID, parsed)
+			return err
+		})
+		if err == nil && registered {
+			metrics.PatientsRegistered.WithLabelValues(msg.HospitalID, metrics.SourceHL7).Inc()
+		}
+		// link the message to its patient, so an erasure reaches the
+		// identifiers in Raw
+		if hn := parsePID(parsed).PatientHN; hn != "" {
+			if patient, findErr := findByHN(db, msg.HospitalID, hn); findErr == nil {
+				msg.PatientID = patient.ID
+			}
+		}
+	}
+
+	if err != nil {
+		msg.Status = models.HL7Failed
+		msg.Error = err.Error()
+	} else {
+		now := time.Now()
+		msg.Status = models.HL7Processed
+		msg.Error = ""
+		msg.ProcessedAt = &now
+	}
+	// the type comes from the sender; anything unexpected shares one series
+	messageType := msg.MessageType
+	if !slices.Contains(adtEvents, messageType) {
+		messageType = "other"
+	}
+	metrics.HL7Messages.WithLabelValues(messageType, msg.Status).Inc()
+	return parsed, err
+}
+
+// ack builds the acknowledgement for a message: AA when applied, AR when it
+// could not be understood and AE when applying it failed.
+func ack(m *Message, hospitalID string, err error) string {
+	code := "AA"
+	var reject *RejectError
+	switch {
+	case errors.As(err, &reject):
+		code = "AR"
+	case err != nil:
+		code = "AE"
+	}
+
+	var sendingApp, sendingFacility, controlID, event, version string
+	version = "2.5"
+	if m != nil {
+		sendingApp = m.Field("MSH", 3)
+		sendingFacility = m.Field("MSH", 4)
+		controlID = m.ControlID()
+		_, event = m.Type()
+		if v := m.Field("MSH", 12); v != "" {
+			version = v
+		}
+	}
+
+	now := time.Now()
+	segments := []string{
+		strings.Join([]string{"MSH", `^~\&`, "HOSPITAL-SYSTEM", hospitalID, sendingApp, sendingFacility,
+			now.Format("20060102150405"), "", "ACK^" + event + "^ACK", fmt.Sprintf("ACK%d", now.UnixNano()),
+			"P", version}, "|"),
+		strings.Join([]string{"MSA", code, controlID}, "|"),
+	}
+	if err != nil {
+		segments = append(segments, strings.Join([]string{"ERR", "", "", "", "E", "", "", "", escapeText(err.Error())}, "|"))
+	}
+	return strings.Join(segments, "\r") + "\r"
+}
+
+// escapeText makes free text safe to place in a field with the default
+// delimiters.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\E\`, "|", `\F\`, "^", `\S\`, "~", `\R\`, "&", `\T\`, "\r", " ", "\n", " ").Replace(s)
+}
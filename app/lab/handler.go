@@ -0,0 +1,450 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/billing"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the laboratory endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+func (h *Handler) AddTest(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่แก้ไขรายการตรวจได้", "Only admins can edit the lab test catalog"))
+		return
+	}
+	var input models.LabTest
+	if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" || input.Name == "" || input.SpecimenType == "" {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if input.RefLow != nil && input.RefHigh != nil && *input.RefLow > *input.RefHigh {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ค่าอ้างอิงต่ำสุดต้องไม่มากกว่าค่าสูงสุด", "Reference low must not be greater than reference high"))
+		return
+	}
+
+	input.ID = 0
+	input.Active = true
+	err := repository.Duplicate(h.DB, h.DB.WithContext(c.Request.Context()).Create(&input).Error)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "รหัสรายการตรวจนี้มีอยู่แล้ว", "A lab test with this code already exists"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเพิ่มรายการตรวจได้", "Could not add the lab test").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, input)
+}
+
+func (h *Handler) GetTests(c *gin.Context) {
+	var tests []models.LabTest
+	if err := h.DB.WithContext(c.Request.Context()).Where("active = ?", true).Order("code").Find(&tests).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงรายการตรวจได้", "Could not load lab tests").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, tests)
+}
+
+// CreateOrder orders tests for a visit. One specimen with its own barcode is
+// created per specimen type needed by the ordered tests, and each priced test
+// is charged to the visit.
+func (h *Handler) CreateOrder(c *gin.Context) {
+	var input struct {
+		EncounterID uint     `json:"encounter_id" binding:"required"`
+		TestCodes   []string `json:"test_codes" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.EncounterID, staffHospital).
+		First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return
+	}
+
+	var tests []models.LabTest
+	h.DB.WithContext(c.Request.Context()).Where("code IN ? AND active = ?", input.TestCodes, true).Order("code").Find(&tests)
+	if len(tests) != len(input.TestCodes) {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "มีรหัสการตรวจที่ไม่อยู่ในรายการหรือซ้ำกัน", "Some test codes are unknown or duplicated"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	orderedBy, _ := username.(string)
+	order := models.LabOrder{
+		PatientID:   encounter.PatientID,
+		EncounterID: encounter.ID,
+		HospitalID:  staffHospital,
+		Status:      models.LabOrdered,
+		OrderedBy:   orderedBy,
+	}
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		specimens := map[string]*models.Specimen{}
+		for _, test := range tests {
+			specimen, ok := specimens[test.SpecimenType]
+			if !ok {
+				specimen = &models.Specimen{
+					LabOrderID: order.ID,
+					HospitalID: staffHospital,
+					Barcode:    fmt.Sprintf("%08d%02d", order.ID, len(specimens)+1),
+					Type:       test.SpecimenType,
+					Status:     models.SpecimenPending,
+				}
+				if err := tx.Create(specimen).Error; err != nil {
+					return err
+				}
+				specimens[test.SpecimenType] = specimen
+				order.Specimens = append(order.Specimens, *specimen)
+			}
+			item := models.LabOrderItem{LabOrderID: order.ID, TestCode: test.Code, SpecimenID: specimen.ID}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			if err := billing.Capture(tx, encounter, test.Code, 1, models.ChargeSourceLabOrder, item.ID, orderedBy); err != nil {
+				return err
+			}
+			order.Items = append(order.Items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสั่งตรวจได้", "Could not create the lab order").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *Handler) GetOrder(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var order models.LabOrder
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Items").Preload("Specimens").Preload("Results").
+		Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&order).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบคำสั่งตรวจที่ระบุ", "Lab order not found"))
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+var (
+	errOrderHasResults = errors.New("lab order has results")
+	errOrderInvoiced   = errors.New("lab order charges are invoiced")
+)
+
+// CancelOrder cancels an order before any result is recorded and drops the
+// charges it captured. Results can no longer be added to a cancelled order.
+func (h *Handler) CancelOrder(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var order models.LabOrder
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&order).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบคำสั่งตรวจที่ระบุ", "Lab order not found"))
+		return
+	}
+	if order.Status != models.LabOrdered && order.Status != models.LabCollected {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ยกเลิกได้เฉพาะคำสั่งตรวจที่ยังไม่มีผล", "Only orders without results can be cancelled"))
+		return
+	}
+
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var results int64
+		if err := tx.Model(&models.LabResult{}).Where("lab_order_id = ?", order.ID).Count(&results).Error; err != nil {
+			return err
+		}
+		if results > 0 {
+			return errOrderHasResults
+		}
+		charges := tx.Model(&models.Charge{}).Where("source = ? AND source_id IN (?)", models.ChargeSourceLabOrder,
+			tx.Model(&models.LabOrderItem{}).Select("id").Where("lab_order_id = ?", order.ID))
+		var invoiced int64
+		if err := charges.Session(&gorm.Session{}).Where("invoice_id IS NOT NULL").Count(&invoiced).Error; err != nil {
+			return err
+		}
+		if invoiced > 0 {
+			return errOrderInvoiced
+		}
+		if err := charges.Session(&gorm.Session{}).Delete(&models.Charge{}).Error; err != nil {
+			return err
+		}
+		// the status check guards against a result recorded meanwhile
+		result := tx.Model(&models.LabOrder{}).Where("id = ? AND status = ?", order.ID, order.Status).
+			Update("status", models.LabCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderHasResults
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errOrderHasResults):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ยกเลิกได้เฉพาะคำสั่งตรวจที่ยังไม่มีผล", "Only orders without results can be cancelled"))
+		return
+	case errors.Is(err, errOrderInvoiced):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ค่าตรวจของคำสั่งนี้ออกใบแจ้งหนี้แล้ว กรุณายกเลิกใบแจ้งหนี้ก่อน", "The order's charges are invoiced; void the invoice first"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถยกเลิกคำสั่งตรวจได้", "Could not cancel the lab order").Wrap(err))
+		return
+	}
+	order.Status = models.LabCancelled
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) GetPatientOrders(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var orders []models.LabOrder
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Items").Preload("Specimens").Preload("Results").
+		Where("patient_id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		Order("created_at DESC").
+		Find(&orders).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคำสั่งตรวจได้", "Could not load lab orders").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+func (h *Handler) GetSpecimen(c *gin.Context) {
+	specimen, ok := h.findSpecimen(c, c.Param("barcode"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, specimen)
+}
+
+func (h *Handler) CollectSpecimen(c *gin.Context) {
+	specimen, ok := h.findSpecimen(c, c.Param("barcode"))
+	if !ok {
+		return
+	}
+	if specimen.Status != models.SpecimenPending {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "สิ่งส่งตรวจนี้ถูกเก็บแล้ว", "The specimen has already been collected"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	now := time.Now()
+	specimen.Status = models.SpecimenCollected
+	specimen.CollectedAt = &now
+	specimen.CollectedBy, _ = username.(string)
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&specimen).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.LabOrder{}).
+			Where("id = ? AND status = ?", specimen.LabOrderID, models.LabOrdered).
+			Update("status", models.LabCollected).Error
+	})
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการเก็บสิ่งส่งตรวจได้", "Could not record the specimen collection").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, specimen)
+}
+
+func (h *Handler) ReceiveSpecimen(c *gin.Context) {
+	specimen, ok := h.findSpecimen(c, c.Param("barcode"))
+	if !ok {
+		return
+	}
+	if specimen.Status != models.SpecimenCollected {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "รับได้เฉพาะสิ่งส่งตรวจที่เก็บแล้ว", "Only collected specimens can be received"))
+		return
+	}
+
+	now := time.Now()
+	specimen.Status = models.SpecimenReceived
+	specimen.ReceivedAt = &now
+	if err := h.DB.WithContext(c.Request.Context()).Save(&specimen).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการรับสิ่งส่งตรวจได้", "Could not record the specimen receipt").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, specimen)
+}
+
+func (h *Handler) RejectSpecimen(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุเหตุผลในการปฏิเสธ", "Please give a reason for the rejection"))
+		return
+	}
+	specimen, ok := h.findSpecimen(c, c.Param("barcode"))
+	if !ok {
+		return
+	}
+	if specimen.Status != models.SpecimenCollected && specimen.Status != models.SpecimenReceived {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ปฏิเสธได้เฉพาะสิ่งส่งตรวจที่เก็บหรือรับแล้ว", "Only collected or received specimens can be rejected"))
+		return
+	}
+
+	specimen.Status = models.SpecimenRejected
+	specimen.RejectReason = input.Reason
+	if err := h.DB.WithContext(c.Request.Context()).Save(&specimen).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการปฏิเสธสิ่งส่งตรวจได้", "Could not record the specimen rejection").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, specimen)
+}
+
+func (h *Handler) AddResult(c *gin.Context) {
+	var input struct {
+		Barcode  string `json:"barcode" binding:"required"`
+		TestCode string `json:"test_code" binding:"required"`
+		Value    string `json:"value" binding:"required"`
+		Unit     string `json:"unit"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if _, ok := h.findSpecimen(c, input.Barcode); !ok {
+		return
+	}
+
+	username, _ := c.Get("username")
+	resultedBy, _ := username.(string)
+	var result models.LabResult
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = SaveResult(tx, ResultRecord{
+			Barcode:  input.Barcode,
+			TestCode: input.TestCode,
+			Value:    input.Value,
+			Unit:     input.Unit,
+		}, SourceManual, resultedBy)
+		return err
+	})
+	switch {
+	case errors.Is(err, ErrTestNotOrdered):
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่ได้สั่งตรวจรายการนี้กับสิ่งส่งตรวจนี้", "The test was not ordered on this specimen"))
+		return
+	case errors.Is(err, ErrSpecimenState):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "บันทึกผลได้เฉพาะสิ่งส่งตรวจที่ห้องปฏิบัติการรับแล้ว", "Results can only be added for received specimens"))
+		return
+	case errors.Is(err, ErrOrderCancelled):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ใบสั่งตรวจนี้ถูกยกเลิกแล้ว", "The lab order has been cancelled"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกผลตรวจได้", "Could not save the result").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+type cumulativeTest struct {
+	TestCode string             `json:"test_code"`
+	Name     string             `json:"name"`
+	Unit     string             `json:"unit"`
+	Results  []models.LabResult `json:"results"`
+}
+
+// GetCumulativeResults returns every result of a patient grouped by test,
+// oldest first, so values can be read across visits.
+func (h *Handler) GetCumulativeResults(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ?", c.Param("id"), staffHospital)
+	if testCode := c.Query("test_code"); testCode != "" {
+		query = query.Where("test_code = ?", testCode)
+	}
+	var results []models.LabResult
+	if err := query.Order("resulted_at, id").Find(&results).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงผลตรวจได้", "Could not load results").Wrap(err))
+		return
+	}
+
+	var codes []string
+	byCode := map[string]*cumulativeTest{}
+	for _, r := range results {
+		group, ok := byCode[r.TestCode]
+		if !ok {
+			group = &cumulativeTest{TestCode: r.TestCode, Unit: r.Unit}
+			byCode[r.TestCode] = group
+			codes = append(codes, r.TestCode)
+		}
+		group.Results = append(group.Results, r)
+	}
+	var tests []models.LabTest
+	h.DB.WithContext(c.Request.Context()).Where("code IN ?", codes).Find(&tests)
+	for _, t := range tests {
+		byCode[t.Code].Name = t.Name
+	}
+
+	sort.Strings(codes)
+	cumulative := make([]cumulativeTest, 0, len(codes))
+	for _, code := range codes {
+		cumulative = append(cumulative, *byCode[code])
+	}
+	c.JSON(http.StatusOK, cumulative)
+}
+
+func (h *Handler) findSpecimen(c *gin.Context, barcode string) (models.Specimen, bool) {
+	var specimen models.Specimen
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return specimen, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("barcode = ? AND hospital_id = ?", barcode, staffHospital).
+		First(&specimen).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบสิ่งส่งตรวจที่ระบุ", "Specimen not found"))
+		return specimen, false
+	}
+	return specimen, true
+}
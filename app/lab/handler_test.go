@@ -0,0 +1,305 @@
+package lab
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{}, &models.LabTest{},
+		&models.LabOrder{}, &models.LabOrderItem{}, &models.Specimen{}, &models.LabResult{},
+		&models.ChargeItem{}, &models.Charge{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	db.Create(&models.LabTest{Code: "GLU", Name: "Glucose", SpecimenType: "blood", Unit: "mg/dL",
+		RefLow: ptr(70), RefHigh: ptr(100), CriticalLow: ptr(40), CriticalHigh: ptr(400), Active: true})
+	db.Create(&models.LabTest{Code: "K", Name: "Potassium", SpecimenType: "blood", Unit: "mmol/L",
+		RefLow: ptr(3.5), RefHigh: ptr(5.1), Active: true})
+	db.Create(&models.LabTest{Code: "UPRO", Name: "Urine protein", SpecimenType: "urine",
+		RefText: "Negative", Active: true})
+	db.Create(&models.ChargeItem{HospitalID: "1", Code: "GLU", Name: "Glucose", Category: "lab",
+		Price: decimal.RequireFromString("40.00"), Active: true})
+	db.Create(&models.ChargeItem{HospitalID: "1", Code: "K", Name: "Potassium", Category: "lab",
+		Price: decimal.RequireFromString("55.50"), Active: true})
+	return db
+}
+
+func generateTestToken(HospitalID string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/lab/order/add", h.CreateOrder)
+	r.POST("/lab/order/cancel/:id", h.CancelOrder)
+	r.POST("/lab/specimen/collect/:barcode", h.CollectSpecimen)
+	r.POST("/lab/specimen/receive/:barcode", h.ReceiveSpecimen)
+	r.POST("/lab/specimen/reject/:barcode", h.RejectSpecimen)
+	r.POST("/lab/result/add", h.AddResult)
+	r.GET("/lab/result/patient/:id", h.GetCumulativeResults)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestFlag(t *testing.T) {
+	var glucose models.LabTest
+	var protein models.LabTest
+	db := SetupTestDB()
+	db.Where("code = ?", "GLU").First(&glucose)
+	db.Where("code = ?", "UPRO").First(&protein)
+
+	for value, flag := range map[string]string{"85": "N", "65": "L", "130": "H", "35": "LL", "450": "HH"} {
+		got, _ := Flag(glucose, value)
+		assert.Equal(t, flag, got, value)
+	}
+	got, numeric := Flag(protein, "negative")
+	assert.Equal(t, models.FlagNormal, got)
+	assert.Nil(t, numeric)
+	got, _ = Flag(protein, "2+")
+	assert.Equal(t, models.FlagAbnormal, got)
+}
+
+func TestLabOrderWorkflow(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	w := send(r, "POST", "/lab/order/add", map[string]interface{}{
+		"encounter_id": 1, "test_codes": []string{"GLU", "K", "UPRO"},
+	}, "1")
+	var order models.LabOrder
+	json.Unmarshal(w.Body.Bytes(), &order)
+
+	t.Run("Create Order Groups Specimens", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Len(t, order.Items, 3)
+		assert.Len(t, order.Specimens, 2)
+		assert.Equal(t, "0000000101", order.Specimens[0].Barcode)
+	})
+
+	t.Run("Create Order Captures Priced Tests", func(t *testing.T) {
+		var charges []models.Charge
+		db.Where("encounter_id = ?", 1).Order("charge_code").Find(&charges)
+		assert.Len(t, charges, 2) // UPRO has no price
+		assert.Equal(t, "GLU", charges[0].ChargeCode)
+		assert.Equal(t, models.ChargeSourceLabOrder, charges[0].Source)
+		assert.True(t, decimal.RequireFromString("55.5").Equal(charges[1].Amount))
+	})
+
+	t.Run("Create Order Fail Case Unknown Test", func(t *testing.T) {
+		w := send(r, "POST", "/lab/order/add", map[string]interface{}{
+			"encounter_id": 1, "test_codes": []string{"XYZ"},
+		}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	blood := order.Specimens[0].Barcode
+	urine := order.Specimens[1].Barcode
+
+	t.Run("Collect Specimen Success", func(t *testing.T) {
+		w := send(r, "POST", "/lab/specimen/collect/"+blood, nil, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"collected"`)
+	})
+
+	t.Run("Collect Specimen Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", "/lab/specimen/collect/"+urine, nil, "2")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Add Result Fail Case Not Received", func(t *testing.T) {
+		w := send(r, "POST", "/lab/result/add", map[string]interface{}{
+			"barcode": blood, "test_code": "GLU", "value": "180",
+		}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Reject Specimen Fail Case Not Collected", func(t *testing.T) {
+		w := send(r, "POST", "/lab/specimen/reject/"+urine, map[string]interface{}{"reason": "hemolyzed"}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	send(r, "POST", "/lab/specimen/receive/"+blood, nil, "1")
+	t.Run("Add Result Flags High", func(t *testing.T) {
+		w := send(r, "POST", "/lab/result/add", map[string]interface{}{
+			"barcode": blood, "test_code": "GLU", "value": "180",
+		}, "1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"flag":"H"`)
+		assert.Contains(t, w.Body.String(), `"unit":"mg/dL"`)
+	})
+
+	t.Run("Add Result Fail Case Test Not On Specimen", func(t *testing.T) {
+		w := send(r, "POST", "/lab/result/add", map[string]interface{}{
+			"barcode": blood, "test_code": "UPRO", "value": "Negative",
+		}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Order Resulted When Complete", func(t *testing.T) {
+		send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": blood, "test_code": "K", "value": "4.0"}, "1")
+		var o models.LabOrder
+		db.First(&o, order.ID)
+		assert.Equal(t, models.LabCollected, o.Status)
+
+		send(r, "POST", "/lab/specimen/collect/"+urine, nil, "1")
+		send(r, "POST", "/lab/specimen/receive/"+urine, nil, "1")
+		send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": urine, "test_code": "UPRO", "value": "Negative"}, "1")
+		db.First(&o, order.ID)
+		assert.Equal(t, models.LabResulted, o.Status)
+	})
+
+	t.Run("Cumulative Results", func(t *testing.T) {
+		send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": blood, "test_code": "GLU", "value": "95"}, "1")
+
+		req, _ := http.NewRequest("GET", "/lab/result/patient/001", nil)
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var cumulative []cumulativeTest
+		json.Unmarshal(w.Body.Bytes(), &cumulative)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, cumulative, 3)
+		assert.Equal(t, "GLU", cumulative[0].TestCode)
+		assert.Equal(t, "Glucose", cumulative[0].Name)
+		assert.Equal(t, []string{"180", "95"}, []string{cumulative[0].Results[0].Value, cumulative[0].Results[1].Value})
+	})
+}
+
+func TestSpecimenTransitions(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	w := send(r, "POST", "/lab/order/add", map[string]interface{}{"encounter_id": 1, "test_codes": []string{"GLU"}}, "1")
+	var order models.LabOrder
+	json.Unmarshal(w.Body.Bytes(), &order)
+	barcode := order.Specimens[0].Barcode
+	send(r, "POST", "/lab/specimen/collect/"+barcode, nil, "1")
+	send(r, "POST", "/lab/specimen/receive/"+barcode, nil, "1")
+
+	t.Run("Add Result Fail Case Order Cancelled", func(t *testing.T) {
+		db.Model(&order).Update("status", models.LabCancelled)
+		defer db.Model(&order).Update("status", models.LabOrdered)
+		w := send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": barcode, "test_code": "GLU", "value": "90"}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Reject Specimen Success", func(t *testing.T) {
+		w := send(r, "POST", "/lab/specimen/reject/"+barcode, map[string]interface{}{"reason": "hemolyzed"}, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"rejected"`)
+	})
+
+	t.Run("Reject Specimen Fail Case Already Rejected", func(t *testing.T) {
+		w := send(r, "POST", "/lab/specimen/reject/"+barcode, map[string]interface{}{"reason": "again"}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Add Result Fail Case Rejected", func(t *testing.T) {
+		w := send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": barcode, "test_code": "GLU", "value": "90"}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestCancelOrder(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	newOrder := func() models.LabOrder {
+		w := send(r, "POST", "/lab/order/add", map[string]interface{}{"encounter_id": 1, "test_codes": []string{"GLU", "K"}}, "1")
+		var order models.LabOrder
+		json.Unmarshal(w.Body.Bytes(), &order)
+		return order
+	}
+	order := newOrder()
+	cancelPath := "/lab/order/cancel/" + strconv.Itoa(int(order.ID))
+
+	t.Run("Cancel Order Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", cancelPath, nil, "2")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Cancel Order Fail Case Invoiced", func(t *testing.T) {
+		invoiceID := uint(1)
+		db.Model(&models.Charge{}).Where("charge_code = ?", "GLU").Update("invoice_id", invoiceID)
+		defer db.Model(&models.Charge{}).Where("charge_code = ?", "GLU").Update("invoice_id", nil)
+		w := send(r, "POST", cancelPath, nil, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Cancel Order Success", func(t *testing.T) {
+		w := send(r, "POST", cancelPath, nil, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"cancelled"`)
+
+		var charges int64
+		db.Model(&models.Charge{}).Count(&charges)
+		assert.Equal(t, int64(0), charges)
+	})
+
+	t.Run("Cancel Order Fail Case Already Cancelled", func(t *testing.T) {
+		w := send(r, "POST", cancelPath, nil, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Add Result Fail Case Order Cancelled", func(t *testing.T) {
+		barcode := order.Specimens[0].Barcode
+		send(r, "POST", "/lab/specimen/collect/"+barcode, nil, "1")
+		send(r, "POST", "/lab/specimen/receive/"+barcode, nil, "1")
+		w := send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": barcode, "test_code": "GLU", "value": "90"}, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Cancel Order Fail Case Has Results", func(t *testing.T) {
+		resulted := newOrder()
+		barcode := resulted.Specimens[0].Barcode
+		send(r, "POST", "/lab/specimen/collect/"+barcode, nil, "1")
+		send(r, "POST", "/lab/specimen/receive/"+barcode, nil, "1")
+		send(r, "POST", "/lab/result/add", map[string]interface{}{"barcode": barcode, "test_code": "GLU", "value": "90"}, "1")
+
+		w := send(r, "POST", "/lab/order/cancel/"+strconv.Itoa(int(resulted.ID)), nil, "1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
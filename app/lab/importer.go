@@ -0,0 +1,330 @@
+package lab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SourceManual   = "manual"
+	SourceAnalyzer = "analyzer"
+)
+
+// ParseCSV reads analyzer results from a CSV file with the header
+// barcode,test_code,value[,unit][,resulted_at]. resulted_at is RFC 3339 or
+// "2006-01-02 15:04:05".
+func ParseCSV(r io.Reader) ([]ResultRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"barcode", "test_code", "value"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var records []ResultRecord
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := ResultRecord{
+			Barcode:  field(record, "barcode"),
+			TestCode: field(record, "test_code"),
+			Value:    field(record, "value"),
+			Unit:     field(record, "unit"),
+		}
+		if rec.Barcode == "" && rec.TestCode == "" && rec.Value == "" {
+			continue
+		}
+		if rec.Barcode == "" || rec.TestCode == "" || rec.Value == "" {
+			return nil, fmt.Errorf("line %d: barcode, test_code and value are required", line)
+		}
+		if at := field(record, "resulted_at"); at != "" {
+			if rec.ResultedAt, err = parseTime(at, time.RFC3339, "2006-01-02 15:04:05"); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// ParseASTM reads the subset of ASTM E1394 records our analyzers emit: each
+// O (order) record carries the specimen barcode in field 3, and the R
+// (result) records following it carry ^^^TEST in field 3, the value in
+// field 4, units in field 5 and the completion time (YYYYMMDDHHMMSS) in
+// field 13. Other record types are ignored. Records end with CR, as the
+// standard has it, or with LF or CRLF. A file without any result record is
+// an error, so that it is not filed away as imported.
+func ParseASTM(r io.Reader) ([]ResultRecord, error) {
+	var records []ResultRecord
+	barcode := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanRecords)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		// strip a frame number prefix such as "1R|..." sent by some devices
+		if len(text) > 1 && text[0] >= '0' && text[0] <= '9' {
+			text = text[1:]
+		}
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		switch fields[0] {
+		case "O":
+			if len(fields) < 3 || component(fields[2], 0) == "" {
+				return nil, fmt.Errorf("line %d: order record without specimen id", line)
+			}
+			barcode = component(fields[2], 0)
+		case "R":
+			if barcode == "" {
+				return nil, fmt.Errorf("line %d: result record before any order record", line)
+			}
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: result record too short", line)
+			}
+			rec := ResultRecord{
+				Barcode:  barcode,
+				TestCode: lastComponent(fields[2]),
+				Value:    fields[3],
+			}
+			if len(fields) > 4 {
+				rec.Unit = fields[4]
+			}
+			if len(fields) > 12 && fields[12] != "" {
+				at, err := parseTime(fields[12], "20060102150405")
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				rec.ResultedAt = at
+			}
+			if rec.TestCode == "" || rec.Value == "" {
+				return nil, fmt.Errorf("line %d: result record without test or value", line)
+			}
+			records = append(records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no result records")
+	}
+	return records, nil
+}
+
+// scanRecords is a bufio.SplitFunc for lines ending in CR, LF or CRLF.
+func scanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// a CR at the end of the buffer may be the first half of CRLF
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// ImportFile parses one dropped analyzer file and stores all of its results
+// in a single transaction, so a file is either fully applied or not at all.
+func ImportFile(db *gorm.DB, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var records []ResultRecord
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		records, err = ParseCSV(f)
+	} else {
+		records, err = ParseASTM(f)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, rec := range records {
+			if _, err := SaveResult(tx, rec, SourceAnalyzer, "analyzer"); err != nil {
+				return fmt.Errorf("result %d (%s %s): %w", i+1, rec.Barcode, rec.TestCode, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// WatchDropDir polls dir for analyzer files (*.csv, *.txt, *.astm) until ctx
+// is cancelled. Imported files are moved to dir/processed; files that fail
+// are moved to dir/failed next to a .err file with the reason, so they can
+// be fixed and dropped in again. A file is imported once its size and
+// modification time are unchanged since the previous poll, so one still
+// being written is left alone; senders should still write under another
+// extension and rename the finished file.
+func WatchDropDir(ctx context.Context, db *gorm.DB, dir string, interval time.Duration) {
+	for _, sub := range []string{"processed", "failed"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			log.Println("Failed to prepare lab drop directory:", err)
+			return
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	seen := map[string]fileStat{}
+	for {
+		scanDropDir(db, dir, seen)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fileStat is what a dropped file looked like at the previous poll.
+type fileStat struct {
+	size    int64
+	modTime time.Time
+}
+
+// scanDropDir imports the files in dir that have not changed since they
+// were recorded in seen, and records the rest for the next poll.
+func scanDropDir(db *gorm.DB, dir string, seen map[string]fileStat) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Println("Failed to read lab drop directory:", err)
+		return
+	}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".csv" && ext != ".txt" && ext != ".astm") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[entry.Name()] = true
+		stat := fileStat{size: info.Size(), modTime: info.ModTime()}
+		if previous, ok := seen[entry.Name()]; !ok || previous != stat {
+			// new or still growing: wait for the next poll
+			seen[entry.Name()] = stat
+			continue
+		}
+		delete(seen, entry.Name())
+
+		path := filepath.Join(dir, entry.Name())
+		n, err := ImportFile(db, path)
+		if err != nil {
+			log.Printf("Failed to import lab file %s: %v", entry.Name(), err)
+			target := freeName(filepath.Join(dir, "failed"), entry.Name())
+			os.WriteFile(target+".err", []byte(err.Error()+"\n"), 0o644)
+			os.Rename(path, target)
+			continue
+		}
+		log.Printf("Imported %d lab results from %s", n, entry.Name())
+		os.Rename(path, freeName(filepath.Join(dir, "processed"), entry.Name()))
+	}
+	for name := range seen {
+		if !present[name] {
+			delete(seen, name)
+		}
+	}
+}
+
+// freeName returns the path for name in dir, numbered as run1-1.astm,
+// run1-2.astm... when an earlier file of that name is already there, so
+// that analyzers reusing file names do not overwrite each other.
+func freeName(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	path := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, i, ext))
+	}
+}
+
+func component(field string, i int) string {
+	parts := strings.Split(field, "^")
+	if i >= len(parts) {
+		return ""
+	}
+	return strings.TrimSpace(parts[i])
+}
+
+func lastComponent(field string) string {
+	parts := strings.Split(field, "^")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if p := strings.TrimSpace(parts[i]); p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+func parseTime(value string, layouts ...string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
@@ -0,0 +1,118 @@
+package lab
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const testASTM = `H|\^&|||Analyzer^1.0|||||||P|1|20240105103000
+P|1||HN001
+O|1|0000000101||^^^GLU\^^^K|R
+R|1|^^^GLU|62|mg/dL|70^100|L||F||||20240105102500
+R|2|^^^K|4.2|mmol/L|3.5^5.1|N||F||||20240105102500
+L|1|N
+`
+
+func seedOrder(db *gorm.DB) {
+	db.Create(&models.LabOrder{ID: 1, PatientID: "001", EncounterID: 1, HospitalID: "1", Status: models.LabCollected})
+	db.Create(&models.Specimen{ID: 1, LabOrderID: 1, HospitalID: "1", Barcode: "0000000101", Type: "blood", Status: models.SpecimenReceived})
+	db.Create(&models.LabOrderItem{LabOrderID: 1, TestCode: "GLU", SpecimenID: 1})
+	db.Create(&models.LabOrderItem{LabOrderID: 1, TestCode: "K", SpecimenID: 1})
+}
+
+func TestParseASTM(t *testing.T) {
+	records, err := ParseASTM(strings.NewReader(testASTM))
+
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, ResultRecord{
+		Barcode:    "0000000101",
+		TestCode:   "GLU",
+		Value:      "62",
+		Unit:       "mg/dL",
+		ResultedAt: time.Date(2024, 1, 5, 10, 25, 0, 0, time.Local),
+	}, records[0])
+
+	_, err = ParseASTM(strings.NewReader("R|1|^^^GLU|62|mg/dL\n"))
+	assert.Error(t, err)
+
+	// analyzers end records with CR alone, or CRLF
+	for _, ending := range []string{"\r", "\r\n"} {
+		records, err = ParseASTM(strings.NewReader(strings.ReplaceAll(testASTM, "\n", ending)))
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, "K", records[1].TestCode)
+	}
+
+	_, err = ParseASTM(strings.NewReader("H|\\^&|||Analyzer^1.0\rL|1|N\r"))
+	assert.ErrorContains(t, err, "no result records")
+}
+
+func TestParseCSV(t *testing.T) {
+	records, err := ParseCSV(strings.NewReader("barcode,test_code,value,unit,resulted_at\n0000000101,GLU,62,mg/dL,2024-01-05 10:25:00\n"))
+
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "GLU", records[0].TestCode)
+	assert.Equal(t, 2024, records[0].ResultedAt.Year())
+
+	_, err = ParseCSV(strings.NewReader("barcode,value\n0000000101,62\n"))
+	assert.Error(t, err)
+}
+
+func TestScanDropDir(t *testing.T) {
+	db := SetupTestDB()
+	seedOrder(db)
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "processed"), 0o755)
+	os.MkdirAll(filepath.Join(dir, "failed"), 0o755)
+	// an earlier run1.astm was already imported
+	os.WriteFile(filepath.Join(dir, "processed", "run1.astm"), []byte("earlier"), 0o644)
+	os.WriteFile(filepath.Join(dir, "run1.astm"), []byte(testASTM[:len(testASTM)/2]), 0o644)
+	os.WriteFile(filepath.Join(dir, "bad.csv"), []byte("barcode,test_code,value\n9999999999,GLU,80\n"), 0o644)
+	seen := map[string]fileStat{}
+
+	// the first poll only records the files, and a file that grew since
+	// is left for the next one
+	scanDropDir(db, dir, seen)
+	os.WriteFile(filepath.Join(dir, "run1.astm"), []byte(testASTM), 0o644)
+	scanDropDir(db, dir, seen)
+	assert.FileExists(t, filepath.Join(dir, "run1.astm"))
+	assert.FileExists(t, filepath.Join(dir, "failed", "bad.csv"))
+
+	scanDropDir(db, dir, seen)
+
+	var results []models.LabResult
+	db.Order("test_code").Find(&results)
+	assert.Len(t, results, 2)
+	assert.Equal(t, models.FlagLow, results[0].Flag)
+	assert.Equal(t, SourceAnalyzer, results[0].Source)
+
+	var order models.LabOrder
+	db.First(&order, 1)
+	assert.Equal(t, models.LabResulted, order.Status)
+
+	assert.FileExists(t, filepath.Join(dir, "processed", "run1-1.astm"))
+	earlier, _ := os.ReadFile(filepath.Join(dir, "processed", "run1.astm"))
+	assert.Equal(t, "earlier", string(earlier))
+	assert.Empty(t, seen)
+	assert.FileExists(t, filepath.Join(dir, "failed", "bad.csv"))
+	reason, _ := os.ReadFile(filepath.Join(dir, "failed", "bad.csv.err"))
+	assert.Contains(t, string(reason), ErrUnknownSpecimen.Error())
+
+	// the same file dropped again does not double the results
+	os.WriteFile(filepath.Join(dir, "run1.astm"), []byte(testASTM), 0o644)
+	scanDropDir(db, dir, seen)
+	scanDropDir(db, dir, seen)
+	var count int64
+	db.Model(&models.LabResult{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	assert.FileExists(t, filepath.Join(dir, "processed", "run1-2.astm"))
+}
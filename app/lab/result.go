@@ -0,0 +1,143 @@
+package lab
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownSpecimen = errors.New("unknown specimen barcode")
+	ErrTestNotOrdered  = errors.New("test was not ordered on this specimen")
+	ErrSpecimenState   = errors.New("specimen has not been received")
+	ErrOrderCancelled  = errors.New("lab order was cancelled")
+)
+
+// Flag compares a value with the test's reference range. Numeric values are
+// flagged L/H, or LL/HH beyond the critical limits; qualitative values are
+// flagged A when they differ from the expected text.
+func Flag(test models.LabTest, value string) (string, *float64) {
+	if n, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		switch {
+		case test.CriticalLow != nil && n < *test.CriticalLow:
+			return models.FlagCriticalLow, &n
+		case test.CriticalHigh != nil && n > *test.CriticalHigh:
+			return models.FlagCriticalHigh, &n
+		case test.RefLow != nil && n < *test.RefLow:
+			return models.FlagLow, &n
+		case test.RefHigh != nil && n > *test.RefHigh:
+			return models.FlagHigh, &n
+		}
+		return models.FlagNormal, &n
+	}
+	if test.RefText != "" && !strings.EqualFold(strings.TrimSpace(value), test.RefText) {
+		return models.FlagAbnormal, nil
+	}
+	return models.FlagNormal, nil
+}
+
+// ResultRecord is one result as entered by hand or read from an analyzer
+// file.
+type ResultRecord struct {
+	Barcode    string
+	TestCode   string
+	Value      string
+	Unit       string
+	ResultedAt time.Time
+}
+
+// SaveResult stores a result against the specimen with the record's barcode
+// and marks the order resulted once every ordered test has a value. A result
+// already stored for the same specimen, test and time, as when an analyzer
+// file is dropped twice, is returned instead of being stored again.
+func SaveResult(tx *gorm.DB, rec ResultRecord, source, resultedBy string) (models.LabResult, error) {
+	var result models.LabResult
+
+	var specimen models.Specimen
+	if err := tx.Where("barcode = ?", rec.Barcode).First(&specimen).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return result, ErrUnknownSpecimen
+		}
+		return result, err
+	}
+	// results come from the lab, so only for specimens it has received
+	if specimen.Status != models.SpecimenReceived {
+		return result, ErrSpecimenState
+	}
+
+	var item models.LabOrderItem
+	if err := tx.Where("specimen_id = ? AND test_code = ?", specimen.ID, rec.TestCode).
+		First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return result, ErrTestNotOrdered
+		}
+		return result, err
+	}
+
+	var order models.LabOrder
+	if err := tx.First(&order, specimen.LabOrderID).Error; err != nil {
+		return result, err
+	}
+	if order.Status == models.LabCancelled {
+		return result, ErrOrderCancelled
+	}
+	var test models.LabTest
+	if err := tx.Where("code = ?", rec.TestCode).First(&test).Error; err != nil {
+		return result, err
+	}
+
+	flag, numeric := Flag(test, rec.Value)
+	unit := rec.Unit
+	if unit == "" {
+		unit = test.Unit
+	}
+	resultedAt := rec.ResultedAt
+	if resultedAt.IsZero() {
+		resultedAt = time.Now()
+	}
+	err := tx.Where("specimen_id = ? AND test_code = ? AND resulted_at = ?", specimen.ID, test.Code, resultedAt).
+		First(&result).Error
+	if err == nil {
+		return result, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, err
+	}
+	result = models.LabResult{
+		LabOrderID:   order.ID,
+		SpecimenID:   specimen.ID,
+		PatientID:    order.PatientID,
+		HospitalID:   order.HospitalID,
+		TestCode:     test.Code,
+		Value:        strings.TrimSpace(rec.Value),
+		NumericValue: numeric,
+		Unit:         unit,
+		RefLow:       test.RefLow,
+		RefHigh:      test.RefHigh,
+		RefText:      test.RefText,
+		Flag:         flag,
+		Source:       source,
+		ResultedBy:   resultedBy,
+		ResultedAt:   resultedAt,
+	}
+	if err := tx.Create(&result).Error; err != nil {
+		return result, err
+	}
+
+	var pending int64
+	err = tx.Model(&models.LabOrderItem{}).
+		Where("lab_order_id = ? AND test_code NOT IN (?)", order.ID,
+			tx.Model(&models.LabResult{}).Select("test_code").Where("lab_order_id = ?", order.ID)).
+		Count(&pending).Error
+	if err != nil {
+		return result, err
+	}
+	if pending == 0 {
+		err = tx.Model(&order).Update("status", models.LabResulted).Error
+	}
+	return result, err
+}
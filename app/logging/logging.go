@@ -0,0 +1,66 @@
+// Package logging writes the server's logs as JSON through log/slog. A
+// record logged within a request carries its request ID, trace ID and the
+// caller's staff and hospital, and patient identifiers are masked before
+// anything is written.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ctxKey struct{}
+
+// With returns ctx carrying attrs, which are added to every record logged
+// with it.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return context.WithValue(ctx, ctxKey{}, append(slices.Clip(prev), attrs...))
+}
+
+// New returns a logger writing JSON records at level or above to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(handler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})})
+}
+
+// Setup makes New(os.Stdout, level) the default logger. The log package
+// writes through it as well, so existing log.Println calls come out as
+// JSON at INFO.
+func Setup(level slog.Level) {
+	slog.SetDefault(New(os.Stdout, level))
+}
+
+// handler adds the context's attrs to each record and redacts its message.
+// Attribute values are redacted by redactAttr.
+type handler struct{ next slog.Handler }
+
+func (h handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = Redact(r.Message)
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler{h.next.WithAttrs(attrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{h.next.WithGroup(name)}
+}
@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// capture makes a JSON logger writing to the returned buffer the default
+// until the test ends.
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(New(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func records(buf *bytes.Buffer) []map[string]any {
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		json.Unmarshal([]byte(line), &record)
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestRedact(t *testing.T) {
+	for in, want := range map[string]string{
+		"patient 1100700000001 not found":       "patient [NATIONAL_ID] not found",
+		"national id 1-1007-00000-00-1":         "national id [NATIONAL_ID]",
+		"mail somchai@example.com now":          "mail [EMAIL] now",
+		"call 081-234-5678 or +66812345678":     "call [PHONE] or [PHONE]",
+		"passport AA1234567":                    "passport [PASSPORT]",
+		"HN001 encounter 42 took 12ms":          "HN001 encounter 42 took 12ms",
+		"GET /patient/search/001 status 200 OK": "GET /patient/search/001 status 200 OK",
+	} {
+		assert.Equal(t, want, Redact(in))
+	}
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("Logger Success Context And Redaction", func(t *testing.T) {
+		buf := capture(t)
+		ctx := With(context.Background(), slog.String("request_id", "req-1"))
+		ctx = With(ctx, slog.String("staff", "nurse01"))
+		slog.InfoContext(ctx, "lookup 1100700000001",
+			"national_id", "1100700000001", "first_name_th", "สมชาย",
+			"error", errors.New("no patient with email somchai@example.com"))
+
+		record := records(buf)[0]
+		assert.Equal(t, "lookup [NATIONAL_ID]", record["msg"])
+		assert.Equal(t, "req-1", record["request_id"])
+		assert.Equal(t, "nurse01", record["staff"])
+		assert.Equal(t, "[REDACTED]", record["national_id"])
+		assert.Equal(t, "[REDACTED]", record["first_name_th"])
+		assert.Equal(t, "no patient with email [EMAIL]", record["error"])
+	})
+
+	t.Run("Logger Success Trace ID", func(t *testing.T) {
+		buf := capture(t)
+		traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+		ctx := trace.ContextWithSpanContext(context.Background(),
+			trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+		slog.InfoContext(ctx, "traced")
+
+		record := records(buf)[0]
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record["trace_id"])
+		assert.Equal(t, "00f067aa0ba902b7", record["span_id"])
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupRouter := func() *gin.Engine {
+		r := gin.New()
+		r.Use(RequestID(), AccessLog(), Recovery())
+		r.GET("/patient/search", func(c *gin.Context) {
+			slog.InfoContext(c.Request.Context(), "searching")
+			c.Status(http.StatusOK)
+		})
+		r.GET("/panic", func(c *gin.Context) { panic("boom") })
+		return r
+	}
+
+	t.Run("RequestID Success Propagated", func(t *testing.T) {
+		buf := capture(t)
+		req, _ := http.NewRequest(http.MethodGet, "/patient/search?national_id=1100700000001", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		w := httptest.NewRecorder()
+		setupRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+		logged := records(buf)
+		assert.Len(t, logged, 2)
+		for _, record := range logged {
+			assert.Equal(t, "abc-123", record["request_id"])
+		}
+		assert.Equal(t, "/patient/search", logged[1]["path"])
+		assert.Equal(t, float64(200), logged[1]["status"])
+		assert.NotContains(t, buf.String(), "1100700000001")
+	})
+
+	t.Run("RequestID Success Generated For Invalid Header", func(t *testing.T) {
+		capture(t)
+		req, _ := http.NewRequest(http.MethodGet, "/patient/search", nil)
+		req.Header.Set(RequestIDHeader, "forged\"}\n{\"level\":\"INFO")
+		w := httptest.NewRecorder()
+		setupRouter().ServeHTTP(w, req)
+		assert.Regexp(t, `^[0-9a-f]{32}$`, w.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Recovery Success", func(t *testing.T) {
+		buf := capture(t)
+		req, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+		w := httptest.NewRecorder()
+		setupRouter().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		logged := records(buf)
+		assert.Equal(t, "panic", logged[0]["msg"])
+		assert.Equal(t, "ERROR", logged[1]["level"])
+	})
+}
+
+func TestGormLogger(t *testing.T) {
+	buf := capture(t)
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: NewGormLogger(0)})
+	db.AutoMigrate(&models.Patient{})
+	buf.Reset()
+
+	ctx := With(context.Background(), slog.String("request_id", "req-2"))
+	db.WithContext(ctx).Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", NationalID: "1100700000001", FirstNameTH: "สมชาย"})
+	db.WithContext(ctx).Exec("INSERT INTO no_such_table VALUES (?)", "1100700000001")
+
+	logged := records(buf)
+	assert.Len(t, logged, 2)
+	assert.Equal(t, "query", logged[0]["msg"])
+	assert.Equal(t, "req-2", logged[0]["request_id"])
+	assert.Contains(t, logged[0]["sql"], "INSERT INTO `patients`")
+	assert.Equal(t, "query failed", logged[1]["msg"])
+	assert.Contains(t, logged[1]["error"], "no such table")
+	assert.NotContains(t, buf.String(), "1100700000001")
+	assert.NotContains(t, buf.String(), "สมชาย")
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+// redacted replaces the value of an attribute named after a patient field.
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names whose values are always dropped.
+var sensitiveKeys = map[string]bool{
+	"national_id": true, "passport_id": true, "phone_number": true, "email": true,
+	"first_name_th": true, "middle_name_th": true, "last_name_th": true,
+	"first_name_en": true, "middle_name_en": true, "last_name_en": true,
+	"date_of_birth": true, "policy_number": true,
+}
+
+// identifiers finds patient identifiers in free text. Thai national IDs are
+// masked with or without dashes and whether or not the checksum is valid, a
+// mistyped ID being as personal as a correct one.
+var identifiers = []struct {
+	pattern *regexp.Regexp
+	mask    string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b\d-?\d{4}-?\d{5}-?\d{2}-?\d\b`), "[NATIONAL_ID]"},
+	{regexp.MustCompile(`(?:\+66|\b0)\d{1,2}-?\d{3}-?\d{3,4}\b`), "[PHONE]"},
+	{regexp.MustCompile(`\b[A-Z]{1,2}\d{7,8}\b`), "[PASSPORT]"},
+}
+
+// Redact masks national IDs, passport numbers, phone numbers and email
+// addresses in s.
+func Redact(s string) string {
+	for _, id := range identifiers {
+		s = id.pattern.ReplaceAllString(s, id.mask)
+	}
+	return s
+}
+
+// redactAttr drops patient fields by name and masks identifiers in string,
+// error and Stringer values.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[a.Key] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(Redact(v.String()))
+		}
+	}
+	return a
+}
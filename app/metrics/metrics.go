@@ -0,0 +1,48 @@
+// Package metrics defines the Prometheus metrics served on /metrics: HTTP
+// requests by route, database statements and pool use, logins, and
+// business events. Label values are kept to small fixed sets (route
+// templates, hospital IDs, outcomes) and never carry patient data.
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Login outcomes.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// Sources a patient is registered from.
+const (
+	SourceAPI    = "api"
+	SourceImport = "import"
+	SourceFHIR   = "fhir"
+	SourceHL7    = "hl7"
+)
+
+var (
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Staff logins by result (success, failure).",
+	}, []string{"result"})
+
+	PatientsRegistered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "patients_registered_total",
+		Help: "Patients registered, by hospital and source (api, import, fhir, hl7).",
+	}, []string{"hospital_id", "source"})
+
+	HL7Messages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hl7_messages_total",
+		Help: "HL7 messages applied, by message type and status (processed, failed).",
+	}, []string{"type", "status"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
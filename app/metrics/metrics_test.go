@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func sampleCount(h *prometheus.HistogramVec, labels ...string) uint64 {
+	var m dto.Metric
+	h.WithLabelValues(labels...).(prometheus.Histogram).Write(&m)
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestHTTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(HTTP())
+	r.GET("/patient/search/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", Handler())
+
+	for _, path := range []string{"/patient/search/001", "/patient/search/002", "/no/such/path"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/patient/search/:id", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+	assert.Equal(t, uint64(2), sampleCount(httpDuration, "GET", "/patient/search/:id"))
+
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `http_requests_total{method="GET",route="/patient/search/:id",status="200"} 2`)
+	assert.False(t, strings.Contains(w.Body.String(), "/patient/search/001"), "raw paths are never labels")
+}
+
+func TestGorm(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, db.Use(gormPlugin{}))
+	db.AutoMigrate(&models.Patient{})
+
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	var patient models.Patient
+	db.First(&patient, "id = ?", "001")
+	err := db.First(&patient, "id = ?", "999").Error
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN002", HospitalID: "1"})
+
+	assert.Equal(t, uint64(2), sampleCount(dbDuration, "create", "patients"))
+	assert.Equal(t, uint64(2), sampleCount(dbDuration, "query", "patients"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(dbErrors.WithLabelValues("create", "patients")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(dbErrors.WithLabelValues("query", "patients")))
+}
@@ -1,22 +1,33 @@
 package middleware
 
 import (
-	"os"
-	"net/http"
+	"log/slog"
 	"strings"
 
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
+var jwtKey []byte
+
+// SetJWTKey sets the key tokens are verified with. It is called once at
+// startup, before the server accepts requests.
+func SetJWTKey(key []byte) {
+	jwtKey = key
+}
+
+// JWTKeyLoaded reports whether a key has been set.
+func JWTKeyLoaded() bool {
+	return len(jwtKey) > 0
+}
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "กรุณา Login ก่อนใช้งาน"})
-			c.Abort()
+			apierror.Respond(c, apierror.New(apierror.Unauthorized, "กรุณา Login ก่อนใช้งาน", "Please log in first"))
 			return
 		}
 
@@ -27,8 +38,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		})
 
 		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token ไม่ถูกต้องหรือหมดอายุ"})
-			c.Abort()
+			apierror.Respond(c, apierror.New(apierror.Unauthorized, "Token ไม่ถูกต้องหรือหมดอายุ", "The token is invalid or expired"))
 			return
 		}
 
@@ -37,7 +47,20 @@ func AuthMiddleware() gin.HandlerFunc {
             if ok {
                 c.Set("hospital_id", hospital)
             }
+            if username, ok := claims["username"].(string); ok {
+                c.Set("username", username)
+            }
+            if staffID, ok := claims["staff_id"].(float64); ok {
+                c.Set("staff_id", uint(staffID))
+            }
+            if role, ok := claims["role"].(string); ok {
+                c.Set("role", role)
+            }
         }
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(),
+			slog.String("staff", c.GetString("username")),
+			slog.String("hospital_id", c.GetString("hospital_id")),
+			slog.String("role", c.GetString("role"))))
 
 		c.Next()
 	}
@@ -11,7 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func createTestToken(hospitalId uint, expired bool) string {
+func createTestToken(hospitalId string, expired bool) string {
 	expiration := time.Now().Add(time.Hour * 1).Unix()
 	if expired {
 		expiration = time.Now().Add(-time.Hour * 1).Unix()
@@ -59,7 +59,7 @@ func TestAuthMiddleware(t *testing.T) {
 			ctx.Status(http.StatusOK)
 		})
 
-		expiredToken := createTestToken(01, true) //expire token
+		expiredToken := createTestToken("01", true) //expire token
 
 		c.Request, _ = http.NewRequest("GET", "/test", nil)
 		c.Request.Header.Set("Authorization", "Bearer " + expiredToken)
@@ -73,22 +73,54 @@ func TestAuthMiddleware(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, r := gin.CreateTestContext(w)
 
-		var hospitalInContext uint
+		var hospitalInContext string
 
 		r.Use(AuthMiddleware())
 		r.GET("/test", func(ctx *gin.Context) {
 			h, _ := ctx.Get("hospital_id")
-			hospitalInContext = h.(uint)
+			hospitalInContext = h.(string)
 			ctx.Status(http.StatusOK)
 		})
 
-		validToken := createTestToken(01, false)
+		validToken := createTestToken("01", false)
 
 		c.Request, _ = http.NewRequest("GET", "/test", nil)
 		c.Request.Header.Set("Authorization", "Bearer "+ validToken)
 		r.ServeHTTP(w, c.Request)
 
 		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Equal(t, uint(01), hospitalInContext)
+		assert.Equal(t, "01", hospitalInContext)
 	})
-}
\ No newline at end of file
+	t.Run("Valid Token Sets Staff Claims - 200", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, r := gin.CreateTestContext(w)
+
+		var staffID, role, username interface{}
+
+		r.Use(AuthMiddleware())
+		r.GET("/test", func(ctx *gin.Context) {
+			staffID, _ = ctx.Get("staff_id")
+			role, _ = ctx.Get("role")
+			username, _ = ctx.Get("username")
+			ctx.Status(http.StatusOK)
+		})
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"hospital_id": "01",
+			"username":    "doctor01",
+			"staff_id":    7,
+			"role":        "doctor",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+		})
+		validToken, _ := token.SignedString(jwtKey)
+
+		c.Request, _ = http.NewRequest("GET", "/test", nil)
+		c.Request.Header.Set("Authorization", "Bearer "+validToken)
+		r.ServeHTTP(w, c.Request)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, uint(7), staffID)
+		assert.Equal(t, "doctor", role)
+		assert.Equal(t, "doctor01", username)
+	})
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	AllergyDrug        = "drug"
+	AllergyFood        = "food"
+	AllergyEnvironment = "environment"
+
+	SeverityMild            = "mild"
+	SeverityModerate        = "moderate"
+	SeveritySevere          = "severe"
+	SeverityLifeThreatening = "life-threatening"
+
+	VerificationUnconfirmed    = "unconfirmed"
+	VerificationConfirmed      = "confirmed"
+	VerificationRefuted        = "refuted"
+	VerificationEnteredInError = "entered-in-error"
+
+	SourcePatient   = "patient"
+	SourceRelative  = "relative"
+	SourceClinician = "clinician"
+	SourceRecord    = "record"
+)
+
+type Allergy struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	PatientID  string `gorm:"not null;index" json:"patient_id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+
+	Category           string `gorm:"size:20;not null" json:"category"`
+	Substance          string `gorm:"size:255;not null" json:"substance"`
+	Reaction           string `json:"reaction"`
+	Severity           string `gorm:"size:20;not null" json:"severity"`
+	VerificationStatus string `gorm:"size:20;not null" json:"verification_status"`
+	Source             string `gorm:"size:20" json:"source"`
+
+	RecordedBy string    `json:"recorded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
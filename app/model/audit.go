@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AuditLog records who did what to which record. HospitalID is the actor's
+// hospital and PatientHospitalID the hospital owning the patient, so access
+// from another hospital shows up in the owner's audit trail too.
+type AuditLog struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+	Username   string `json:"username"`
+	StaffID    uint   `json:"staff_id"`
+
+	Action       string `gorm:"size:50;not null;index" json:"action"`
+	ResourceType string `gorm:"size:50;not null" json:"resource_type"`
+	ResourceID   string `gorm:"size:50" json:"resource_id"`
+
+	PatientID         string `gorm:"index" json:"patient_id"`
+	PatientHospitalID string `gorm:"index" json:"patient_hospital_id"`
+	Detail            string `json:"detail"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ChargeItem is a line of a hospital's charge master. Code matches the drug
+// or lab test code when the item is captured automatically from an order.
+type ChargeItem struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	HospitalID string          `gorm:"size:50;not null;uniqueIndex:idx_charge_item_code" json:"hospital_id"`
+	Code       string          `gorm:"size:50;not null;uniqueIndex:idx_charge_item_code" json:"code"`
+	Name       string          `gorm:"size:255;not null" json:"name"`
+	Category   string          `gorm:"size:20;not null" json:"category"`
+	Price      decimal.Decimal `gorm:"type:numeric(12,2);not null" json:"price"`
+	Active     bool            `gorm:"default:true" json:"active"`
+}
+
+// PriceListEntry overrides the charge master price for one payer.
+type PriceListEntry struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	HospitalID string          `gorm:"size:50;not null;uniqueIndex:idx_price_list" json:"hospital_id"`
+	Payer      string          `gorm:"size:50;not null;uniqueIndex:idx_price_list" json:"payer"`
+	ChargeCode string          `gorm:"size:50;not null;uniqueIndex:idx_price_list" json:"charge_code"`
+	Price      decimal.Decimal `gorm:"type:numeric(12,2);not null" json:"price"`
+}
+
+const (
+	ChargeCategoryService = "service"
+	ChargeCategoryDrug    = "drug"
+	ChargeCategoryLab     = "lab"
+	ChargeCategorySupply  = "supply"
+)
+
+var ChargeCategories = []string{ChargeCategoryService, ChargeCategoryDrug, ChargeCategoryLab, ChargeCategorySupply}
+
+const (
+	ChargeSourceManual       = "manual"
+	ChargeSourceLabOrder     = "lab_order_item"
+	ChargeSourcePrescription = "prescription_item"
+)
+
+// Charge is one billable line on an encounter. Charges captured from orders
+// are unique per source row, so capturing twice never double-bills; manual
+// charges have no SourceID.
+type Charge struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+	EncounterID uint   `gorm:"not null;index" json:"encounter_id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+
+	ChargeCode  string          `gorm:"size:50;not null;uniqueIndex:idx_charge_source" json:"charge_code"`
+	Description string          `json:"description"`
+	Quantity    int             `gorm:"not null" json:"quantity"`
+	UnitPrice   decimal.Decimal `gorm:"type:numeric(12,2);not null" json:"unit_price"`
+	Amount      decimal.Decimal `gorm:"type:numeric(12,2);not null" json:"amount"`
+
+	Source    string `gorm:"size:30;not null;uniqueIndex:idx_charge_source" json:"source"`
+	SourceID  *uint  `gorm:"uniqueIndex:idx_charge_source" json:"source_id"`
+	InvoiceID *uint  `gorm:"index" json:"invoice_id"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	InvoiceOpen = "open"
+	InvoicePaid = "paid"
+	InvoiceVoid = "void"
+)
+
+type Invoice struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+	EncounterID uint   `gorm:"not null;index" json:"encounter_id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+
+	Number     string          `gorm:"size:30;index" json:"number"`
+	Payer      string          `gorm:"size:50" json:"payer"`
+	CoverageID *uint           `json:"coverage_id"`
+	Total      decimal.Decimal `gorm:"type:numeric(12,2);not null" json:"total"`
+	Status     string          `gorm:"size:10;not null" json:"status"`
+	Charges    []Charge        `json:"charges"`
+	Payments   []Payment       `json:"payments"`
+
+	IssuedBy  string    `json:"issued_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	PaymentKindPayment = "payment"
+	PaymentKindRefund  = "refund"
+)
+
+// Payment is money received against an invoice, or given back when Kind is
+// refund. Amount is always positive.
+type Payment struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	InvoiceID  uint            `gorm:"not null;index" json:"invoice_id"`
+	HospitalID string          `gorm:"not null;index" json:"hospital_id"`
+	PatientID  string          `gorm:"not null;index" json:"patient_id"`
+	Kind       string          `gorm:"size:10;not null" json:"kind"`
+	Amount     decimal.Decimal `gorm:"type:numeric(12,2);not null" json:"amount"`
+	Method     string          `gorm:"size:20" json:"method"`
+	Reference  string          `json:"reference"`
+	ReceivedBy string          `json:"received_by"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
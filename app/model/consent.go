@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+const (
+	// Purposes that need the patient's consent under the PDPA. Treatment
+	// itself rests on another lawful basis and is not listed.
+	ConsentResearch     = "research"
+	ConsentNotification = "notification"
+	ConsentMarketing    = "marketing"
+
+	ConsentChannelPaper  = "paper"
+	ConsentChannelKiosk  = "kiosk"
+	ConsentChannelOnline = "online"
+	ConsentChannelVerbal = "verbal"
+)
+
+var ConsentPurposes = []string{ConsentResearch, ConsentNotification, ConsentMarketing}
+var ConsentChannels = []string{ConsentChannelPaper, ConsentChannelKiosk, ConsentChannelOnline, ConsentChannelVerbal}
+
+// Consent is one grant of consent for a purpose under a version of the
+// consent text. Withdrawing it sets WithdrawnAt; a new grant is a new row,
+// so the history is kept.
+type Consent struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	PatientID  string `gorm:"not null;index" json:"patient_id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+	Purpose    string `gorm:"size:30;not null;index" json:"purpose"`
+	Version    string `gorm:"size:20;not null" json:"version"`
+
+	Channel    string    `gorm:"size:20;not null" json:"channel"`
+	Note       string    `json:"note"`
+	GrantedAt  time.Time `json:"granted_at"`
+	RecordedBy string    `json:"recorded_by"`
+
+	WithdrawnAt  *time.Time `json:"withdrawn_at"`
+	WithdrawnBy  string     `json:"withdrawn_by"`
+	WithdrawVia  string     `gorm:"size:20" json:"withdraw_channel"`
+	WithdrawNote string     `json:"withdraw_note"`
+}
+
+const (
+	SubjectRequestAccess  = "access"
+	SubjectRequestErasure = "erasure"
+
+	SubjectRequestPending   = "pending"
+	SubjectRequestCompleted = "completed"
+	SubjectRequestRejected  = "rejected"
+)
+
+// DataSubjectRequest is a patient's request to obtain a copy of their data
+// or to have it erased. The PDPA expects an answer within 30 days (DueAt).
+type DataSubjectRequest struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	PatientID  string `gorm:"not null;index" json:"patient_id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+	Type       string `gorm:"size:20;not null" json:"type"`
+	Note       string `json:"note"`
+
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	RequestedAt time.Time  `json:"requested_at"`
+	DueAt       time.Time  `json:"due_at"`
+	HandledBy   string     `json:"handled_by"`
+	HandledAt   *time.Time `json:"handled_at"`
+	Outcome     string     `json:"outcome"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+const (
+	SchemeUCS     = "UCS" // Universal Coverage (gold card)
+	SchemeSSS     = "SSS" // Social Security
+	SchemeCSMBS   = "CSMBS"
+	SchemePrivate = "PRIVATE"
+
+	EligibilityUnknown    = "unknown"
+	EligibilityEligible   = "eligible"
+	EligibilityIneligible = "ineligible"
+)
+
+// Coverage is a payer a patient is entitled to bill. A patient may hold
+// several; the one with the lowest Priority that is valid and not known to
+// be ineligible is used by default.
+type Coverage struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	PatientID  string `gorm:"not null;index" json:"patient_id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+
+	Scheme       string     `gorm:"size:10;not null" json:"scheme"`
+	InsurerName  string     `gorm:"size:255" json:"insurer_name"`
+	PolicyNumber string     `gorm:"size:50" json:"policy_number"`
+	MainHospital string     `gorm:"size:255" json:"main_hospital"`
+	ValidFrom    time.Time  `json:"valid_from"`
+	ValidTo      *time.Time `json:"valid_to"`
+	Priority     int        `gorm:"default:1" json:"priority"`
+
+	EligibilityStatus    string     `gorm:"size:20;not null" json:"eligibility_status"`
+	EligibilityNote      string     `json:"eligibility_note"`
+	EligibilityCheckedAt *time.Time `json:"eligibility_checked_at"`
+
+	RecordedBy string    `json:"recorded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Payer is the name invoices and price lists use for this coverage: the
+// scheme for public schemes, the insurer for private insurance.
+func (c Coverage) Payer() string {
+	if c.Scheme == SchemePrivate && c.InsurerName != "" {
+		return c.InsurerName
+	}
+	return c.Scheme
+}
+
+// ValidAt reports whether t falls inside the coverage's validity dates.
+// ValidTo is the last covered day, so the whole of that day counts.
+func (c Coverage) ValidAt(t time.Time) bool {
+	if t.Before(c.ValidFrom) {
+		return false
+	}
+	return c.ValidTo == nil || t.Before(c.ValidTo.AddDate(0, 0, 1))
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// ICD10Code is one entry of the ICD-10 / ICD-10-TM catalog, stored in dotted
+// form (e.g. "J18.9").
+type ICD10Code struct {
+	Code          string `gorm:"primaryKey;size:10" json:"code"`
+	DescriptionEN string `gorm:"size:500" json:"description_en"`
+	DescriptionTH string `gorm:"size:500" json:"description_th"`
+}
+
+const (
+	DiagnosisPrimary   = "primary"
+	DiagnosisSecondary = "secondary"
+)
+
+type Diagnosis struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	EncounterID uint   `gorm:"not null;index;uniqueIndex:idx_diagnoses_primary,where:type = 'primary'" json:"encounter_id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+
+	Code  string    `gorm:"size:10;not null" json:"code"`
+	ICD10 ICD10Code `gorm:"foreignKey:Code;references:Code" json:"icd10"`
+	Type  string    `gorm:"size:10;not null" json:"type"`
+	Note  string    `json:"note"`
+
+	DiagnosedBy string    `json:"diagnosed_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	EncounterOPD = "OPD"
+	EncounterIPD = "IPD"
+	EncounterER  = "ER"
+)
+
+type Encounter struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	PatientID  string `gorm:"not null;index" json:"patient_id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+	Type       string `gorm:"size:3;not null" json:"type"`
+
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
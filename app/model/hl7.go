@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	HL7Processed = "processed"
+	HL7Failed    = "failed"
+)
+
+// HL7Message is an inbound HL7 v2 message as received. Failed messages are
+// kept with the reason so they can be corrected and reprocessed. PatientID
+// is set once the PID names a patient of the hospital, or when that patient
+// is later registered or erased, since Raw carries their identifiers.
+type HL7Message struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+	PatientID   string `gorm:"index" json:"patient_id"`
+	ControlID   string `gorm:"size:50;index" json:"control_id"`
+	MessageType string `gorm:"size:20" json:"message_type"`
+	Raw         string `gorm:"type:text;not null" json:"raw"`
+
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	Error       string     `json:"error"`
+	Attempts    int        `json:"attempts"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	ProcessedAt *time.Time `json:"processed_at"`
+}
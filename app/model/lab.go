@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// LabTest is an entry of the laboratory test catalog. Numeric tests carry a
+// reference range (and optionally critical limits); qualitative tests carry
+// the expected normal text in RefText.
+type LabTest struct {
+	ID           uint     `gorm:"primaryKey" json:"id"`
+	Code         string   `gorm:"size:20;not null;unique" json:"code"`
+	Name         string   `gorm:"size:255;not null" json:"name"`
+	SpecimenType string   `gorm:"size:20;not null" json:"specimen_type"`
+	Unit         string   `gorm:"size:20" json:"unit"`
+	RefLow       *float64 `json:"ref_low"`
+	RefHigh      *float64 `json:"ref_high"`
+	CriticalLow  *float64 `json:"critical_low"`
+	CriticalHigh *float64 `json:"critical_high"`
+	RefText      string   `gorm:"size:50" json:"ref_text"`
+	Active       bool     `gorm:"default:true" json:"active"`
+}
+
+const (
+	LabOrdered   = "ordered"
+	LabCollected = "collected"
+	LabResulted  = "resulted"
+	LabCancelled = "cancelled"
+)
+
+type LabOrder struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+	EncounterID uint   `gorm:"not null;index" json:"encounter_id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+
+	Status    string         `gorm:"size:20;not null" json:"status"`
+	Items     []LabOrderItem `json:"items"`
+	Specimens []Specimen     `json:"specimens"`
+	Results   []LabResult    `json:"results"`
+	OrderedBy string         `json:"ordered_by"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type LabOrderItem struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	LabOrderID uint   `gorm:"not null;index" json:"lab_order_id"`
+	TestCode   string `gorm:"size:20;not null" json:"test_code"`
+	SpecimenID uint   `gorm:"not null" json:"specimen_id"`
+}
+
+const (
+	SpecimenPending   = "pending"
+	SpecimenCollected = "collected"
+	SpecimenReceived  = "received"
+	SpecimenRejected  = "rejected"
+)
+
+type Specimen struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	LabOrderID   uint       `gorm:"not null;index" json:"lab_order_id"`
+	HospitalID   string     `gorm:"not null;index" json:"hospital_id"`
+	Barcode      string     `gorm:"size:20;not null;unique" json:"barcode"`
+	Type         string     `gorm:"size:20;not null" json:"type"`
+	Status       string     `gorm:"size:20;not null" json:"status"`
+	CollectedAt  *time.Time `json:"collected_at"`
+	CollectedBy  string     `json:"collected_by"`
+	ReceivedAt   *time.Time `json:"received_at"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+}
+
+const (
+	FlagNormal       = "N"
+	FlagLow          = "L"
+	FlagHigh         = "H"
+	FlagCriticalLow  = "LL"
+	FlagCriticalHigh = "HH"
+	FlagAbnormal     = "A"
+)
+
+// LabResult is one reported value. The reference range is copied from the
+// catalog at result time so later catalog changes do not alter old flags.
+type LabResult struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	LabOrderID uint   `gorm:"not null;index" json:"lab_order_id"`
+	SpecimenID uint   `gorm:"not null;index" json:"specimen_id"`
+	PatientID  string `gorm:"not null;index" json:"patient_id"`
+	HospitalID string `gorm:"not null;index" json:"hospital_id"`
+
+	TestCode     string   `gorm:"size:20;not null;index" json:"test_code"`
+	Value        string   `gorm:"size:100;not null" json:"value"`
+	NumericValue *float64 `json:"numeric_value"`
+	Unit         string   `gorm:"size:20" json:"unit"`
+	RefLow       *float64 `json:"ref_low"`
+	RefHigh      *float64 `json:"ref_high"`
+	RefText      string   `gorm:"size:50" json:"ref_text"`
+	Flag         string   `gorm:"size:2" json:"flag"`
+
+	Source     string    `gorm:"size:20" json:"source"`
+	ResultedBy string    `json:"resulted_by"`
+	ResultedAt time.Time `gorm:"index" json:"resulted_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+const (
+	NoteDraft  = "draft"
+	NoteSigned = "signed"
+)
+
+// ClinicalNote is a SOAP note on an encounter. Once signed it is never
+// changed again; corrections are made as addenda, which are notes pointing
+// at the original through AddendumToID.
+type ClinicalNote struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	EncounterID uint   `gorm:"not null;index" json:"encounter_id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+
+	AuthorID uint  `gorm:"not null;index" json:"author_id"`
+	Author   Staff `gorm:"foreignKey:AuthorID" json:"author"`
+
+	Subjective string `gorm:"type:text" json:"subjective"`
+	Objective  string `gorm:"type:text" json:"objective"`
+	Assessment string `gorm:"type:text" json:"assessment"`
+	Plan       string `gorm:"type:text" json:"plan"`
+
+	Status       string         `gorm:"size:10;not null" json:"status"`
+	SignedAt     *time.Time     `json:"signed_at"`
+	AddendumToID *uint          `gorm:"index" json:"addendum_to_id"`
+	Addenda      []ClinicalNote `gorm:"foreignKey:AddendumToID" json:"addenda,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
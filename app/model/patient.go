@@ -24,4 +24,17 @@ type Patient struct {
 	PhoneNumber string `gorm:"size:20" json:"phone_number"`
 	Email       string `gorm:"size:100" json:"email"`
 	Gender      string `gorm:"size:1" json:"gender"`
+
+	Allergies []Allergy  `gorm:"foreignKey:PatientID" json:"allergies"`
+	Coverages []Coverage `gorm:"foreignKey:PatientID" json:"coverages"`
+}
+
+// PatientRecords lists the tables holding a patient's clinical, billing,
+// consent and interface records by patient_id and hospital_id, for
+// operations that act on a whole chart such as merging duplicates.
+var PatientRecords = []interface{}{
+	&Allergy{}, &Coverage{}, &Encounter{}, &VitalSign{}, &Triage{}, &Diagnosis{},
+	&Prescription{}, &LabOrder{}, &LabResult{}, &ClinicalNote{},
+	&Charge{}, &Invoice{}, &Payment{}, &Consent{}, &DataSubjectRequest{},
+	&HL7Message{},
 }
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Store is a drug store or dispensing counter belonging to a hospital.
+type Store struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	HospitalID string    `gorm:"not null;index" json:"hospital_id"`
+	Name       string    `gorm:"size:255;not null" json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type StockLot struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	HospitalID string    `gorm:"not null;index" json:"hospital_id"`
+	StoreID    uint      `gorm:"not null;uniqueIndex:idx_store_drug_lot" json:"store_id"`
+	DrugID     uint      `gorm:"not null;uniqueIndex:idx_store_drug_lot" json:"drug_id"`
+	Drug       Drug      `json:"drug"`
+	LotNumber  string    `gorm:"size:50;not null;uniqueIndex:idx_store_drug_lot" json:"lot_number"`
+	ExpiryDate time.Time `gorm:"not null;index" json:"expiry_date"`
+	Quantity   int       `gorm:"not null" json:"quantity"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+const (
+	MovementReceive     = "receive"
+	MovementDispense    = "dispense"
+	MovementTransferOut = "transfer_out"
+	MovementTransferIn  = "transfer_in"
+	MovementAdjust      = "adjust"
+)
+
+// StockMovement is the ledger of every change to a lot's quantity; Quantity
+// is signed (negative when stock leaves the lot).
+type StockMovement struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	HospitalID     string    `gorm:"not null;index" json:"hospital_id"`
+	StoreID        uint      `gorm:"not null;index" json:"store_id"`
+	LotID          uint      `gorm:"not null;index" json:"lot_id"`
+	DrugID         uint      `gorm:"not null" json:"drug_id"`
+	Type           string    `gorm:"size:20;not null" json:"type"`
+	Quantity       int       `gorm:"not null" json:"quantity"`
+	PrescriptionID *uint     `gorm:"index" json:"prescription_id,omitempty"`
+	Note           string    `json:"note"`
+	PerformedBy    string    `json:"performed_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
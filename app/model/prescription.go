@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Drug is an entry of the formulary. Code is also used as the charge and
+// stock item code.
+type Drug struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Code        string `gorm:"size:50;not null;unique" json:"code"`
+	Name        string `gorm:"size:255;not null" json:"name"`
+	GenericName string `gorm:"size:255;index" json:"generic_name"`
+	Form        string `gorm:"size:50" json:"form"`
+	Strength    string `gorm:"size:50" json:"strength"`
+	Unit        string `gorm:"size:20" json:"unit"`
+	Active      bool   `gorm:"default:true" json:"active"`
+}
+
+const (
+	InteractionMinor           = "minor"
+	InteractionModerate        = "moderate"
+	InteractionMajor           = "major"
+	InteractionContraindicated = "contraindicated"
+)
+
+// DrugInteraction is a configured drug-drug interaction pair, matched on
+// generic name. DrugA is always the lexically smaller of the two names.
+type DrugInteraction struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	DrugA       string `gorm:"size:255;not null;uniqueIndex:idx_interaction_pair" json:"drug_a"`
+	DrugB       string `gorm:"size:255;not null;uniqueIndex:idx_interaction_pair" json:"drug_b"`
+	Severity    string `gorm:"size:20;not null" json:"severity"`
+	Description string `json:"description"`
+}
+
+const (
+	PrescriptionDraft     = "draft"
+	PrescriptionSigned    = "signed"
+	PrescriptionDispensed = "dispensed"
+	PrescriptionCancelled = "cancelled"
+)
+
+type Prescription struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+	EncounterID uint   `gorm:"not null;index" json:"encounter_id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+
+	Status       string             `gorm:"size:20;not null;index" json:"status"`
+	Items        []PrescriptionItem `json:"items"`
+	PrescribedBy string             `json:"prescribed_by"`
+	SignedBy     string             `json:"signed_by"`
+	SignedAt     *time.Time         `json:"signed_at"`
+	CancelReason string             `json:"cancel_reason,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PrescriptionItem struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	PrescriptionID uint   `gorm:"not null;index" json:"prescription_id"`
+	DrugID         uint   `gorm:"not null" json:"drug_id"`
+	Drug           Drug   `json:"drug"`
+	Dose           string `gorm:"size:50;not null" json:"dose"`
+	DoseUnit       string `gorm:"size:20;not null" json:"dose_unit"`
+	Route          string `gorm:"size:20;not null" json:"route"`
+	Frequency      string `gorm:"size:20;not null" json:"frequency"`
+	DurationDays   int    `json:"duration_days"`
+	Quantity       int    `gorm:"not null" json:"quantity"`
+	Instruction    string `json:"instruction"`
+}
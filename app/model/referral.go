@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+const (
+	ReferralPending   = "pending"
+	ReferralAccepted  = "accepted"
+	ReferralRejected  = "rejected"
+	ReferralCancelled = "cancelled"
+
+	// Parts of the record beyond demographics that a referral can share.
+	ReferralScopeAllergies     = "allergies"
+	ReferralScopeDiagnoses     = "diagnoses"
+	ReferralScopePrescriptions = "prescriptions"
+	ReferralScopeLabResults    = "lab_results"
+	ReferralScopeNotes         = "notes"
+)
+
+var ReferralScopes = []string{ReferralScopeAllergies, ReferralScopeDiagnoses, ReferralScopePrescriptions,
+	ReferralScopeLabResults, ReferralScopeNotes}
+
+// Referral sends a patient from one hospital to another. Once accepted, the
+// receiving hospital may read the shared parts of the patient's record until
+// AccessExpiresAt, or until the sender cancels the referral.
+type Referral struct {
+	ID             uint     `gorm:"primaryKey" json:"id"`
+	PatientID      string   `gorm:"not null;index" json:"patient_id"`
+	FromHospitalID string   `gorm:"not null;index" json:"from_hospital_id"`
+	ToHospitalID   string   `gorm:"not null;index" json:"to_hospital_id"`
+	ToHospital     Hospital `gorm:"foreignKey:ToHospitalID" json:"to_hospital"`
+	FromHospital   Hospital `gorm:"foreignKey:FromHospitalID" json:"from_hospital"`
+
+	Reason          string   `gorm:"not null" json:"reason"`
+	ClinicalSummary string   `gorm:"type:text" json:"clinical_summary"`
+	Scopes          []string `gorm:"serializer:json" json:"scopes"`
+	AccessDays      int      `gorm:"not null" json:"access_days"`
+
+	Status          string     `gorm:"size:20;not null;index" json:"status"`
+	RequestedBy     string     `json:"requested_by"`
+	RespondedBy     string     `json:"responded_by"`
+	RespondedAt     *time.Time `json:"responded_at"`
+	ResponseNote    string     `json:"response_note"`
+	AccessExpiresAt *time.Time `json:"access_expires_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccessOpen reports whether the receiving hospital may read the record at t.
+func (r Referral) AccessOpen(t time.Time) bool {
+	return r.Status == ReferralAccepted && r.AccessExpiresAt != nil && t.Before(*r.AccessExpiresAt)
+}
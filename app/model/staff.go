@@ -1,12 +1,31 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
+
+const (
+	RoleAdmin      = "admin"
+	RoleDoctor     = "doctor"
+	RoleDentist    = "dentist"
+	RoleNurse      = "nurse"
+	RolePharmacist = "pharmacist"
+)
+
+var Roles = []string{RoleAdmin, RoleDoctor, RoleDentist, RoleNurse, RolePharmacist}
+
+// CanPrescribe reports whether staff with the given role may sign
+// prescriptions.
+func CanPrescribe(role string) bool {
+	return slices.Contains([]string{RoleDoctor, RoleDentist}, role)
+}
 
 type Staff struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	Username   string    `gorm:"unique;not null" json:"username"`
 	Password   string    `gorm:"not null" json:"-"`
-	HospitalID string      `gorm:"not null" json:"hospital_id"`
+	HospitalID string    `gorm:"not null" json:"hospital_id"`
 	Hospital   Hospital  `gorm:"foreignKey:HospitalID" json:"hospital"`
 	FullName   string    `json:"full_name"`
 	Role       string    `json:"role"`
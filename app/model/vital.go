@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// VitalSign is one set of measurements taken during an encounter. All values
+// are stored in metric units; nil means the measurement was not taken.
+type VitalSign struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	EncounterID uint   `gorm:"not null;index" json:"encounter_id"`
+	PatientID   string `gorm:"not null;index" json:"patient_id"`
+	HospitalID  string `gorm:"not null;index" json:"hospital_id"`
+
+	Systolic        *int     `json:"systolic"`         // mmHg
+	Diastolic       *int     `json:"diastolic"`        // mmHg
+	Pulse           *int     `json:"pulse"`            // beats/min
+	Temperature     *float64 `json:"temperature"`      // °C
+	SpO2            *int     `json:"spo2"`             // %
+	RespiratoryRate *int     `json:"respiratory_rate"` // breaths/min
+	Weight          *float64 `json:"weight"`           // kg
+	Height          *float64 `json:"height"`           // cm
+	BMI             *float64 `json:"bmi"`
+	PainScore       *int     `json:"pain_score"` // 0-10
+
+	Flags      []string  `gorm:"serializer:json" json:"abnormal_flags"`
+	MeasuredAt time.Time `gorm:"index" json:"measured_at"`
+	RecordedBy string    `json:"recorded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	TriageESI  = "ESI"
+	TriageMOPH = "MOPH"
+)
+
+// Triage is the ER acuity level assigned to an encounter, either on the
+// Emergency Severity Index or the Thai MOPH ED triage scale (both 1-5).
+type Triage struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	EncounterID    uint      `gorm:"not null;index" json:"encounter_id"`
+	PatientID      string    `gorm:"not null;index" json:"patient_id"`
+	HospitalID     string    `gorm:"not null;index" json:"hospital_id"`
+	System         string    `gorm:"size:4;not null" json:"system"`
+	Level          int       `gorm:"not null" json:"level"`
+	Label          string    `json:"label"`
+	ChiefComplaint string    `json:"chief_complaint"`
+	AssessedBy     string    `json:"assessed_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,276 @@
+package note
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the clinical note endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+type soapInput struct {
+	Subjective string `json:"subjective"`
+	Objective  string `json:"objective"`
+	Assessment string `json:"assessment"`
+	Plan       string `json:"plan"`
+}
+
+func (in soapInput) empty() bool {
+	return strings.TrimSpace(in.Subjective+in.Objective+in.Assessment+in.Plan) == ""
+}
+
+func (h *Handler) CreateNote(c *gin.Context) {
+	var input struct {
+		EncounterID uint `json:"encounter_id" binding:"required"`
+		soapInput
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.empty() {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	staffHospital, authorID, ok := author(c)
+	if !ok {
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.EncounterID, staffHospital).
+		First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return
+	}
+
+	note := models.ClinicalNote{
+		EncounterID: encounter.ID,
+		PatientID:   encounter.PatientID,
+		HospitalID:  staffHospital,
+		AuthorID:    authorID,
+		Subjective:  input.Subjective,
+		Objective:   input.Objective,
+		Assessment:  input.Assessment,
+		Plan:        input.Plan,
+		Status:      models.NoteDraft,
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&note).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกโน้ตได้", "Could not save the note").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, note)
+}
+
+// UpdateNote edits a draft. Signed notes are immutable: the update is made
+// conditional on the note still being a draft, so a concurrent sign wins.
+func (h *Handler) UpdateNote(c *gin.Context) {
+	var input soapInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.empty() {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	note, ok := h.findOwnDraft(c)
+	if !ok {
+		return
+	}
+
+	result := h.DB.WithContext(c.Request.Context()).Model(&note).
+		Where("status = ?", models.NoteDraft).
+		Updates(map[string]interface{}{
+			"subjective": input.Subjective,
+			"objective":  input.Objective,
+			"assessment": input.Assessment,
+			"plan":       input.Plan,
+		})
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถแก้ไขโน้ตได้", "Could not update the note").Wrap(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "โน้ตที่ลงนามแล้วแก้ไขไม่ได้ กรุณาเพิ่ม Addendum", "Signed notes cannot be edited, please add an addendum"))
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+func (h *Handler) SignNote(c *gin.Context) {
+	note, ok := h.findOwnDraft(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	result := h.DB.WithContext(c.Request.Context()).Model(&note).
+		Where("status = ?", models.NoteDraft).
+		Updates(map[string]interface{}{"status": models.NoteSigned, "signed_at": now})
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถลงนามโน้ตได้", "Could not sign the note").Wrap(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "โน้ตนี้ลงนามแล้ว", "The note is already signed"))
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// AddAddendum appends a correction to a signed note. Addenda always hang off
+// the original note, and are themselves drafts until signed.
+func (h *Handler) AddAddendum(c *gin.Context) {
+	var input soapInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.empty() {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	staffHospital, authorID, ok := author(c)
+	if !ok {
+		return
+	}
+
+	var original models.ClinicalNote
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&original).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบโน้ตที่ระบุ", "Note not found"))
+		return
+	}
+	if original.Status != models.NoteSigned {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "เพิ่ม Addendum ได้เฉพาะโน้ตที่ลงนามแล้ว ฉบับร่างแก้ไขได้โดยตรง", "Addenda can only be added to signed notes; edit drafts directly"))
+		return
+	}
+	rootID := original.ID
+	if original.AddendumToID != nil {
+		rootID = *original.AddendumToID
+	}
+
+	addendum := models.ClinicalNote{
+		EncounterID:  original.EncounterID,
+		PatientID:    original.PatientID,
+		HospitalID:   staffHospital,
+		AuthorID:     authorID,
+		Subjective:   input.Subjective,
+		Objective:    input.Objective,
+		Assessment:   input.Assessment,
+		Plan:         input.Plan,
+		Status:       models.NoteDraft,
+		AddendumToID: &rootID,
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&addendum).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึก Addendum ได้", "Could not save the addendum").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, addendum)
+}
+
+func (h *Handler) GetNote(c *gin.Context) {
+	staffHospital, authorID, ok := author(c)
+	if !ok {
+		return
+	}
+
+	var note models.ClinicalNote
+	if err := visible(h.DB.WithContext(c.Request.Context()), authorID).
+		Preload("Author").
+		Preload("Addenda", func(db *gorm.DB) *gorm.DB { return visible(db, authorID).Order("created_at") }).
+		Preload("Addenda.Author").
+		Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&note).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบโน้ตที่ระบุ", "Note not found"))
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+func (h *Handler) GetEncounterNotes(c *gin.Context) {
+	staffHospital, authorID, ok := author(c)
+	if !ok {
+		return
+	}
+
+	var notes []models.ClinicalNote
+	if err := visible(h.DB.WithContext(c.Request.Context()), authorID).
+		Preload("Author").
+		Preload("Addenda", func(db *gorm.DB) *gorm.DB { return visible(db, authorID).Order("created_at") }).
+		Preload("Addenda.Author").
+		Where("encounter_id = ? AND hospital_id = ? AND addendum_to_id IS NULL", c.Param("id"), staffHospital).
+		Order("created_at").
+		Find(&notes).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลโน้ตได้", "Could not load notes").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// SearchPatientNotes searches the notes and addenda in one patient's chart.
+// Every word of q must appear somewhere in the note's SOAP text.
+func (h *Handler) SearchPatientNotes(c *gin.Context) {
+	staffHospital, authorID, ok := author(c)
+	if !ok {
+		return
+	}
+
+	query := visible(h.DB.WithContext(c.Request.Context()), authorID).
+		Preload("Author").
+		Where("patient_id = ? AND hospital_id = ?", c.Param("id"), staffHospital)
+	text := "LOWER(subjective || ' ' || objective || ' ' || assessment || ' ' || plan)"
+	for _, word := range strings.Fields(strings.ToLower(c.Query("q"))) {
+		query = query.Where(text+" LIKE ?", "%"+word+"%")
+	}
+
+	var notes []models.ClinicalNote
+	if err := query.Order("created_at DESC").Limit(100).Find(&notes).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถค้นหาโน้ตได้", "Could not search notes").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// visible hides other authors' drafts; signed notes are visible to everyone
+// in the hospital.
+func visible(db *gorm.DB, authorID uint) *gorm.DB {
+	return db.Where("status = ? OR author_id = ?", models.NoteSigned, authorID)
+}
+
+func author(c *gin.Context) (string, uint, bool) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return "", 0, false
+	}
+	id, _ := c.Get("staff_id")
+	staffID, ok := id.(uint)
+	if !ok {
+		apierror.Respond(c, apierror.New(apierror.Unauthorized, "ไม่พบข้อมูลเจ้าหน้าที่ กรุณา Login ใหม่", "Staff account not found, please log in again"))
+		return "", 0, false
+	}
+	return staffHospital, staffID, true
+}
+
+func (h *Handler) findOwnDraft(c *gin.Context) (models.ClinicalNote, bool) {
+	var note models.ClinicalNote
+	staffHospital, authorID, ok := author(c)
+	if !ok {
+		return note, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&note).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบโน้ตที่ระบุ", "Note not found"))
+		return note, false
+	}
+	if note.AuthorID != authorID {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "แก้ไขหรือลงนามได้เฉพาะโน้ตของตนเอง", "You can only edit or sign your own notes"))
+		return note, false
+	}
+	if note.Status != models.NoteDraft {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "โน้ตที่ลงนามแล้วแก้ไขไม่ได้ กรุณาเพิ่ม Addendum", "Signed notes cannot be edited, please add an addendum"))
+		return note, false
+	}
+	return note, true
+}
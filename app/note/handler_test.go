@@ -0,0 +1,165 @@
+package note
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Staff{}, &models.Encounter{}, &models.ClinicalNote{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Staff{ID: 1, Username: "doctor01", Password: "x", HospitalID: "1", Role: "doctor"})
+	db.Create(&models.Staff{ID: 2, Username: "doctor02", Password: "x", HospitalID: "1", Role: "doctor"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	return db
+}
+
+func generateTestToken(HospitalID string, staffID uint) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"staff_id":    staffID,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/note/add", h.CreateNote)
+	r.PUT("/note/:id", h.UpdateNote)
+	r.POST("/note/sign/:id", h.SignNote)
+	r.POST("/note/addendum/:id", h.AddAddendum)
+	r.GET("/note/search/:id", h.GetNote)
+	r.GET("/note/patient/:id", h.SearchPatientNotes)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID string, staffID uint) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID, staffID))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestNoteLifecycle(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	w := send(r, "POST", "/note/add", map[string]interface{}{
+		"encounter_id": 1,
+		"subjective":   "Fever for 2 days",
+		"assessment":   "Suspected dengue",
+		"plan":         "CBC, NS1 antigen",
+	}, "1", 1)
+	var note models.ClinicalNote
+	json.Unmarshal(w.Body.Bytes(), &note)
+	id := fmt.Sprint(note.ID)
+
+	t.Run("Create Note Success", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, models.NoteDraft, note.Status)
+		assert.Equal(t, uint(1), note.AuthorID)
+	})
+
+	t.Run("Other Author Cannot See Or Edit Draft", func(t *testing.T) {
+		w := send(r, "GET", "/note/search/"+id, nil, "1", 2)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = send(r, "PUT", "/note/"+id, map[string]interface{}{"plan": "x"}, "1", 2)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Update Draft Success", func(t *testing.T) {
+		w := send(r, "PUT", "/note/"+id, map[string]interface{}{
+			"subjective": "Fever for 3 days", "assessment": "Dengue fever", "plan": "CBC, NS1 antigen",
+		}, "1", 1)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Fever for 3 days")
+	})
+
+	t.Run("Sign Success", func(t *testing.T) {
+		w := send(r, "POST", "/note/sign/"+id, nil, "1", 1)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"signed"`)
+	})
+
+	t.Run("Signed Note Is Immutable", func(t *testing.T) {
+		w := send(r, "PUT", "/note/"+id, map[string]interface{}{"plan": "changed"}, "1", 1)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Addendum Success", func(t *testing.T) {
+		w := send(r, "POST", "/note/addendum/"+id, map[string]interface{}{
+			"assessment": "NS1 positive, confirmed dengue",
+		}, "1", 2)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var addendum models.ClinicalNote
+		json.Unmarshal(w.Body.Bytes(), &addendum)
+		send(r, "POST", "/note/sign/"+fmt.Sprint(addendum.ID), nil, "1", 2)
+
+		w = send(r, "GET", "/note/search/"+id, nil, "1", 1)
+		var got models.ClinicalNote
+		json.Unmarshal(w.Body.Bytes(), &got)
+		assert.Equal(t, "Fever for 3 days", got.Subjective)
+		assert.Len(t, got.Addenda, 1)
+		assert.Equal(t, "doctor02", got.Addenda[0].Author.Username)
+	})
+
+	t.Run("Get Note Fail Case Other Hospital", func(t *testing.T) {
+		w := send(r, "GET", "/note/search/"+id, nil, "2", 1)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestSearchPatientNotes(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	db.Create(&models.ClinicalNote{EncounterID: 1, PatientID: "001", HospitalID: "1", AuthorID: 1,
+		Subjective: "Chest pain", Assessment: "Unstable angina", Status: models.NoteSigned})
+	db.Create(&models.ClinicalNote{EncounterID: 1, PatientID: "001", HospitalID: "1", AuthorID: 1,
+		Subjective: "Follow-up chest pain", Plan: "Echocardiogram", Status: models.NoteSigned})
+	db.Create(&models.ClinicalNote{EncounterID: 1, PatientID: "001", HospitalID: "1", AuthorID: 2,
+		Subjective: "Chest pain draft", Status: models.NoteDraft})
+
+	search := func(q string, hospitalID string) []models.ClinicalNote {
+		w := send(r, "GET", "/note/patient/001?q="+q, nil, hospitalID, 1)
+		var notes []models.ClinicalNote
+		json.Unmarshal(w.Body.Bytes(), &notes)
+		return notes
+	}
+
+	assert.Len(t, search("chest", "1"), 2)
+	assert.Len(t, search("chest+ECHOCARDIOGRAM", "1"), 1)
+	assert.Len(t, search("angina", "1"), 1)
+	assert.Len(t, search("chest", "2"), 0)
+}
@@ -0,0 +1,255 @@
+package patient
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/deid"
+	"example.com/myapp/app/fhir"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+)
+
+const exportBatchSize = 500
+
+const (
+	ExportCSV    = "csv"
+	ExportJSONL  = "jsonl"
+	ExportNDJSON = "ndjson"
+)
+
+var exportFormats = map[string]struct{ contentType, extension string }{
+	ExportCSV:    {"text/csv; charset=utf-8", "csv"},
+	ExportJSONL:  {"application/jsonl", "jsonl"},
+	ExportNDJSON: {"application/fhir+ndjson", "ndjson"},
+}
+
+// exportRecord is a patient as exported: the CreatePatient fields, so a CSV
+// export can be loaded again with ImportPatients.
+type exportRecord struct {
+	ID           string `json:"id"`
+	PatientHN    string `json:"patient_hn"`
+	HospitalID   string `json:"hospital_id"`
+	FirstNameTH  string `json:"first_name_th"`
+	MiddleNameTH string `json:"middle_name_th"`
+	LastNameTH   string `json:"last_name_th"`
+	FirstNameEN  string `json:"first_name_en"`
+	MiddleNameEN string `json:"middle_name_en"`
+	LastNameEN   string `json:"last_name_en"`
+	DateOfBirth  string `json:"date_of_birth"`
+	NationalID   string `json:"national_id"`
+	PassportID   string `json:"passport_id"`
+	PhoneNumber  string `json:"phone_number"`
+	Email        string `json:"email"`
+	Gender       string `json:"gender"`
+}
+
+func newExportRecord(p models.Patient) exportRecord {
+	r := exportRecord{
+		ID: p.ID, PatientHN: p.PatientHN, HospitalID: p.HospitalID,
+		FirstNameTH: p.FirstNameTH, MiddleNameTH: p.MiddleNameTH, LastNameTH: p.LastNameTH,
+		FirstNameEN: p.FirstNameEN, MiddleNameEN: p.MiddleNameEN, LastNameEN: p.LastNameEN,
+		NationalID: p.NationalID, PassportID: p.PassportID,
+		PhoneNumber: p.PhoneNumber, Email: p.Email, Gender: p.Gender,
+	}
+	if !p.DateOfBirth.IsZero() {
+		r.DateOfBirth = p.DateOfBirth.Format("2006-01-02")
+	}
+	return r
+}
+
+// values lists the record in importColumns order.
+func (r exportRecord) values() []string {
+	return []string{
+		r.ID, r.PatientHN, r.HospitalID,
+		r.FirstNameTH, r.MiddleNameTH, r.LastNameTH,
+		r.FirstNameEN, r.MiddleNameEN, r.LastNameEN,
+		r.DateOfBirth, r.NationalID, r.PassportID, r.PhoneNumber, r.Email, r.Gender,
+	}
+}
+
+// filterFields names the criteria the export was narrowed by, never their
+// values, so the audit log does not become another copy of national IDs,
+// names and emails.
+func filterFields(filter repository.PatientFilter) string {
+	raw, _ := json.Marshal(filter)
+	var criteria map[string]string
+	json.Unmarshal(raw, &criteria)
+	fields := make([]string, 0, len(criteria))
+	for field, value := range criteria {
+		if value != "" {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+	return strings.Join(fields, ",")
+}
+
+// ExportPatients streams the caller's hospital's patients, narrowed by the
+// GetPatients criteria given as query parameters, as CSV, JSON Lines or FHIR
+// bulk NDJSON. Patients are read in batches so the export never holds the
+// whole table. Admin only; every export is audited before it starts.
+func (h *Handler) ExportPatients(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่ส่งออกข้อมูลคนไข้ได้", "Only admins can export patient data"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	format := c.DefaultQuery("format", ExportCSV)
+	spec, ok := exportFormats[format]
+	if !ok {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "format ต้องเป็น csv, jsonl หรือ ndjson", "format must be csv, jsonl or ndjson"))
+		return
+	}
+	var filter repository.PatientFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		apierror.Respond(c, apierror.ErrInvalidInput)
+		return
+	}
+	deidentified, _ := strconv.ParseBool(c.Query("deidentify"))
+	var engine *deid.Engine
+	if deidentified {
+		if engine = deid.Default; engine == nil {
+			apierror.Respond(c, apierror.New(apierror.Unavailable, "ยังไม่ได้ตั้งค่ากุญแจสำหรับทำข้อมูลนิรนาม (DEID_KEY)", "The de-identification key (DEID_KEY) is not configured"))
+			return
+		}
+		// a de-identified export is a research extract, as /research/extract
+		filter.Consent = models.ConsentResearch
+	}
+
+	hospital, err := h.Hospitals.Get(c.Request.Context(), staffHospital)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "รหัสโรงพยาบาลไม่ถูกต้อง", "Invalid hospital ID"))
+		return
+	}
+	if err := h.Audit(c, audit.Entry{
+		Action:            "patient.export",
+		ResourceType:      "patient",
+		PatientHospitalID: staffHospital,
+		Detail:            fmt.Sprintf("format=%s deidentified=%t filter=%s", format, deidentified, filterFields(filter)),
+	}); err != nil {
+		// an export that cannot be audited is not allowed
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถส่งออกข้อมูลคนไข้ได้", "Could not export patients").Wrap(err))
+		return
+	}
+
+	c.Header("Content-Type", spec.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="patients-%s-%s.%s"`,
+		staffHospital, time.Now().Format("20060102"), spec.extension))
+	c.Status(http.StatusOK)
+	// a large export outlasts WRITE_TIMEOUT; it ends when the data does
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	w := newExportWriter(format, c.Writer, engine)
+
+	err = h.Patients.Each(c.Request.Context(), staffHospital, filter, exportBatchSize, func(batch []models.Patient) error {
+		for _, p := range batch {
+			p.Hospital = hospital
+			if err := w.write(p); err != nil {
+				return err
+			}
+		}
+		if err := w.flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil {
+		err = w.flush()
+	}
+	if err != nil {
+		// the status is already sent; the client sees a truncated file
+		log.Println("Patient export failed:", err)
+	}
+}
+
+// deidentifiedColumns head a de-identified CSV export. Identifier columns
+// are empty unless the policy keeps or hashes them.
+var deidentifiedColumns = append([]string{"patient_key", "hospital_id", "gender", "birth_date", "birth_year", "age_band"},
+	deid.Identifiers...)
+
+type exportWriter struct {
+	format string
+	csv    *csv.Writer
+	json   *json.Encoder
+	engine *deid.Engine
+	asOf   time.Time
+}
+
+// newExportWriter writes patients to out in format, de-identified by engine
+// unless it is nil.
+func newExportWriter(format string, out io.Writer, engine *deid.Engine) *exportWriter {
+	w := &exportWriter{format: format, engine: engine, asOf: time.Now()}
+	switch {
+	case format != ExportCSV:
+		w.json = json.NewEncoder(out)
+	case engine != nil:
+		w.csv = csv.NewWriter(out)
+		w.csv.Write(deidentifiedColumns)
+	default:
+		w.csv = csv.NewWriter(out)
+		w.csv.Write(importColumns)
+	}
+	return w
+}
+
+func (w *exportWriter) write(p models.Patient) error {
+	if w.engine != nil {
+		return w.writeDeidentified(p)
+	}
+	switch w.format {
+	case ExportCSV:
+		return w.csv.Write(newExportRecord(p).values())
+	case ExportNDJSON:
+		return w.json.Encode(fhir.FromPatient(p))
+	}
+	return w.json.Encode(newExportRecord(p))
+}
+
+func (w *exportWriter) writeDeidentified(p models.Patient) error {
+	r := w.engine.Patient(p, w.asOf)
+	switch w.format {
+	case ExportCSV:
+		row := []string{r.PatientKey, r.HospitalID, r.Gender, r.BirthDate, "", r.AgeBand}
+		if r.BirthYear != 0 {
+			row[4] = strconv.Itoa(r.BirthYear)
+		}
+		for _, field := range deid.Identifiers {
+			row = append(row, r.Identifiers[field])
+		}
+		return w.csv.Write(row)
+	case ExportNDJSON:
+		resource := fhir.FromPatient(models.Patient{ID: r.PatientKey, HospitalID: r.HospitalID, Hospital: p.Hospital, Gender: r.Gender})
+		resource.BirthDate = r.BirthDate
+		if r.BirthYear != 0 {
+			resource.BirthDate = strconv.Itoa(r.BirthYear)
+		}
+		return w.json.Encode(resource)
+	}
+	return w.json.Encode(r)
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
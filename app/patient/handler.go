@@ -1,97 +1,83 @@
 package patient
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
-	"example.com/myapp/app/database"
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/metrics"
 	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func GetPatientByID(c *gin.Context) {
+// Handler serves the patient endpoints.
+type Handler struct {
+	Patients  repository.PatientRepository
+	Hospitals repository.HospitalRepository
+	// Audit records an action, as audit.Log does.
+	Audit func(c *gin.Context, entry audit.Entry) error
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{
+		Patients:  repository.NewPatientRepository(db),
+		Hospitals: repository.NewHospitalRepository(db),
+		Audit: func(c *gin.Context, entry audit.Entry) error {
+			return audit.Log(db.WithContext(c.Request.Context()), c, entry)
+		},
+	}
+}
+
+func (h *Handler) GetPatientByID(c *gin.Context) {
 	id := c.Param("id")
 	val, _ := c.Get("hospital_id")
 	staffHospitalID, ok := val.(string)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "ไม่พบข้อมูลสิทธิ์โรงพยาบาล"})
+		apierror.Respond(c, apierror.ErrNoHospital)
 		return
 	}
 
-	var patient models.Patient
-	result := database.DB.Preload("Hospital").
-		Where("id = ? AND hospital_id = ?", id, staffHospitalID).
-		First(&patient)
-
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "ไม่พบข้อมูลคนไข้ที่ระบุ",
-		})
+	patient, err := h.Patients.Get(c.Request.Context(), staffHospitalID, id)
+	if err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
 		return
 	}
+	if patient.Allergies == nil {
+		// always send the list so "no allergies recorded" is explicit
+		patient.Allergies = []models.Allergy{}
+	}
+	if patient.Coverages == nil {
+		patient.Coverages = []models.Coverage{}
+	}
 	c.JSON(http.StatusOK, patient)
 }
 
-func GetPatients(c *gin.Context) {
+func (h *Handler) GetPatients(c *gin.Context) {
 	val, _ := c.Get("hospital_id")
 	staffHospital, ok := val.(string)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "ไม่พบข้อมูลสิทธิ์โรงพยาบาล"})
+		apierror.Respond(c, apierror.ErrNoHospital)
 		return
 	}
-	var input struct {
-		NationalID  string `json:"national_id"`
-		PassportID  string `json:"passport_id"`
-		FirstName   string `json:"first_name"`
-		MiddleName  string `json:"middle_name"`
-		LastName    string `json:"last_name"`
-		DateOfBirth string `json:"date_of_birth"`
-		Email       string `json:"email"`
-	}
-
-	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูล Input ไม่ถูกต้อง"})
+	var filter repository.PatientFilter
+	if err := c.ShouldBindJSON(&filter); err != nil && c.Request.ContentLength > 0 {
+		apierror.Respond(c, apierror.ErrInvalidInput)
 		return
 	}
-	query := database.DB.Model(&models.Patient{}).
-		Preload("Hospital").
-		Where("hospital_id = ?", staffHospital)
 
-	if input.NationalID != "" {
-		query = query.Where("national_id = ?", input.NationalID)
-	}
-	if input.PassportID != "" {
-		query = query.Where("passport_id = ?", input.PassportID)
-	}
-	if input.FirstName != "" {
-		query = query.Where("first_name_th LIKE ? OR first_name_en LIKE ?", "%"+input.FirstName+"%", "%"+input.FirstName+"%")
-	}
-	if input.MiddleName != "" {
-		query = query.Where("middle_name_th = ? OR middle_name_en = ?", input.MiddleName, input.MiddleName)
-	}
-	if input.LastName != "" {
-		query = query.Where("last_name_th LIKE ? OR last_name_en LIKE ?", "%"+input.LastName+"%", "%"+input.LastName+"%")
-	}
-	if input.DateOfBirth != "" {
-		query = query.Where("date_of_birth = ?", input.DateOfBirth)
-	}
-	if input.Email != "" {
-		query = query.Where("email = ?", input.Email)
-	}
-
-	var patients []models.Patient
-	result := query.Find(&patients)
-
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "ไม่พบข้อมูลคนไข้",
-		})
+	patients, err := h.Patients.Search(c.Request.Context(), staffHospital, filter)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคนไข้ได้", "Could not load patients").Wrap(err))
 		return
 	}
 	c.JSON(http.StatusOK, patients)
 }
 
-func CreatePatient(c *gin.Context) {
+func (h *Handler) CreatePatient(c *gin.Context) {
 	var input struct {
 		ID           string    `json:"id" binding:"required"`
 		PatientHN    string    `json:"patient_hn" binding:"required"`
@@ -111,23 +97,22 @@ func CreatePatient(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณากรอกข้อมูลให้ครบถ้วน"})
+		apierror.Respond(c, apierror.ErrIncomplete)
 		return
 	}
 	val, _ := c.Get("hospital_id")
 	staffHospital, ok := val.(string)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "ไม่พบข้อมูลสิทธิ์โรงพยาบาล"})
+		apierror.Respond(c, apierror.ErrNoHospital)
 		return
 	}
 	if input.HospitalID != staffHospital {
-		c.JSON(http.StatusForbidden, gin.H{"error": "คุณไม่มีสิทธิ์เพิ่มข้อมูลให้โรงพยาบาลอื่น"})
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "คุณไม่มีสิทธิ์เพิ่มข้อมูลให้โรงพยาบาลอื่น", "You cannot add data for another hospital"))
 		return
 	}
 
-	var hospital models.Hospital
-	if err := database.DB.First(&hospital, input.HospitalID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "รหัสโรงพยาบาลไม่ถูกต้อง"})
+	if _, err := h.Hospitals.Get(c.Request.Context(), input.HospitalID); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "รหัสโรงพยาบาลไม่ถูกต้อง", "Invalid hospital ID"))
 		return
 	}
 
@@ -148,11 +133,21 @@ func CreatePatient(c *gin.Context) {
 		Email:        input.Email,
 		Gender:       input.Gender,
 	}
+	if invalid := repository.ValidatePatient(newPatient); invalid != nil {
+		apierror.Respond(c, apierror.Invalid(invalid.Field, invalid.Message.TH, invalid.Message.EN))
+		return
+	}
 
-	if err := database.DB.Create(&newPatient).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถเพิ่มข้อมูลคนไข้ได้: " + err.Error()})
+	err := h.Patients.Create(c.Request.Context(), &newPatient)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "รหัสคนไข้หรือ HN นี้มีอยู่แล้ว", "A patient with this ID or HN already exists"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเพิ่มข้อมูลคนไข้ได้", "Could not add the patient").Wrap(err))
 		return
 	}
+	metrics.PatientsRegistered.WithLabelValues(staffHospital, metrics.SourceAPI).Inc()
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":    "เพิ่มข้อมูลคนไข้สำเร็จ",
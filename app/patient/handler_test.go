@@ -1,17 +1,23 @@
 package patient
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
-	"example.com/myapp/app/database"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/deid"
 	"example.com/myapp/app/middleware"
 	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
@@ -20,15 +26,28 @@ import (
 )
 
 // SetupTestDB
-func SetupTestDB() {
+func SetupTestDB() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.Hospital{}, &models.Patient{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Allergy{}, &models.Coverage{}, &models.AuditLog{}, &models.Consent{})
 	db.Create(&models.Hospital{
 		// Model: gorm.Model{ID: 1},
 		ID:   "1",
 		Name: "Test Hospital",
 	})
-	database.DB = db
+	return db
+}
+
+// setupMemoryHandler serves the handlers from an in-memory store, for tests
+// that need no SQL behaviour.
+func setupMemoryHandler() (*Handler, *repository.Memory) {
+	store := repository.NewMemory()
+	store.AddHospital(models.Hospital{ID: "1", Name: "Test Hospital"})
+	h := &Handler{
+		Patients:  store.Patients(),
+		Hospitals: store.Hospitals(),
+		Audit:     func(*gin.Context, audit.Entry) error { return nil },
+	}
+	return h, store
 }
 
 func generateTestToken(HospitalID string) string {
@@ -42,19 +61,32 @@ func generateTestToken(HospitalID string) string {
 	return t
 }
 
+func generateRoleToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
 func TestPatientSearchById(t *testing.T) {
-	SetupTestDB()
+	t.Parallel()
+	h, store := setupMemoryHandler()
 	gin.SetMode(gin.TestMode)
 
 	// mock Patient DB
-	database.DB.Create(&models.Patient{
+	store.Patients().Create(context.Background(), &models.Patient{
 		ID: "001", PatientHN: "HN001", HospitalID: "1",
 	})
 
 	t.Run("Search Fail Case Not Login", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.GET("/patient/search/:id", GetPatientByID)
+		r.GET("/patient/search/:id", h.GetPatientByID)
 
 		req, _ := http.NewRequest("GET", "/patient/search/001", nil)
 		w := httptest.NewRecorder()
@@ -66,7 +98,7 @@ func TestPatientSearchById(t *testing.T) {
 	t.Run("Search Success", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.GET("/patient/search/:id", GetPatientByID)
+		r.GET("/patient/search/:id", h.GetPatientByID)
 
 		token := generateTestToken("1")
 		req, _ := http.NewRequest("GET", "/patient/search/001", nil)
@@ -81,7 +113,7 @@ func TestPatientSearchById(t *testing.T) {
 	t.Run("Search Fail Case Invalid Hospital", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.GET("/patient/search/:id", GetPatientByID)
+		r.GET("/patient/search/:id", h.GetPatientByID)
 
 		token := generateTestToken("002")
 		req, _ := http.NewRequest("GET", "/patient/search/001", nil)
@@ -95,18 +127,19 @@ func TestPatientSearchById(t *testing.T) {
 }
 
 func TestPatientSearch(t *testing.T) {
-	SetupTestDB()
+	t.Parallel()
+	h, store := setupMemoryHandler()
 	gin.SetMode(gin.TestMode)
 
 	// mock Patient DB
-	database.DB.Create(&models.Patient{
+	store.Patients().Create(context.Background(), &models.Patient{
 		ID: "001", PatientHN: "HN001", HospitalID: "1",
 	})
 
 	t.Run("Search Fail Case Not Login", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.GET("/patient/search", GetPatients)
+		r.GET("/patient/search", h.GetPatients)
 
 		req, _ := http.NewRequest("GET", "/patient/search", nil)
 		w := httptest.NewRecorder()
@@ -118,7 +151,7 @@ func TestPatientSearch(t *testing.T) {
 	t.Run("Search Success", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.GET("/patient/search", GetPatients)
+		r.GET("/patient/search", h.GetPatients)
 
 		token := generateTestToken("1")
 		req, _ := http.NewRequest("GET", "/patient/search", nil)
@@ -133,7 +166,7 @@ func TestPatientSearch(t *testing.T) {
 	t.Run("Search Fail Case Invalid Hospital", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.GET("/patient/search", GetPatients)
+		r.GET("/patient/search", h.GetPatients)
 
 		token := generateTestToken("002")
 		req, _ := http.NewRequest("GET", "/patient/search", nil)
@@ -147,14 +180,15 @@ func TestPatientSearch(t *testing.T) {
 }
 
 func TestPatientCreate(t *testing.T) {
-	SetupTestDB()
+	t.Parallel()
+	h, store := setupMemoryHandler()
 	gin.SetMode(gin.TestMode)
 
 	t.Run("Create Patient Success", func(t *testing.T) {
 		// SetupTestDB()
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.POST("/patient/add", CreatePatient)
+		r.POST("/patient/add", h.CreatePatient)
 
 		token := generateTestToken("1")
 		patientData := map[string]interface{}{
@@ -178,12 +212,15 @@ func TestPatientCreate(t *testing.T) {
 
 		assert.Equal(t, http.StatusCreated, w.Code)
 		assert.Contains(t, w.Body.String(), "เพิ่มข้อมูลคนไข้สำเร็จ")
+		patient, err := store.Patients().Get(context.Background(), "1", "005")
+		assert.NoError(t, err)
+		assert.Equal(t, "HN005", patient.PatientHN)
 	})
 
 	t.Run("Create Patient Fail Case Incomplete Input", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.POST("/patient/add", CreatePatient)
+		r.POST("/patient/add", h.CreatePatient)
 
 		token := generateTestToken("1")
 		patientData := map[string]interface{}{
@@ -201,10 +238,52 @@ func TestPatientCreate(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	t.Run("Create Patient Fail Case Invalid National ID", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.POST("/patient/add", h.CreatePatient)
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"id": "007", "patient_hn": "HN007", "hospital_id": "1", "national_id": "12345",
+		})
+		req, _ := http.NewRequest("POST", "/patient/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"national_id"`)
+	})
+
+	t.Run("Create Patient Fail Case Duplicate", func(t *testing.T) {
+		r := gin.Default()
+		r.Use(middleware.AuthMiddleware())
+		r.POST("/patient/add", h.CreatePatient)
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"id": "005", "patient_hn": "HN008", "hospital_id": "1",
+		})
+		req, _ := http.NewRequest("POST", "/patient/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+		req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, "CONFLICT", response["code"])
+		assert.Equal(t, "A patient with this ID or HN already exists", response["error"])
+	})
+
 	t.Run("Create Patient Fail Case Not Login", func(t *testing.T) {
 		r := gin.Default()
 		r.Use(middleware.AuthMiddleware())
-		r.POST("/patient/add", CreatePatient)
+		r.POST("/patient/add", h.CreatePatient)
 
 		patientData := map[string]interface{}{
 			"id":            "005",
@@ -228,3 +307,341 @@ func TestPatientCreate(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 }
+
+func TestPatientSearchByIdAllergies(t *testing.T) {
+	db := SetupTestDB()
+	h := NewHandler(db)
+	gin.SetMode(gin.TestMode)
+
+	db.Create(&models.Patient{
+		ID: "001", PatientHN: "HN001", HospitalID: "1",
+	})
+	db.Create(&models.Patient{
+		ID: "002", PatientHN: "HN002", HospitalID: "1",
+	})
+	db.Create(&models.Allergy{PatientID: "001", HospitalID: "1", Category: "food",
+		Substance: "Shrimp", Severity: "mild", VerificationStatus: "confirmed"})
+	db.Create(&models.Allergy{PatientID: "001", HospitalID: "1", Category: "drug",
+		Substance: "Penicillin", Severity: "life-threatening", VerificationStatus: "confirmed"})
+	db.Create(&models.Allergy{PatientID: "001", HospitalID: "1", Category: "drug",
+		Substance: "Aspirin", Severity: "moderate", VerificationStatus: "refuted"})
+
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/patient/search/:id", h.GetPatientByID)
+	token := generateTestToken("1")
+
+	t.Run("Search Success With Allergies", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/patient/search/001", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var patient models.Patient
+		json.Unmarshal(w.Body.Bytes(), &patient)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, patient.Allergies, 2)
+		assert.Equal(t, "Penicillin", patient.Allergies[0].Substance)
+	})
+
+	t.Run("Search Success Without Allergies", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/patient/search/002", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"allergies":[]`)
+	})
+}
+
+func TestPatientSearchByIdCoverages(t *testing.T) {
+	db := SetupTestDB()
+	h := NewHandler(db)
+	gin.SetMode(gin.TestMode)
+
+	db.Create(&models.Patient{
+		ID: "001", PatientHN: "HN001", HospitalID: "1",
+	})
+	db.Create(&models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "PRIVATE", InsurerName: "Thai Life",
+		PolicyNumber: "P-1", Priority: 2, EligibilityStatus: "unknown"})
+	db.Create(&models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "SSS", MainHospital: "BKK Hospital",
+		Priority: 1, EligibilityStatus: "eligible"})
+
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/patient/search/:id", h.GetPatientByID)
+
+	req, _ := http.NewRequest("GET", "/patient/search/001", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var patient models.Patient
+	json.Unmarshal(w.Body.Bytes(), &patient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, patient.Coverages, 2)
+	assert.Equal(t, "SSS", patient.Coverages[0].Scheme)
+}
+
+func sendImport(r *gin.Engine, filename string, content []byte, form map[string]string, hospitalID string) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(content)
+	for k, v := range form {
+		writer.WriteField(k, v)
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/patient/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// testXLSX builds a one-sheet workbook: a header and a row in shared strings,
+// plus an inline name and a numeric date serial.
+func testXLSX() []byte {
+	return buildXLSX(`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c></row>` +
+		`<row r="3"><c r="A3" t="s"><v>4</v></c><c r="B3"><v>900</v></c><c r="C3" t="inlineStr"><is><t>Malee</t></is></c><c r="D3"><v>29342</v></c></row>`)
+}
+
+// buildXLSX builds a one-sheet workbook with the given sheetData rows.
+func buildXLSX(rows string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	files := map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Patients" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>HN</t></si><si><t>Patient ID</t></si><si><t>first_name_en</t></si><si><t>date_of_birth</t></si><si><t>HN900</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			rows + `</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestPatientImport(t *testing.T) {
+	db := SetupTestDB()
+	h := NewHandler(db)
+	gin.SetMode(gin.TestMode)
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/patient/import", h.ImportPatients)
+
+	csv := "\ufeffid,patient_hn,first_name_th,date_of_birth,national_id,gender\n" +
+		"101,HN101,สมหญิง,15/03/2523,1100700000101,หญิง\n" +
+		"102,HN102,สมชาย,1990-07-01,,M\n" +
+		"103,HN001,ซ้ำ,,,\n" +
+		"104,HN104,ผิด,,12345,\n" +
+		"105,HN102,ซ้ำในไฟล์,,,\n"
+	count := func() int64 {
+		var n int64
+		db.Model(&models.Patient{}).Count(&n)
+		return n
+	}
+
+	t.Run("Import Dry Run Reports Every Row", func(t *testing.T) {
+		w := sendImport(r, "patients.csv", []byte(csv), map[string]string{"dry_run": "true"}, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var report ImportReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		assert.Equal(t, 5, report.Total)
+		assert.Equal(t, 2, report.Valid)
+		assert.Equal(t, 0, report.Imported)
+		assert.Equal(t, []RowError{
+			{Row: 4, Field: "patient_hn", Message: "HN นี้มีอยู่แล้วในโรงพยาบาล"},
+			{Row: 5, Field: "national_id", Message: "เลขบัตรประชาชนต้องเป็นตัวเลข 13 หลัก"},
+			{Row: 6, Field: "patient_hn", Message: "HN ซ้ำกับแถวที่ 3"},
+		}, report.Errors)
+		assert.Equal(t, int64(1), count())
+	})
+
+	t.Run("Import Fail Case All Mode With Invalid Rows", func(t *testing.T) {
+		w := sendImport(r, "patients.csv", []byte(csv), nil, "1")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, int64(1), count())
+
+		var body struct {
+			Code    string `json:"code"`
+			Total   int    `json:"total"`
+			Details []struct {
+				Row   int    `json:"row"`
+				Field string `json:"field"`
+			} `json:"details"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		assert.Equal(t, "UNPROCESSABLE", body.Code)
+		assert.Equal(t, 5, body.Total)
+		assert.Len(t, body.Details, 3)
+		assert.Equal(t, 5, body.Details[1].Row)
+		assert.Equal(t, "national_id", body.Details[1].Field)
+	})
+
+	t.Run("Import Batch Mode Skips Invalid Rows", func(t *testing.T) {
+		w := sendImport(r, "patients.csv", []byte(csv), map[string]string{"mode": "batch"}, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"imported":2`)
+
+		var p models.Patient
+		db.First(&p, "id = ?", "101")
+		assert.Equal(t, "F", p.Gender)
+		assert.Equal(t, 1980, p.DateOfBirth.Year())
+	})
+
+	t.Run("Import Fail Case Other Hospital Row", func(t *testing.T) {
+		w := sendImport(r, "patients.csv", []byte("id,patient_hn,hospital_id\n201,HN201,2\n"), nil, "1")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "คุณไม่มีสิทธิ์เพิ่มข้อมูลให้โรงพยาบาลอื่น")
+	})
+
+	t.Run("Import Fail Case Missing Required Column", func(t *testing.T) {
+		w := sendImport(r, "patients.csv", []byte("hn,name\nHN1,A\n"), nil, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Import XLSX With Column Mapping", func(t *testing.T) {
+		w := sendImport(r, "patients.xlsx", testXLSX(), map[string]string{
+			"mapping": `{"HN": "patient_hn", "Patient ID": "id"}`,
+		}, "1")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var p models.Patient
+		assert.NoError(t, db.First(&p, "id = ?", "900").Error)
+		assert.Equal(t, "HN900", p.PatientHN)
+		assert.Equal(t, "1", p.HospitalID)
+		assert.Equal(t, "Malee", p.FirstNameEN)
+		assert.Equal(t, "1980-05-01", p.DateOfBirth.Format("2006-01-02"))
+	})
+
+	t.Run("Import Fail Case XLSX Shared String Out Of Range", func(t *testing.T) {
+		for _, rows := range []string{
+			`<row r="1"><c r="A1" t="s"><v>-1</v></c></row>`,
+			`<row r="1"><c r="A1" t="s"><v>5</v></c></row>`,
+			`<row r="1"><c r="A1" t="s"><v>HN</v></c></row>`,
+		} {
+			w := sendImport(r, "patients.xlsx", buildXLSX(rows), nil, "1")
+			assert.Equal(t, http.StatusBadRequest, w.Code, rows)
+		}
+	})
+
+	t.Run("Import Fail Case XLSX Row Or Column Out Of Range", func(t *testing.T) {
+		for _, rows := range []string{
+			`<row r="1"><c r="A1"><v>1</v></c></row><row r="2000000000"><c r="A2000000000"><v>1</v></c></row>`,
+			`<row r="1"><c r="ZZZZZZ1"><v>1</v></c></row>`,
+			`<row r="1"><c r="XFE1"><v>1</v></c></row>`,
+		} {
+			w := sendImport(r, "patients.xlsx", buildXLSX(rows), nil, "1")
+			assert.Equal(t, http.StatusBadRequest, w.Code, rows)
+		}
+	})
+}
+
+func TestPatientExport(t *testing.T) {
+	db := SetupTestDB()
+	h := NewHandler(db)
+	gin.SetMode(gin.TestMode)
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", FirstNameTH: "สมชาย",
+		FirstNameEN: "Somchai", NationalID: "1100700000001", Gender: "M", DateOfBirth: time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)})
+	db.Create(&models.Patient{ID: "002", PatientHN: "HN002", HospitalID: "1", FirstNameEN: "Malee", Gender: "F"})
+	db.Create(&models.Hospital{ID: "2", Name: "Other Hospital"})
+	db.Create(&models.Patient{ID: "003", PatientHN: "HN003", HospitalID: "2", FirstNameEN: "Other"})
+
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/patient/export", h.ExportPatients)
+	r.POST("/patient/import", h.ImportPatients)
+	export := func(query, role string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/patient/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+generateRoleToken("1", role))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Export Fail Case Not Admin", func(t *testing.T) {
+		w := export("", "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Export CSV Success", func(t *testing.T) {
+		w := export("?format=csv", "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "patients-1-")
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.Equal(t, strings.Join(importColumns, ","), lines[0])
+		assert.Contains(t, lines[1], "001,HN001,1,สมชาย")
+		assert.Contains(t, lines[1], "1980-05-01,1100700000001")
+		assert.NotContains(t, w.Body.String(), "Other")
+
+		var logs []models.AuditLog
+		db.Where("action = ?", "patient.export").Find(&logs)
+		assert.Len(t, logs, 1)
+	})
+
+	t.Run("Export JSONL With Filter", func(t *testing.T) {
+		w := export("?format=jsonl&first_name=Mal", "admin")
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Len(t, lines, 1)
+		var record map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal(t, "002", record["id"])
+
+		var entry models.AuditLog
+		db.Where("action = ?", "patient.export").Last(&entry)
+		assert.Contains(t, entry.Detail, "filter=first_name")
+		assert.NotContains(t, entry.Detail, "Mal")
+	})
+
+	t.Run("Export Fail Case Deidentify Without Key", func(t *testing.T) {
+		w := export("?deidentify=true", "admin")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("Export FHIR NDJSON Deidentified", func(t *testing.T) {
+		defer func(previous *deid.Engine) { deid.Default = previous }(deid.Default)
+		policy := deid.DefaultPolicy
+		policy.DateOfBirth = deid.DOBYear
+		deid.Default, _ = deid.New([]byte(strings.Repeat("k", 32)), policy)
+		db.Create(&models.Consent{PatientID: "001", HospitalID: "1", Purpose: models.ConsentResearch, Version: "1",
+			Channel: "paper", GrantedAt: time.Now()})
+		defer db.Where("purpose = ?", models.ConsentResearch).Delete(&models.Consent{})
+
+		w := export("?format=ndjson&deidentify=true", "admin")
+		assert.Equal(t, "application/fhir+ndjson", w.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Len(t, lines, 1)
+		assert.Contains(t, lines[0], `"resourceType":"Patient"`)
+		assert.Contains(t, lines[0], `"birthDate":"1980"`)
+		assert.NotContains(t, lines[0], `"id":"001"`)
+		assert.NotContains(t, w.Body.String(), "Somchai")
+		assert.NotContains(t, w.Body.String(), "1100700000001")
+	})
+
+	t.Run("Export Fail Case Unknown Format", func(t *testing.T) {
+		w := export("?format=xml", "admin")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Exported CSV Imports Again", func(t *testing.T) {
+		csv := export("?format=csv", "admin").Body.String()
+		csv = strings.ReplaceAll(csv, "HN00", "HN10")
+		csv = strings.ReplaceAll(csv, "\n00", "\n10")
+		w := sendImport(r, "patients.csv", []byte(csv), map[string]string{"dry_run": "true"}, "1")
+		assert.Contains(t, w.Body.String(), `"valid":2`)
+	})
+}
@@ -0,0 +1,411 @@
+package patient
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/metrics"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	importBatchSize = 500
+	maxImportRows   = 50000
+	maxImportBytes  = 20 << 20
+)
+
+const (
+	// ImportAll commits the whole file in one transaction, and only if every
+	// row is valid.
+	ImportAll = "all"
+	// ImportBatch commits the valid rows in batches and reports the rest.
+	ImportBatch = "batch"
+)
+
+// importColumns are the patient fields a file can fill, named as in the API.
+var importColumns = []string{
+	"id", "patient_hn", "hospital_id",
+	"first_name_th", "middle_name_th", "last_name_th",
+	"first_name_en", "middle_name_en", "last_name_en",
+	"date_of_birth", "national_id", "passport_id", "phone_number", "email", "gender",
+}
+
+var (
+	errTooManyRows = apierror.New(apierror.InvalidInput,
+		fmt.Sprintf("นำเข้าได้ไม่เกิน %d แถวต่อไฟล์", maxImportRows),
+		fmt.Sprintf("At most %d rows can be imported per file", maxImportRows))
+	errInvalidRows = apierror.New(apierror.Unprocessable,
+		"มีแถวที่ไม่ถูกต้อง ไม่มีข้อมูลถูกบันทึก",
+		"Some rows are invalid, so nothing was saved")
+
+	saveFailed = apierror.Text{TH: "บันทึกไม่สำเร็จ", EN: "Could not save the row"}
+	idTaken    = apierror.Text{TH: "รหัสคนไข้นี้มีอยู่แล้ว", EN: "The id is already in use"}
+	hnTaken    = apierror.Text{TH: "HN นี้มีอยู่แล้วในโรงพยาบาล", EN: "The patient_hn is already registered at the hospital"}
+)
+
+// RowError reports why a row of an import file was not (or would not be)
+// loaded. Row counts the header as row 1, as spreadsheets do.
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// text is Message in both languages, for the error envelope
+	text apierror.Text
+}
+
+func rowError(row int, field string, text apierror.Text, lang apierror.Lang) RowError {
+	return RowError{Row: row, Field: field, Message: text.In(lang), text: text}
+}
+
+type ImportReport struct {
+	DryRun   bool       `json:"dry_run"`
+	Mode     string     `json:"mode"`
+	Total    int        `json:"total"`
+	Valid    int        `json:"valid"`
+	Imported int        `json:"imported"`
+	Errors   []RowError `json:"errors"`
+}
+
+type importRow struct {
+	number  int
+	patient models.Patient
+}
+
+// ImportPatients loads patients into the caller's hospital from a CSV or
+// XLSX file with a header row. Columns named like the CreatePatient fields
+// are picked up directly; others can be mapped with a JSON object from file
+// header to field in the mapping form value. With dry_run=true the file is
+// only checked and the row-by-row report returned.
+func (h *Handler) ImportPatients(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาแนบไฟล์ CSV หรือ Excel", "Please attach a CSV or Excel file"))
+		return
+	}
+	if file.Size > maxImportBytes {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไฟล์มีขนาดเกิน 20 MB", "The file is larger than 20 MB"))
+		return
+	}
+	mode := c.DefaultPostForm("mode", ImportAll)
+	if mode != ImportAll && mode != ImportBatch {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "mode ต้องเป็น all หรือ batch", "mode must be all or batch"))
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", "false"))
+	mapping := map[string]string{}
+	if s := c.PostForm("mapping"); s != "" {
+		if err := json.Unmarshal([]byte(s), &mapping); err != nil {
+			apierror.Respond(c, apierror.New(apierror.InvalidInput, "mapping ต้องเป็น JSON object ของชื่อคอลัมน์ในไฟล์และชื่อฟิลด์", "mapping must be a JSON object of file column names to field names"))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.Hospitals.Get(ctx, staffHospital); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "รหัสโรงพยาบาลไม่ถูกต้อง", "Invalid hospital ID"))
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่สามารถอ่านไฟล์ได้", "Could not read the file"))
+		return
+	}
+	defer f.Close()
+	var invalid *apierror.Error
+	records, err := readRecords(file.Filename, f)
+	switch {
+	case errors.As(err, &invalid):
+		apierror.Respond(c, invalid)
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่สามารถอ่านไฟล์ได้", "Could not read the file").Wrap(err))
+		return
+	}
+	if len(records) == 0 {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไฟล์ไม่มีข้อมูล", "The file has no data"))
+		return
+	}
+	if len(records)-1 > maxImportRows {
+		apierror.Respond(c, errTooManyRows)
+		return
+	}
+	columns, invalid := mapColumns(records[0], mapping)
+	if invalid != nil {
+		apierror.Respond(c, invalid)
+		return
+	}
+
+	lang := apierror.Language(c)
+	report := ImportReport{DryRun: dryRun, Mode: mode, Errors: []RowError{}}
+	rows := checkRows(records[1:], columns, staffHospital, lang, &report)
+	if err := checkExisting(ctx, h.Patients, staffHospital, lang, &rows, &report); err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถตรวจสอบข้อมูลคนไข้เดิมได้", "Could not check existing patients").Wrap(err))
+		return
+	}
+	slices.SortStableFunc(report.Errors, byRow)
+	report.Valid = len(rows)
+
+	switch {
+	case dryRun:
+		c.JSON(http.StatusOK, report)
+		return
+	case mode == ImportAll && len(report.Errors) > 0:
+		details := make([]apierror.FieldError, len(report.Errors))
+		for i, e := range report.Errors {
+			details[i] = apierror.FieldError{Row: e.Row, Field: e.Field, Message: e.text}
+		}
+		apierror.Respond(c, errInvalidRows.WithDetails(details...).With("total", report.Total).With("valid", report.Valid))
+		return
+	}
+
+	if mode == ImportAll {
+		if err := h.Patients.CreateAll(ctx, patientsOf(rows)); err != nil {
+			apierror.Respond(c, apierror.New(apierror.Internal,
+				"นำเข้าข้อมูลคนไข้ไม่สำเร็จ ไม่มีข้อมูลถูกบันทึก",
+				"The import failed and nothing was saved").Wrap(err))
+			return
+		}
+		report.Imported = len(rows)
+	} else {
+		for batch := range slices.Chunk(rows, importBatchSize) {
+			if err := h.Patients.CreateAll(ctx, patientsOf(batch)); err != nil {
+				c.Error(err)
+				for _, row := range batch {
+					report.Errors = append(report.Errors, rowError(row.number, "", saveFailed, lang))
+				}
+				continue
+			}
+			report.Imported += len(batch)
+		}
+		slices.SortStableFunc(report.Errors, byRow)
+	}
+	metrics.PatientsRegistered.WithLabelValues(staffHospital, metrics.SourceImport).Add(float64(report.Imported))
+	c.JSON(http.StatusOK, report)
+}
+
+// readRecords reads an XLSX workbook by its extension, anything else as CSV.
+func readRecords(filename string, r io.Reader) ([][]string, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".xlsx") {
+		data, err := io.ReadAll(io.LimitReader(r, maxImportBytes))
+		if err != nil {
+			return nil, err
+		}
+		return readXLSX(data)
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, apierror.New(apierror.InvalidInput, "ไฟล์ CSV ไม่ถูกต้อง", "The CSV file is invalid").Wrap(err)
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+	return records, nil
+}
+
+// mapColumns works out which patient field each file column fills. mapping
+// takes precedence over a header that already names a field.
+func mapColumns(header []string, mapping map[string]string) (map[string]int, *apierror.Error) {
+	normalized := map[string]string{}
+	for from, to := range mapping {
+		to = strings.ToLower(strings.TrimSpace(to))
+		if !slices.Contains(importColumns, to) {
+			return nil, apierror.Invalid("mapping",
+				fmt.Sprintf("ไม่รู้จักฟิลด์ %q ใน mapping", to),
+				fmt.Sprintf("Unknown field %q in mapping", to))
+		}
+		normalized[strings.ToLower(strings.TrimSpace(from))] = to
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		field, ok := normalized[name]
+		if !ok && slices.Contains(importColumns, name) {
+			field = name
+		}
+		if field == "" {
+			continue
+		}
+		if _, dup := columns[field]; dup {
+			return nil, apierror.New(apierror.InvalidInput,
+				fmt.Sprintf("มีหลายคอลัมน์ที่ใช้เป็น %s", field),
+				fmt.Sprintf("More than one column is used as %s", field))
+		}
+		columns[field] = i
+	}
+	for _, required := range []string{"id", "patient_hn"} {
+		if _, ok := columns[required]; !ok {
+			return nil, apierror.New(apierror.InvalidInput,
+				fmt.Sprintf("ไฟล์ต้องมีคอลัมน์ %s หรือระบุใน mapping", required),
+				fmt.Sprintf("The file needs a %s column, or one mapped to it", required))
+		}
+	}
+	return columns, nil
+}
+
+// checkRows turns records into patients, reporting the rows that fail
+// validation or repeat an ID or HN seen earlier in the file.
+func checkRows(records [][]string, columns map[string]int, hospitalID string, lang apierror.Lang, report *ImportReport) []importRow {
+	var rows []importRow
+	seenID, seenHN := map[string]int{}, map[string]int{}
+	for i, record := range records {
+		number := i + 2
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		report.Total++
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		fail := func(field, th, en string) {
+			report.Errors = append(report.Errors, rowError(number, field, apierror.Text{TH: th, EN: en}, lang))
+		}
+
+		if h := field("hospital_id"); h != "" && h != hospitalID {
+			fail("hospital_id", "คุณไม่มีสิทธิ์เพิ่มข้อมูลให้โรงพยาบาลอื่น", "You cannot add data for another hospital")
+			continue
+		}
+		p := models.Patient{
+			ID:           field("id"),
+			PatientHN:    field("patient_hn"),
+			HospitalID:   hospitalID,
+			FirstNameTH:  field("first_name_th"),
+			MiddleNameTH: field("middle_name_th"),
+			LastNameTH:   field("last_name_th"),
+			FirstNameEN:  field("first_name_en"),
+			MiddleNameEN: field("middle_name_en"),
+			LastNameEN:   field("last_name_en"),
+			NationalID:   strings.ReplaceAll(field("national_id"), "-", ""),
+			PassportID:   field("passport_id"),
+			PhoneNumber:  field("phone_number"),
+			Email:        field("email"),
+			Gender:       normalizeGender(field("gender")),
+		}
+		if s := field("date_of_birth"); s != "" {
+			dob, ok := parseDate(s)
+			if !ok {
+				fail("date_of_birth", "รูปแบบวันเกิดต้องเป็น YYYY-MM-DD หรือ DD/MM/YYYY", "date_of_birth must be YYYY-MM-DD or DD/MM/YYYY")
+				continue
+			}
+			p.DateOfBirth = dob
+		}
+		if invalid := repository.ValidatePatient(p); invalid != nil {
+			fail(invalid.Field, invalid.Message.TH, invalid.Message.EN)
+			continue
+		}
+		if first, dup := seenID[p.ID]; dup {
+			fail("id", fmt.Sprintf("รหัสคนไข้ซ้ำกับแถวที่ %d", first), fmt.Sprintf("Same id as row %d", first))
+			continue
+		}
+		if first, dup := seenHN[p.PatientHN]; dup {
+			fail("patient_hn", fmt.Sprintf("HN ซ้ำกับแถวที่ %d", first), fmt.Sprintf("Same patient_hn as row %d", first))
+			continue
+		}
+		seenID[p.ID], seenHN[p.PatientHN] = number, number
+		rows = append(rows, importRow{number: number, patient: p})
+	}
+	return rows
+}
+
+// checkExisting drops the rows whose ID is already taken, or whose HN is
+// already registered at the hospital, and reports them.
+func checkExisting(ctx context.Context, patients repository.PatientRepository, hospitalID string, lang apierror.Lang, rows *[]importRow, report *ImportReport) error {
+	takenID, takenHN := map[string]bool{}, map[string]bool{}
+	for batch := range slices.Chunk(*rows, importBatchSize) {
+		ids := make([]string, len(batch))
+		hns := make([]string, len(batch))
+		for i, row := range batch {
+			ids[i], hns[i] = row.patient.ID, row.patient.PatientHN
+		}
+		foundIDs, foundHNs, err := patients.Taken(ctx, hospitalID, ids, hns)
+		if err != nil {
+			return err
+		}
+		for _, id := range foundIDs {
+			takenID[id] = true
+		}
+		for _, hn := range foundHNs {
+			takenHN[hn] = true
+		}
+	}
+
+	*rows = slices.DeleteFunc(*rows, func(row importRow) bool {
+		switch {
+		case takenID[row.patient.ID]:
+			report.Errors = append(report.Errors, rowError(row.number, "id", idTaken, lang))
+		case takenHN[row.patient.PatientHN]:
+			report.Errors = append(report.Errors, rowError(row.number, "patient_hn", hnTaken, lang))
+		default:
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+func byRow(a, b RowError) int { return a.Row - b.Row }
+
+func patientsOf(rows []importRow) []models.Patient {
+	patients := make([]models.Patient, len(rows))
+	for i, row := range rows {
+		patients[i] = row.patient
+	}
+	return patients
+}
+
+// parseDate accepts ISO dates, DD/MM/YYYY in either the Gregorian or the
+// Buddhist era, and Excel date serials.
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2/1/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			if t.Year() > 2400 {
+				t = t.AddDate(-543, 0, 0)
+			}
+			return t, true
+		}
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial >= 1 && serial < 100000 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)), true
+	}
+	return time.Time{}, false
+}
+
+func normalizeGender(s string) string {
+	switch strings.ToLower(s) {
+	case "m", "male", "ชาย":
+		return "M"
+	case "f", "female", "หญิง":
+		return "F"
+	case "o", "other", "อื่นๆ":
+		return "O"
+	}
+	return s
+}
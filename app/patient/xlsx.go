@@ -0,0 +1,192 @@
+package patient
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"example.com/myapp/app/apierror"
+)
+
+const (
+	// maxXLSXColumns is Excel's own limit, column XFD.
+	maxXLSXColumns = 16384
+	// maxXMLBytes bounds each decompressed part of a workbook.
+	maxXMLBytes = 64 << 20
+)
+
+var errInvalidXLSX = apierror.New(apierror.InvalidInput, "ไฟล์ Excel ไม่ถูกต้อง", "The Excel file is invalid")
+
+// readXLSX returns the rows of the first worksheet in an Excel workbook as
+// text, keeping empty cells in place so columns line up with the header.
+// Only what a patient list needs is supported: shared, inline and numeric
+// cells. Dates stay as Excel serial numbers; see parseDate.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errInvalidXLSX
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decodeXML(f, &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	var ws struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeXML(sheet, &ws); err != nil {
+		return nil, err
+	}
+
+	// row and cell references are checked before padding to them, so a
+	// small file cannot claim a huge sheet
+	if len(ws.Rows) > maxImportRows+1 {
+		return nil, errTooManyRows
+	}
+	rows := make([][]string, 0, len(ws.Rows))
+	for _, r := range ws.Rows {
+		if r.Number > maxImportRows+1 {
+			return nil, errTooManyRows
+		}
+		// blank rows are left out of the sheet; keep row numbers true
+		for len(rows) < r.Number-1 {
+			rows = append(rows, nil)
+		}
+		var row []string
+		for _, c := range r.Cells {
+			col := len(row)
+			if i := columnIndex(c.Ref); i >= 0 {
+				col = i
+			}
+			if col >= maxXLSXColumns {
+				return nil, errInvalidXLSX
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, errInvalidXLSX
+				}
+				row[col] = shared[i]
+			case "inlineStr":
+				row[col] = c.Inline.String()
+			default:
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// xlsxText is a string item, either plain or split into formatted runs.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+// firstSheet finds the first worksheet listed in the workbook, falling back
+// to the conventional sheet1.xml.
+func firstSheet(files map[string]*zip.File) (*zip.File, error) {
+	var workbook struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if wb, ok := files["xl/workbook.xml"]; ok && decodeXML(wb, &workbook) == nil && len(workbook.Sheets) > 0 {
+		if rf, ok := files["xl/_rels/workbook.xml.rels"]; ok && decodeXML(rf, &rels) == nil {
+			for _, rel := range rels.Items {
+				if rel.ID != workbook.Sheets[0].RID {
+					continue
+				}
+				name := path.Join("xl", rel.Target)
+				if strings.HasPrefix(rel.Target, "/") {
+					name = strings.TrimPrefix(rel.Target, "/")
+				}
+				if f, ok := files[name]; ok {
+					return f, nil
+				}
+			}
+		}
+	}
+	if f, ok := files["xl/worksheets/sheet1.xml"]; ok {
+		return f, nil
+	}
+	return nil, apierror.New(apierror.InvalidInput, "ไม่พบ Worksheet ในไฟล์ Excel", "The Excel file has no worksheet")
+}
+
+func decodeXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, maxXMLBytes)).Decode(v); err != nil {
+		return errInvalidXLSX
+	}
+	return nil
+}
+
+// columnIndex turns a cell reference such as "C12" into the 0-based column 2.
+// Columns past maxXLSXColumns all come out as maxXLSXColumns.
+func columnIndex(ref string) int {
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		n = min(n*26+int(r-'A')+1, maxXLSXColumns+1)
+	}
+	return n - 1
+}
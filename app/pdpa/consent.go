@@ -0,0 +1,207 @@
+package pdpa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the consent and data subject request endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+var errAlreadyWithdrawn = errors.New("pdpa: consent already withdrawn")
+
+// HasConsent reports whether the patient has consent in force for purpose.
+// Features that rely on consent call it before acting on a single patient.
+func HasConsent(db *gorm.DB, patientID, hospitalID, purpose string) (bool, error) {
+	var count int64
+	err := db.Model(&models.Consent{}).
+		Where("patient_id = ? AND hospital_id = ? AND purpose = ? AND withdrawn_at IS NULL", patientID, hospitalID, purpose).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// WithConsent limits a query on patients to those with consent in force for
+// purpose, for features that act on many patients at once.
+func WithConsent(purpose string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("EXISTS (SELECT 1 FROM consents WHERE consents.patient_id = patients.id"+
+			" AND consents.hospital_id = patients.hospital_id AND consents.purpose = ? AND consents.withdrawn_at IS NULL)", purpose)
+	}
+}
+
+// RecordConsent records that a patient granted consent for a purpose. A
+// grant under a new version of the consent text replaces the one in force.
+func (h *Handler) RecordConsent(c *gin.Context) {
+	var input struct {
+		PatientID string `json:"patient_id" binding:"required"`
+		Purpose   string `json:"purpose" binding:"required"`
+		Version   string `json:"version" binding:"required"`
+		Channel   string `json:"channel" binding:"required"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if !slices.Contains(models.ConsentPurposes, input.Purpose) {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "วัตถุประสงค์ต้องเป็น research, notification หรือ marketing", "Purpose must be research, notification or marketing"))
+		return
+	}
+	if !slices.Contains(models.ConsentChannels, input.Channel) {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ช่องทางต้องเป็น paper, kiosk, online หรือ verbal", "Channel must be paper, kiosk, online or verbal"))
+		return
+	}
+	patient, staffHospital, ok := h.findPatient(c, input.PatientID)
+	if !ok {
+		return
+	}
+
+	var current models.Consent
+	err := h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ? AND purpose = ? AND withdrawn_at IS NULL",
+		patient.ID, staffHospital, input.Purpose).First(&current).Error
+	switch {
+	case err == nil && current.Version == input.Version:
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คนไข้ให้ความยินยอมสำหรับวัตถุประสงค์และฉบับนี้อยู่แล้ว", "The patient has already consented to this purpose and version"))
+		return
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกความยินยอมได้", "Could not save the consent").Wrap(err))
+		return
+	}
+
+	now := time.Now()
+	by := username(c)
+	consent := models.Consent{
+		PatientID:  patient.ID,
+		HospitalID: staffHospital,
+		Purpose:    input.Purpose,
+		Version:    input.Version,
+		Channel:    input.Channel,
+		GrantedAt:  now,
+		RecordedBy: by,
+		Note:       input.Note,
+	}
+	err = h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if current.ID != 0 {
+			if err := withdraw(tx, current.ID, now, by, input.Channel, "แทนที่ด้วยฉบับ "+input.Version); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&consent).Error; err != nil {
+			return err
+		}
+		return audit.Log(tx, c, consentEntry(consent, "consent.grant", input.Purpose+" v"+input.Version))
+	})
+	switch {
+	case errors.Is(err, errAlreadyWithdrawn):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ความยินยอมถูกเปลี่ยนโดยผู้ใช้อื่นแล้ว", "The consent was changed by another user"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกความยินยอมได้", "Could not save the consent").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, consent)
+}
+
+// WithdrawConsent records that the patient withdrew a consent. Withdrawal
+// takes effect for every later use of the data.
+func (h *Handler) WithdrawConsent(c *gin.Context) {
+	var input struct {
+		Channel string `json:"channel" binding:"required"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุช่องทางที่คนไข้แจ้งถอนความยินยอม", "Please give the channel the patient used to withdraw consent"))
+		return
+	}
+	if !slices.Contains(models.ConsentChannels, input.Channel) {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ช่องทางต้องเป็น paper, kiosk, online หรือ verbal", "Channel must be paper, kiosk, online or verbal"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	var consent models.Consent
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&consent).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบข้อมูลความยินยอมที่ระบุ", "Consent not found"))
+		return
+	}
+
+	now := time.Now()
+	by := username(c)
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := withdraw(tx, consent.ID, now, by, input.Channel, input.Note); err != nil {
+			return err
+		}
+		return audit.Log(tx, c, consentEntry(consent, "consent.withdraw", input.Note))
+	})
+	switch {
+	case errors.Is(err, errAlreadyWithdrawn):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ความยินยอมนี้ถูกถอนไปแล้ว", "The consent has already been withdrawn"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการถอนความยินยอมได้", "Could not record the withdrawal").Wrap(err))
+		return
+	}
+	h.DB.WithContext(c.Request.Context()).First(&consent, consent.ID)
+	c.JSON(http.StatusOK, consent)
+}
+
+// GetConsents lists a patient's consents, newest first, including withdrawn
+// ones.
+func (h *Handler) GetConsents(c *gin.Context) {
+	patient, staffHospital, ok := h.findPatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	query := h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ?", patient.ID, staffHospital)
+	if purpose := c.Query("purpose"); purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	var consents []models.Consent
+	if err := query.Order("granted_at DESC").Order("id DESC").Find(&consents).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลความยินยอมได้", "Could not load consents").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, consents)
+}
+
+// withdraw ends a consent in force, failing if it already ended.
+func withdraw(tx *gorm.DB, id uint, at time.Time, by, channel, note string) error {
+	result := tx.Model(&models.Consent{}).Where("id = ? AND withdrawn_at IS NULL", id).
+		Updates(map[string]interface{}{"withdrawn_at": at, "withdrawn_by": by, "withdraw_via": channel, "withdraw_note": note})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errAlreadyWithdrawn
+	}
+	return nil
+}
+
+func consentEntry(consent models.Consent, action, detail string) audit.Entry {
+	return audit.Entry{
+		Action:            action,
+		ResourceType:      "consent",
+		ResourceID:        fmt.Sprint(consent.ID),
+		PatientID:         consent.PatientID,
+		PatientHospitalID: consent.HospitalID,
+		Detail:            detail,
+	}
+}
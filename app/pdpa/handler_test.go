@@ -0,0 +1,302 @@
+package pdpa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Referral{}, &models.AuditLog{})
+	db.AutoMigrate(models.PatientRecords...)
+	db.Create(&models.Hospital{ID: "1", Name: "BKK Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", FirstNameEN: "Somchai",
+		LastNameEN: "Jaidee", NationalID: "1100700000001", PhoneNumber: "0812345678",
+		DateOfBirth: time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)})
+	db.Create(&models.Patient{ID: "002", PatientHN: "HN002", HospitalID: "2", FirstNameEN: "Other"})
+	db.Create(&models.Allergy{PatientID: "001", HospitalID: "1", Category: "drug", Substance: "Penicillin",
+		Severity: "severe", VerificationStatus: "confirmed"})
+	db.Create(&models.Coverage{PatientID: "001", HospitalID: "1", Scheme: "OFC", PolicyNumber: "P-123",
+		EligibilityStatus: "eligible"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD"})
+	db.Create(&models.HL7Message{PatientID: "001", HospitalID: "1", ControlID: "C1", MessageType: "ADT^A08",
+		Raw: "MSH|^~\\&|HIS|BKK\rPID|1||HN001^^^BKK^MR~1100700000001^^^TH^NI||Jaidee^Somchai", Status: models.HL7Failed,
+		Error: "no patient with HN HN001"})
+	// received before messages were linked, and one for an HN that only
+	// starts with HN001
+	db.Create(&models.HL7Message{HospitalID: "1", ControlID: "C0", MessageType: "ADT^A04",
+		Raw: "MSH|^~\\&|HIS|BKK\rPID|1||HN001^^^BKK^MR||Jaidee^Somchai", Status: models.HL7Failed})
+	db.Create(&models.HL7Message{HospitalID: "1", ControlID: "C9", MessageType: "ADT^A04",
+		Raw: "MSH|^~\\&|HIS|BKK\rPID|1||HN0019^^^BKK^MR||Jaidee^Somsri", Status: models.HL7Processed})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/consent/add", h.RecordConsent)
+	r.POST("/consent/withdraw/:id", h.WithdrawConsent)
+	r.GET("/consent/patient/:id", h.GetConsents)
+	r.POST("/dsr/add", h.CreateRequest)
+	r.GET("/dsr", h.GetRequests)
+	r.GET("/dsr/export/:id", h.ExportRequest)
+	r.POST("/dsr/erase/:id", h.EraseRequest)
+	r.POST("/dsr/reject/:id", h.RejectRequest)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken("1", role))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestConsent(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	grant := func(version string) *httptest.ResponseRecorder {
+		return send(r, "POST", "/consent/add", map[string]interface{}{
+			"patient_id": "001", "purpose": "research", "version": version, "channel": "kiosk",
+		}, "nurse")
+	}
+
+	t.Run("Record Consent Fail Case Unknown Purpose", func(t *testing.T) {
+		w := send(r, "POST", "/consent/add", map[string]interface{}{
+			"patient_id": "001", "purpose": "sales", "version": "1", "channel": "kiosk",
+		}, "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Record Consent Fail Case Patient Of Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", "/consent/add", map[string]interface{}{
+			"patient_id": "002", "purpose": "research", "version": "1", "channel": "kiosk",
+		}, "nurse")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	var first models.Consent
+	t.Run("Record Consent Success", func(t *testing.T) {
+		w := grant("1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &first)
+		assert.Equal(t, "testuser", first.RecordedBy)
+
+		ok, err := HasConsent(db, "001", "1", models.ConsentResearch)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, _ = HasConsent(db, "001", "1", models.ConsentMarketing)
+		assert.False(t, ok)
+	})
+
+	t.Run("Record Consent Fail Case Same Version", func(t *testing.T) {
+		w := grant("1")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	var second models.Consent
+	t.Run("Record Consent Success New Version Supersedes", func(t *testing.T) {
+		w := grant("2")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		json.Unmarshal(w.Body.Bytes(), &second)
+
+		var old models.Consent
+		db.First(&old, first.ID)
+		assert.NotNil(t, old.WithdrawnAt)
+
+		var count int64
+		db.Model(&models.Consent{}).Where("withdrawn_at IS NULL").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Withdraw Consent Success", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/consent/withdraw/%d", second.ID),
+			map[string]interface{}{"channel": "paper", "note": "ไม่ประสงค์ร่วมงานวิจัย"}, "nurse")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		ok, _ := HasConsent(db, "001", "1", models.ConsentResearch)
+		assert.False(t, ok)
+		var patients []models.Patient
+		db.Scopes(WithConsent(models.ConsentResearch)).Find(&patients)
+		assert.Empty(t, patients)
+	})
+
+	t.Run("Withdraw Consent Fail Case Already Withdrawn", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/consent/withdraw/%d", second.ID),
+			map[string]interface{}{"channel": "paper"}, "nurse")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Get Consents Success", func(t *testing.T) {
+		w := send(r, "GET", "/consent/patient/001", nil, "nurse")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var consents []models.Consent
+		json.Unmarshal(w.Body.Bytes(), &consents)
+		assert.Len(t, consents, 2)
+
+		var count int64
+		db.Model(&models.AuditLog{}).Where("resource_type = ?", "consent").Count(&count)
+		assert.Equal(t, int64(3), count)
+	})
+}
+
+func TestDataSubjectRequest(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	create := func(kind string) models.DataSubjectRequest {
+		w := send(r, "POST", "/dsr/add", map[string]interface{}{"patient_id": "001", "type": kind}, "nurse")
+		var request models.DataSubjectRequest
+		json.Unmarshal(w.Body.Bytes(), &request)
+		return request
+	}
+	grant := send(r, "POST", "/consent/add", map[string]interface{}{
+		"patient_id": "001", "purpose": "notification", "version": "1", "channel": "online",
+	}, "nurse")
+	assert.Equal(t, http.StatusCreated, grant.Code)
+
+	t.Run("Create Request Fail Case Unknown Type", func(t *testing.T) {
+		w := send(r, "POST", "/dsr/add", map[string]interface{}{"patient_id": "001", "type": "rectify"}, "nurse")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	access := create("access")
+	t.Run("Create Request Success", func(t *testing.T) {
+		assert.Equal(t, models.SubjectRequestPending, access.Status)
+		assert.Equal(t, access.RequestedAt.AddDate(0, 0, 30).Unix(), access.DueAt.Unix())
+	})
+
+	t.Run("Get Requests Fail Case Not Admin", func(t *testing.T) {
+		w := send(r, "GET", "/dsr", nil, "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Export Request Fail Case Wrong Type", func(t *testing.T) {
+		erasure := create("erasure")
+		w := send(r, "GET", fmt.Sprintf("/dsr/export/%d", erasure.ID), nil, "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		send(r, "POST", fmt.Sprintf("/dsr/reject/%d", erasure.ID), map[string]interface{}{"reason": "test"}, "admin")
+	})
+
+	t.Run("Export Request Success", func(t *testing.T) {
+		w := send(r, "GET", fmt.Sprintf("/dsr/export/%d", access.ID), nil, "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+		var export map[string]json.RawMessage
+		json.Unmarshal(w.Body.Bytes(), &export)
+		assert.Contains(t, string(export["patient"]), "Somchai")
+		assert.Contains(t, string(export["allergies"]), "Penicillin")
+		assert.Contains(t, string(export["encounters"]), "OPD")
+		assert.Contains(t, string(export["consents"]), "notification")
+		assert.Contains(t, string(export["access_log"]), "consent.grant")
+		assert.Contains(t, string(export["hl7_messages"]), "1100700000001")
+
+		var request models.DataSubjectRequest
+		db.First(&request, access.ID)
+		assert.Equal(t, models.SubjectRequestCompleted, request.Status)
+		assert.Equal(t, "testuser", request.HandledBy)
+	})
+
+	t.Run("Export Request Success Again", func(t *testing.T) {
+		w := send(r, "GET", fmt.Sprintf("/dsr/export/%d", access.ID), nil, "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Reject Request Fail Case No Reason", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/dsr/reject/%d", access.ID), map[string]interface{}{}, "admin")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Reject Request Fail Case Already Handled", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/dsr/reject/%d", access.ID),
+			map[string]interface{}{"reason": "ยืนยันตัวตนไม่ได้"}, "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	erasure := create("erasure")
+	t.Run("Erase Request Fail Case Not Admin", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/dsr/erase/%d", erasure.ID), nil, "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Erase Request Success", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/dsr/erase/%d", erasure.ID), nil, "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var patient models.Patient
+		db.First(&patient, "id = ?", "001")
+		assert.Equal(t, "ERASED-001", patient.PatientHN)
+		assert.Empty(t, patient.FirstNameEN)
+		assert.Empty(t, patient.NationalID)
+		assert.Empty(t, patient.PhoneNumber)
+		assert.Equal(t, time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), patient.DateOfBirth.UTC())
+
+		var coverage models.Coverage
+		db.First(&coverage)
+		assert.Empty(t, coverage.PolicyNumber)
+		var message models.HL7Message
+		db.First(&message, "patient_id = ?", "001")
+		assert.Empty(t, message.Raw)
+		assert.Empty(t, message.Error)
+		var unlinked, other models.HL7Message
+		db.First(&unlinked, "control_id = ?", "C0")
+		assert.Equal(t, "001", unlinked.PatientID)
+		assert.Empty(t, unlinked.Raw)
+		db.First(&other, "control_id = ?", "C9")
+		assert.Contains(t, other.Raw, "Somsri")
+		var count int64
+		db.Model(&models.Allergy{}).Where("patient_id = ?", "001").Count(&count)
+		assert.Equal(t, int64(1), count)
+		ok, _ := HasConsent(db, "001", "1", models.ConsentNotification)
+		assert.False(t, ok)
+		db.Model(&models.AuditLog{}).Where("action = ?", "dsr.erase").Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Erase Request Fail Case Already Handled", func(t *testing.T) {
+		w := send(r, "POST", fmt.Sprintf("/dsr/erase/%d", erasure.ID), nil, "admin")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Get Requests Success", func(t *testing.T) {
+		w := send(r, "GET", "/dsr?status=completed", nil, "admin")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var requests []models.DataSubjectRequest
+		json.Unmarshal(w.Body.Bytes(), &requests)
+		assert.Len(t, requests, 2)
+	})
+}
@@ -0,0 +1,358 @@
+package pdpa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/hl7"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// responseDays is how long the PDPA gives to answer a data subject request.
+const responseDays = 30
+
+var errRequestHandled = errors.New("pdpa: request already handled")
+
+// CreateRequest records a patient's request for a copy of their data or for
+// its erasure. Any staff member may take the request; an admin handles it.
+func (h *Handler) CreateRequest(c *gin.Context) {
+	var input struct {
+		PatientID string `json:"patient_id" binding:"required"`
+		Type      string `json:"type" binding:"required"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if input.Type != models.SubjectRequestAccess && input.Type != models.SubjectRequestErasure {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ประเภทคำขอต้องเป็น access หรือ erasure", "Request type must be access or erasure"))
+		return
+	}
+	patient, staffHospital, ok := h.findPatient(c, input.PatientID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	request := models.DataSubjectRequest{
+		PatientID:   patient.ID,
+		HospitalID:  staffHospital,
+		Type:        input.Type,
+		Note:        input.Note,
+		Status:      models.SubjectRequestPending,
+		RequestedBy: username(c),
+		RequestedAt: now,
+		DueAt:       now.AddDate(0, 0, responseDays),
+	}
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&request).Error; err != nil {
+			return err
+		}
+		return audit.Log(tx, c, requestEntry(request, "dsr.create", input.Type))
+	})
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกคำขอได้", "Could not save the request").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, request)
+}
+
+// GetRequests lists the hospital's data subject requests, those due soonest
+// first.
+func (h *Handler) GetRequests(c *gin.Context) {
+	staffHospital, ok := requireAdmin(c)
+	if !ok {
+		return
+	}
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", staffHospital)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var requests []models.DataSubjectRequest
+	if err := query.Order("due_at").Order("id").Find(&requests).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคำขอได้", "Could not load requests").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// ExportRequest answers an access request with everything the hospital
+// holds about the patient: the patient record, every chart table, the
+// referrals it sent and the audit trail of who accessed the data. The
+// first export completes the request; it can be downloaded again later.
+func (h *Handler) ExportRequest(c *gin.Context) {
+	request, ok := h.findRequest(c, models.SubjectRequestAccess)
+	if !ok {
+		return
+	}
+	if request.Status == models.SubjectRequestRejected {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คำขอนี้ถูกปฏิเสธแล้ว", "The request has been rejected"))
+		return
+	}
+
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", request.PatientID, request.HospitalID).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+	export, err := subjectData(h.DB.WithContext(c.Request.Context()), patient)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถส่งออกข้อมูลได้", "Could not export the data").Wrap(err))
+		return
+	}
+
+	err = h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if request.Status == models.SubjectRequestPending {
+			if err := handle(tx, &request, c, models.SubjectRequestCompleted, "ส่งสำเนาข้อมูลให้คนไข้แล้ว"); err != nil {
+				return err
+			}
+		}
+		return audit.Log(tx, c, requestEntry(request, "dsr.export", ""))
+	})
+	switch {
+	case errors.Is(err, errRequestHandled):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คำขอนี้ถูกดำเนินการโดยผู้ใช้อื่นแล้ว", "The request was handled by another user"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถส่งออกข้อมูลได้", "Could not export the data").Wrap(err))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="dsr-%d-%s.json"`, request.ID, patient.ID))
+	c.JSON(http.StatusOK, export)
+}
+
+// EraseRequest carries out an erasure request. Medical and billing records
+// must be kept by law, so rather than deleting the chart the patient is
+// anonymized: names, identity numbers and contact details are blanked, the
+// HN is replaced and the date of birth is cut to the year. Consents in
+// force are withdrawn. The clinical records stay, no longer linked to a
+// person.
+func (h *Handler) EraseRequest(c *gin.Context) {
+	request, ok := h.findRequest(c, models.SubjectRequestErasure)
+	if !ok {
+		return
+	}
+	if request.Status != models.SubjectRequestPending {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คำขอนี้ถูกดำเนินการไปแล้ว", "The request has already been fulfilled"))
+		return
+	}
+
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", request.PatientID, request.HospitalID).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+	now := time.Now()
+	erased := map[string]interface{}{
+		"patient_hn":    "ERASED-" + patient.ID,
+		"first_name_th": "", "middle_name_th": "", "last_name_th": "",
+		"first_name_en": "", "middle_name_en": "", "last_name_en": "",
+		"national_id": "", "passport_id": "", "phone_number": "", "email": "",
+	}
+	if !patient.DateOfBirth.IsZero() {
+		erased["date_of_birth"] = time.Date(patient.DateOfBirth.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	hn := patient.PatientHN
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := handle(tx, &request, c, models.SubjectRequestCompleted,
+			"ทำข้อมูลคนไข้เป็นนิรนามแล้ว เวชระเบียนยังคงเก็บไว้ตามกฎหมาย"); err != nil {
+			return err
+		}
+		if err := tx.Model(&patient).Updates(erased).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Coverage{}).Where("patient_id = ? AND hospital_id = ?", patient.ID, patient.HospitalID).
+			Update("policy_number", "").Error; err != nil {
+			return err
+		}
+		// the raw HL7 text repeats the PID; an erased message cannot be
+		// reprocessed to write the identifiers back. Messages never linked
+		// to the patient are found by the HN in their PID.
+		if err := hl7.LinkMessages(tx, patient.HospitalID, hn, patient.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.HL7Message{}).Where("patient_id = ? AND hospital_id = ?", patient.ID, patient.HospitalID).
+			Updates(map[string]interface{}{"raw": "", "error": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Consent{}).
+			Where("patient_id = ? AND hospital_id = ? AND withdrawn_at IS NULL", patient.ID, patient.HospitalID).
+			Updates(map[string]interface{}{"withdrawn_at": now, "withdrawn_by": username(c),
+				"withdraw_note": fmt.Sprintf("ลบข้อมูลตามคำขอเลขที่ %d", request.ID)}).Error; err != nil {
+			return err
+		}
+		return audit.Log(tx, c, requestEntry(request, "dsr.erase", ""))
+	})
+	switch {
+	case errors.Is(err, errRequestHandled):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คำขอนี้ถูกดำเนินการโดยผู้ใช้อื่นแล้ว", "The request was handled by another user"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถลบข้อมูลคนไข้ได้", "Could not erase the patient's data").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// RejectRequest closes a request that will not be carried out, for example
+// because the requester's identity could not be confirmed. The reason is
+// required so it can be given to the patient.
+func (h *Handler) RejectRequest(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุเหตุผลที่ปฏิเสธคำขอ", "Please give a reason for rejecting the request"))
+		return
+	}
+	request, ok := h.findRequest(c, "")
+	if !ok {
+		return
+	}
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := handle(tx, &request, c, models.SubjectRequestRejected, input.Reason); err != nil {
+			return err
+		}
+		return audit.Log(tx, c, requestEntry(request, "dsr.reject", input.Reason))
+	})
+	switch {
+	case errors.Is(err, errRequestHandled):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คำขอนี้ถูกดำเนินการไปแล้ว", "The request has already been fulfilled"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการปฏิเสธคำขอได้", "Could not record the rejection").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// subjectData gathers the patient's data for an access request, keyed by
+// table name.
+func subjectData(db *gorm.DB, patient models.Patient) (map[string]interface{}, error) {
+	export := map[string]interface{}{"patient": patient}
+	for _, table := range models.PatientRecords {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			return nil, err
+		}
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(table).Elem()))
+		if err := db.Where("patient_id = ? AND hospital_id = ?", patient.ID, patient.HospitalID).
+			Order("id").Find(rows.Interface()).Error; err != nil {
+			return nil, err
+		}
+		export[stmt.Schema.Table] = rows.Elem().Interface()
+	}
+
+	var referrals []models.Referral
+	if err := db.Where("patient_id = ? AND from_hospital_id = ?", patient.ID, patient.HospitalID).
+		Order("id").Find(&referrals).Error; err != nil {
+		return nil, err
+	}
+	export["referrals"] = referrals
+
+	var logs []models.AuditLog
+	if err := db.Where("patient_id = ? AND patient_hospital_id = ?", patient.ID, patient.HospitalID).
+		Order("created_at").Order("id").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	export["access_log"] = logs
+	return export, nil
+}
+
+// handle closes a pending request, failing if someone else got to it first.
+func handle(tx *gorm.DB, request *models.DataSubjectRequest, c *gin.Context, status, outcome string) error {
+	now := time.Now()
+	by := username(c)
+	result := tx.Model(&models.DataSubjectRequest{}).
+		Where("id = ? AND status = ?", request.ID, models.SubjectRequestPending).
+		Updates(map[string]interface{}{"status": status, "handled_by": by, "handled_at": now, "outcome": outcome})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errRequestHandled
+	}
+	request.Status, request.HandledBy, request.HandledAt, request.Outcome = status, by, &now, outcome
+	return nil
+}
+
+// findRequest loads the request named in the path for an admin of its
+// hospital, checking its type unless kind is empty.
+func (h *Handler) findRequest(c *gin.Context, kind string) (models.DataSubjectRequest, bool) {
+	var request models.DataSubjectRequest
+	staffHospital, ok := requireAdmin(c)
+	if !ok {
+		return request, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&request).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบคำขอที่ระบุ", "Request not found"))
+		return request, false
+	}
+	if kind != "" && request.Type != kind {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ประเภทคำขอไม่ตรงกับการดำเนินการ", "The request type does not match the action"))
+		return request, false
+	}
+	return request, true
+}
+
+func requireAdmin(c *gin.Context) (string, bool) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่ดำเนินการคำขอของเจ้าของข้อมูลได้", "Only admins can handle data subject requests"))
+		return "", false
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return "", false
+	}
+	return staffHospital, true
+}
+
+// findPatient loads a patient of the caller's hospital, answering the
+// request itself if there is none.
+func (h *Handler) findPatient(c *gin.Context, id string) (models.Patient, string, bool) {
+	var patient models.Patient
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return patient, "", false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", id, staffHospital).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return patient, "", false
+	}
+	return patient, staffHospital, true
+}
+
+func username(c *gin.Context) string {
+	val, _ := c.Get("username")
+	name, _ := val.(string)
+	return name
+}
+
+func requestEntry(request models.DataSubjectRequest, action, detail string) audit.Entry {
+	return audit.Entry{
+		Action:            action,
+		ResourceType:      "data_subject_request",
+		ResourceID:        fmt.Sprint(request.ID),
+		PatientID:         request.PatientID,
+		PatientHospitalID: request.HospitalID,
+		Detail:            detail,
+	}
+}
@@ -0,0 +1,370 @@
+package pharmacy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the pharmacy stock endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+func (h *Handler) CreateStore(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin && role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบหรือเภสัชกรเท่านั้นที่จัดการคลังยาได้", "Only admins or pharmacists can manage drug stock"))
+		return
+	}
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	store := models.Store{HospitalID: staffHospital, Name: input.Name}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&store).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้างคลังยาได้", "Could not create the store").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, store)
+}
+
+func (h *Handler) GetStores(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var stores []models.Store
+	if err := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", staffHospital).Order("id").Find(&stores).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคลังยาได้", "Could not load stores").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, stores)
+}
+
+func (h *Handler) ReceiveStock(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin && role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบหรือเภสัชกรเท่านั้นที่จัดการคลังยาได้", "Only admins or pharmacists can manage drug stock"))
+		return
+	}
+	var input struct {
+		StoreID    uint   `json:"store_id" binding:"required"`
+		DrugCode   string `json:"drug_code" binding:"required"`
+		LotNumber  string `json:"lot_number" binding:"required"`
+		ExpiryDate string `json:"expiry_date" binding:"required"`
+		Quantity   int    `json:"quantity" binding:"required,gt=0"`
+		Note       string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	expiry, err := time.Parse("2006-01-02", input.ExpiryDate)
+	if err != nil {
+		apierror.Respond(c, apierror.ErrInvalidDate)
+		return
+	}
+
+	store, ok := h.findStore(c, input.StoreID)
+	if !ok {
+		return
+	}
+	var drug models.Drug
+	if err := h.DB.WithContext(c.Request.Context()).Where("code = ?", input.DrugCode).First(&drug).Error; err != nil {
+		apierror.Respond(c, apierror.Invalid("drug_code", "ไม่พบยารหัส "+input.DrugCode+" ในบัญชียา", "Drug "+input.DrugCode+" is not in the formulary"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	performedBy, _ := username.(string)
+	var lot models.StockLot
+	err = h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		lot, err = Receive(tx, store, drug.ID, input.LotNumber, expiry, input.Quantity, input.Note, performedBy)
+		return err
+	})
+	if errors.Is(err, ErrExpiryMismatch) {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "Lot นี้มีอยู่แล้วแต่วันหมดอายุไม่ตรงกัน", "The lot already exists with a different expiry date"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถรับยาเข้าคลังได้", "Could not receive the stock").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, lot)
+}
+
+func (h *Handler) TransferStock(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin && role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบหรือเภสัชกรเท่านั้นที่จัดการคลังยาได้", "Only admins or pharmacists can manage drug stock"))
+		return
+	}
+	var input struct {
+		LotID     uint   `json:"lot_id" binding:"required"`
+		ToStoreID uint   `json:"to_store_id" binding:"required"`
+		Quantity  int    `json:"quantity" binding:"required,gt=0"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+
+	lot, ok := h.findLot(c, input.LotID)
+	if !ok {
+		return
+	}
+	target, ok := h.findStore(c, input.ToStoreID)
+	if !ok {
+		return
+	}
+	if target.ID == lot.StoreID {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "คลังต้นทางและปลายทางต้องไม่ใช่คลังเดียวกัน", "Source and destination stores must differ"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	performedBy, _ := username.(string)
+	var received models.StockLot
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := Take(tx, lot, input.Quantity, models.MovementTransferOut, nil, input.Note, performedBy); err != nil {
+			return err
+		}
+		var err error
+		received, err = receive(tx, target, lot.DrugID, lot.LotNumber, lot.ExpiryDate, input.Quantity,
+			models.MovementTransferIn, input.Note, performedBy)
+		return err
+	})
+	if errors.Is(err, ErrInsufficientStock) {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "จำนวนยาใน Lot ไม่เพียงพอ", "Not enough stock in the lot"))
+		return
+	}
+	if errors.Is(err, ErrExpiryMismatch) {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "Lot นี้มีอยู่แล้วแต่วันหมดอายุไม่ตรงกัน", "The lot already exists with a different expiry date"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถโอนยาได้", "Could not transfer the stock").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, received)
+}
+
+func (h *Handler) AdjustStock(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin && role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบหรือเภสัชกรเท่านั้นที่จัดการคลังยาได้", "Only admins or pharmacists can manage drug stock"))
+		return
+	}
+	var input struct {
+		LotID    uint   `json:"lot_id" binding:"required"`
+		Quantity int    `json:"quantity" binding:"required,ne=0"`
+		Reason   string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+
+	lot, ok := h.findLot(c, input.LotID)
+	if !ok {
+		return
+	}
+
+	username, _ := c.Get("username")
+	performedBy, _ := username.(string)
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if input.Quantity < 0 {
+			return Take(tx, lot, -input.Quantity, models.MovementAdjust, nil, input.Reason, performedBy)
+		}
+		if err := tx.Model(&lot).Update("quantity", gorm.Expr("quantity + ?", input.Quantity)).Error; err != nil {
+			return err
+		}
+		return record(tx, lot, models.MovementAdjust, input.Quantity, nil, input.Reason, performedBy)
+	})
+	if errors.Is(err, ErrInsufficientStock) {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "จำนวนยาใน Lot ไม่เพียงพอ", "Not enough stock in the lot"))
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถปรับปรุงยอดยาได้", "Could not adjust the stock").Wrap(err))
+		return
+	}
+
+	h.DB.WithContext(c.Request.Context()).Preload("Drug").First(&lot, lot.ID)
+	c.JSON(http.StatusOK, lot)
+}
+
+func (h *Handler) GetStock(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Preload("Drug").
+		Where("stock_lots.hospital_id = ? AND stock_lots.quantity > 0", staffHospital)
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("stock_lots.store_id = ?", storeID)
+	}
+	if drugCode := c.Query("drug_code"); drugCode != "" {
+		query = query.Joins("JOIN drugs ON drugs.id = stock_lots.drug_id").Where("drugs.code = ?", drugCode)
+	}
+
+	var lots []models.StockLot
+	if err := query.Order("stock_lots.expiry_date, stock_lots.id").Find(&lots).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลยาคงคลังได้", "Could not load stock").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, lots)
+}
+
+func (h *Handler) GetMovements(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("hospital_id = ?", staffHospital)
+	for _, filter := range []string{"store_id", "lot_id", "prescription_id", "type"} {
+		if v := c.Query(filter); v != "" {
+			query = query.Where(filter+" = ?", v)
+		}
+	}
+
+	var movements []models.StockMovement
+	if err := query.Order("id DESC").Limit(500).Find(&movements).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงประวัติการเคลื่อนไหวของยาได้", "Could not load stock movements").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, movements)
+}
+
+type lowStockRow struct {
+	StoreID   uint   `json:"store_id"`
+	DrugID    uint   `json:"drug_id"`
+	DrugCode  string `json:"drug_code"`
+	DrugName  string `json:"drug_name"`
+	Available int    `json:"available"`
+}
+
+// LowStockReport lists drugs whose unexpired quantity in a store is below the
+// threshold (default 10).
+func (h *Handler) LowStockReport(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	threshold, err := strconv.Atoi(c.DefaultQuery("threshold", "10"))
+	if err != nil || threshold < 0 {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "threshold ต้องเป็นจำนวนเต็มบวก", "threshold must be a positive integer"))
+		return
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	query := h.DB.WithContext(c.Request.Context()).Table("stock_lots").
+		Select("stock_lots.store_id, stock_lots.drug_id, drugs.code AS drug_code, drugs.name AS drug_name, "+
+			"SUM(CASE WHEN stock_lots.expiry_date > ? THEN stock_lots.quantity ELSE 0 END) AS available", today).
+		Joins("JOIN drugs ON drugs.id = stock_lots.drug_id").
+		Where("stock_lots.hospital_id = ?", staffHospital)
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("stock_lots.store_id = ?", storeID)
+	}
+
+	var rows []lowStockRow
+	err = query.Group("stock_lots.store_id, stock_lots.drug_id, drugs.code, drugs.name").
+		Having("SUM(CASE WHEN stock_lots.expiry_date > ? THEN stock_lots.quantity ELSE 0 END) < ?", today, threshold).
+		Order("available, drugs.code").
+		Scan(&rows).Error
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้างรายงานยาใกล้หมดได้", "Could not build the low stock report").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// NearExpiryReport lists lots with stock left that expire within the given
+// number of days (default 90), including lots already expired.
+func (h *Handler) NearExpiryReport(c *gin.Context) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+	if err != nil || days < 0 {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "days ต้องเป็นจำนวนเต็มบวก", "days must be a positive integer"))
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Preload("Drug").
+		Where("hospital_id = ? AND quantity > 0 AND expiry_date <= ?", staffHospital, time.Now().AddDate(0, 0, days))
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+
+	var lots []models.StockLot
+	if err := query.Order("expiry_date, id").Find(&lots).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้างรายงานยาใกล้หมดอายุได้", "Could not build the expiry report").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, lots)
+}
+
+func (h *Handler) findStore(c *gin.Context, id uint) (models.Store, bool) {
+	var store models.Store
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return store, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", id, staffHospital).First(&store).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบคลังยาที่ระบุ", "Store not found"))
+		return store, false
+	}
+	return store, true
+}
+
+func (h *Handler) findLot(c *gin.Context, id uint) (models.StockLot, bool) {
+	var lot models.StockLot
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return lot, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", id, staffHospital).First(&lot).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบ Lot ที่ระบุ", "Lot not found"))
+		return lot, false
+	}
+	return lot, true
+}
@@ -0,0 +1,200 @@
+package pharmacy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Drug{}, &models.Store{}, &models.StockLot{}, &models.StockMovement{})
+	db.Create(&models.Drug{ID: 1, Code: "PARA500", Name: "Paracetamol 500 mg tab", GenericName: "paracetamol", Active: true})
+	db.Create(&models.Store{ID: 1, HospitalID: "1", Name: "Main Store"})
+	db.Create(&models.Store{ID: 2, HospitalID: "1", Name: "ER Counter"})
+	db.Create(&models.Store{ID: 3, HospitalID: "2", Name: "Other Hospital Store"})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/pharmacy/receive", h.ReceiveStock)
+	r.POST("/pharmacy/transfer", h.TransferStock)
+	r.POST("/pharmacy/adjust", h.AdjustStock)
+	r.GET("/pharmacy/report/low-stock", h.LowStockReport)
+	r.GET("/pharmacy/report/near-expiry", h.NearExpiryReport)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken("1", role))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReceiveStock(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	expiry := time.Now().AddDate(1, 0, 0).Format("2006-01-02")
+
+	t.Run("Receive Success", func(t *testing.T) {
+		data := map[string]interface{}{"store_id": 1, "drug_code": "PARA500", "lot_number": "A1", "expiry_date": expiry, "quantity": 50}
+		send(r, "POST", "/pharmacy/receive", data, "pharmacist")
+		w := send(r, "POST", "/pharmacy/receive", data, "pharmacist")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"quantity":100`)
+		var count int64
+		db.Model(&models.StockMovement{}).Where("type = ?", models.MovementReceive).Count(&count)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("Receive Fail Case Expiry Mismatch", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/receive", map[string]interface{}{
+			"store_id": 1, "drug_code": "PARA500", "lot_number": "A1", "expiry_date": "2030-01-01", "quantity": 5,
+		}, "pharmacist")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Receive Fail Case Other Hospital Store", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/receive", map[string]interface{}{
+			"store_id": 3, "drug_code": "PARA500", "lot_number": "B1", "expiry_date": expiry, "quantity": 5,
+		}, "pharmacist")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Receive Fail Case Not Pharmacist", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/receive", map[string]interface{}{
+			"store_id": 1, "drug_code": "PARA500", "lot_number": "B1", "expiry_date": expiry, "quantity": 5,
+		}, "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestTransferAndAdjustStock(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	db.Create(&models.StockLot{ID: 1, HospitalID: "1", StoreID: 1, DrugID: 1, LotNumber: "A1",
+		ExpiryDate: time.Now().AddDate(1, 0, 0), Quantity: 30})
+
+	t.Run("Transfer Success", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/transfer", map[string]interface{}{"lot_id": 1, "to_store_id": 2, "quantity": 10}, "pharmacist")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var lots []models.StockLot
+		db.Order("store_id").Find(&lots)
+		assert.Equal(t, 20, lots[0].Quantity)
+		assert.Equal(t, 10, lots[1].Quantity)
+		assert.Equal(t, "A1", lots[1].LotNumber)
+	})
+
+	t.Run("Transfer Fail Case Insufficient Stock", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/transfer", map[string]interface{}{"lot_id": 1, "to_store_id": 2, "quantity": 999}, "pharmacist")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Adjust Success", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/adjust", map[string]interface{}{"lot_id": 1, "quantity": -3, "reason": "broken"}, "pharmacist")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"quantity":17`)
+	})
+
+	t.Run("Adjust Fail Case Below Zero", func(t *testing.T) {
+		w := send(r, "POST", "/pharmacy/adjust", map[string]interface{}{"lot_id": 1, "quantity": -100, "reason": "count"}, "pharmacist")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestDispenseFEFO(t *testing.T) {
+	db := SetupTestDB()
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 1, LotNumber: "LATE",
+		ExpiryDate: time.Now().AddDate(2, 0, 0), Quantity: 10})
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 1, LotNumber: "EARLY",
+		ExpiryDate: time.Now().AddDate(0, 2, 0), Quantity: 4})
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 1, LotNumber: "EXPIRED",
+		ExpiryDate: time.Now().AddDate(0, 0, -1), Quantity: 50})
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return DispenseFEFO(tx, 1, 1, 6, nil, "testuser")
+	})
+	assert.NoError(t, err)
+
+	remaining := map[string]int{}
+	var lots []models.StockLot
+	db.Find(&lots)
+	for _, lot := range lots {
+		remaining[lot.LotNumber] = lot.Quantity
+	}
+	assert.Equal(t, map[string]int{"EARLY": 0, "LATE": 8, "EXPIRED": 50}, remaining)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return DispenseFEFO(tx, 1, 1, 9, nil, "testuser")
+	})
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+}
+
+func TestReports(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+	db.Create(&models.Drug{ID: 2, Code: "IBU400", Name: "Ibuprofen 400 mg tab", GenericName: "ibuprofen", Active: true})
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 1, LotNumber: "A1",
+		ExpiryDate: time.Now().AddDate(0, 0, 20), Quantity: 3})
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 2, LotNumber: "B1",
+		ExpiryDate: time.Now().AddDate(2, 0, 0), Quantity: 200})
+
+	t.Run("Low Stock", func(t *testing.T) {
+		w := send(r, "GET", "/pharmacy/report/low-stock?threshold=10", nil, "pharmacist")
+
+		var rows []lowStockRow
+		json.Unmarshal(w.Body.Bytes(), &rows)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, rows, 1)
+		assert.Equal(t, "PARA500", rows[0].DrugCode)
+		assert.Equal(t, 3, rows[0].Available)
+	})
+
+	t.Run("Near Expiry", func(t *testing.T) {
+		w := send(r, "GET", "/pharmacy/report/near-expiry?days=30", nil, "pharmacist")
+
+		var lots []models.StockLot
+		json.Unmarshal(w.Body.Bytes(), &lots)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, lots, 1)
+		assert.Equal(t, "A1", lots[0].LotNumber)
+	})
+}
@@ -0,0 +1,109 @@
+package pharmacy
+
+import (
+	"errors"
+	"time"
+
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrExpiryMismatch    = errors.New("lot already exists with a different expiry date")
+)
+
+// Receive adds quantity to a lot, creating the lot the first time it is
+// received into the store. It must be called inside a transaction.
+func Receive(tx *gorm.DB, store models.Store, drugID uint, lotNumber string, expiry time.Time, quantity int, note, performedBy string) (models.StockLot, error) {
+	return receive(tx, store, drugID, lotNumber, expiry, quantity, models.MovementReceive, note, performedBy)
+}
+
+func receive(tx *gorm.DB, store models.Store, drugID uint, lotNumber string, expiry time.Time, quantity int, kind, note, performedBy string) (models.StockLot, error) {
+	lot := models.StockLot{
+		HospitalID: store.HospitalID,
+		StoreID:    store.ID,
+		DrugID:     drugID,
+		LotNumber:  lotNumber,
+	}
+	err := tx.Where(&lot).
+		Attrs(models.StockLot{ExpiryDate: expiry}).
+		FirstOrCreate(&lot).Error
+	if err != nil {
+		return lot, err
+	}
+	if !lot.ExpiryDate.Equal(expiry) {
+		return lot, ErrExpiryMismatch
+	}
+	if err := tx.Model(&lot).Update("quantity", gorm.Expr("quantity + ?", quantity)).Error; err != nil {
+		return lot, err
+	}
+	lot.Quantity += quantity
+
+	return lot, record(tx, lot, kind, quantity, nil, note, performedBy)
+}
+
+// Take removes quantity from one lot. The update is conditional on enough
+// stock remaining, so concurrent dispensing can never drive a lot negative.
+func Take(tx *gorm.DB, lot models.StockLot, quantity int, kind string, prescriptionID *uint, note, performedBy string) error {
+	result := tx.Model(&models.StockLot{}).
+		Where("id = ? AND quantity >= ?", lot.ID, quantity).
+		Update("quantity", gorm.Expr("quantity - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return record(tx, lot, kind, -quantity, prescriptionID, note, performedBy)
+}
+
+// DispenseFEFO takes quantity of a drug from a store, first-expiry-first-out
+// across its unexpired lots. It must be called inside a transaction so a
+// partial allocation is rolled back when stock runs out.
+func DispenseFEFO(tx *gorm.DB, storeID, drugID uint, quantity int, prescriptionID *uint, performedBy string) error {
+	today := time.Now().Truncate(24 * time.Hour)
+	for quantity > 0 {
+		var lots []models.StockLot
+		err := tx.Where("store_id = ? AND drug_id = ? AND quantity > 0 AND expiry_date > ?", storeID, drugID, today).
+			Order("expiry_date, id").
+			Find(&lots).Error
+		if err != nil {
+			return err
+		}
+		if len(lots) == 0 {
+			return ErrInsufficientStock
+		}
+
+		for _, lot := range lots {
+			take := min(quantity, lot.Quantity)
+			err := Take(tx, lot, take, models.MovementDispense, prescriptionID, "", performedBy)
+			if errors.Is(err, ErrInsufficientStock) {
+				// another counter took from this lot since we read it; re-read the lots
+				break
+			}
+			if err != nil {
+				return err
+			}
+			quantity -= take
+			if quantity == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func record(tx *gorm.DB, lot models.StockLot, kind string, quantity int, prescriptionID *uint, note, performedBy string) error {
+	return tx.Create(&models.StockMovement{
+		HospitalID:     lot.HospitalID,
+		StoreID:        lot.StoreID,
+		LotID:          lot.ID,
+		DrugID:         lot.DrugID,
+		Type:           kind,
+		Quantity:       quantity,
+		PrescriptionID: prescriptionID,
+		Note:           note,
+		PerformedBy:    performedBy,
+	}).Error
+}
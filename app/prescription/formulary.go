@@ -0,0 +1,128 @@
+package prescription
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
+	"github.com/gin-gonic/gin"
+)
+
+var interactionSeverities = []string{
+	models.InteractionMinor, models.InteractionModerate,
+	models.InteractionMajor, models.InteractionContraindicated,
+}
+
+func (h *Handler) AddDrug(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin && role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบหรือเภสัชกรเท่านั้นที่แก้ไขบัญชียาได้", "Only admins or pharmacists can edit the formulary"))
+		return
+	}
+
+	var input struct {
+		Code        string `json:"code" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		GenericName string `json:"generic_name" binding:"required"`
+		Form        string `json:"form"`
+		Strength    string `json:"strength"`
+		Unit        string `json:"unit"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+
+	drug := models.Drug{
+		Code:        strings.TrimSpace(input.Code),
+		Name:        input.Name,
+		GenericName: strings.ToLower(strings.TrimSpace(input.GenericName)),
+		Form:        input.Form,
+		Strength:    input.Strength,
+		Unit:        input.Unit,
+		Active:      true,
+	}
+	err := repository.Duplicate(h.DB, h.DB.WithContext(c.Request.Context()).Create(&drug).Error)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "รหัสยานี้มีอยู่แล้ว", "A drug with this code already exists"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเพิ่มยาได้", "Could not add the drug").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, drug)
+}
+
+func (h *Handler) SearchDrugs(c *gin.Context) {
+	query := h.DB.WithContext(c.Request.Context()).Where("active = ?", true)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(code) LIKE ? OR LOWER(name) LIKE ? OR generic_name LIKE ?", like, like, like)
+	}
+
+	var drugs []models.Drug
+	if err := query.Order("name").Limit(100).Find(&drugs).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถค้นหายาได้", "Could not search drugs").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, drugs)
+}
+
+func (h *Handler) AddInteraction(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin && role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบหรือเภสัชกรเท่านั้นที่แก้ไขบัญชียาได้", "Only admins or pharmacists can edit the formulary"))
+		return
+	}
+
+	var input struct {
+		DrugA       string `json:"drug_a" binding:"required"`
+		DrugB       string `json:"drug_b" binding:"required"`
+		Severity    string `json:"severity" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if !slices.Contains(interactionSeverities, input.Severity) {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ความรุนแรงต้องเป็น minor, moderate, major หรือ contraindicated", "Severity must be minor, moderate, major or contraindicated"))
+		return
+	}
+
+	a, b := NormalizePair(input.DrugA, input.DrugB)
+	if a == b {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ต้องระบุยาสองชนิดที่ต่างกัน", "Two different drugs are required"))
+		return
+	}
+	interaction := models.DrugInteraction{
+		DrugA:       a,
+		DrugB:       b,
+		Severity:    input.Severity,
+		Description: input.Description,
+	}
+	err := repository.Duplicate(h.DB, h.DB.WithContext(c.Request.Context()).Create(&interaction).Error)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "คู่ยานี้มีอยู่แล้ว", "This interaction already exists"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเพิ่มคู่ยาได้", "Could not add the interaction").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusCreated, interaction)
+}
+
+func (h *Handler) GetInteractions(c *gin.Context) {
+	var interactions []models.DrugInteraction
+	if err := h.DB.WithContext(c.Request.Context()).Order("drug_a, drug_b").Find(&interactions).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคู่ยาได้", "Could not load interactions").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, interactions)
+}
@@ -0,0 +1,356 @@
+package prescription
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/billing"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/pharmacy"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the formulary and prescription endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+var errStatusChanged = errors.New("prescription status changed")
+
+var routes = []string{"PO", "SL", "IV", "IM", "SC", "TOP", "INH", "PR", "EYE", "EAR", "NASAL"}
+
+type itemInput struct {
+	DrugCode     string `json:"drug_code" binding:"required"`
+	Dose         string `json:"dose" binding:"required"`
+	DoseUnit     string `json:"dose_unit" binding:"required"`
+	Route        string `json:"route" binding:"required"`
+	Frequency    string `json:"frequency" binding:"required"`
+	DurationDays int    `json:"duration_days"`
+	Quantity     int    `json:"quantity" binding:"required"`
+	Instruction  string `json:"instruction"`
+}
+
+func (h *Handler) CreatePrescription(c *gin.Context) {
+	var input struct {
+		EncounterID uint        `json:"encounter_id" binding:"required"`
+		Items       []itemInput `json:"items" binding:"required,min=1,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.EncounterID, staffHospital).
+		First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return
+	}
+
+	items := make([]models.PrescriptionItem, 0, len(input.Items))
+	drugs := make([]models.Drug, 0, len(input.Items))
+	for _, in := range input.Items {
+		if dose, err := strconv.ParseFloat(in.Dose, 64); err != nil || dose <= 0 {
+			apierror.Respond(c, apierror.New(apierror.InvalidInput, "ขนาดยาต้องเป็นตัวเลขที่มากกว่า 0", "Dose must be a number greater than 0"))
+			return
+		}
+		if !slices.Contains(routes, in.Route) {
+			apierror.Respond(c, apierror.Invalid("route", "ไม่รู้จักวิธีการให้ยา "+in.Route, "Unknown route "+in.Route))
+			return
+		}
+		if in.Quantity <= 0 || in.DurationDays < 0 {
+			apierror.Respond(c, apierror.New(apierror.InvalidInput, "จำนวนยาและระยะเวลาต้องมากกว่า 0", "Quantity and duration must be greater than 0"))
+			return
+		}
+
+		var drug models.Drug
+		if err := h.DB.WithContext(c.Request.Context()).Where("code = ? AND active = ?", in.DrugCode, true).
+			First(&drug).Error; err != nil {
+			apierror.Respond(c, apierror.Invalid("drug_code", "ไม่พบยารหัส "+in.DrugCode+" ในบัญชียา", "Drug "+in.DrugCode+" is not in the formulary"))
+			return
+		}
+		drugs = append(drugs, drug)
+		items = append(items, models.PrescriptionItem{
+			DrugID:       drug.ID,
+			Drug:         drug,
+			Dose:         in.Dose,
+			DoseUnit:     in.DoseUnit,
+			Route:        in.Route,
+			Frequency:    in.Frequency,
+			DurationDays: in.DurationDays,
+			Quantity:     in.Quantity,
+			Instruction:  in.Instruction,
+		})
+	}
+
+	warnings, err := Check(h.DB.WithContext(c.Request.Context()), encounter.PatientID, drugs, 0)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถตรวจสอบการแพ้และปฏิกิริยาระหว่างยาได้", "Could not check allergies and interactions").Wrap(err))
+		return
+	}
+
+	username, _ := c.Get("username")
+	prescribedBy, _ := username.(string)
+	prescription := models.Prescription{
+		PatientID:    encounter.PatientID,
+		EncounterID:  encounter.ID,
+		HospitalID:   staffHospital,
+		Status:       models.PrescriptionDraft,
+		Items:        items,
+		PrescribedBy: prescribedBy,
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Omit("Items.Drug").Create(&prescription).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้างใบสั่งยาได้", "Could not create the prescription").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"prescription": prescription,
+		"warnings":     warnings,
+	})
+}
+
+func (h *Handler) GetPrescription(c *gin.Context) {
+	prescription, ok := h.findPrescription(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, prescription)
+}
+
+func (h *Handler) GetPatientPrescriptions(c *gin.Context) {
+	patientID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Preload("Items.Drug").
+		Where("patient_id = ? AND hospital_id = ?", patientID, staffHospital)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var prescriptions []models.Prescription
+	if err := query.Order("created_at DESC").Find(&prescriptions).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลใบสั่งยาได้", "Could not load prescriptions").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, prescriptions)
+}
+
+// SignPrescription moves a draft to signed. Only prescriber roles may sign,
+// and any rule warnings must be explicitly acknowledged.
+func (h *Handler) SignPrescription(c *gin.Context) {
+	role, _ := c.Get("role")
+	roleName, _ := role.(string)
+	if !models.CanPrescribe(roleName) {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะแพทย์หรือทันตแพทย์เท่านั้นที่ลงนามใบสั่งยาได้", "Only doctors or dentists can sign prescriptions"))
+		return
+	}
+
+	var input struct {
+		AcknowledgeWarnings bool `json:"acknowledge_warnings"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		apierror.Respond(c, apierror.ErrInvalidInput)
+		return
+	}
+
+	prescription, ok := h.findPrescription(c)
+	if !ok {
+		return
+	}
+	if prescription.Status != models.PrescriptionDraft {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ลงนามได้เฉพาะใบสั่งยาที่เป็นฉบับร่าง", "Only draft prescriptions can be signed"))
+		return
+	}
+
+	drugs := make([]models.Drug, 0, len(prescription.Items))
+	for _, item := range prescription.Items {
+		drugs = append(drugs, item.Drug)
+	}
+	warnings, err := Check(h.DB.WithContext(c.Request.Context()), prescription.PatientID, drugs, prescription.ID)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถตรวจสอบการแพ้และปฏิกิริยาระหว่างยาได้", "Could not check allergies and interactions").Wrap(err))
+		return
+	}
+	if len(warnings) > 0 && !input.AcknowledgeWarnings {
+		apierror.Respond(c, apierror.New(apierror.Conflict,
+			"ใบสั่งยามีคำเตือน กรุณายืนยัน acknowledge_warnings ก่อนลงนาม",
+			"The prescription has warnings, set acknowledge_warnings to sign it").With("warnings", warnings))
+		return
+	}
+
+	username, _ := c.Get("username")
+	now := time.Now()
+	prescription.SignedBy, _ = username.(string)
+	prescription.SignedAt = &now
+	if !h.updateStatus(c, &prescription, models.PrescriptionDraft, models.PrescriptionSigned) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prescription": prescription, "warnings": warnings})
+}
+
+func (h *Handler) CancelPrescription(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุเหตุผลในการยกเลิก", "Please give a reason for the cancellation"))
+		return
+	}
+
+	prescription, ok := h.findPrescription(c)
+	if !ok {
+		return
+	}
+	if prescription.Status != models.PrescriptionDraft && prescription.Status != models.PrescriptionSigned {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ไม่สามารถยกเลิกใบสั่งยาที่จ่ายยาแล้วหรือถูกยกเลิกแล้ว", "Dispensed or cancelled prescriptions cannot be cancelled"))
+		return
+	}
+
+	prescription.CancelReason = input.Reason
+	if !h.updateStatus(c, &prescription, prescription.Status, models.PrescriptionCancelled) {
+		return
+	}
+	c.JSON(http.StatusOK, prescription)
+}
+
+// DispensePrescription issues every item of a signed prescription from the
+// given store, allocating lots first-expiry-first-out. Stock, status and the
+// drug charges are updated in one transaction, so either the whole
+// prescription is dispensed or nothing is.
+func (h *Handler) DispensePrescription(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RolePharmacist {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะเภสัชกรเท่านั้นที่จ่ายยาได้", "Only pharmacists can dispense"))
+		return
+	}
+	var input struct {
+		StoreID uint `json:"store_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุคลังยาที่จ่าย", "Please give the store to dispense from"))
+		return
+	}
+
+	prescription, ok := h.findPrescription(c)
+	if !ok {
+		return
+	}
+	if prescription.Status != models.PrescriptionSigned {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "จ่ายยาได้เฉพาะใบสั่งยาที่ลงนามแล้ว", "Only signed prescriptions can be dispensed"))
+		return
+	}
+	var store models.Store
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.StoreID, prescription.HospitalID).
+		First(&store).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบคลังยาที่ระบุ", "Store not found"))
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).First(&encounter, prescription.EncounterID).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบข้อมูลการรับบริการของใบสั่งยา", "The prescription's encounter was not found"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	performedBy, _ := username.(string)
+	var shortDrug string
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Prescription{}).
+			Where("id = ? AND status = ?", prescription.ID, models.PrescriptionSigned).
+			Update("status", models.PrescriptionDispensed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStatusChanged
+		}
+		for _, item := range prescription.Items {
+			err := pharmacy.DispenseFEFO(tx, store.ID, item.DrugID, item.Quantity, &prescription.ID, performedBy)
+			if err != nil {
+				shortDrug = item.Drug.Code
+				return err
+			}
+			err = billing.Capture(tx, encounter, item.Drug.Code, item.Quantity, models.ChargeSourcePrescription, item.ID, performedBy)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errStatusChanged):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "สถานะใบสั่งยาถูกเปลี่ยนโดยผู้ใช้อื่นแล้ว", "The prescription was changed by another user"))
+		return
+	case errors.Is(err, pharmacy.ErrInsufficientStock):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ยา "+shortDrug+" ในคลังไม่เพียงพอ", "Not enough "+shortDrug+" in stock"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถจ่ายยาได้", "Could not dispense the prescription").Wrap(err))
+		return
+	}
+
+	prescription.Status = models.PrescriptionDispensed
+	c.JSON(http.StatusOK, prescription)
+}
+
+func (h *Handler) findPrescription(c *gin.Context) (models.Prescription, bool) {
+	var prescription models.Prescription
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return prescription, false
+	}
+
+	if err := h.DB.WithContext(c.Request.Context()).Preload("Items.Drug").
+		Where("id = ? AND hospital_id = ?", c.Param("id"), staffHospital).
+		First(&prescription).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบใบสั่งยาที่ระบุ", "Prescription not found"))
+		return prescription, false
+	}
+	return prescription, true
+}
+
+// updateStatus saves a status transition only if nobody else changed the
+// prescription's status in the meantime.
+func (h *Handler) updateStatus(c *gin.Context, p *models.Prescription, from, to string) bool {
+	p.Status = to
+	result := h.DB.WithContext(c.Request.Context()).Model(&models.Prescription{}).
+		Where("id = ? AND status = ?", p.ID, from).
+		Updates(map[string]interface{}{
+			"status":        to,
+			"signed_by":     p.SignedBy,
+			"signed_at":     p.SignedAt,
+			"cancel_reason": p.CancelReason,
+		})
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถเปลี่ยนสถานะใบสั่งยาได้", "Could not change the prescription status").Wrap(result.Error))
+		return false
+	}
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "สถานะใบสั่งยาถูกเปลี่ยนโดยผู้ใช้อื่นแล้ว", "The prescription was changed by another user"))
+		return false
+	}
+	return true
+}
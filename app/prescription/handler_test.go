@@ -0,0 +1,282 @@
+package prescription
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{}, &models.Allergy{},
+		&models.Drug{}, &models.DrugInteraction{}, &models.Prescription{}, &models.PrescriptionItem{},
+		&models.Store{}, &models.StockLot{}, &models.StockMovement{}, &models.ChargeItem{}, &models.Charge{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	db.Create(&models.Drug{Code: "AMOX500", Name: "Amoxicillin 500 mg cap", GenericName: "amoxicillin", Active: true})
+	db.Create(&models.Drug{Code: "WARF3", Name: "Warfarin 3 mg tab", GenericName: "warfarin", Active: true})
+	db.Create(&models.Drug{Code: "ASA81", Name: "Aspirin 81 mg tab", GenericName: "aspirin", Active: true})
+	db.Create(&models.DrugInteraction{DrugA: "aspirin", DrugB: "warfarin", Severity: "major", Description: "bleeding risk"})
+	db.Create(&models.Store{ID: 1, HospitalID: "1", Name: "OPD Pharmacy"})
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 3, LotNumber: "L2",
+		ExpiryDate: time.Now().AddDate(1, 0, 0), Quantity: 100})
+	db.Create(&models.StockLot{HospitalID: "1", StoreID: 1, DrugID: 3, LotNumber: "L1",
+		ExpiryDate: time.Now().AddDate(0, 1, 0), Quantity: 5})
+	db.Create(&models.ChargeItem{HospitalID: "1", Code: "ASA81", Name: "Aspirin 81 mg tab", Category: "drug",
+		Price: decimal.RequireFromString("1.50"), Active: true})
+	return db
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/drug/interaction/add", h.AddInteraction)
+	r.POST("/prescription/add", h.CreatePrescription)
+	r.POST("/prescription/sign/:id", h.SignPrescription)
+	r.POST("/prescription/cancel/:id", h.CancelPrescription)
+	r.POST("/prescription/dispense/:id", h.DispensePrescription)
+	return r
+}
+
+func sendJSON(r *gin.Engine, path string, data interface{}, role string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken("1", role))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func item(code string) map[string]interface{} {
+	return map[string]interface{}{
+		"drug_code": code, "dose": "1", "dose_unit": "tab", "route": "PO",
+		"frequency": "OD", "duration_days": 7, "quantity": 7,
+	}
+}
+
+type createResponse struct {
+	Prescription models.Prescription `json:"prescription"`
+	Warnings     []Warning           `json:"warnings"`
+}
+
+func TestCreatePrescription(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Create Prescription Success", func(t *testing.T) {
+		w := sendJSON(r, "/prescription/add", map[string]interface{}{
+			"encounter_id": 1, "items": []interface{}{item("AMOX500")},
+		}, "doctor")
+
+		var resp createResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, models.PrescriptionDraft, resp.Prescription.Status)
+		assert.Len(t, resp.Prescription.Items, 1)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("Create Prescription Warns On Allergy", func(t *testing.T) {
+		db.Create(&models.Allergy{PatientID: "001", HospitalID: "1", Category: "drug",
+			Substance: "Amoxicillin", Reaction: "rash", Severity: "moderate", VerificationStatus: "confirmed"})
+		defer db.Where("1 = 1").Delete(&models.Allergy{})
+
+		w := sendJSON(r, "/prescription/add", map[string]interface{}{
+			"encounter_id": 1, "items": []interface{}{item("AMOX500")},
+		}, "doctor")
+
+		var resp createResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Len(t, resp.Warnings, 1)
+		assert.Equal(t, WarningAllergy, resp.Warnings[0].Type)
+	})
+
+	t.Run("Create Prescription Warns On Interaction", func(t *testing.T) {
+		w := sendJSON(r, "/prescription/add", map[string]interface{}{
+			"encounter_id": 1, "items": []interface{}{item("WARF3"), item("ASA81")},
+		}, "doctor")
+
+		var resp createResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Len(t, resp.Warnings, 1)
+		assert.Equal(t, WarningInteraction, resp.Warnings[0].Type)
+		assert.Equal(t, []string{"ASA81", "WARF3"}, resp.Warnings[0].Drugs)
+	})
+
+	t.Run("Create Prescription Fail Case Unknown Drug", func(t *testing.T) {
+		w := sendJSON(r, "/prescription/add", map[string]interface{}{
+			"encounter_id": 1, "items": []interface{}{item("NOPE")},
+		}, "doctor")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Create Prescription Fail Case No Items", func(t *testing.T) {
+		w := sendJSON(r, "/prescription/add", map[string]interface{}{
+			"encounter_id": 1, "items": []interface{}{},
+		}, "doctor")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestPrescriptionLifecycle(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	// an active warfarin course makes a later aspirin order interact
+	signedAt := time.Now()
+	db.Create(&models.Prescription{PatientID: "001", EncounterID: 1, HospitalID: "1",
+		Status: models.PrescriptionSigned, SignedAt: &signedAt,
+		Items: []models.PrescriptionItem{{DrugID: 2, Dose: "1", DoseUnit: "tab", Route: "PO",
+			Frequency: "OD", DurationDays: 30, Quantity: 30}}})
+
+	w := sendJSON(r, "/prescription/add", map[string]interface{}{
+		"encounter_id": 1, "items": []interface{}{item("ASA81")},
+	}, "doctor")
+	var created createResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := func(action string) string {
+		return "/prescription/" + action + "/" + fmt.Sprint(created.Prescription.ID)
+	}
+	assert.Len(t, created.Warnings, 1)
+
+	t.Run("Sign Fail Case Not Prescriber", func(t *testing.T) {
+		w := sendJSON(r, path("sign"), map[string]interface{}{"acknowledge_warnings": true}, "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Sign Fail Case Warnings Not Acknowledged", func(t *testing.T) {
+		w := sendJSON(r, path("sign"), map[string]interface{}{}, "doctor")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "bleeding risk")
+	})
+
+	t.Run("Dispense Fail Case Not Signed", func(t *testing.T) {
+		w := sendJSON(r, path("dispense"), map[string]interface{}{"store_id": 1}, "pharmacist")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Sign Success", func(t *testing.T) {
+		w := sendJSON(r, path("sign"), map[string]interface{}{"acknowledge_warnings": true}, "doctor")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"signed"`)
+	})
+
+	t.Run("Dispense Fail Case Not Pharmacist", func(t *testing.T) {
+		w := sendJSON(r, path("dispense"), map[string]interface{}{"store_id": 1}, "doctor")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Dispense Success Allocates FEFO", func(t *testing.T) {
+		w := sendJSON(r, path("dispense"), map[string]interface{}{"store_id": 1}, "pharmacist")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"dispensed"`)
+
+		var lots []models.StockLot
+		db.Order("lot_number").Find(&lots)
+		assert.Equal(t, 0, lots[0].Quantity) // L1 expires first and is used up
+		assert.Equal(t, 98, lots[1].Quantity)
+
+		var charge models.Charge
+		db.Where("source = ?", models.ChargeSourcePrescription).First(&charge)
+		assert.Equal(t, 7, charge.Quantity)
+		assert.True(t, decimal.RequireFromString("10.50").Equal(charge.Amount))
+	})
+
+	t.Run("Cancel Fail Case Already Dispensed", func(t *testing.T) {
+		w := sendJSON(r, path("cancel"), map[string]interface{}{"reason": "wrong patient"}, "doctor")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestDispenseInsufficientStock(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	order := item("ASA81")
+	order["quantity"] = 500
+	w := sendJSON(r, "/prescription/add", map[string]interface{}{
+		"encounter_id": 1, "items": []interface{}{order},
+	}, "doctor")
+	var created createResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := fmt.Sprint(created.Prescription.ID)
+	sendJSON(r, "/prescription/sign/"+id, map[string]interface{}{}, "doctor")
+
+	w = sendJSON(r, "/prescription/dispense/"+id, map[string]interface{}{"store_id": 1}, "pharmacist")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// nothing is taken and the prescription stays signed
+	var total int
+	db.Model(&models.StockLot{}).Select("SUM(quantity)").Scan(&total)
+	assert.Equal(t, 105, total)
+	var prescription models.Prescription
+	db.First(&prescription, created.Prescription.ID)
+	assert.Equal(t, models.PrescriptionSigned, prescription.Status)
+	var charges int64
+	db.Model(&models.Charge{}).Count(&charges)
+	assert.Zero(t, charges)
+}
+
+func TestAddInteraction(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Add Interaction Success Normalizes Pair", func(t *testing.T) {
+		w := sendJSON(r, "/drug/interaction/add", map[string]interface{}{
+			"drug_a": "Simvastatin", "drug_b": "Clarithromycin", "severity": "contraindicated",
+		}, "pharmacist")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"drug_a":"clarithromycin","drug_b":"simvastatin"`)
+	})
+
+	t.Run("Add Interaction Fail Case Duplicate Pair", func(t *testing.T) {
+		w := sendJSON(r, "/drug/interaction/add", map[string]interface{}{
+			"drug_a": "clarithromycin", "drug_b": "simvastatin", "severity": "major",
+		}, "pharmacist")
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Add Interaction Fail Case Not Allowed", func(t *testing.T) {
+		w := sendJSON(r, "/drug/interaction/add", map[string]interface{}{
+			"drug_a": "a", "drug_b": "b", "severity": "minor",
+		}, "nurse")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,162 @@
+package prescription
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+const (
+	WarningAllergy     = "allergy"
+	WarningInteraction = "interaction"
+)
+
+// Warning is raised by the prescribing rules. Warnings do not block a draft
+// but must be acknowledged when the prescription is signed.
+type Warning struct {
+	Type     string   `json:"type"`
+	Severity string   `json:"severity"`
+	Drugs    []string `json:"drugs"`
+	Message  string   `json:"message"`
+}
+
+// NormalizePair orders and lower-cases a pair of generic names the way
+// DrugInteraction rows are stored.
+func NormalizePair(a, b string) (string, string) {
+	a = strings.ToLower(strings.TrimSpace(a))
+	b = strings.ToLower(strings.TrimSpace(b))
+	if b < a {
+		a, b = b, a
+	}
+	return a, b
+}
+
+// Check runs the allergy and drug-drug interaction rules for drugs about to
+// be prescribed to a patient. Interactions are checked among the new drugs
+// and against the patient's other active prescriptions; exclude is the ID of
+// the prescription being checked so it is not compared with itself.
+func Check(db *gorm.DB, patientID string, drugs []models.Drug, exclude uint) ([]Warning, error) {
+	warnings := []Warning{}
+
+	var allergies []models.Allergy
+	err := db.Where("patient_id = ? AND category = ? AND verification_status NOT IN ?",
+		patientID, models.AllergyDrug,
+		[]string{models.VerificationRefuted, models.VerificationEnteredInError}).
+		Find(&allergies).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, drug := range drugs {
+		for _, allergy := range allergies {
+			if !allergyMatches(allergy.Substance, drug) {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Type:     WarningAllergy,
+				Severity: allergy.Severity,
+				Drugs:    []string{drug.Code},
+				Message: fmt.Sprintf("คนไข้มีประวัติแพ้ %s (%s): %s",
+					allergy.Substance, allergy.VerificationStatus, allergy.Reaction),
+			})
+		}
+	}
+
+	active, err := activeDrugs(db, patientID, exclude)
+	if err != nil {
+		return nil, err
+	}
+	newNames := map[string]models.Drug{}
+	names := []string{}
+	for _, drug := range drugs {
+		name := strings.ToLower(drug.GenericName)
+		if name == "" {
+			continue
+		}
+		newNames[name] = drug
+		names = append(names, name)
+	}
+	for name := range active {
+		names = append(names, name)
+	}
+	if len(names) < 2 {
+		return warnings, nil
+	}
+
+	var interactions []models.DrugInteraction
+	if err := db.Where("drug_a IN ? AND drug_b IN ?", names, names).
+		Order("id").Find(&interactions).Error; err != nil {
+		return nil, err
+	}
+	for _, interaction := range interactions {
+		a, aNew := newNames[interaction.DrugA]
+		b, bNew := newNames[interaction.DrugB]
+		_, aActive := active[interaction.DrugA]
+		_, bActive := active[interaction.DrugB]
+		var codes []string
+		switch {
+		case aNew && bNew:
+			codes = []string{a.Code, b.Code}
+		case aNew && bActive:
+			codes = []string{a.Code, active[interaction.DrugB].Code}
+		case bNew && aActive:
+			codes = []string{active[interaction.DrugA].Code, b.Code}
+		default:
+			continue
+		}
+		warnings = append(warnings, Warning{
+			Type:     WarningInteraction,
+			Severity: interaction.Severity,
+			Drugs:    codes,
+			Message: fmt.Sprintf("%s กับ %s: %s",
+				interaction.DrugA, interaction.DrugB, interaction.Description),
+		})
+	}
+	return warnings, nil
+}
+
+func allergyMatches(substance string, drug models.Drug) bool {
+	substance = strings.ToLower(strings.TrimSpace(substance))
+	if substance == "" {
+		return false
+	}
+	for _, name := range []string{drug.GenericName, drug.Name} {
+		name = strings.ToLower(name)
+		if name != "" && (strings.Contains(name, substance) || strings.Contains(substance, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeDrugs returns the drugs, keyed by generic name, of the patient's
+// signed or dispensed prescriptions whose course has not yet ended.
+func activeDrugs(db *gorm.DB, patientID string, exclude uint) (map[string]models.Drug, error) {
+	var prescriptions []models.Prescription
+	err := db.Preload("Items.Drug").
+		Where("patient_id = ? AND id <> ? AND status IN ?", patientID, exclude,
+			[]string{models.PrescriptionSigned, models.PrescriptionDispensed}).
+		Find(&prescriptions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := map[string]models.Drug{}
+	for _, p := range prescriptions {
+		start := p.CreatedAt
+		if p.SignedAt != nil {
+			start = *p.SignedAt
+		}
+		for _, item := range p.Items {
+			days := max(item.DurationDays, 1)
+			if start.AddDate(0, 0, days).Before(now) || item.Drug.GenericName == "" {
+				continue
+			}
+			active[strings.ToLower(item.Drug.GenericName)] = item.Drug
+		}
+	}
+	return active, nil
+}
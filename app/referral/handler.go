@@ -0,0 +1,307 @@
+package referral
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the referral endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+const (
+	defaultAccessDays = 30
+	maxAccessDays     = 90
+)
+
+var errStatusChanged = errors.New("referral: status changed concurrently")
+
+func (h *Handler) CreateReferral(c *gin.Context) {
+	var input struct {
+		PatientID       string   `json:"patient_id" binding:"required"`
+		ToHospitalID    string   `json:"to_hospital_id" binding:"required"`
+		Reason          string   `json:"reason" binding:"required"`
+		ClinicalSummary string   `json:"clinical_summary"`
+		Scopes          []string `json:"scopes"`
+		AccessDays      int      `json:"access_days"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	if input.AccessDays == 0 {
+		input.AccessDays = defaultAccessDays
+	}
+	if input.AccessDays < 1 || input.AccessDays > maxAccessDays {
+		apierror.Respond(c, apierror.Invalid("access_days",
+			fmt.Sprintf("ระยะเวลาเข้าถึงข้อมูลต้องอยู่ระหว่าง 1-%d วัน", maxAccessDays),
+			fmt.Sprintf("access_days must be between 1-%d", maxAccessDays)))
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !slices.Contains(models.ReferralScopes, scope) {
+			apierror.Respond(c, apierror.New(apierror.InvalidInput, "ขอบเขตข้อมูลต้องเป็น allergies, diagnoses, prescriptions, lab_results หรือ notes", "Scope must be allergies, diagnoses, prescriptions, lab_results or notes"))
+			return
+		}
+	}
+	if input.ToHospitalID == staffHospital {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ไม่สามารถส่งตัวไปยังโรงพยาบาลเดียวกันได้", "Cannot refer to the same hospital"))
+		return
+	}
+
+	var patient models.Patient
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.PatientID, staffHospital).
+		First(&patient).Error; err != nil {
+		apierror.Respond(c, apierror.ErrPatientNotFound)
+		return
+	}
+	var hospital models.Hospital
+	if err := h.DB.WithContext(c.Request.Context()).First(&hospital, "id = ?", input.ToHospitalID).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "รหัสโรงพยาบาลปลายทางไม่ถูกต้อง", "Invalid destination hospital ID"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	requestedBy, _ := username.(string)
+	referral := models.Referral{
+		PatientID:       patient.ID,
+		FromHospitalID:  staffHospital,
+		ToHospitalID:    hospital.ID,
+		Reason:          input.Reason,
+		ClinicalSummary: input.ClinicalSummary,
+		Scopes:          slices.Compact(slices.Sorted(slices.Values(input.Scopes))),
+		AccessDays:      input.AccessDays,
+		Status:          models.ReferralPending,
+		RequestedBy:     requestedBy,
+	}
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("ToHospital", "FromHospital").Create(&referral).Error; err != nil {
+			return err
+		}
+		return audit.Log(tx, c, entry(referral, "referral.create", "to "+hospital.ID))
+	})
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้างใบส่งตัวได้", "Could not create the referral").Wrap(err))
+		return
+	}
+	referral.ToHospital = hospital
+	c.JSON(http.StatusCreated, referral)
+}
+
+// GetOutgoingReferrals lists referrals the caller's hospital has sent.
+func (h *Handler) GetOutgoingReferrals(c *gin.Context) {
+	h.listReferrals(c, "from_hospital_id")
+}
+
+// GetIncomingReferrals lists referrals sent to the caller's hospital. Only
+// the referral itself is shown; the record is read through
+// GetReferralRecord once accepted.
+func (h *Handler) GetIncomingReferrals(c *gin.Context) {
+	h.listReferrals(c, "to_hospital_id")
+}
+
+func (h *Handler) listReferrals(c *gin.Context, column string) {
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Preload("FromHospital").Preload("ToHospital").Where(column+" = ?", staffHospital)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var referrals []models.Referral
+	if err := query.Order("created_at DESC").Find(&referrals).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลใบส่งตัวได้", "Could not load referrals").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, referrals)
+}
+
+// AcceptReferral is done by the receiving hospital and opens access to the
+// shared record for the number of days the sender allowed.
+func (h *Handler) AcceptReferral(c *gin.Context) {
+	var input struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&input)
+	referral, ok := h.findReferral(c, "to_hospital_id")
+	if !ok {
+		return
+	}
+	if referral.Status != models.ReferralPending {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ตอบรับได้เฉพาะใบส่งตัวที่รอการตอบรับ", "Only pending referrals can be accepted"))
+		return
+	}
+
+	now := time.Now()
+	expires := now.AddDate(0, 0, referral.AccessDays)
+	referral.AccessExpiresAt = &expires
+	h.respond(c, &referral, models.ReferralAccepted, input.Note, now)
+}
+
+func (h *Handler) RejectReferral(c *gin.Context) {
+	var input struct {
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุเหตุผลที่ปฏิเสธ", "Please give a reason for the rejection"))
+		return
+	}
+	referral, ok := h.findReferral(c, "to_hospital_id")
+	if !ok {
+		return
+	}
+	if referral.Status != models.ReferralPending {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ปฏิเสธได้เฉพาะใบส่งตัวที่รอการตอบรับ", "Only pending referrals can be rejected"))
+		return
+	}
+	h.respond(c, &referral, models.ReferralRejected, input.Note, time.Now())
+}
+
+// CancelReferral is done by the sending hospital. Cancelling an accepted
+// referral ends the receiving hospital's access immediately.
+func (h *Handler) CancelReferral(c *gin.Context) {
+	var input struct {
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "กรุณาระบุเหตุผลที่ยกเลิก", "Please give a reason for the cancellation"))
+		return
+	}
+	referral, ok := h.findReferral(c, "from_hospital_id")
+	if !ok {
+		return
+	}
+	if referral.Status != models.ReferralPending && referral.Status != models.ReferralAccepted {
+		apierror.Respond(c, apierror.New(apierror.Conflict, "ใบส่งตัวนี้สิ้นสุดแล้ว", "The referral is closed"))
+		return
+	}
+	h.respond(c, &referral, models.ReferralCancelled, input.Note, time.Now())
+}
+
+// GetReferralRecord returns the parts of the patient's record shared by an
+// accepted referral to the receiving hospital, while access is open. Every
+// read is audited against the sending hospital's patient.
+func (h *Handler) GetReferralRecord(c *gin.Context) {
+	referral, ok := h.findReferral(c, "to_hospital_id")
+	if !ok {
+		return
+	}
+	if !referral.AccessOpen(time.Now()) {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "ไม่มีสิทธิ์เข้าถึงข้อมูล ใบส่งตัวยังไม่ได้รับการตอบรับ ถูกยกเลิก หรือหมดอายุแล้ว", "Access denied: the referral is not accepted, or it was cancelled or has expired"))
+		return
+	}
+
+	record, err := sharedRecord(h.DB.WithContext(c.Request.Context()), referral)
+	if err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคนไข้ได้", "Could not load the patient").Wrap(err))
+		return
+	}
+	if err := audit.Log(h.DB.WithContext(c.Request.Context()), c, entry(referral, "referral.read", "")); err != nil {
+		// access that cannot be audited is not granted
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลคนไข้ได้", "Could not load the patient").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// respond moves a referral to status, provided nobody else changed it first,
+// and audits the change in the same transaction.
+func (h *Handler) respond(c *gin.Context, referral *models.Referral, status, note string, at time.Time) {
+	from := referral.Status
+	username, _ := c.Get("username")
+	referral.Status = status
+	referral.ResponseNote = note
+	if status != models.ReferralCancelled {
+		referral.RespondedBy, _ = username.(string)
+		referral.RespondedAt = &at
+	}
+
+	err := h.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Referral{}).
+			Where("id = ? AND status = ?", referral.ID, from).
+			Updates(map[string]interface{}{
+				"status":            referral.Status,
+				"response_note":     referral.ResponseNote,
+				"responded_by":      referral.RespondedBy,
+				"responded_at":      referral.RespondedAt,
+				"access_expires_at": referral.AccessExpiresAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStatusChanged
+		}
+		return audit.Log(tx, c, entry(*referral, "referral."+verb(status), note))
+	})
+	switch {
+	case errors.Is(err, errStatusChanged):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "สถานะใบส่งตัวถูกเปลี่ยนโดยผู้ใช้อื่นแล้ว", "The referral was changed by another user"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกสถานะใบส่งตัวได้", "Could not save the referral status").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, referral)
+}
+
+func verb(status string) string {
+	switch status {
+	case models.ReferralAccepted:
+		return "accept"
+	case models.ReferralRejected:
+		return "reject"
+	}
+	return "cancel"
+}
+
+func entry(referral models.Referral, action, detail string) audit.Entry {
+	return audit.Entry{
+		Action:            action,
+		ResourceType:      "referral",
+		ResourceID:        fmt.Sprint(referral.ID),
+		PatientID:         referral.PatientID,
+		PatientHospitalID: referral.FromHospitalID,
+		Detail:            detail,
+	}
+}
+
+// findReferral loads the referral in the URL if the caller's hospital is on
+// the given side of it.
+func (h *Handler) findReferral(c *gin.Context, side string) (models.Referral, bool) {
+	var referral models.Referral
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return referral, false
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND "+side+" = ?", c.Param("id"), staffHospital).
+		First(&referral).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบใบส่งตัวที่ระบุ", "Referral not found"))
+		return referral, false
+	}
+	return referral, true
+}
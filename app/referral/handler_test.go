@@ -0,0 +1,200 @@
+package referral
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Staff{}, &models.Allergy{}, &models.Diagnosis{},
+		&models.ICD10Code{}, &models.ClinicalNote{}, &models.Referral{}, &models.AuditLog{})
+	db.Create(&models.Hospital{ID: "1", Name: "BKK Hospital"})
+	db.Create(&models.Hospital{ID: "2", Name: "Bangna Medical"})
+	db.Create(&models.Hospital{ID: "3", Name: "Other Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", FirstNameEN: "Somchai"})
+	db.Create(&models.Allergy{PatientID: "001", HospitalID: "1", Category: "drug", Substance: "Penicillin",
+		Severity: "severe", VerificationStatus: "confirmed"})
+	db.Create(&models.ClinicalNote{EncounterID: 1, PatientID: "001", HospitalID: "1", AuthorID: 1,
+		Assessment: "Unstable angina", Status: "signed"})
+	return db
+}
+
+func generateTestToken(HospitalID string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "user@" + HospitalID,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func setupRouter(db *gorm.DB) *gin.Engine {
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/referral/add", h.CreateReferral)
+	r.GET("/referral/incoming", h.GetIncomingReferrals)
+	r.POST("/referral/accept/:id", h.AcceptReferral)
+	r.POST("/referral/reject/:id", h.RejectReferral)
+	r.POST("/referral/cancel/:id", h.CancelReferral)
+	r.GET("/referral/record/:id", h.GetReferralRecord)
+	return r
+}
+
+func send(r *gin.Engine, method, path string, data interface{}, hospitalID string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateReferral(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	t.Run("Create Referral Fail Case Patient Of Other Hospital", func(t *testing.T) {
+		w := send(r, "POST", "/referral/add", map[string]interface{}{
+			"patient_id": "001", "to_hospital_id": "1", "reason": "cath lab",
+		}, "2")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Create Referral Fail Case Unknown Scope", func(t *testing.T) {
+		w := send(r, "POST", "/referral/add", map[string]interface{}{
+			"patient_id": "001", "to_hospital_id": "2", "reason": "cath lab", "scopes": []string{"billing"},
+		}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Create Referral Fail Case Access Too Long", func(t *testing.T) {
+		w := send(r, "POST", "/referral/add", map[string]interface{}{
+			"patient_id": "001", "to_hospital_id": "2", "reason": "cath lab", "access_days": 365,
+		}, "1")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Create Referral Success", func(t *testing.T) {
+		w := send(r, "POST", "/referral/add", map[string]interface{}{
+			"patient_id": "001", "to_hospital_id": "2", "reason": "cath lab",
+		}, "1")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"pending"`)
+		assert.Contains(t, w.Body.String(), `"access_days":30`)
+
+		w = send(r, "GET", "/referral/incoming", nil, "2")
+		assert.Contains(t, w.Body.String(), `"reason":"cath lab"`)
+	})
+}
+
+func TestReferralAccess(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	w := send(r, "POST", "/referral/add", map[string]interface{}{
+		"patient_id": "001", "to_hospital_id": "2", "reason": "cath lab",
+		"scopes": []string{"allergies"}, "access_days": 7,
+	}, "1")
+	var referral models.Referral
+	json.Unmarshal(w.Body.Bytes(), &referral)
+	path := func(action string) string { return "/referral/" + action + "/" + fmt.Sprint(referral.ID) }
+
+	t.Run("Record Fail Case Not Accepted", func(t *testing.T) {
+		w := send(r, "GET", path("record"), nil, "2")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Accept Fail Case Sender", func(t *testing.T) {
+		w := send(r, "POST", path("accept"), nil, "1")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Accept Success", func(t *testing.T) {
+		w := send(r, "POST", path("accept"), map[string]interface{}{"note": "bed ready"}, "2")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"accepted"`)
+		assert.Contains(t, w.Body.String(), `"responded_by":"user@2"`)
+	})
+
+	t.Run("Record Success Only Shared Scopes", func(t *testing.T) {
+		w := send(r, "GET", path("record"), nil, "2")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var record Record
+		json.Unmarshal(w.Body.Bytes(), &record)
+		assert.Equal(t, "Somchai", record.Patient.FirstNameEN)
+		assert.Len(t, record.Allergies, 1)
+		assert.Empty(t, record.Notes)
+	})
+
+	t.Run("Record Fail Case Third Hospital", func(t *testing.T) {
+		w := send(r, "GET", path("record"), nil, "3")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Access Is Audited", func(t *testing.T) {
+		var logs []models.AuditLog
+		db.Order("id").Find(&logs)
+		assert.Len(t, logs, 3)
+		assert.Equal(t, "referral.read", logs[2].Action)
+		assert.Equal(t, "2", logs[2].HospitalID)
+		assert.Equal(t, "1", logs[2].PatientHospitalID)
+	})
+
+	t.Run("Record Fail Case Access Expired", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		db.Model(&models.Referral{}).Where("id = ?", referral.ID).Update("access_expires_at", past)
+		w := send(r, "GET", path("record"), nil, "2")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestCancelReferralEndsAccess(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+	r := setupRouter(db)
+
+	w := send(r, "POST", "/referral/add", map[string]interface{}{
+		"patient_id": "001", "to_hospital_id": "2", "reason": "cath lab", "scopes": []string{"notes"},
+	}, "1")
+	var referral models.Referral
+	json.Unmarshal(w.Body.Bytes(), &referral)
+	path := func(action string) string { return "/referral/" + action + "/" + fmt.Sprint(referral.ID) }
+
+	send(r, "POST", path("accept"), nil, "2")
+	w = send(r, "GET", path("record"), nil, "2")
+	assert.Contains(t, w.Body.String(), "Unstable angina")
+
+	w = send(r, "POST", path("cancel"), map[string]interface{}{}, "1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = send(r, "POST", path("cancel"), map[string]interface{}{"note": "patient declined transfer"}, "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(r, "GET", path("record"), nil, "2")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(r, "POST", path("reject"), map[string]interface{}{"note": "too late"}, "2")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
@@ -0,0 +1,64 @@
+package referral
+
+import (
+	"slices"
+
+	"example.com/myapp/app/allergy"
+	"example.com/myapp/app/model"
+	"gorm.io/gorm"
+)
+
+// Record is what a receiving hospital sees of a referred patient:
+// demographics always, and each other part only if the referral shares it.
+type Record struct {
+	Referral      models.Referral       `json:"referral"`
+	Patient       models.Patient        `json:"patient"`
+	Allergies     []models.Allergy      `json:"allergies,omitempty"`
+	Diagnoses     []models.Diagnosis    `json:"diagnoses,omitempty"`
+	Prescriptions []models.Prescription `json:"prescriptions,omitempty"`
+	LabResults    []models.LabResult    `json:"lab_results,omitempty"`
+	Notes         []models.ClinicalNote `json:"notes,omitempty"`
+}
+
+func sharedRecord(db *gorm.DB, referral models.Referral) (Record, error) {
+	record := Record{Referral: referral}
+	owner := func(db *gorm.DB) *gorm.DB {
+		return db.Where("patient_id = ? AND hospital_id = ?", referral.PatientID, referral.FromHospitalID)
+	}
+
+	if err := db.Preload("Hospital").Where("id = ? AND hospital_id = ?", referral.PatientID, referral.FromHospitalID).
+		First(&record.Patient).Error; err != nil {
+		return record, err
+	}
+	if slices.Contains(referral.Scopes, models.ReferralScopeAllergies) {
+		if err := db.Scopes(owner, allergy.Active).Find(&record.Allergies).Error; err != nil {
+			return record, err
+		}
+	}
+	if slices.Contains(referral.Scopes, models.ReferralScopeDiagnoses) {
+		if err := db.Scopes(owner).Preload("ICD10").Order("created_at DESC").Find(&record.Diagnoses).Error; err != nil {
+			return record, err
+		}
+	}
+	if slices.Contains(referral.Scopes, models.ReferralScopePrescriptions) {
+		if err := db.Scopes(owner).Preload("Items.Drug").
+			Where("status IN ?", []string{models.PrescriptionSigned, models.PrescriptionDispensed}).
+			Order("created_at DESC").Find(&record.Prescriptions).Error; err != nil {
+			return record, err
+		}
+	}
+	if slices.Contains(referral.Scopes, models.ReferralScopeLabResults) {
+		if err := db.Scopes(owner).Order("resulted_at, id").Find(&record.LabResults).Error; err != nil {
+			return record, err
+		}
+	}
+	if slices.Contains(referral.Scopes, models.ReferralScopeNotes) {
+		// drafts are the author's own until signed, so only signed notes travel
+		if err := db.Scopes(owner).Preload("Author").Preload("Addenda", "status = ?", models.NoteSigned).
+			Where("status = ? AND addendum_to_id IS NULL", models.NoteSigned).
+			Order("created_at DESC").Find(&record.Notes).Error; err != nil {
+			return record, err
+		}
+	}
+	return record, nil
+}
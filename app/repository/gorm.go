@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"example.com/myapp/app/allergy"
+	"example.com/myapp/app/coverage"
+	"example.com/myapp/app/model"
+	"example.com/myapp/app/pdpa"
+	"gorm.io/gorm"
+)
+
+const createBatchSize = 500
+
+type gormPatients struct{ db *gorm.DB }
+
+func NewPatientRepository(db *gorm.DB) PatientRepository { return gormPatients{db} }
+
+func (r gormPatients) loaded(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).
+		Preload("Hospital").
+		Preload("Allergies", allergy.Active).
+		Preload("Coverages", coverage.ByPriority)
+}
+
+func (r gormPatients) Get(ctx context.Context, hospitalID, id string) (models.Patient, error) {
+	var patient models.Patient
+	err := r.loaded(ctx).Where("id = ? AND hospital_id = ?", id, hospitalID).First(&patient).Error
+	return patient, notFound(err)
+}
+
+func (r gormPatients) Search(ctx context.Context, hospitalID string, filter PatientFilter) ([]models.Patient, error) {
+	var patients []models.Patient
+	err := filter.apply(r.loaded(ctx).Where("hospital_id = ?", hospitalID)).Find(&patients).Error
+	return patients, err
+}
+
+func (r gormPatients) Create(ctx context.Context, patient *models.Patient) error {
+	return Duplicate(r.db, r.db.WithContext(ctx).Create(patient).Error)
+}
+
+func (r gormPatients) CreateAll(ctx context.Context, patients []models.Patient) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Omit("Hospital", "Allergies", "Coverages").CreateInBatches(patients, createBatchSize).Error
+	})
+	return Duplicate(r.db, err)
+}
+
+func (r gormPatients) Taken(ctx context.Context, hospitalID string, ids, hns []string) ([]string, []string, error) {
+	var takenIDs, takenHNs []string
+	db := r.db.WithContext(ctx).Model(&models.Patient{}).Session(&gorm.Session{})
+	if err := db.Where("id IN ?", ids).Pluck("id", &takenIDs).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := db.Where("hospital_id = ? AND patient_hn IN ?", hospitalID, hns).Pluck("patient_hn", &takenHNs).Error; err != nil {
+		return nil, nil, err
+	}
+	return takenIDs, takenHNs, nil
+}
+
+func (r gormPatients) Each(ctx context.Context, hospitalID string, filter PatientFilter, batchSize int, fn func([]models.Patient) error) error {
+	var batch []models.Patient
+	query := filter.apply(r.db.WithContext(ctx).Where("hospital_id = ?", hospitalID)).Order("id")
+	return query.FindInBatches(&batch, batchSize, func(*gorm.DB, int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (f PatientFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.NationalID != "" {
+		query = query.Where("national_id = ?", f.NationalID)
+	}
+	if f.PassportID != "" {
+		query = query.Where("passport_id = ?", f.PassportID)
+	}
+	if f.FirstName != "" {
+		query = query.Where("first_name_th LIKE ? OR first_name_en LIKE ?", "%"+f.FirstName+"%", "%"+f.FirstName+"%")
+	}
+	if f.MiddleName != "" {
+		query = query.Where("middle_name_th = ? OR middle_name_en = ?", f.MiddleName, f.MiddleName)
+	}
+	if f.LastName != "" {
+		query = query.Where("last_name_th LIKE ? OR last_name_en LIKE ?", "%"+f.LastName+"%", "%"+f.LastName+"%")
+	}
+	if f.DateOfBirth != "" {
+		query = query.Where("date_of_birth = ?", f.DateOfBirth)
+	}
+	if f.Email != "" {
+		query = query.Where("email = ?", f.Email)
+	}
+	if f.Consent != "" {
+		query = query.Scopes(pdpa.WithConsent(f.Consent))
+	}
+	return query
+}
+
+type gormStaff struct{ db *gorm.DB }
+
+func NewStaffRepository(db *gorm.DB) StaffRepository { return gormStaff{db} }
+
+func (r gormStaff) Create(ctx context.Context, staff *models.Staff) error {
+	return Duplicate(r.db, r.db.WithContext(ctx).Create(staff).Error)
+}
+
+func (r gormStaff) FindByCredentials(ctx context.Context, username, password, hospitalID string) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Preload("Hospital").
+		Where("username = ? AND password = ? AND hospital_id = ?", username, password, hospitalID).
+		First(&staff).Error
+	return staff, notFound(err)
+}
+
+func (r gormStaff) SetRole(ctx context.Context, hospitalID, username, role string) error {
+	result := r.db.WithContext(ctx).Model(&models.Staff{}).
+		Where("username = ? AND hospital_id = ?", username, hospitalID).
+		Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormHospitals struct{ db *gorm.DB }
+
+func NewHospitalRepository(db *gorm.DB) HospitalRepository { return gormHospitals{db} }
+
+func (r gormHospitals) Get(ctx context.Context, id string) (models.Hospital, error) {
+	var hospital models.Hospital
+	err := r.db.WithContext(ctx).First(&hospital, "id = ?", id).Error
+	return hospital, notFound(err)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Duplicate reports a unique constraint violation, in the driver's own error
+// type, as ErrDuplicate.
+func Duplicate(db *gorm.DB, err error) error {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok && err != nil &&
+		errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+	return err
+}
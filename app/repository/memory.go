@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"example.com/myapp/app/model"
+)
+
+// Memory is an in-memory store for unit tests. Its Patients, Staff and
+// Hospitals repositories share one store, which is safe for concurrent use
+// so tests using it can run in parallel. Related records (allergies,
+// coverages) are returned as they were stored.
+type Memory struct {
+	mu        sync.Mutex
+	patients  map[string]models.Patient
+	staff     []models.Staff
+	hospitals map[string]models.Hospital
+	consents  []models.Consent
+}
+
+func NewMemory() *Memory {
+	return &Memory{patients: map[string]models.Patient{}, hospitals: map[string]models.Hospital{}}
+}
+
+// AddHospital stores a hospital, for setting up tests.
+func (m *Memory) AddHospital(hospital models.Hospital) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hospitals[hospital.ID] = hospital
+}
+
+// AddConsent stores a consent, for setting up tests of PatientFilter.Consent.
+func (m *Memory) AddConsent(consent models.Consent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consents = append(m.consents, consent)
+}
+
+func (m *Memory) Patients() PatientRepository   { return memoryPatients{m} }
+func (m *Memory) Staff() StaffRepository        { return memoryStaff{m} }
+func (m *Memory) Hospitals() HospitalRepository { return memoryHospitals{m} }
+
+type memoryPatients struct{ m *Memory }
+
+// withHospital returns p as the database would load it.
+func (m *Memory) withHospital(p models.Patient) models.Patient {
+	p.Hospital = m.hospitals[p.HospitalID]
+	return p
+}
+
+// sorted returns the hospital's patients matching filter in id order.
+func (m *Memory) sorted(hospitalID string, filter PatientFilter) []models.Patient {
+	patients := []models.Patient{}
+	for _, p := range m.patients {
+		if p.HospitalID == hospitalID && filter.matches(p) && m.consented(p, filter.Consent) {
+			patients = append(patients, m.withHospital(p))
+		}
+	}
+	slices.SortFunc(patients, func(a, b models.Patient) int { return cmp.Compare(a.ID, b.ID) })
+	return patients
+}
+
+// consented is the in-memory equivalent of pdpa.WithConsent.
+func (m *Memory) consented(p models.Patient, purpose string) bool {
+	return purpose == "" || slices.ContainsFunc(m.consents, func(c models.Consent) bool {
+		return c.PatientID == p.ID && c.HospitalID == p.HospitalID && c.Purpose == purpose && c.WithdrawnAt == nil
+	})
+}
+
+func (r memoryPatients) Get(_ context.Context, hospitalID, id string) (models.Patient, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	p, ok := r.m.patients[id]
+	if !ok || p.HospitalID != hospitalID {
+		return models.Patient{}, ErrNotFound
+	}
+	return r.m.withHospital(p), nil
+}
+
+func (r memoryPatients) Search(_ context.Context, hospitalID string, filter PatientFilter) ([]models.Patient, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.sorted(hospitalID, filter), nil
+}
+
+func (r memoryPatients) Create(ctx context.Context, patient *models.Patient) error {
+	return r.CreateAll(ctx, []models.Patient{*patient})
+}
+
+func (r memoryPatients) CreateAll(_ context.Context, patients []models.Patient) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ids, hns := map[string]bool{}, map[[2]string]bool{}
+	for _, p := range r.m.patients {
+		hns[[2]string{p.HospitalID, p.PatientHN}] = true
+	}
+	for _, p := range patients {
+		hn := [2]string{p.HospitalID, p.PatientHN}
+		if _, ok := r.m.patients[p.ID]; ok || ids[p.ID] || hns[hn] {
+			return ErrDuplicate
+		}
+		ids[p.ID], hns[hn] = true, true
+	}
+	for _, p := range patients {
+		p.Hospital = models.Hospital{}
+		r.m.patients[p.ID] = p
+	}
+	return nil
+}
+
+func (r memoryPatients) Taken(_ context.Context, hospitalID string, ids, hns []string) ([]string, []string, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var takenIDs, takenHNs []string
+	for _, p := range r.m.patients {
+		if slices.Contains(ids, p.ID) {
+			takenIDs = append(takenIDs, p.ID)
+		}
+		if p.HospitalID == hospitalID && slices.Contains(hns, p.PatientHN) {
+			takenHNs = append(takenHNs, p.PatientHN)
+		}
+	}
+	return takenIDs, takenHNs, nil
+}
+
+func (r memoryPatients) Each(_ context.Context, hospitalID string, filter PatientFilter, batchSize int, fn func([]models.Patient) error) error {
+	r.m.mu.Lock()
+	patients := r.m.sorted(hospitalID, filter)
+	r.m.mu.Unlock()
+	for batch := range slices.Chunk(patients, batchSize) {
+		for i := range batch {
+			batch[i].Hospital = models.Hospital{}
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryStaff struct{ m *Memory }
+
+func (r memoryStaff) Create(_ context.Context, staff *models.Staff) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if slices.ContainsFunc(r.m.staff, func(s models.Staff) bool { return s.Username == staff.Username }) {
+		return ErrDuplicate
+	}
+	staff.ID = uint(len(r.m.staff) + 1)
+	r.m.staff = append(r.m.staff, *staff)
+	return nil
+}
+
+func (r memoryStaff) FindByCredentials(_ context.Context, username, password, hospitalID string) (models.Staff, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, s := range r.m.staff {
+		if s.Username == username && s.Password == password && s.HospitalID == hospitalID {
+			s.Hospital = r.m.hospitals[s.HospitalID]
+			return s, nil
+		}
+	}
+	return models.Staff{}, ErrNotFound
+}
+
+func (r memoryStaff) SetRole(_ context.Context, hospitalID, username, role string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for i, s := range r.m.staff {
+		if s.Username == username && s.HospitalID == hospitalID {
+			r.m.staff[i].Role = role
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type memoryHospitals struct{ m *Memory }
+
+func (r memoryHospitals) Get(_ context.Context, id string) (models.Hospital, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	hospital, ok := r.m.hospitals[id]
+	if !ok {
+		return models.Hospital{}, ErrNotFound
+	}
+	return hospital, nil
+}
@@ -0,0 +1,76 @@
+// Package repository holds the data access used by handlers, behind
+// interfaces so that handlers receive their storage instead of reaching for
+// database.DB, and unit tests can run against the in-memory Memory store.
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"example.com/myapp/app/model"
+)
+
+var (
+	ErrNotFound  = errors.New("repository: not found")
+	ErrDuplicate = errors.New("repository: already exists")
+)
+
+type PatientRepository interface {
+	// Get returns a patient of the hospital with its hospital, active
+	// allergies and coverages loaded.
+	Get(ctx context.Context, hospitalID, id string) (models.Patient, error)
+	// Search lists the hospital's patients matching filter, loaded as Get.
+	Search(ctx context.Context, hospitalID string, filter PatientFilter) ([]models.Patient, error)
+	Create(ctx context.Context, patient *models.Patient) error
+	// CreateAll stores patients in one transaction: all of them or none.
+	CreateAll(ctx context.Context, patients []models.Patient) error
+	// Taken reports which of ids are in use in any hospital and which of
+	// hns are in use in the hospital.
+	Taken(ctx context.Context, hospitalID string, ids, hns []string) (takenIDs, takenHNs []string, err error)
+	// Each passes the hospital's patients matching filter to fn in id
+	// order, at most batchSize at a time, without their related records.
+	Each(ctx context.Context, hospitalID string, filter PatientFilter, batchSize int, fn func([]models.Patient) error) error
+}
+
+type StaffRepository interface {
+	Create(ctx context.Context, staff *models.Staff) error
+	// FindByCredentials returns the staff member with the hospital loaded.
+	FindByCredentials(ctx context.Context, username, password, hospitalID string) (models.Staff, error)
+	// SetRole changes the role of a staff member of the hospital. It
+	// returns ErrNotFound when the hospital has no such username.
+	SetRole(ctx context.Context, hospitalID, username, role string) error
+}
+
+type HospitalRepository interface {
+	Get(ctx context.Context, id string) (models.Hospital, error)
+}
+
+// PatientFilter holds patient search criteria. Empty fields match
+// everything; names match on any part of the Thai or English name.
+type PatientFilter struct {
+	NationalID  string `json:"national_id" form:"national_id"`
+	PassportID  string `json:"passport_id" form:"passport_id"`
+	FirstName   string `json:"first_name" form:"first_name"`
+	MiddleName  string `json:"middle_name" form:"middle_name"`
+	LastName    string `json:"last_name" form:"last_name"`
+	DateOfBirth string `json:"date_of_birth" form:"date_of_birth"`
+	Email       string `json:"email" form:"email"`
+	// Consent limits the patients to those with consent in force for this
+	// purpose. It is set by the server, never from the query string.
+	Consent string `json:"consent,omitempty" form:"-"`
+}
+
+// matches is the in-memory equivalent of the filter's SQL.
+func (f PatientFilter) matches(p models.Patient) bool {
+	either := func(th, en, part string) bool {
+		return part == "" || strings.Contains(th, part) || strings.Contains(en, part)
+	}
+	return (f.NationalID == "" || p.NationalID == f.NationalID) &&
+		(f.PassportID == "" || p.PassportID == f.PassportID) &&
+		either(p.FirstNameTH, p.FirstNameEN, f.FirstName) &&
+		(f.MiddleName == "" || p.MiddleNameTH == f.MiddleName || p.MiddleNameEN == f.MiddleName) &&
+		either(p.LastNameTH, p.LastNameEN, f.LastName) &&
+		(f.DateOfBirth == "" || p.DateOfBirth.Format("2006-01-02") == f.DateOfBirth) &&
+		(f.Email == "" || p.Email == f.Email)
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/model"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type stores struct {
+	patients  PatientRepository
+	staff     StaffRepository
+	hospitals HospitalRepository
+	// addConsent stores a consent the way pdpa does
+	addConsent func(models.Consent)
+}
+
+// backends returns fresh GORM and in-memory stores holding the same
+// hospitals, so every test checks that the fake behaves like the database.
+func backends() map[string]func() stores {
+	hospitals := []models.Hospital{{ID: "1", Name: "BKK Hospital"}, {ID: "2", Name: "Bangna Medical"}}
+	return map[string]func() stores{
+		"GORM": func() stores {
+			db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Staff{}, &models.Allergy{}, &models.Coverage{},
+				&models.Consent{})
+			db.Exec("CREATE UNIQUE INDEX idx_patients_hospital_hn ON patients (hospital_id, patient_hn)")
+			db.Create(&hospitals)
+			return stores{NewPatientRepository(db), NewStaffRepository(db), NewHospitalRepository(db),
+				func(c models.Consent) { db.Create(&c) }}
+		},
+		"Memory": func() stores {
+			m := NewMemory()
+			for _, h := range hospitals {
+				m.AddHospital(h)
+			}
+			return stores{m.Patients(), m.Staff(), m.Hospitals(), m.AddConsent}
+		},
+	}
+}
+
+func TestPatientRepository(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range backends() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := open()
+			assert.NoError(t, s.patients.Create(ctx, &models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1",
+				FirstNameEN: "Somchai", NationalID: "1100700000001",
+				DateOfBirth: time.Date(1980, 5, 1, 0, 0, 0, 0, time.UTC)}))
+			assert.NoError(t, s.patients.CreateAll(ctx, []models.Patient{
+				{ID: "002", PatientHN: "HN002", HospitalID: "1", FirstNameTH: "มาลี"},
+				{ID: "003", PatientHN: "HN001", HospitalID: "2", FirstNameEN: "Somsak"},
+			}))
+
+			t.Run("Get Success", func(t *testing.T) {
+				p, err := s.patients.Get(ctx, "1", "001")
+				assert.NoError(t, err)
+				assert.Equal(t, "BKK Hospital", p.Hospital.Name)
+			})
+
+			t.Run("Get Fail Case Other Hospital", func(t *testing.T) {
+				_, err := s.patients.Get(ctx, "2", "001")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("Search Success", func(t *testing.T) {
+				all, err := s.patients.Search(ctx, "1", PatientFilter{})
+				assert.NoError(t, err)
+				assert.Len(t, all, 2)
+
+				found, _ := s.patients.Search(ctx, "1", PatientFilter{FirstName: "Som"})
+				assert.Len(t, found, 1)
+				found, _ = s.patients.Search(ctx, "1", PatientFilter{FirstName: "มา"})
+				assert.Len(t, found, 1)
+				found, _ = s.patients.Search(ctx, "1", PatientFilter{NationalID: "1100700000001", FirstName: "Somchai"})
+				assert.Len(t, found, 1)
+				found, _ = s.patients.Search(ctx, "1", PatientFilter{NationalID: "0000000000000"})
+				assert.NotNil(t, found)
+				assert.Empty(t, found)
+			})
+
+			t.Run("Search With Consent Success", func(t *testing.T) {
+				withdrawn := time.Now()
+				s.addConsent(models.Consent{PatientID: "001", HospitalID: "1", Purpose: models.ConsentResearch,
+					Version: "1", Channel: "paper", WithdrawnAt: &withdrawn})
+				s.addConsent(models.Consent{PatientID: "002", HospitalID: "1", Purpose: models.ConsentResearch,
+					Version: "1", Channel: "paper"})
+				s.addConsent(models.Consent{PatientID: "001", HospitalID: "1", Purpose: models.ConsentMarketing,
+					Version: "1", Channel: "paper"})
+
+				found, err := s.patients.Search(ctx, "1", PatientFilter{Consent: models.ConsentResearch})
+				assert.NoError(t, err)
+				assert.Len(t, found, 1)
+				assert.Equal(t, "002", found[0].ID)
+			})
+
+			t.Run("CreateAll Fail Case Duplicate Writes Nothing", func(t *testing.T) {
+				err := s.patients.CreateAll(ctx, []models.Patient{
+					{ID: "004", PatientHN: "HN004", HospitalID: "1"},
+					{ID: "005", PatientHN: "HN002", HospitalID: "1"},
+				})
+				assert.ErrorIs(t, err, ErrDuplicate)
+				_, err = s.patients.Get(ctx, "1", "004")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("Taken Success", func(t *testing.T) {
+				ids, hns, err := s.patients.Taken(ctx, "1", []string{"003", "009"}, []string{"HN001", "HN009"})
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"003"}, ids)
+				assert.Equal(t, []string{"HN001"}, hns)
+			})
+
+			t.Run("Each Success", func(t *testing.T) {
+				var batches [][]string
+				err := s.patients.Each(ctx, "1", PatientFilter{}, 1, func(batch []models.Patient) error {
+					var ids []string
+					for _, p := range batch {
+						ids = append(ids, p.ID)
+					}
+					batches = append(batches, ids)
+					return nil
+				})
+				assert.NoError(t, err)
+				assert.Equal(t, [][]string{{"001"}, {"002"}}, batches)
+			})
+		})
+	}
+}
+
+func TestStaffRepository(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range backends() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := open()
+			staff := models.Staff{Username: "nurse01", Password: "secret", HospitalID: "1", Role: models.RoleNurse}
+			assert.NoError(t, s.staff.Create(ctx, &staff))
+			assert.NotZero(t, staff.ID)
+
+			t.Run("Create Fail Case Duplicate Username", func(t *testing.T) {
+				err := s.staff.Create(ctx, &models.Staff{Username: "nurse01", Password: "x", HospitalID: "2"})
+				assert.ErrorIs(t, err, ErrDuplicate)
+			})
+
+			t.Run("FindByCredentials Success", func(t *testing.T) {
+				found, err := s.staff.FindByCredentials(ctx, "nurse01", "secret", "1")
+				assert.NoError(t, err)
+				assert.Equal(t, staff.ID, found.ID)
+				assert.Equal(t, "BKK Hospital", found.Hospital.Name)
+			})
+
+			t.Run("SetRole Success", func(t *testing.T) {
+				assert.NoError(t, s.staff.SetRole(ctx, "1", "nurse01", models.RoleAdmin))
+				found, _ := s.staff.FindByCredentials(ctx, "nurse01", "secret", "1")
+				assert.Equal(t, models.RoleAdmin, found.Role)
+				assert.NoError(t, s.staff.SetRole(ctx, "1", "nurse01", models.RoleNurse))
+			})
+
+			t.Run("SetRole Fail Case Other Hospital", func(t *testing.T) {
+				assert.ErrorIs(t, s.staff.SetRole(ctx, "2", "nurse01", models.RoleAdmin), ErrNotFound)
+			})
+
+			t.Run("FindByCredentials Fail Case Wrong Password", func(t *testing.T) {
+				_, err := s.staff.FindByCredentials(ctx, "nurse01", "guess", "1")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("Hospital Get", func(t *testing.T) {
+				h, err := s.hospitals.Get(ctx, "2")
+				assert.NoError(t, err)
+				assert.Equal(t, "Bangna Medical", h.Name)
+				_, err = s.hospitals.Get(ctx, "9")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"strings"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+)
+
+func invalid(field, th, en string) *apierror.FieldError {
+	return &apierror.FieldError{Field: field, Message: apierror.Text{TH: th, EN: en}}
+}
+
+// ValidatePatient applies the rules every new patient must pass, whether
+// entered through the patient API, the FHIR API or a bulk import.
+func ValidatePatient(p models.Patient) *apierror.FieldError {
+	switch {
+	case strings.TrimSpace(p.ID) == "":
+		return invalid("id", "กรุณาระบุรหัสคนไข้", "id is required")
+	case strings.TrimSpace(p.PatientHN) == "":
+		return invalid("patient_hn", "กรุณาระบุ HN", "patient_hn is required")
+	case strings.TrimSpace(p.HospitalID) == "":
+		return invalid("hospital_id", "กรุณาระบุรหัสโรงพยาบาล", "hospital_id is required")
+	}
+	if p.NationalID != "" && (len(p.NationalID) != 13 || strings.Trim(p.NationalID, "0123456789") != "") {
+		return invalid("national_id", "เลขบัตรประชาชนต้องเป็นตัวเลข 13 หลัก", "National ID must be 13 digits")
+	}
+	if p.PassportID != "" && len(p.PassportID) > 20 {
+		return invalid("passport_id", "เลขหนังสือเดินทางยาวเกิน 20 ตัวอักษร", "Passport number is longer than 20 characters")
+	}
+	switch p.Gender {
+	case "", "M", "F", "O":
+	default:
+		return invalid("gender", "เพศต้องเป็น M, F หรือ O", "Gender must be M, F or O")
+	}
+	if p.Email != "" && !strings.Contains(p.Email, "@") {
+		return invalid("email", "รูปแบบอีเมลไม่ถูกต้อง", "Invalid email address")
+	}
+	return nil
+}
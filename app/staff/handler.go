@@ -1,19 +1,36 @@
 package staff
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
+	"slices"
 	"time"
 
-	"example.com/myapp/app/database"
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/metrics"
 	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
+// Handler serves the staff account endpoints.
+type Handler struct {
+	Staff repository.StaffRepository
+	// JWTKey signs the tokens issued at login.
+	JWTKey []byte
+}
+
+func NewHandler(db *gorm.DB, jwtKey []byte) *Handler {
+	return &Handler{Staff: repository.NewStaffRepository(db), JWTKey: jwtKey}
+}
 
-func StaffCreate(c *gin.Context) {
+// StaffCreate registers an account. The endpoint is public, so new accounts
+// get no role; an admin of the hospital assigns one with AssignRole.
+func (h *Handler) StaffCreate(c *gin.Context) {
 	var input struct {
 		Username   string `json:"username" binding:"required"`
 		Password   string `json:"password" binding:"required"`
@@ -22,7 +39,7 @@ func StaffCreate(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณากรอกข้อมูลให้ครบถ้วน"})
+		apierror.Respond(c, apierror.ErrIncomplete)
 		return
 	}
 
@@ -33,15 +50,72 @@ func StaffCreate(c *gin.Context) {
 		FullName:   input.FullName,
 	}
 
-	if err := database.DB.Create(&newStaff).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้างบัญชีได้ หรือ Username นี้มีอยู่แล้ว"})
+	err := h.Staff.Create(c.Request.Context(), &newStaff)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		apierror.Respond(c, apierror.New(apierror.Conflict, "Username นี้มีอยู่แล้ว", "The username is already taken"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้างบัญชีได้", "Could not create the account").Wrap(err))
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "สร้างบัญชี Staff สำเร็จ", "username": newStaff.Username})
 }
 
-func StaffLogin(c *gin.Context) {
+// AssignRole sets the role of a staff member of the caller's hospital. Only
+// an admin can do it, and the new role is in the token from the staff
+// member's next login.
+func (h *Handler) AssignRole(c *gin.Context) {
+	role, _ := c.Get("role")
+	if role != models.RoleAdmin {
+		apierror.Respond(c, apierror.New(apierror.Forbidden, "เฉพาะผู้ดูแลระบบเท่านั้นที่กำหนดตำแหน่งได้", "Only admins can assign roles"))
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	if !slices.Contains(models.Roles, input.Role) {
+		apierror.Respond(c, apierror.Invalid("role", "ตำแหน่งต้องเป็น admin, doctor, dentist, nurse หรือ pharmacist", "Role must be admin, doctor, dentist, nurse or pharmacist"))
+		return
+	}
+
+	username := c.Param("username")
+	err := h.Staff.SetRole(c.Request.Context(), staffHospital, username, input.Role)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		apierror.Respond(c, apierror.New(apierror.NotFound, "ไม่พบเจ้าหน้าที่ที่ระบุ", "Staff member not found"))
+		return
+	case err != nil:
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถกำหนดตำแหน่งได้", "Could not assign the role").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "กำหนดตำแหน่งสำเร็จ", "username": username, "role": input.Role})
+}
+
+// RoleCommand runs the staff role subcommand, which assigns a role from the
+// command line; it is how a hospital's first admin is made.
+func RoleCommand(db *gorm.DB, args []string) error {
+	if len(args) != 4 || args[0] != "role" {
+		return errors.New("usage: staff role <hospital_id> <username> <role>")
+	}
+	if !slices.Contains(models.Roles, args[3]) {
+		return fmt.Errorf("unknown role %q", args[3])
+	}
+	return repository.NewStaffRepository(db).SetRole(context.Background(), args[1], args[2], args[3])
+}
+
+func (h *Handler) StaffLogin(c *gin.Context) {
 	var credentials struct {
 		Username   string `json:"username" binding:"required"`
 		Password   string `json:"password" binding:"required"`
@@ -49,32 +123,34 @@ func StaffLogin(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&credentials); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ข้อมูลไม่ถูกต้อง"})
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ข้อมูลไม่ถูกต้อง", "Invalid input"))
 		return
 	}
 
-	var staff models.Staff
-	result := database.DB.Preload("Hospital").
-		Where("username = ? AND password = ? AND hospital_id = ?",
-			credentials.Username, credentials.Password, credentials.HospitalID).First(&staff)
-
-	if result.Error != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Username, Password หรือ HospitalID ไม่ถูกต้อง"})
+	staff, err := h.Staff.FindByCredentials(c.Request.Context(),
+		credentials.Username, credentials.Password, credentials.HospitalID)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
+		apierror.Respond(c, apierror.New(apierror.Unauthorized, "Username, Password หรือ HospitalID ไม่ถูกต้อง", "Invalid username, password or hospital ID"))
 		return
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username":    staff.Username,
+		"staff_id":    staff.ID,
+		"role":        staff.Role,
 		"hospital_id": staff.HospitalID,
 		"exp":         time.Now().Add(time.Hour * 24).Unix(), // Expire in 24 hr.
 	})
 
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := token.SignedString(h.JWTKey)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ไม่สามารถสร้าง Token ได้"})
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถสร้าง Token ได้", "Could not issue a token").Wrap(err))
 		return
 	}
 
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Login successful",
 		"token":   tokenString,
@@ -1,37 +1,38 @@
 package staff
 
 import (
-	// "os"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
-	// "time"
+	"time"
 
-	"example.com/myapp/app/database"
+	"example.com/myapp/app/middleware"
 	"example.com/myapp/app/model"
+	"example.com/myapp/app/repository"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-	// "github.com/golang-jwt/jwt/v5"
 )
 
-// SetupTestDB
-func SetupTestDB() {
-	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.Staff{})
-	database.DB = db
+// setupHandler gives each test its own in-memory store, so tests can run
+// in parallel.
+func setupHandler() (*Handler, repository.StaffRepository) {
+	store := repository.NewMemory().Staff()
+	return &Handler{Staff: store}, store
 }
 
 func TestStaffCreate(t *testing.T) {
-	SetupTestDB()
+	t.Parallel()
+	h, store := setupHandler()
 	gin.SetMode(gin.TestMode)
 
 	t.Run("Create Staff Success", func(t *testing.T) {
 		r := gin.Default()
-		r.POST("/staff/add", StaffCreate)
+		r.POST("/staff/add", h.StaffCreate)
 
 		staffData := map[string]interface{}{
 			"username":    "admin01",
@@ -53,7 +54,7 @@ func TestStaffCreate(t *testing.T) {
 
 	t.Run("Create Staff Fail Case Incomplete Data", func(t *testing.T) {
 		r := gin.Default()
-		r.POST("/staff/add", StaffCreate)
+		r.POST("/staff/add", h.StaffCreate)
 
 		staffData := map[string]interface{}{
 			"username": "admin01",
@@ -73,11 +74,11 @@ func TestStaffCreate(t *testing.T) {
 
 	t.Run("Create Staff Fail Case Duplicate", func(t *testing.T) {
 		// mock Staff DB
-		database.DB.Create(&models.Staff{
+		store.Create(context.Background(), &models.Staff{
 			Username: "admin01", Password: "password123", HospitalID: "01",
 		})
 		r := gin.Default()
-		r.POST("/staff/add", StaffCreate)
+		r.POST("/staff/add", h.StaffCreate)
 
 		staffData := map[string]interface{}{
 			"username":    "admin01",
@@ -93,21 +94,23 @@ func TestStaffCreate(t *testing.T) {
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
-		assert.Contains(t, w.Body.String(), "ไม่สามารถสร้างบัญชีได้ หรือ Username นี้มีอยู่แล้ว")
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"CONFLICT"`)
+		assert.Contains(t, w.Body.String(), "Username นี้มีอยู่แล้ว")
 	})
 }
 
 func TestStaffLogin(t *testing.T) {
-	SetupTestDB()
+	t.Parallel()
+	h, store := setupHandler()
 	gin.SetMode(gin.TestMode)
 
-	database.DB.Create(&models.Staff{
+	store.Create(context.Background(), &models.Staff{
 		Username: "admin01", Password: "password123", HospitalID: "01",
 	})
 	t.Run("Login Success", func(t *testing.T) {
 		r := gin.Default()
-		r.POST("/staff/login", StaffLogin)
+		r.POST("/staff/login", h.StaffLogin)
 
 		staffData := map[string]interface{}{
 			"username":    "admin01",
@@ -128,7 +131,7 @@ func TestStaffLogin(t *testing.T) {
 
 	t.Run("Login Fail", func(t *testing.T) {
 		r := gin.Default()
-		r.POST("/staff/login", StaffLogin)
+		r.POST("/staff/login", h.StaffLogin)
 
 		staffData := map[string]interface{}{
 			"username":    "admin01",
@@ -149,7 +152,7 @@ func TestStaffLogin(t *testing.T) {
 
 	t.Run("Login Fail Case Incomplete Data", func(t *testing.T) {
 		r := gin.Default()
-		r.POST("/staff/login", StaffLogin)
+		r.POST("/staff/login", h.StaffLogin)
 
 		staffData := map[string]interface{}{
 			"username": "admin01",
@@ -167,3 +170,92 @@ func TestStaffLogin(t *testing.T) {
 	})
 
 }
+
+func TestStaffCreateRole(t *testing.T) {
+	t.Parallel()
+	h, store := setupHandler()
+	gin.SetMode(gin.TestMode)
+
+	t.Run("Create Staff Ignores Role", func(t *testing.T) {
+		r := gin.Default()
+		r.POST("/staff/add", h.StaffCreate)
+
+		staffData := map[string]interface{}{
+			"username":    "doctor01",
+			"password":    "password123",
+			"hospital_id": "01",
+			"role":        "admin",
+		}
+		body, _ := json.Marshal(staffData)
+
+		req, _ := http.NewRequest("POST", "/staff/add", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		staff, _ := store.FindByCredentials(context.Background(), "doctor01", "password123", "01")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, staff.Role)
+	})
+}
+
+func generateTestToken(HospitalID string, role string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"staff_id":    7,
+		"role":        role,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func TestAssignRole(t *testing.T) {
+	t.Parallel()
+	h, store := setupHandler()
+	store.Create(context.Background(), &models.Staff{Username: "doctor01", Password: "password123", HospitalID: "01"})
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/staff/role/:username", h.AssignRole)
+
+	assign := func(username, hospitalID, role, newRole string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"role": newRole})
+		req, _ := http.NewRequest("POST", "/staff/role/"+username, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID, role))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	roleOf := func() string {
+		staff, _ := store.FindByCredentials(context.Background(), "doctor01", "password123", "01")
+		return staff.Role
+	}
+
+	t.Run("Assign Role Fail Case Not Admin", func(t *testing.T) {
+		w := assign("doctor01", "01", models.RoleDoctor, models.RoleAdmin)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, roleOf())
+	})
+
+	t.Run("Assign Role Fail Case Other Hospital", func(t *testing.T) {
+		w := assign("doctor01", "02", models.RoleAdmin, models.RoleDoctor)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, roleOf())
+	})
+
+	t.Run("Assign Role Fail Case Invalid Role", func(t *testing.T) {
+		w := assign("doctor01", "01", models.RoleAdmin, "superuser")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Assign Role Success", func(t *testing.T) {
+		w := assign("doctor01", "01", models.RoleAdmin, models.RoleDoctor)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, models.RoleDoctor, roleOf())
+	})
+}
@@ -0,0 +1,69 @@
+// Package tracing sets up OpenTelemetry tracing: a span for each request,
+// continued from an upstream traceparent header, and a child span for each
+// database statement run with the request's context.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Exporters, named as in OTEL_TRACES_EXPORTER.
+const (
+	ExporterNone    = "none"
+	ExporterOTLP    = "otlp"
+	ExporterConsole = "console"
+)
+
+var Exporters = []string{ExporterNone, ExporterOTLP, ExporterConsole}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. Spans go to an OTLP/HTTP collector at endpoint (the
+// exporter's default, localhost:4318, if empty), to stdout for console, or
+// nowhere for none, in which case spans are still created so trace IDs
+// reach the logs. The returned function flushes buffered spans and must be
+// called before exit.
+func Setup(exporter, endpoint, serviceName string) (func(context.Context) error, error) {
+	var opts []sdktrace.TracerProviderOption
+	switch exporter {
+	case ExporterNone:
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		exp, err := otlptracehttp.New(context.Background(), clientOpts...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	case ExporterConsole:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(append(opts, sdktrace.WithResource(res))...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupRecorder installs a tracer provider that keeps finished spans in
+// memory, for the duration of the test.
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(ExporterNone, "", "test")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup("jaeger", "", "test")
+	assert.ErrorContains(t, err, "unknown exporter")
+}
+
+func TestTracing(t *testing.T) {
+	recorder := setupRecorder(t)
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, InstrumentDB(db))
+	db.AutoMigrate(&models.Patient{})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1", NationalID: "1100700000001"})
+	assert.Empty(t, recorder.Ended(), "statements outside a request are not traced")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(otelgin.Middleware("test"))
+	r.GET("/patient/search/:id", func(c *gin.Context) {
+		var patient models.Patient
+		db.WithContext(c.Request.Context()).Where("national_id = ?", "1100700000001").First(&patient)
+		c.JSON(http.StatusOK, patient)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/patient/search/001", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	query, server := spans[0], spans[1]
+	assert.Equal(t, "GET /patient/search/:id", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String(), "continues the upstream trace")
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+
+	assert.Equal(t, "db.query patients", query.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), query.Parent().SpanID())
+	assert.Equal(t, "patients", attr(query, "db.collection.name"))
+	assert.Contains(t, attr(query, "db.query.text"), "national_id = ?")
+	assert.NotContains(t, attr(query, "db.query.text"), "1100700000001")
+}
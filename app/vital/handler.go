@@ -0,0 +1,272 @@
+package vital
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Handler serves the vital sign and triage endpoints.
+type Handler struct {
+	DB *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler { return &Handler{DB: db} }
+
+func (h *Handler) RecordVitals(c *gin.Context) {
+	var input struct {
+		EncounterID uint       `json:"encounter_id" binding:"required"`
+		MeasuredAt  *time.Time `json:"measured_at"`
+		Measurements
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.EncounterID, staffHospital).
+		First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return
+	}
+
+	var vitalSign models.VitalSign
+	if invalid := Normalize(input.Measurements, &vitalSign); invalid != nil {
+		apierror.Respond(c, invalid)
+		return
+	}
+
+	username, _ := c.Get("username")
+	vitalSign.RecordedBy, _ = username.(string)
+	vitalSign.EncounterID = encounter.ID
+	vitalSign.PatientID = encounter.PatientID
+	vitalSign.HospitalID = staffHospital
+	vitalSign.MeasuredAt = time.Now()
+	if input.MeasuredAt != nil {
+		vitalSign.MeasuredAt = *input.MeasuredAt
+	}
+	vitalSign.Flags = AbnormalFlags(vitalSign)
+
+	if err := h.DB.WithContext(c.Request.Context()).Create(&vitalSign).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกสัญญาณชีพได้", "Could not save the vital signs").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, vitalSign)
+}
+
+func (h *Handler) GetVitals(c *gin.Context) {
+	patientID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ?", patientID, staffHospital)
+	if encounterID := c.Query("encounter_id"); encounterID != "" {
+		query = query.Where("encounter_id = ?", encounterID)
+	}
+
+	var vitals []models.VitalSign
+	if err := query.Order("measured_at DESC").Find(&vitals).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลสัญญาณชีพได้", "Could not load vital signs").Wrap(err))
+		return
+	}
+	c.JSON(http.StatusOK, vitals)
+}
+
+var trendMeasures = []string{
+	"systolic", "diastolic", "pulse", "temperature", "spo2",
+	"respiratory_rate", "weight", "height", "bmi", "pain_score",
+}
+
+type trendPoint struct {
+	MeasuredAt  time.Time `json:"measured_at"`
+	EncounterID uint      `json:"encounter_id"`
+	Value       float64   `json:"value"`
+}
+
+// GetVitalTrend returns a time series per measurement for a patient, oldest
+// first, optionally restricted to one measurement and a date range.
+func (h *Handler) GetVitalTrend(c *gin.Context) {
+	patientID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var input struct {
+		Measure string `form:"measure"`
+		From    string `form:"from"`
+		To      string `form:"to"`
+	}
+	if err := c.ShouldBindQuery(&input); err != nil {
+		apierror.Respond(c, apierror.ErrInvalidInput)
+		return
+	}
+
+	if input.Measure != "" && !slices.Contains(trendMeasures, input.Measure) {
+		apierror.Respond(c, apierror.Invalid("measure", "ไม่รู้จักชนิดสัญญาณชีพ "+input.Measure, "Unknown measure "+input.Measure))
+		return
+	}
+
+	query := h.DB.WithContext(c.Request.Context()).Where("patient_id = ? AND hospital_id = ?", patientID, staffHospital)
+	if input.From != "" {
+		from, err := time.Parse("2006-01-02", input.From)
+		if err != nil {
+			apierror.Respond(c, apierror.ErrInvalidDate)
+			return
+		}
+		query = query.Where("measured_at >= ?", from)
+	}
+	if input.To != "" {
+		to, err := time.Parse("2006-01-02", input.To)
+		if err != nil {
+			apierror.Respond(c, apierror.ErrInvalidDate)
+			return
+		}
+		query = query.Where("measured_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	var vitals []models.VitalSign
+	if err := query.Order("measured_at ASC").Find(&vitals).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลสัญญาณชีพได้", "Could not load vital signs").Wrap(err))
+		return
+	}
+
+	series := map[string][]trendPoint{}
+	for _, v := range vitals {
+		values := map[string]*float64{
+			"systolic":         intValue(v.Systolic),
+			"diastolic":        intValue(v.Diastolic),
+			"pulse":            intValue(v.Pulse),
+			"temperature":      v.Temperature,
+			"spo2":             intValue(v.SpO2),
+			"respiratory_rate": intValue(v.RespiratoryRate),
+			"weight":           v.Weight,
+			"height":           v.Height,
+			"bmi":              v.BMI,
+			"pain_score":       intValue(v.PainScore),
+		}
+		for name, value := range values {
+			if value == nil || (input.Measure != "" && input.Measure != name) {
+				continue
+			}
+			series[name] = append(series[name], trendPoint{
+				MeasuredAt:  v.MeasuredAt,
+				EncounterID: v.EncounterID,
+				Value:       *value,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patient_id": patientID,
+		"series":     series,
+	})
+}
+
+func (h *Handler) AssignTriage(c *gin.Context) {
+	var input struct {
+		EncounterID    uint   `json:"encounter_id" binding:"required"`
+		System         string `json:"system"`
+		Level          int    `json:"level" binding:"required"`
+		ChiefComplaint string `json:"chief_complaint"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apierror.Respond(c, apierror.ErrIncomplete)
+		return
+	}
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+	if input.System == "" {
+		input.System = models.TriageMOPH
+	}
+	label := TriageLabel(input.System, input.Level)
+	if label == "" {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "ระดับ Triage ต้องเป็น ESI หรือ MOPH ระดับ 1-5", "Triage level must be ESI or MOPH level 1-5"))
+		return
+	}
+
+	var encounter models.Encounter
+	if err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND hospital_id = ?", input.EncounterID, staffHospital).
+		First(&encounter).Error; err != nil {
+		apierror.Respond(c, apierror.ErrEncounterNotFound)
+		return
+	}
+	if encounter.Type != models.EncounterER {
+		apierror.Respond(c, apierror.New(apierror.InvalidInput, "คัดแยกผู้ป่วยได้เฉพาะการรับบริการประเภท ER", "Triage applies only to ER encounters"))
+		return
+	}
+
+	username, _ := c.Get("username")
+	assessedBy, _ := username.(string)
+	triage := models.Triage{
+		EncounterID:    encounter.ID,
+		PatientID:      encounter.PatientID,
+		HospitalID:     staffHospital,
+		System:         input.System,
+		Level:          input.Level,
+		Label:          label,
+		ChiefComplaint: input.ChiefComplaint,
+		AssessedBy:     assessedBy,
+	}
+	if err := h.DB.WithContext(c.Request.Context()).Create(&triage).Error; err != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถบันทึกการคัดแยกผู้ป่วยได้", "Could not save the triage").Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, triage)
+}
+
+func (h *Handler) GetTriage(c *gin.Context) {
+	encounterID := c.Param("id")
+	val, _ := c.Get("hospital_id")
+	staffHospital, ok := val.(string)
+	if !ok {
+		apierror.Respond(c, apierror.ErrNoHospital)
+		return
+	}
+
+	var triages []models.Triage
+	result := h.DB.WithContext(c.Request.Context()).
+		Where("encounter_id = ? AND hospital_id = ?", encounterID, staffHospital).
+		Order("created_at DESC").
+		Find(&triages)
+
+	if result.Error != nil {
+		apierror.Respond(c, apierror.New(apierror.Internal, "ไม่สามารถดึงข้อมูลการคัดแยกผู้ป่วยได้", "Could not load triage records").Wrap(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, triages)
+}
+
+func intValue(v *int) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
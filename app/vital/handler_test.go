@@ -0,0 +1,190 @@
+package vital
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SetupTestDB
+func SetupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Hospital{}, &models.Patient{}, &models.Encounter{},
+		&models.VitalSign{}, &models.Triage{})
+	db.Create(&models.Hospital{ID: "1", Name: "Test Hospital"})
+	db.Create(&models.Patient{ID: "001", PatientHN: "HN001", HospitalID: "1"})
+	db.Create(&models.Encounter{ID: 1, PatientID: "001", HospitalID: "1", Type: "ER", StartedAt: time.Now()})
+	db.Create(&models.Encounter{ID: 2, PatientID: "001", HospitalID: "1", Type: "OPD", StartedAt: time.Now()})
+	return db
+}
+
+func generateTestToken(HospitalID string) string {
+	claims := jwt.MapClaims{
+		"hospital_id": HospitalID,
+		"username":    "testuser",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t, _ := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return t
+}
+
+func postJSON(r *gin.Engine, path string, data map[string]interface{}, hospitalID string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(data)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(hospitalID))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRecordVitals(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/vital/add", h.RecordVitals)
+
+	t.Run("Record Vitals Success With Unit Conversion", func(t *testing.T) {
+		w := postJSON(r, "/vital/add", map[string]interface{}{
+			"encounter_id":     1,
+			"systolic":         150,
+			"diastolic":        95,
+			"pulse":            110,
+			"temperature":      101.3,
+			"temperature_unit": "F",
+			"spo2":             97,
+			"weight":           70,
+			"height":           175,
+		}, "1")
+
+		var vitalSign models.VitalSign
+		json.Unmarshal(w.Body.Bytes(), &vitalSign)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, 38.5, *vitalSign.Temperature)
+		assert.Equal(t, 22.9, *vitalSign.BMI)
+		assert.ElementsMatch(t, []string{FlagHighBP, FlagTachycardia, FlagFever}, vitalSign.Flags)
+	})
+
+	t.Run("Record Vitals Fail Case Out Of Range", func(t *testing.T) {
+		w := postJSON(r, "/vital/add", map[string]interface{}{
+			"encounter_id": 1,
+			"spo2":         120,
+		}, "1")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "SpO2")
+	})
+
+	t.Run("Record Vitals Fail Case Unknown Unit", func(t *testing.T) {
+		w := postJSON(r, "/vital/add", map[string]interface{}{
+			"encounter_id": 1,
+			"weight":       70,
+			"weight_unit":  "stone",
+		}, "1")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Record Vitals Fail Case Other Hospital", func(t *testing.T) {
+		w := postJSON(r, "/vital/add", map[string]interface{}{
+			"encounter_id": 1,
+			"pulse":        80,
+		}, "2")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestVitalTrend(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	pulse1, pulse2, temp := 80, 95, 36.8
+	db.Create(&models.VitalSign{EncounterID: 1, PatientID: "001", HospitalID: "1",
+		Pulse: &pulse1, Temperature: &temp, MeasuredAt: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)})
+	db.Create(&models.VitalSign{EncounterID: 1, PatientID: "001", HospitalID: "1",
+		Pulse: &pulse2, MeasuredAt: time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)})
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.GET("/vital/trend/:id", h.GetVitalTrend)
+
+	t.Run("Trend Success", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/vital/trend/001?measure=pulse", nil)
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp struct {
+			Series map[string][]trendPoint `json:"series"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, resp.Series, 1)
+		assert.Equal(t, []float64{80, 95}, []float64{resp.Series["pulse"][0].Value, resp.Series["pulse"][1].Value})
+	})
+
+	t.Run("Trend Fail Case Unknown Measure", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/vital/trend/001?measure=glucose", nil)
+		req.Header.Set("Authorization", "Bearer "+generateTestToken("1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestAssignTriage(t *testing.T) {
+	db := SetupTestDB()
+	gin.SetMode(gin.TestMode)
+
+	h := NewHandler(db)
+	r := gin.Default()
+	r.Use(middleware.AuthMiddleware())
+	r.POST("/triage/add", h.AssignTriage)
+
+	t.Run("Assign Triage Success", func(t *testing.T) {
+		w := postJSON(r, "/triage/add", map[string]interface{}{
+			"encounter_id": 1, "system": "ESI", "level": 2, "chief_complaint": "chest pain",
+		}, "1")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), "Emergent")
+	})
+
+	t.Run("Assign Triage Fail Case Invalid Level", func(t *testing.T) {
+		w := postJSON(r, "/triage/add", map[string]interface{}{
+			"encounter_id": 1, "system": "ESI", "level": 6,
+		}, "1")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Assign Triage Fail Case Not ER", func(t *testing.T) {
+		w := postJSON(r, "/triage/add", map[string]interface{}{
+			"encounter_id": 2, "level": 3,
+		}, "1")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
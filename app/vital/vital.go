@@ -0,0 +1,186 @@
+package vital
+
+import (
+	"math"
+	"strings"
+
+	"example.com/myapp/app/apierror"
+	"example.com/myapp/app/model"
+)
+
+// Abnormal-value flags attached to a VitalSign. Thresholds follow common
+// adult reference ranges.
+const (
+	FlagHighBP       = "HIGH_BP"
+	FlagLowBP        = "LOW_BP"
+	FlagTachycardia  = "TACHYCARDIA"
+	FlagBradycardia  = "BRADYCARDIA"
+	FlagFever        = "FEVER"
+	FlagHypothermia  = "HYPOTHERMIA"
+	FlagLowSpO2      = "LOW_SPO2"
+	FlagCriticalSpO2 = "CRITICAL_SPO2"
+	FlagTachypnea    = "TACHYPNEA"
+	FlagBradypnea    = "BRADYPNEA"
+	FlagSeverePain   = "SEVERE_PAIN"
+	FlagUnderweight  = "UNDERWEIGHT"
+	FlagObese        = "OBESE"
+)
+
+type Measurements struct {
+	Systolic        *int     `json:"systolic"`
+	Diastolic       *int     `json:"diastolic"`
+	Pulse           *int     `json:"pulse"`
+	Temperature     *float64 `json:"temperature"`
+	TemperatureUnit string   `json:"temperature_unit"` // C (default) or F
+	SpO2            *int     `json:"spo2"`
+	RespiratoryRate *int     `json:"respiratory_rate"`
+	Weight          *float64 `json:"weight"`
+	WeightUnit      string   `json:"weight_unit"` // kg (default) or lb
+	Height          *float64 `json:"height"`
+	HeightUnit      string   `json:"height_unit"` // cm (default) or in
+	PainScore       *int     `json:"pain_score"`
+}
+
+// Normalize converts the measurements to metric units and fills v with them.
+// It rejects unknown units and values outside the physiologically possible
+// range, which almost always indicate a typo or the wrong unit.
+func Normalize(m Measurements, v *models.VitalSign) *apierror.Error {
+	if m.Systolic == nil && m.Diastolic == nil && m.Pulse == nil && m.Temperature == nil &&
+		m.SpO2 == nil && m.RespiratoryRate == nil && m.Weight == nil && m.Height == nil &&
+		m.PainScore == nil {
+		return apierror.New(apierror.InvalidInput, "ต้องระบุค่าสัญญาณชีพอย่างน้อยหนึ่งค่า", "At least one measurement is required")
+	}
+
+	if m.Temperature != nil {
+		t := *m.Temperature
+		switch strings.ToUpper(m.TemperatureUnit) {
+		case "", "C":
+		case "F":
+			t = (t - 32) * 5 / 9
+		default:
+			return apierror.Invalid("temperature_unit", "หน่วยอุณหภูมิต้องเป็น C หรือ F", "temperature_unit must be C or F")
+		}
+		t = round(t, 1)
+		v.Temperature = &t
+	}
+	if m.Weight != nil {
+		w := *m.Weight
+		switch strings.ToLower(m.WeightUnit) {
+		case "", "kg":
+		case "lb":
+			w = w * 0.45359237
+		default:
+			return apierror.Invalid("weight_unit", "หน่วยน้ำหนักต้องเป็น kg หรือ lb", "weight_unit must be kg or lb")
+		}
+		w = round(w, 2)
+		v.Weight = &w
+	}
+	if m.Height != nil {
+		h := *m.Height
+		switch strings.ToLower(m.HeightUnit) {
+		case "", "cm":
+		case "in":
+			h = h * 2.54
+		default:
+			return apierror.Invalid("height_unit", "หน่วยส่วนสูงต้องเป็น cm หรือ in", "height_unit must be cm or in")
+		}
+		h = round(h, 1)
+		v.Height = &h
+	}
+	v.Systolic = m.Systolic
+	v.Diastolic = m.Diastolic
+	v.Pulse = m.Pulse
+	v.SpO2 = m.SpO2
+	v.RespiratoryRate = m.RespiratoryRate
+	v.PainScore = m.PainScore
+
+	checks := []struct {
+		ok         bool
+		field      string
+		msg, msgEN string
+	}{
+		{intIn(v.Systolic, 40, 300), "systolic", "ความดันตัวบนต้องอยู่ระหว่าง 40-300 mmHg", "Systolic must be between 40-300 mmHg"},
+		{intIn(v.Diastolic, 20, 200), "diastolic", "ความดันตัวล่างต้องอยู่ระหว่าง 20-200 mmHg", "Diastolic must be between 20-200 mmHg"},
+		{intIn(v.Pulse, 20, 300), "pulse", "ชีพจรต้องอยู่ระหว่าง 20-300 ครั้ง/นาที", "Pulse must be between 20-300 /min"},
+		{floatIn(v.Temperature, 25, 45), "temperature", "อุณหภูมิต้องอยู่ระหว่าง 25-45 °C", "Temperature must be between 25-45 °C"},
+		{intIn(v.SpO2, 50, 100), "spo2", "SpO2 ต้องอยู่ระหว่าง 50-100 %", "SpO2 must be between 50-100 %"},
+		{intIn(v.RespiratoryRate, 4, 80), "respiratory_rate", "อัตราการหายใจต้องอยู่ระหว่าง 4-80 ครั้ง/นาที", "Respiratory rate must be between 4-80 /min"},
+		{floatIn(v.Weight, 0.3, 500), "weight", "น้ำหนักต้องอยู่ระหว่าง 0.3-500 kg", "Weight must be between 0.3-500 kg"},
+		{floatIn(v.Height, 20, 280), "height", "ส่วนสูงต้องอยู่ระหว่าง 20-280 cm", "Height must be between 20-280 cm"},
+		{intIn(v.PainScore, 0, 10), "pain_score", "คะแนนความปวดต้องอยู่ระหว่าง 0-10", "Pain score must be between 0-10"},
+	}
+	for _, check := range checks {
+		if !check.ok {
+			return apierror.Invalid(check.field, check.msg, check.msgEN)
+		}
+	}
+	if v.Systolic != nil && v.Diastolic != nil && *v.Diastolic >= *v.Systolic {
+		return apierror.Invalid("diastolic", "ความดันตัวล่างต้องน้อยกว่าความดันตัวบน", "Diastolic must be lower than systolic")
+	}
+
+	if v.Weight != nil && v.Height != nil {
+		m := *v.Height / 100
+		bmi := round(*v.Weight/(m*m), 1)
+		v.BMI = &bmi
+	}
+	return nil
+}
+
+// AbnormalFlags returns the flags for every measurement outside the adult
+// reference range.
+func AbnormalFlags(v models.VitalSign) []string {
+	flags := []string{}
+	add := func(cond bool, flag string) {
+		if cond {
+			flags = append(flags, flag)
+		}
+	}
+
+	if v.Systolic != nil || v.Diastolic != nil {
+		add(intGE(v.Systolic, 140) || intGE(v.Diastolic, 90), FlagHighBP)
+		add(intLT(v.Systolic, 90) || intLT(v.Diastolic, 60), FlagLowBP)
+	}
+	add(intGT(v.Pulse, 100), FlagTachycardia)
+	add(intLT(v.Pulse, 60), FlagBradycardia)
+	add(v.Temperature != nil && *v.Temperature >= 37.5, FlagFever)
+	add(v.Temperature != nil && *v.Temperature < 35, FlagHypothermia)
+	add(intLT(v.SpO2, 90), FlagCriticalSpO2)
+	add(intLT(v.SpO2, 95) && !intLT(v.SpO2, 90), FlagLowSpO2)
+	add(intGT(v.RespiratoryRate, 20), FlagTachypnea)
+	add(intLT(v.RespiratoryRate, 12), FlagBradypnea)
+	add(intGE(v.PainScore, 7), FlagSeverePain)
+	add(v.BMI != nil && *v.BMI < 18.5, FlagUnderweight)
+	add(v.BMI != nil && *v.BMI >= 30, FlagObese)
+	return flags
+}
+
+// TriageLabel returns the name of a triage level on the given scale, or ""
+// if the system or level is unknown.
+func TriageLabel(system string, level int) string {
+	labels := map[string][]string{
+		models.TriageESI:  {"Resuscitation", "Emergent", "Urgent", "Less Urgent", "Non-Urgent"},
+		models.TriageMOPH: {"Resuscitation (แดง)", "Emergency (ชมพู)", "Urgent (เหลือง)", "Semi-urgent (เขียว)", "Non-urgent (ขาว)"},
+	}
+	l, ok := labels[system]
+	if !ok || level < 1 || level > len(l) {
+		return ""
+	}
+	return l[level-1]
+}
+
+func round(f float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p
+}
+
+func intIn(v *int, lo, hi int) bool {
+	return v == nil || (*v >= lo && *v <= hi)
+}
+
+func floatIn(v *float64, lo, hi float64) bool {
+	return v == nil || (*v >= lo && *v <= hi)
+}
+
+func intGE(v *int, n int) bool { return v != nil && *v >= n }
+func intGT(v *int, n int) bool { return v != nil && *v > n }
+func intLT(v *int, n int) bool { return v != nil && *v < n }
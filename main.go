@@ -1,27 +1,341 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"example.com/myapp/app/allergy"
+	"example.com/myapp/app/audit"
+	"example.com/myapp/app/billing"
+	"example.com/myapp/app/config"
+	"example.com/myapp/app/coverage"
 	"example.com/myapp/app/database"
+	"example.com/myapp/app/deid"
+	"example.com/myapp/app/diagnosis"
+	"example.com/myapp/app/encounter"
+	"example.com/myapp/app/fhir"
+	"example.com/myapp/app/health"
+	"example.com/myapp/app/hl7"
+	"example.com/myapp/app/lab"
+	"example.com/myapp/app/logging"
+	"example.com/myapp/app/metrics"
 	"example.com/myapp/app/middleware"
+	"example.com/myapp/app/note"
 	"example.com/myapp/app/patient"
+	"example.com/myapp/app/pdpa"
+	"example.com/myapp/app/pharmacy"
+	"example.com/myapp/app/prescription"
+	"example.com/myapp/app/referral"
 	"example.com/myapp/app/staff"
+	"example.com/myapp/app/tracing"
+	"example.com/myapp/app/vital"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
-	database.InitDB()
-	r := gin.Default()
+	// The maintenance commands below only need the database settings.
+	load := config.Load
+	if len(os.Args) > 1 && slices.Contains([]string{"migrate", "staff"}, os.Args[1]) {
+		load = config.LoadCommand
+	}
+	cfg, err := load()
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+
+	// go run . migrate up | down [steps] | status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		connectCtx, cancel := context.WithTimeout(context.Background(), cfg.DBConnectTimeout)
+		database.Connect(connectCtx, cfg.DBSource, pool(cfg))
+		cancel()
+		if err := database.MigrateCommand(database.DB, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// go run . staff role <hospital_id> <username> <role>
+	if len(os.Args) > 1 && os.Args[1] == "staff" {
+		connectCtx, cancel := context.WithTimeout(context.Background(), cfg.DBConnectTimeout)
+		database.Connect(connectCtx, cfg.DBSource, pool(cfg))
+		cancel()
+		if err := staff.RoleCommand(database.DB, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	logging.Setup(cfg.LogLevel)
+	shutdownTracing, err := tracing.Setup(cfg.OTelTracesExporter, cfg.OTelEndpoint, cfg.OTelServiceName)
+	if err != nil {
+		log.Fatal("Failed to set up tracing: ", err)
+	}
+	slog.Info("starting", "config", cfg)
+
+	// SIGTERM (docker stop, a rolling deploy) stops the server gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	connectCtx, cancelConnect := context.WithTimeout(ctx, cfg.DBConnectTimeout)
+	database.InitDB(connectCtx, cfg.DBSource, pool(cfg))
+	cancelConnect()
+	if err := metrics.InstrumentDB(database.DB); err != nil {
+		log.Fatal("Failed to instrument database: ", err)
+	}
+	if err := tracing.InstrumentDB(database.DB); err != nil {
+		log.Fatal("Failed to instrument database: ", err)
+	}
+	diagnosis.LoadICD10File(database.DB, cfg.ICD10CSV)
+	if err := deid.Load(cfg.DeidKey, cfg.DeidPolicyFile); err != nil {
+		log.Fatal("Failed to load de-identification settings: ", err)
+	}
+	middleware.SetJWTKey([]byte(cfg.JWTSecret))
+	var workers sync.WaitGroup
+	if cfg.LabDropDir != "" {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			lab.WatchDropDir(ctx, database.DB, cfg.LabDropDir, 10*time.Second)
+		}()
+	}
+	if cfg.HL7MLLPAddr != "" {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if err := hl7.ListenMLLP(ctx, database.DB, cfg.HL7MLLPAddr, cfg.HL7HospitalID); err != nil {
+				log.Println("HL7 MLLP listener stopped:", err)
+			}
+		}()
+	}
+
+	patientHandler := patient.NewHandler(database.DB)
+	staffHandler := staff.NewHandler(database.DB, []byte(cfg.JWTSecret))
+	encounterHandler := encounter.NewHandler(database.DB)
+	vitalHandler := vital.NewHandler(database.DB)
+	diagnosisHandler := diagnosis.NewHandler(database.DB)
+	allergyHandler := allergy.NewHandler(database.DB)
+	prescriptionHandler := prescription.NewHandler(database.DB)
+	pharmacyHandler := pharmacy.NewHandler(database.DB)
+	labHandler := lab.NewHandler(database.DB)
+	noteHandler := note.NewHandler(database.DB)
+	billingHandler := billing.NewHandler(database.DB)
+	coverageHandler := coverage.NewHandler(database.DB)
+	referralHandler := referral.NewHandler(database.DB)
+	fhirHandler := fhir.NewHandler(database.DB)
+	hl7Handler := hl7.NewHandler(database.DB)
+	deidHandler := deid.NewHandler(database.DB)
+	pdpaHandler := pdpa.NewHandler(database.DB)
+	auditHandler := audit.NewHandler(database.DB)
+
+	checks := []health.Check{
+		health.Database(database.DB),
+		health.Migrations(database.DB),
+		health.Loaded("jwt_key", middleware.JWTKeyLoaded),
+	}
+	if cfg.DeidKey != "" {
+		checks = append(checks, health.Loaded("deid_key", deid.Loaded))
+	}
+	healthHandler := health.NewHandler(checks...)
+
+	r := gin.New()
+	// probes and scrapes are not traced
+	untraced := []string{"/healthz", "/readyz", "/metrics"}
+	r.Use(otelgin.Middleware(cfg.OTelServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		return !slices.Contains(untraced, req.URL.Path)
+	})))
+	r.Use(logging.RequestID(), logging.AccessLog(), metrics.HTTP(), logging.Recovery())
+
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+	r.GET("/metrics", metrics.Handler())
 
 	protected := r.Group("/")
 	protected.Use(middleware.AuthMiddleware())
 	{
-		protected.GET("/patient/search/:id", patient.GetPatientByID)
-		protected.GET("/patient/search", patient.GetPatients)
-		protected.POST("/patient/add", patient.CreatePatient)
+		protected.POST("/staff/role/:username", staffHandler.AssignRole)
+
+		protected.GET("/patient/search/:id", patientHandler.GetPatientByID)
+		protected.GET("/patient/search", patientHandler.GetPatients)
+		protected.POST("/patient/add", patientHandler.CreatePatient)
+		protected.POST("/patient/import", patientHandler.ImportPatients)
+		protected.GET("/patient/export", patientHandler.ExportPatients)
+
+		protected.POST("/encounter/add", encounterHandler.CreateEncounter)
+		protected.GET("/encounter/patient/:id", encounterHandler.GetEncounters)
+
+		protected.POST("/vital/add", vitalHandler.RecordVitals)
+		protected.GET("/vital/patient/:id", vitalHandler.GetVitals)
+		protected.GET("/vital/trend/:id", vitalHandler.GetVitalTrend)
+
+		protected.POST("/triage/add", vitalHandler.AssignTriage)
+		protected.GET("/triage/encounter/:id", vitalHandler.GetTriage)
+
+		protected.POST("/icd10/import", diagnosisHandler.ImportCodes)
+		protected.GET("/icd10/search", diagnosisHandler.SearchCodes)
+
+		protected.POST("/diagnosis/add", diagnosisHandler.AddDiagnosis)
+		protected.GET("/diagnosis/encounter/:id", diagnosisHandler.GetEncounterDiagnoses)
+		protected.GET("/diagnosis/patient/:id", diagnosisHandler.GetPatientDiagnoses)
+
+		protected.POST("/allergy/add", allergyHandler.AddAllergy)
+		protected.PUT("/allergy/:id", allergyHandler.UpdateAllergy)
+		protected.GET("/allergy/patient/:id", allergyHandler.GetAllergies)
+
+		protected.POST("/drug/add", prescriptionHandler.AddDrug)
+		protected.GET("/drug/search", prescriptionHandler.SearchDrugs)
+		protected.POST("/drug/interaction/add", prescriptionHandler.AddInteraction)
+		protected.GET("/drug/interaction", prescriptionHandler.GetInteractions)
+
+		protected.POST("/prescription/add", prescriptionHandler.CreatePrescription)
+		protected.GET("/prescription/search/:id", prescriptionHandler.GetPrescription)
+		protected.GET("/prescription/patient/:id", prescriptionHandler.GetPatientPrescriptions)
+		protected.POST("/prescription/sign/:id", prescriptionHandler.SignPrescription)
+		protected.POST("/prescription/cancel/:id", prescriptionHandler.CancelPrescription)
+		protected.POST("/prescription/dispense/:id", prescriptionHandler.DispensePrescription)
+
+		protected.POST("/pharmacy/store/add", pharmacyHandler.CreateStore)
+		protected.GET("/pharmacy/store", pharmacyHandler.GetStores)
+		protected.POST("/pharmacy/receive", pharmacyHandler.ReceiveStock)
+		protected.POST("/pharmacy/transfer", pharmacyHandler.TransferStock)
+		protected.POST("/pharmacy/adjust", pharmacyHandler.AdjustStock)
+		protected.GET("/pharmacy/stock", pharmacyHandler.GetStock)
+		protected.GET("/pharmacy/movement", pharmacyHandler.GetMovements)
+		protected.GET("/pharmacy/report/low-stock", pharmacyHandler.LowStockReport)
+		protected.GET("/pharmacy/report/near-expiry", pharmacyHandler.NearExpiryReport)
+
+		protected.POST("/lab/test/add", labHandler.AddTest)
+		protected.GET("/lab/test", labHandler.GetTests)
+		protected.POST("/lab/order/add", labHandler.CreateOrder)
+		protected.GET("/lab/order/search/:id", labHandler.GetOrder)
+		protected.GET("/lab/order/patient/:id", labHandler.GetPatientOrders)
+		protected.POST("/lab/order/cancel/:id", labHandler.CancelOrder)
+		protected.GET("/lab/specimen/search/:barcode", labHandler.GetSpecimen)
+		protected.POST("/lab/specimen/collect/:barcode", labHandler.CollectSpecimen)
+		protected.POST("/lab/specimen/receive/:barcode", labHandler.ReceiveSpecimen)
+		protected.POST("/lab/specimen/reject/:barcode", labHandler.RejectSpecimen)
+		protected.POST("/lab/result/add", labHandler.AddResult)
+		protected.GET("/lab/result/patient/:id", labHandler.GetCumulativeResults)
+
+		protected.POST("/note/add", noteHandler.CreateNote)
+		protected.PUT("/note/:id", noteHandler.UpdateNote)
+		protected.POST("/note/sign/:id", noteHandler.SignNote)
+		protected.POST("/note/addendum/:id", noteHandler.AddAddendum)
+		protected.GET("/note/search/:id", noteHandler.GetNote)
+		protected.GET("/note/encounter/:id", noteHandler.GetEncounterNotes)
+		protected.GET("/note/patient/:id", noteHandler.SearchPatientNotes)
+
+		protected.POST("/billing/item/add", billingHandler.AddChargeItem)
+		protected.GET("/billing/item", billingHandler.GetChargeItems)
+		protected.POST("/billing/price/add", billingHandler.SetPayerPrice)
+		protected.GET("/billing/price", billingHandler.GetPriceList)
+		protected.POST("/billing/charge/add", billingHandler.AddCharge)
+		protected.GET("/billing/charge/encounter/:id", billingHandler.GetEncounterCharges)
+		protected.POST("/billing/invoice/add", billingHandler.CreateInvoice)
+		protected.GET("/billing/invoice/search/:id", billingHandler.GetInvoice)
+		protected.GET("/billing/invoice/patient/:id", billingHandler.GetPatientInvoices)
+		protected.POST("/billing/invoice/payment/:id", billingHandler.AddPayment)
+		protected.POST("/billing/invoice/void/:id", billingHandler.VoidInvoice)
+		protected.GET("/billing/balance/:id", billingHandler.GetPatientBalance)
+
+		protected.POST("/coverage/add", coverageHandler.AddCoverage)
+		protected.PUT("/coverage/:id", coverageHandler.UpdateCoverage)
+		protected.GET("/coverage/patient/:id", coverageHandler.GetCoverages)
+		protected.POST("/coverage/check/:id", coverageHandler.CheckEligibility)
+
+		protected.POST("/referral/add", referralHandler.CreateReferral)
+		protected.GET("/referral/outgoing", referralHandler.GetOutgoingReferrals)
+		protected.GET("/referral/incoming", referralHandler.GetIncomingReferrals)
+		protected.POST("/referral/accept/:id", referralHandler.AcceptReferral)
+		protected.POST("/referral/reject/:id", referralHandler.RejectReferral)
+		protected.POST("/referral/cancel/:id", referralHandler.CancelReferral)
+		protected.GET("/referral/record/:id", referralHandler.GetReferralRecord)
+
+		protected.GET("/audit", auditHandler.GetLogs)
+
+		protected.GET("/research/extract", deidHandler.GetResearchExtract)
+
+		protected.POST("/consent/add", pdpaHandler.RecordConsent)
+		protected.POST("/consent/withdraw/:id", pdpaHandler.WithdrawConsent)
+		protected.GET("/consent/patient/:id", pdpaHandler.GetConsents)
+
+		protected.POST("/dsr/add", pdpaHandler.CreateRequest)
+		protected.GET("/dsr", pdpaHandler.GetRequests)
+		protected.GET("/dsr/export/:id", pdpaHandler.ExportRequest)
+		protected.POST("/dsr/erase/:id", pdpaHandler.EraseRequest)
+		protected.POST("/dsr/reject/:id", pdpaHandler.RejectRequest)
+
+		protected.GET("/fhir/Patient/:id", fhirHandler.GetPatient)
+		protected.GET("/fhir/Patient", fhirHandler.SearchPatients)
+		protected.POST("/fhir/Patient", fhirHandler.CreatePatient)
+		protected.GET("/fhir/Organization/:id", fhirHandler.GetOrganization)
+		protected.GET("/fhir/Organization", fhirHandler.SearchOrganizations)
+		protected.POST("/fhir/Organization", fhirHandler.CreateOrganization)
+		protected.GET("/fhir/Practitioner/:id", fhirHandler.GetPractitioner)
+		protected.GET("/fhir/Practitioner", fhirHandler.SearchPractitioners)
+		protected.POST("/fhir/Practitioner", fhirHandler.CreatePractitioner)
+
+		protected.GET("/hl7/message", hl7Handler.GetMessages)
+		protected.POST("/hl7/message/reprocess/:id", hl7Handler.ReprocessMessage)
+	}
+
+	r.POST("/staff/create", staffHandler.StaffCreate)
+	r.POST("/staff/login", staffHandler.StaffLogin)
+
+	srv := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      r,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 	}
+	go func() {
+		log.Println("Listening on", srv.Addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
 
-	r.POST("/staff/create", staff.StaffCreate)
-	r.POST("/staff/login", staff.StaffLogin)
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("HTTP shutdown:", err)
+	}
+	drained := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		log.Println("Background workers did not stop in time")
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Println("Flushing traces:", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Println("Closing database:", err)
+	}
+}
 
-	r.Run(":8080")
+func pool(cfg *config.Config) database.Pool {
+	return database.Pool{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+	}
 }
\ No newline at end of file